@@ -0,0 +1,352 @@
+// agent.go
+//
+// `agent --url https://config.example/payload.zip`: pull-based config
+// management. The agent polls the URL every --interval for a zip of payload
+// files (settings.json, extensions.txt, manifest.json, settings.d/, ...;
+// the layout `pack --data` takes). Requests carry the last ETag as
+// If-None-Match, so an unchanged payload costs a 304. A new payload is
+// unpacked into the state folder and applied with `apply --silent --src`
+// when its version (manifest "version", else the content hash) differs
+// from the last one applied, or when the last apply failed.
+//
+// With --report-url every apply is reported back as a JSON POST (with the
+// bearer token of --report-token-file / $HYPREDITORS_REPORT_TOKEN):
+//
+//   {"host": ..., "url": ..., "version": ..., "exitCode": 0,
+//    "report": {the --report document of the run}}
+//
+// The agent's own state (ETag, versions, last result) is kept in
+// <state>/agent.json. --once checks a single time and exits, for cron and
+// the schedulers of install-service.
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	agentStateFile  = "agent.json"
+	agentPayloadDir = "agent-payload"
+	agentMaxPayload = 64 << 20
+	agentMaxUnpack  = 256 << 20 // decompressed payload files
+)
+
+// agentState is what the agent remembers between checks
+type agentState struct {
+	URL            string    `json:"url"`
+	ETag           string    `json:"etag,omitempty"`
+	FetchedVersion string    `json:"fetchedVersion,omitempty"` // version of the unpacked payload
+	AppliedVersion string    `json:"appliedVersion,omitempty"` // version of the last successful apply
+	LastCheck      time.Time `json:"lastCheck"`
+	LastApply      time.Time `json:"lastApply"`
+	LastExit       int       `json:"lastExit"`
+	LastError      string    `json:"lastError,omitempty"`
+}
+
+// agentReport is the status POSTed to --report-url
+type agentReport struct {
+	Host     string          `json:"host"`
+	URL      string          `json:"url"`
+	Version  string          `json:"version"`
+	ExitCode int             `json:"exitCode"`
+	Error    string          `json:"error,omitempty"`
+	Report   json.RawMessage `json:"report,omitempty"`
+}
+
+func runAgent(args []string) error {
+	fs, opts := newCommandFlags("agent")
+	url := fs.String("url", "", "HTTPS URL of the payload zip")
+	interval := fs.Duration("interval", 15*time.Minute, "How often the payload is checked")
+	once := fs.Bool("once", false, "Check and apply once, then exit")
+	fs.Parse(args)
+	if *url == "" {
+		return errors.New("usage: agent --url <https://.../payload.zip> [--interval 15m] [--report-url <url>] [--once]")
+	}
+	if !agentURLAllowed(*url) {
+		return fmt.Errorf("--url must be https:// (got %s)", *url)
+	}
+	if *interval < time.Minute {
+		return errors.New("--interval must be at least 1m")
+	}
+	if opts.SrcOverride != "" {
+		return errors.New("agent cannot be combined with --src (the payload comes from --url)")
+	}
+
+	inst, err := NewInstaller(*opts)
+	if err != nil {
+		return fmt.Errorf("cannot initialize installer: %w", err)
+	}
+	defer inst.Close()
+
+	if *once {
+		return inst.agentCheck(opts, *url, opts.ReportURL)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	inst.logf("Agent polling %s every %s (Ctrl+C to stop)", *url, *interval)
+	tick := time.NewTicker(*interval)
+	defer tick.Stop()
+	for {
+		if err := inst.agentCheck(opts, *url, opts.ReportURL); err != nil {
+			inst.errorf("agent: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			inst.logf("Agent stopped")
+			return nil
+		case <-tick.C:
+		}
+	}
+}
+
+// agentURLAllowed accepts https URLs, and plain http to this machine only
+func agentURLAllowed(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if u.Scheme == "https" {
+		return true
+	}
+	host := u.Hostname()
+	ip := net.ParseIP(host)
+	return u.Scheme == "http" && (host == "localhost" || (ip != nil && ip.IsLoopback()))
+}
+
+func (i *Installer) agentStatePath() string {
+	return filepath.Join(stateDir(i.homeDir), agentStateFile)
+}
+
+func (i *Installer) loadAgentState(url string) agentState {
+	st := agentState{URL: url}
+	if b, err := os.ReadFile(i.agentStatePath()); err == nil {
+		json.Unmarshal(b, &st)
+	}
+	if st.URL != url {
+		// another endpoint: nothing of the old state applies
+		st = agentState{URL: url}
+	}
+	return st
+}
+
+func (i *Installer) saveAgentState(st agentState) {
+	b, err := json.MarshalIndent(st, "", "  ")
+	if err == nil {
+		err = writeBytes(i.agentStatePath(), append(b, '\n'))
+	}
+	if err != nil {
+		i.warnf("cannot save agent state: %v", err)
+	}
+}
+
+// agentCheck fetches the payload and applies it when its version changed
+func (i *Installer) agentCheck(opts *Options, url, reportURL string) error {
+	st := i.loadAgentState(url)
+	st.LastCheck = time.Now().UTC()
+	defer func() { i.saveAgentState(st) }()
+
+	dir := filepath.Join(stateDir(i.homeDir), agentPayloadDir)
+	data, etag, err := i.fetchPayload(url, st.ETag)
+	switch {
+	case err != nil:
+		st.LastError = err.Error()
+		return err
+	case data != nil:
+		version, err := unpackAgentPayload(data, dir)
+		if err != nil {
+			st.LastError = err.Error()
+			return err
+		}
+		st.ETag, st.FetchedVersion = etag, version
+		i.logToFile("agent: fetched payload %s (etag %s)", version, orDash(etag))
+	default:
+		i.logToFile("agent: payload unchanged (304)")
+	}
+	if st.FetchedVersion == "" || (st.FetchedVersion == st.AppliedVersion && st.LastExit == exitOK) {
+		st.LastError = ""
+		return nil
+	}
+	if i.dryRun {
+		i.logf("DRY-RUN: would apply payload %s from %s", st.FetchedVersion, url)
+		return nil
+	}
+
+	i.logf("Agent: applying payload %s", st.FetchedVersion)
+	code, report, runErr := i.agentApply(opts, dir)
+	st.LastApply, st.LastExit = time.Now().UTC(), code
+	st.LastError = ""
+	if runErr != nil {
+		st.LastError = runErr.Error()
+	}
+	if code == exitOK && runErr == nil {
+		st.AppliedVersion = st.FetchedVersion
+		i.logf("Agent: payload %s applied", st.FetchedVersion)
+	} else {
+		i.errorf("Agent: apply of payload %s failed (exit %d)", st.FetchedVersion, code)
+	}
+	if reportURL != "" {
+		host, _ := os.Hostname()
+		rep := agentReport{Host: host, URL: url, Version: st.FetchedVersion, ExitCode: code, Error: st.LastError, Report: report}
+		token, err := reportToken(opts.ReportTokenFile)
+		if err == nil {
+			err = i.postJSON(reportURL, token, rep)
+		}
+		if err != nil {
+			i.warnf("agent: cannot report to %s: %v", reportURL, err)
+		}
+	}
+	return runErr
+}
+
+// fetchPayload GETs url with If-None-Match; data is nil when unchanged
+func (i *Installer) fetchPayload(url, etag string) (data []byte, newETag string, err error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	resp, err := i.doHTTP(registryClient, req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return nil, etag, nil
+	case http.StatusOK:
+	default:
+		return nil, "", fmt.Errorf("fetch %s: HTTP %s", url, resp.Status)
+	}
+	data, err = io.ReadAll(io.LimitReader(resp.Body, agentMaxPayload+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("fetch %s: %w", url, err)
+	}
+	if len(data) > agentMaxPayload {
+		return nil, "", fmt.Errorf("fetch %s: payload larger than %s", url, humanBytes(agentMaxPayload))
+	}
+	return data, resp.Header.Get("ETag"), nil
+}
+
+// unpackAgentPayload replaces dir with the payload files of the zip and
+// returns the payload version
+func unpackAgentPayload(data []byte, dir string) (string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("payload is not a zip: %w", err)
+	}
+	// only the payload files are read, and at most agentMaxUnpack of them:
+	// archive/zip fails a member that inflates past its declared size. An
+	// entry that would leave the payload folder rejects the whole zip
+	targets := packTargets()
+	var members []*zip.File
+	var size uint64
+	for _, f := range zr.File {
+		p, ok := localZipPath(f.Name)
+		if !ok {
+			return "", fmt.Errorf("payload entry %q leaves the payload folder", f.Name)
+		}
+		name := strings.TrimPrefix(filepath.ToSlash(p), "./")
+		if _, ok := targets[name]; !ok && !isPayloadDirPath(name) && !isBackendPath(name) {
+			continue
+		}
+		if size += f.UncompressedSize64; size > agentMaxUnpack {
+			return "", fmt.Errorf("payload unpacks to more than %s", humanBytes(agentMaxUnpack))
+		}
+		members = append(members, f)
+	}
+	files, err := readZipFiles(members)
+	if err != nil {
+		return "", err
+	}
+	tmp := dir + ".tmp"
+	if err := os.RemoveAll(tmp); err != nil {
+		return "", err
+	}
+	n := 0
+	for name, b := range files {
+		p, _ := localZipPath(name)
+		if err := writeBytes(filepath.Join(tmp, p), b); err != nil {
+			return "", err
+		}
+		n++
+	}
+	if n == 0 {
+		os.RemoveAll(tmp)
+		return "", errors.New("the zip holds no payload files")
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, dir); err != nil {
+		return "", err
+	}
+	version := ""
+	if v, err := parseJSONC(files[manifestFile]); err == nil {
+		if obj, ok := v.(map[string]interface{}); ok {
+			version, _ = obj["version"].(string)
+		}
+	}
+	if version != "" {
+		return payloadLabel(version, ""), nil
+	}
+	sum := sha256.Sum256(data)
+	return payloadLabel("", hex.EncodeToString(sum[:])), nil
+}
+
+// agentApply runs `apply --silent --src dir` as a child process and returns
+// its exit code and report
+func (i *Installer) agentApply(opts *Options, dir string) (int, json.RawMessage, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return exitFailure, nil, fmt.Errorf("cannot determine exe path: %w", err)
+	}
+	reportPath := filepath.Join(stateDir(i.homeDir), "agent-report.json")
+	os.Remove(reportPath)
+	o := *opts
+	o.SrcOverride = dir
+	o.ReportURL = "" // the agent reports the run itself
+	args := append(serviceArgs(&o), "--report", reportPath)
+	cmd := exec.Command(exe, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	code := exitOK
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		code = exitErr.ExitCode()
+		err = nil
+		// silent runs print their errors as "ERROR: ..." lines
+		if msg := strings.TrimSpace(strings.ReplaceAll(stderr.String(), "ERROR: ", "")); msg != "" {
+			err = errors.New(msg)
+		}
+	case err != nil:
+		return exitFailure, nil, err
+	}
+	report, _ := os.ReadFile(reportPath)
+	if !json.Valid(report) {
+		report = nil
+	}
+	return code, report, err
+}
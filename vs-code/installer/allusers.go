@@ -0,0 +1,274 @@
+// allusers.go
+//
+// Lab image preparation on Windows (--all-users, run elevated). Instead of
+// the current user's config the payload goes into
+//
+//   - the Default profile (C:\Users\Default), which Windows copies into
+//     every account created afterwards, and
+//   - every existing local or domain account profile of the ProfileList
+//     registry key (system and service profiles are skipped)
+//
+// For each profile settings.json and keybindings.json are written to
+// AppData\Roaming\Code\User (the previous files are kept as
+// <file>.backup_<ts> unless --no-backup; keybindings as in the payload,
+// --keybindings-mode append is not applied per profile) and the missing
+// extensions are installed into the profile's .vscode\extensions with
+// `code --extensions-dir`. The files are created by the administrator, so
+// their ACLs are fixed with icacls afterwards: in an existing profile the
+// account becomes the owner and gets full control; in the Default profile
+// the folders are reset to inherited permissions, which Windows hands over
+// to the new account on its first logon.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	profileListKey         = `HKLM\SOFTWARE\Microsoft\Windows NT\CurrentVersion\ProfileList`
+	profileCmdTimeout      = 60 * time.Second
+	allUsersInstallTimeout = 15 * time.Minute
+)
+
+// winEnvRef matches %NAME% in registry REG_EXPAND_SZ values
+var winEnvRef = regexp.MustCompile(`%([^%]+)%`)
+
+// winProfile is a Windows user profile folder; SID is "" for Default
+type winProfile struct {
+	SID string
+	Dir string
+}
+
+func (p winProfile) name() string {
+	return filepath.Base(p.Dir)
+}
+
+// userDir is the profile's VS Code user config folder
+func (p winProfile) userDir() string {
+	return filepath.Join(p.Dir, "AppData", "Roaming", "Code", "User")
+}
+
+// extensionsDir is the profile's VS Code extensions folder
+func (p winProfile) extensionsDir() string {
+	return filepath.Join(p.Dir, ".vscode", "extensions")
+}
+
+// parseProfileList reads the account profiles from the output of
+// `reg query <ProfileList> /s /v ProfileImagePath`
+func parseProfileList(out string) []winProfile {
+	var res []winProfile
+	sid := ""
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(strings.ToUpper(line), "HKEY_") {
+			sid = line[strings.LastIndex(line, `\`)+1:]
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 3 || !strings.EqualFold(fields[0], "ProfileImagePath") || !strings.HasPrefix(fields[1], "REG_") {
+			continue
+		}
+		// S-1-5-21-* are local and domain accounts; 18/19/20 are system services
+		if !strings.HasPrefix(sid, "S-1-5-21-") {
+			continue
+		}
+		dir := winEnvRef.ReplaceAllStringFunc(strings.Join(fields[2:], " "), func(ref string) string {
+			return os.Getenv(strings.Trim(ref, "%"))
+		})
+		res = append(res, winProfile{SID: sid, Dir: filepath.Clean(dir)})
+	}
+	return res
+}
+
+// windowsElevated reports whether the process runs with administrator
+// rights (`net session` is refused otherwise)
+func windowsElevated() bool {
+	return exec.Command("net", "session").Run() == nil
+}
+
+// allUserProfiles lists the Default profile and the existing account
+// profiles whose folder exists
+func allUserProfiles() ([]winProfile, error) {
+	out, err := runCommandWithTimeout(profileCmdTimeout, "reg", "query", profileListKey, "/s", "/v", "ProfileImagePath")
+	if err != nil {
+		return nil, fmt.Errorf("cannot list user profiles: %v: %s", err, strings.TrimSpace(out))
+	}
+	root := filepath.Join(os.Getenv("SystemDrive")+`\`, "Users")
+	if pub := os.Getenv("PUBLIC"); pub != "" {
+		root = filepath.Dir(pub)
+	}
+	res := []winProfile{{Dir: filepath.Join(root, "Default")}}
+	for _, p := range parseProfileList(out) {
+		if fi, err := os.Stat(p.Dir); err == nil && fi.IsDir() {
+			res = append(res, p)
+		}
+	}
+	return res, nil
+}
+
+// applyAllUsers provisions the Default profile and every existing profile
+func (i *Installer) applyAllUsers() error {
+	if runtime.GOOS != "windows" {
+		return errors.New("--all-users is only supported on Windows")
+	}
+	if !i.dryRun && !windowsElevated() {
+		return errors.New("--all-users must run elevated (as administrator)")
+	}
+	profiles, err := allUserProfiles()
+	if err != nil {
+		return err
+	}
+	if err := i.ensureCodeCLI(); err != nil && len(i.extList) > 0 {
+		i.warnf("code CLI not found — extensions are skipped: %v", err)
+	}
+	failed := 0
+	for _, p := range profiles {
+		i.logf("Profile %s: provisioning %s", p.name(), p.Dir)
+		if err := i.provisionProfile(p); err != nil {
+			i.errorf("Profile %s: %v", p.name(), err)
+			failed++
+		}
+	}
+	i.printSummary()
+	if failed > 0 {
+		return fmt.Errorf("%d of %d profiles failed", failed, len(profiles))
+	}
+	return nil
+}
+
+// provisionProfile writes the payload files and extensions of one profile
+// and hands them over to its account
+func (i *Installer) provisionProfile(p winProfile) error {
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{settingsFile, i.settingsData},
+		{keybindingsFile, i.keybindData},
+	}
+	ts := time.Now().Format("2006-01-02_15-04-05")
+	for _, f := range files {
+		if len(f.data) == 0 {
+			continue
+		}
+		dst := filepath.Join(p.userDir(), f.name)
+		item := p.name() + ":" + f.name
+		if sameContent(dst, f.data) {
+			i.report.UpToDate = append(i.report.UpToDate, item)
+			continue
+		}
+		if i.dryRun {
+			i.simulateWrite(item, dst, f.data)
+			continue
+		}
+		if !i.skipBackup && exists(dst) {
+			if err := copyFile(dst, dst+"."+backupPrefix+ts); err != nil {
+				i.fail(exitConfig)
+				return fmt.Errorf("cannot back up %s: %w", dst, err)
+			}
+		}
+		if err := i.safeWrite(dst, f.data); err != nil {
+			i.fail(exitConfig)
+			return fmt.Errorf("cannot write %s: %w", dst, err)
+		}
+		i.report.Written = append(i.report.Written, item)
+	}
+
+	extErr := i.installProfileExtensions(p)
+	if i.dryRun {
+		return extErr
+	}
+	if err := fixProfileACLs(p); err != nil {
+		i.fail(exitConfig)
+		return fmt.Errorf("cannot set permissions: %w", err)
+	}
+	return extErr
+}
+
+// installProfileExtensions installs the missing extensions into the
+// profile's extensions folder in one CLI call
+func (i *Installer) installProfileExtensions(p winProfile) error {
+	if len(i.extList) == 0 || i.codeCLIPath == "" {
+		return nil
+	}
+	dir := p.extensionsDir()
+	out, err := runCommandWithTimeout(profileCmdTimeout, i.codeCLIPath, "--extensions-dir", dir, "--list-extensions", "--show-versions")
+	if err != nil {
+		return fmt.Errorf("cannot list extensions in %s: %v", dir, err)
+	}
+	var installed []installedExtension
+	for _, l := range strings.Split(out, "\n") {
+		if t := strings.TrimSpace(l); t != "" {
+			id, ver, _ := strings.Cut(t, "@")
+			installed = append(installed, installedExtension{ID: id, Version: ver})
+		}
+	}
+	args := []string{"--extensions-dir", dir}
+	var pending []extensionSpec
+	for _, ext := range i.extList {
+		if have := installedVersion(installed, ext.ID); have != "" && (ext.Version == "" || have == ext.Version) {
+			i.report.Skipped = append(i.report.Skipped, p.name()+":"+ext.ID)
+			continue
+		}
+		pending = append(pending, ext)
+		args = append(args, "--install-extension", ext.String())
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	if i.dryRun {
+		i.logf("DRY-RUN: would install %d extensions into %s", len(pending), dir)
+		for _, ext := range pending {
+			i.report.Installed = append(i.report.Installed, p.name()+":"+ext.ID)
+		}
+		return nil
+	}
+	i.logf("Profile %s: installing %d extensions", p.name(), len(pending))
+	out, err = runCommandWithTimeout(allUsersInstallTimeout, i.codeCLIPath, append(args, "--force")...)
+	i.logToFile("Profile %s install output:\n%s", p.name(), out)
+	if err != nil {
+		for _, ext := range pending {
+			i.report.Failed = append(i.report.Failed, p.name()+":"+ext.ID)
+		}
+		i.fail(exitExtensions)
+		return fmt.Errorf("extension install failed: %w", err)
+	}
+	for _, ext := range pending {
+		i.report.Installed = append(i.report.Installed, p.name()+":"+ext.ID)
+	}
+	return nil
+}
+
+// fixProfileACLs hands the folders written by the administrator over to
+// the profile's account (Default: inherited permissions)
+func fixProfileACLs(p winProfile) error {
+	for _, dir := range []string{filepath.Dir(p.userDir()), filepath.Dir(p.extensionsDir())} {
+		if !exists(dir) {
+			continue
+		}
+		var calls [][]string
+		if p.SID == "" {
+			calls = [][]string{{dir, "/reset", "/T", "/C", "/Q"}}
+		} else {
+			calls = [][]string{
+				{dir, "/setowner", "*" + p.SID, "/T", "/C", "/Q"},
+				{dir, "/grant", "*" + p.SID + ":(OI)(CI)F", "/T", "/C", "/Q"},
+			}
+		}
+		for _, args := range calls {
+			if out, err := runCommandWithTimeout(profileCmdTimeout, "icacls", args...); err != nil {
+				return fmt.Errorf("icacls %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(out))
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+// ansible.go
+//
+// Ansible module mode (--ansible). The run behaves like --silent, but
+// stdout carries exactly one JSON object in the shape Ansible expects from
+// a module, so the binary can be wrapped as a module or called from the
+// command/script action with the result registered:
+//
+//   {"changed": true, "failed": false, "rc": 0, "msg": "...",
+//    "installed": [...], "uninstalled": [...], "written": [...],
+//    "failed_extensions": [...], "diff": [{"before_header": ..., ...}]}
+//
+// "diff" holds the before/after content of every file the run rewrote (for
+// `--diff`), with secret values masked as in the plan. Anything else the run would print goes to stderr. Ansible's
+// check mode maps to --dry-run.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ansibleDiff is one entry of the module's diff list
+type ansibleDiff struct {
+	BeforeHeader string `json:"before_header"`
+	AfterHeader  string `json:"after_header"`
+	Before       string `json:"before"`
+	After        string `json:"after"`
+}
+
+// ansibleResult is the module result object
+type ansibleResult struct {
+	Changed          bool          `json:"changed"`
+	Failed           bool          `json:"failed"`
+	RC               int           `json:"rc"`
+	Msg              string        `json:"msg"`
+	Installed        []string      `json:"installed"`
+	Uninstalled      []string      `json:"uninstalled"`
+	Written          []string      `json:"written"`
+	FailedExtensions []string      `json:"failed_extensions"`
+	Diff             []ansibleDiff `json:"diff,omitempty"`
+}
+
+// startAnsible moves everything printed during the run to stderr and
+// returns the real stdout for the result object
+func startAnsible() *os.File {
+	out := os.Stdout
+	os.Stdout = os.Stderr
+	return out
+}
+
+// ansibleResult builds the module result of the finished run
+func (i *Installer) ansibleResult() ansibleResult {
+	r := i.report
+	res := ansibleResult{
+		Changed:          len(r.Installed)+len(r.Uninstalled)+len(r.Written) > 0,
+		RC:               i.exitCode(),
+		Installed:        nonNil(r.Installed),
+		Uninstalled:      nonNil(r.Uninstalled),
+		Written:          nonNil(r.Written),
+		FailedExtensions: nonNil(r.Failed),
+	}
+	res.Failed = res.RC != exitOK
+	switch {
+	case res.Failed:
+		res.Msg = fmt.Sprintf("apply failed (exit code %d), see %s", res.RC, i.logPath)
+	case res.Changed:
+		res.Msg = fmt.Sprintf("%d extensions installed, %d removed, %d files written",
+			len(r.Installed), len(r.Uninstalled), len(r.Written))
+	default:
+		res.Msg = "already up to date"
+	}
+	for _, c := range i.safety {
+		after, err := os.ReadFile(c.Path)
+		if err != nil && c.Existed {
+			continue
+		}
+		if string(after) == string(c.Data) {
+			continue
+		}
+		before := c.Path
+		if !c.Existed {
+			before = "/dev/null"
+		}
+		res.Diff = append(res.Diff, ansibleDiff{BeforeHeader: before, AfterHeader: c.Path,
+			Before: i.redactSecrets(string(c.Data)), After: i.redactSecrets(string(after))})
+	}
+	return res
+}
+
+// writeAnsible prints res as the single JSON line of the run
+func writeAnsible(w io.Writer, res ansibleResult) {
+	b, err := json.Marshal(res)
+	if err != nil {
+		b = []byte(`{"failed": true, "msg": "cannot encode the result"}`)
+	}
+	fmt.Fprintln(w, string(b))
+}
+
+// nonNil keeps empty lists as [] in the JSON
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
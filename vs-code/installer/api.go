@@ -0,0 +1,320 @@
+// api.go
+//
+// `serve --listen 127.0.0.1:7777`: a local REST API for desktop frontends
+// (the Hypr control panel) to drive the installer without re-implementing
+// it. Every action runs this binary as a child process with the payload
+// switches the server was started with; one job runs at a time.
+//
+//   POST /api/apply   {"dryRun": false, "force": false}  -> 202 {"id", "events"}
+//   POST /api/verify                                     -> 202 {"id", "events"}
+//   POST /api/status                                     -> 202 {"id", "events"}
+//   GET  /api/jobs/<id>          the job: state, output lines, exit code, report
+//   GET  /api/jobs/<id>/events   Server-Sent Events: "line" per output line
+//                                (replayed from the start), then "done" with
+//                                {"exitCode", "report"}
+//
+// The server only listens on loopback addresses. Requests must carry the
+// token printed at start and stored in <state>/serve.token (0600), as
+// "Authorization: Bearer <token>" or ?token=<token> (EventSource cannot set
+// headers), so web pages open in a browser cannot trigger an apply.
+
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const apiTokenFile = "serve.token"
+
+// apiJob is one child run
+type apiJob struct {
+	ID       string          `json:"id"`
+	Command  string          `json:"command"`
+	State    string          `json:"state"` // running, done
+	Started  time.Time       `json:"started"`
+	Finished time.Time       `json:"finished"`
+	ExitCode int             `json:"exitCode"`
+	Lines    []string        `json:"lines"`
+	Report   json.RawMessage `json:"report,omitempty"`
+
+	mu     sync.Mutex
+	notify chan struct{} // closed and replaced on every new line / the end
+}
+
+// apiServer is the handler of serve
+type apiServer struct {
+	inst  *Installer
+	opts  *Options
+	token string
+
+	mu   sync.Mutex
+	jobs map[string]*apiJob
+	busy bool
+}
+
+func runServe(args []string) error {
+	fs, opts := newCommandFlags("serve")
+	listen := fs.String("listen", "127.0.0.1:7777", "Loopback address to listen on")
+	fs.Parse(args)
+	host, _, err := net.SplitHostPort(*listen)
+	if err != nil {
+		return fmt.Errorf("--listen: %w", err)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("--listen %s: only loopback addresses are allowed", *listen)
+	}
+
+	inst, err := NewInstaller(*opts)
+	if err != nil {
+		return fmt.Errorf("cannot initialize installer: %w", err)
+	}
+	defer inst.Close()
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return err
+	}
+	s := &apiServer{inst: inst, opts: opts, token: hex.EncodeToString(buf), jobs: make(map[string]*apiJob)}
+	tokenPath := filepath.Join(stateDir(inst.homeDir), apiTokenFile)
+	if err := os.MkdirAll(filepath.Dir(tokenPath), 0o700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(tokenPath, []byte(s.token+"\n"), 0o600); err != nil {
+		return err
+	}
+	defer os.Remove(tokenPath)
+
+	inst.logf("API listening on http://%s (token in %s)", *listen, tokenPath)
+	fmt.Printf("Token: %s\n", s.token)
+	srv := &http.Server{Addr: *listen, Handler: s, ReadHeaderTimeout: 10 * time.Second}
+	return srv.ListenAndServe()
+}
+
+func (s *apiServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		http.Error(w, "missing or wrong token", http.StatusUnauthorized)
+		return
+	}
+	p := strings.TrimSuffix(r.URL.Path, "/")
+	switch {
+	case r.Method == http.MethodPost && (p == "/api/apply" || p == "/api/verify" || p == "/api/status"):
+		s.startJob(w, r, strings.TrimPrefix(p, "/api/"))
+	case r.Method == http.MethodGet && strings.HasPrefix(p, "/api/jobs/"):
+		id, events := strings.CutSuffix(strings.TrimPrefix(p, "/api/jobs/"), "/events")
+		s.mu.Lock()
+		job := s.jobs[id]
+		s.mu.Unlock()
+		if job == nil {
+			http.NotFound(w, r)
+			return
+		}
+		if events {
+			job.stream(w, r)
+			return
+		}
+		job.mu.Lock()
+		defer job.mu.Unlock()
+		writeAPIJSON(w, http.StatusOK, job)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *apiServer) authorized(r *http.Request) bool {
+	got := r.URL.Query().Get("token")
+	if h, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		got = h
+	}
+	return subtle.ConstantTimeCompare([]byte(got), []byte(s.token)) == 1
+}
+
+// startJob launches command as a child process and answers with its id
+func (s *apiServer) startJob(w http.ResponseWriter, r *http.Request, command string) {
+	var req struct {
+		DryRun bool `json:"dryRun"`
+		Force  bool `json:"force"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "bad JSON body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	s.mu.Lock()
+	if s.busy {
+		s.mu.Unlock()
+		http.Error(w, "another job is running", http.StatusConflict)
+		return
+	}
+	s.busy = true
+	buf := make([]byte, 6)
+	rand.Read(buf)
+	job := &apiJob{ID: hex.EncodeToString(buf), Command: command, State: "running", Started: time.Now().UTC(),
+		Lines: []string{}, notify: make(chan struct{})}
+	s.jobs[job.ID] = job
+	s.mu.Unlock()
+
+	args := append([]string{command}, payloadArgs(s.opts)...)
+	if command == "apply" {
+		args = append(args, "--yes")
+		if req.DryRun {
+			args = append(args, "--dry-run")
+		}
+		if req.Force {
+			args = append(args, "--force")
+		}
+	}
+	s.inst.logToFile("api: job %s: %s", job.ID, strings.Join(args, " "))
+	go func() {
+		s.runJob(job, args)
+		s.mu.Lock()
+		s.busy = false
+		s.mu.Unlock()
+	}()
+	writeAPIJSON(w, http.StatusAccepted, map[string]string{"id": job.ID, "events": "/api/jobs/" + job.ID + "/events"})
+}
+
+// ansiEscape matches terminal styling in the child's output
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]`)
+
+// runJob runs the child and collects its output
+func (s *apiServer) runJob(job *apiJob, args []string) {
+	code := exitOK
+	var report []byte
+	defer func() {
+		job.mu.Lock()
+		job.State, job.Finished, job.ExitCode = "done", time.Now().UTC(), code
+		if json.Valid(report) {
+			job.Report = report
+		}
+		close(job.notify)
+		job.mu.Unlock()
+		s.inst.logToFile("api: job %s done, exit %d", job.ID, code)
+	}()
+	exe, err := os.Executable()
+	if err != nil {
+		job.add("cannot determine exe path: " + err.Error())
+		code = exitFailure
+		return
+	}
+	var reportPath string
+	if job.Command == "apply" {
+		reportPath = filepath.Join(os.TempDir(), "hypreditors-api-"+job.ID+".json")
+		args = append(args, "--report", reportPath)
+		defer os.Remove(reportPath)
+	}
+	cmd := exec.Command(exe, args...)
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		job.add(err.Error())
+		code = exitFailure
+		return
+	}
+	cmd.Stderr = cmd.Stdout
+	if err := cmd.Start(); err != nil {
+		job.add(err.Error())
+		code = exitFailure
+		return
+	}
+	sc := bufio.NewScanner(out)
+	sc.Split(scanLinesCR)
+	for sc.Scan() {
+		if line := strings.TrimSpace(ansiEscape.ReplaceAllString(sc.Text(), "")); line != "" {
+			job.add(line)
+		}
+	}
+	var exitErr *exec.ExitError
+	if err := cmd.Wait(); errors.As(err, &exitErr) {
+		code = exitErr.ExitCode()
+	} else if err != nil {
+		job.add(err.Error())
+		code = exitFailure
+	}
+	if reportPath != "" {
+		// interactive apply runs exit 0; the report knows how it went
+		report, _ = os.ReadFile(reportPath)
+		var rep reportFile
+		if code == exitOK && json.Unmarshal(report, &rep) == nil {
+			code = rep.ExitCode
+		}
+	}
+}
+
+// scanLinesCR splits on \n and \r, so progress bar redraws become lines
+func scanLinesCR(data []byte, atEOF bool) (int, []byte, error) {
+	for n, b := range data {
+		if b == '\n' || b == '\r' {
+			return n + 1, data[:n], nil
+		}
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// add appends an output line and wakes the streams
+func (j *apiJob) add(line string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.Lines = append(j.Lines, line)
+	close(j.notify)
+	j.notify = make(chan struct{})
+}
+
+// stream sends the job's lines as Server-Sent Events until it is done
+func (j *apiJob) stream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	sent := 0
+	for {
+		j.mu.Lock()
+		lines, state, notify := j.Lines[sent:], j.State, j.notify
+		done, _ := json.Marshal(struct {
+			ExitCode int             `json:"exitCode"`
+			Report   json.RawMessage `json:"report,omitempty"`
+		}{j.ExitCode, j.Report})
+		j.mu.Unlock()
+		for _, l := range lines {
+			fmt.Fprintf(w, "event: line\ndata: %s\n\n", l)
+		}
+		sent += len(lines)
+		if state == "done" {
+			fmt.Fprintf(w, "event: done\ndata: %s\n\n", done)
+			flusher.Flush()
+			return
+		}
+		flusher.Flush()
+		select {
+		case <-notify:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func writeAPIJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,254 @@
+// archive.go
+//
+// Archive backups (--backup-archive): the whole backup is a single
+// backup_<ts>.tar.gz (backup_<ts>.zip on Windows). Next to the files the
+// archive holds backup-manifest.json with every entry's original path, so a
+// backup stays meaningful after it was moved to another machine.
+
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const backupManifestName = "backup-manifest.json"
+
+// backupManifest is stored inside archive backups
+type backupManifest struct {
+	Created string                `json:"created"`
+	Files   []backupManifestEntry `json:"files"`
+}
+
+type backupManifestEntry struct {
+	Name     string `json:"name"`
+	Original string `json:"original,omitempty"`
+	Size     int64  `json:"size"`
+	SHA256   string `json:"sha256,omitempty"` // incremental backups: object holding the content
+}
+
+// archiveExt is the archive suffix native to the platform
+func archiveExt() string {
+	if runtime.GOOS == "windows" {
+		return ".zip"
+	}
+	return ".tar.gz"
+}
+
+func isArchivePath(p string) bool {
+	return strings.HasSuffix(p, ".tar.gz") || strings.HasSuffix(p, ".zip")
+}
+
+// archiveContents returns the archive member order and contents for entries
+func archiveContents(entries []backupEntry) ([]string, map[string][]byte, error) {
+	files := make(map[string][]byte, len(entries)+1)
+	man := backupManifest{Created: time.Now().Format(time.RFC3339)}
+	for _, e := range entries {
+		data, err := e.content()
+		if err != nil {
+			return nil, nil, fmt.Errorf("read %s: %w", e.Name, err)
+		}
+		files[e.Name] = data
+		man.Files = append(man.Files, backupManifestEntry{Name: e.Name, Original: e.Original, Size: int64(len(data))})
+	}
+	mb, err := json.MarshalIndent(man, "", "  ")
+	if err != nil {
+		return nil, nil, err
+	}
+	order := []string{backupManifestName}
+	files[backupManifestName] = mb
+	for _, e := range entries {
+		order = append(order, e.Name)
+	}
+	return order, files, nil
+}
+
+// encodeBackupArchive renders entries plus the manifest as a zip or tar.gz
+func encodeBackupArchive(w io.Writer, zipped bool, entries []backupEntry) error {
+	order, files, err := archiveContents(entries)
+	if err != nil {
+		return err
+	}
+	if zipped {
+		return writeZip(w, order, files)
+	}
+	return writeTarGz(w, order, files)
+}
+
+// writeBackupArchive writes entries plus the manifest into a new archive at path
+func writeBackupArchive(path string, entries []backupEntry) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = encodeBackupArchive(out, strings.HasSuffix(path, ".zip"), entries)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
+
+func writeTarGz(w io.Writer, order []string, files map[string][]byte) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+	for _, name := range order {
+		data := files[name]
+		hdr := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), ModTime: now, Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func writeZip(w io.Writer, order []string, files map[string][]byte) error {
+	zw := zip.NewWriter(w)
+	for _, name := range order {
+		f, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(files[name]); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// readBackupArchive returns all files (except the manifest) and the manifest
+func readBackupArchive(path string) (map[string][]byte, backupManifest, error) {
+	var (
+		files map[string][]byte
+		err   error
+	)
+	if strings.HasSuffix(path, ".zip") {
+		files, err = readZip(path)
+	} else {
+		files, err = readTarGz(path)
+	}
+	if err != nil {
+		return nil, backupManifest{}, err
+	}
+	return splitBackupManifest(files)
+}
+
+// decodeBackupArchive is readBackupArchive for an archive held in memory;
+// name only selects the format
+func decodeBackupArchive(name string, data []byte) (map[string][]byte, backupManifest, error) {
+	var (
+		files map[string][]byte
+		err   error
+	)
+	if strings.HasSuffix(name, ".zip") {
+		files, err = readZipFrom(bytes.NewReader(data), int64(len(data)))
+	} else {
+		files, err = readTarGzFrom(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, backupManifest{}, err
+	}
+	return splitBackupManifest(files)
+}
+
+// splitBackupManifest removes the manifest from files and parses it
+func splitBackupManifest(files map[string][]byte) (map[string][]byte, backupManifest, error) {
+	var man backupManifest
+	if mb, ok := files[backupManifestName]; ok {
+		if err := json.Unmarshal(mb, &man); err != nil {
+			return nil, man, fmt.Errorf("bad %s: %w", backupManifestName, err)
+		}
+		delete(files, backupManifestName)
+	}
+	return files, man, nil
+}
+
+func readTarGz(path string) (map[string][]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readTarGzFrom(f)
+}
+
+func readTarGzFrom(r io.Reader) (map[string][]byte, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(gz)
+	res := make(map[string][]byte)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return res, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		var buf bytes.Buffer
+		if _, err := io.Copy(&buf, tr); err != nil {
+			return nil, err
+		}
+		res[hdr.Name] = buf.Bytes()
+	}
+}
+
+func readZip(path string) (map[string][]byte, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return readZipFiles(zr.File)
+}
+
+func readZipFrom(r io.ReaderAt, size int64) (map[string][]byte, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return readZipFiles(zr.File)
+}
+
+func readZipFiles(members []*zip.File) (map[string][]byte, error) {
+	res := make(map[string][]byte)
+	for _, f := range members {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		res[f.Name] = data
+	}
+	return res, nil
+}
@@ -0,0 +1,554 @@
+// backup.go
+//
+// Backups of the user config taken before the apply flow changes anything:
+// settings.json, keybindings.json, snippets/, profiles/ (with the profile
+// registry from globalStorage/storage.json) and the installed extension list
+// as reported by the code CLI. Stored as a timestamped directory under the VS Code user dir or, with
+// --backup-archive, as one archive (see archive.go); --encrypt-backup seals that archive (crypt.go).
+//
+// The `backup` subcommand inspects them:
+//
+//   backup list         all backups with timestamp, size and contents
+//   backup show <ts>    diff between a backup and the current config
+//   backup diff <tsA> [<tsB>|--payload]
+//                       diff between two backups, or a backup and the payload
+//                       (without a second argument: the next newer backup)
+//
+// <ts> is the timestamp part of the directory name (2006-01-02_15-04-05),
+// the full directory name, a unique prefix of either, or "latest".
+
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pterm/pterm"
+)
+
+const (
+	backupTimeLayout   = "2006-01-02_15-04-05"
+	backupExtListName  = "extensions-installed.txt" // generated: code --list-extensions --show-versions
+	profileStorageFile = "globalStorage/storage.json"
+	backupWorkers      = 8 // parallel file copies of a folder backup
+)
+
+// backup storage formats
+const (
+	backupFormatDir         = "dir"
+	backupFormatArchive     = "archive"
+	backupFormatIncremental = "incremental"
+	backupFormatEncrypted   = "encrypted"
+)
+
+// directories under the user dir captured completely
+var backupDirs = []string{"snippets", "profiles"}
+
+// backupEntry is one file going into a backup
+type backupEntry struct {
+	Name     string // slash-separated path inside the backup
+	Original string // where the file lives in the editor config
+	Source   string // file to copy; empty when Data is set
+	Data     []byte
+}
+
+func (e backupEntry) content() ([]byte, error) {
+	if e.Source == "" {
+		return e.Data, nil
+	}
+	return os.ReadFile(e.Source)
+}
+
+// printBackupEntries lists what a dry-run backup would contain
+func printBackupEntries(entries []backupEntry) {
+	rows := [][]string{{"File", "Size", "From"}}
+	for _, e := range entries {
+		from, size := e.Original, int64(len(e.Data))
+		if e.Source != "" {
+			if fi, err := os.Stat(e.Source); err == nil {
+				size = fi.Size()
+			}
+		}
+		if from == "" {
+			from = "(generated)"
+		}
+		rows = append(rows, []string{e.Name, humanBytes(size), from})
+	}
+	if len(rows) > 1 {
+		pterm.DefaultTable.WithHasHeader().WithData(rows).Render()
+	}
+}
+
+// backupEntries lists everything a backup should capture: settings, keybindings,
+// snippets, profiles (with the profile registry) and the installed extension list
+func (i *Installer) backupEntries() []backupEntry {
+	var res []backupEntry
+	for _, nm := range []string{settingsFile, keybindingsFile} {
+		src := filepath.Join(i.vscodeUser, nm)
+		if !exists(src) {
+			i.logf("no existing %s to backup", nm)
+			continue
+		}
+		res = append(res, backupEntry{Name: nm, Original: src, Source: src})
+	}
+	for _, dir := range backupDirs {
+		res = append(res, i.dirBackupEntries(dir)...)
+	}
+	// profiles are registered in storage.json; without it restored profile dirs are orphans
+	if storage := filepath.Join(i.vscodeUser, filepath.FromSlash(profileStorageFile)); exists(filepath.Join(i.vscodeUser, "profiles")) && exists(storage) {
+		res = append(res, backupEntry{Name: profileStorageFile, Original: storage, Source: storage})
+	}
+	if data, err := i.installedExtensionsSnapshot(); err != nil {
+		i.warnf("extension list not included in backup: %v", err)
+	} else {
+		res = append(res, backupEntry{Name: backupExtListName, Data: data})
+	}
+	return res
+}
+
+// dirBackupEntries returns all files below <user dir>/rel
+func (i *Installer) dirBackupEntries(rel string) []backupEntry {
+	root := filepath.Join(i.vscodeUser, rel)
+	var res []backupEntry
+	filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		name, _ := filepath.Rel(i.vscodeUser, p)
+		res = append(res, backupEntry{Name: filepath.ToSlash(name), Original: p, Source: p})
+		return nil
+	})
+	return res
+}
+
+// installedExtensionsSnapshot renders the installed extensions as id@version lines
+func (i *Installer) installedExtensionsSnapshot() ([]byte, error) {
+	if i.codeCLIPath == "" {
+		if err := i.ensureCodeCLI(); err != nil {
+			return nil, err
+		}
+	}
+	installed, err := i.installedExtensions()
+	if err != nil {
+		return nil, err
+	}
+	var sb strings.Builder
+	for _, e := range installed {
+		fmt.Fprintf(&sb, "%s@%s\n", e.ID, e.Version)
+	}
+	return []byte(sb.String()), nil
+}
+
+// currentContent returns the live counterpart of a backup entry ("" when absent)
+func (i *Installer) currentContent(rel string) (string, error) {
+	if rel == backupExtListName {
+		data, err := i.installedExtensionsSnapshot()
+		return string(data), err
+	}
+	cur, err := os.ReadFile(filepath.Join(i.vscodeUser, filepath.FromSlash(rel)))
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	return string(cur), nil
+}
+
+// payloadUnchanged reports whether applying the payload (merged under --merge) would leave
+// settings.json and keybindings.json byte-for-byte as they are
+func (i *Installer) payloadUnchanged() bool {
+	for _, f := range []struct {
+		name string
+		data []byte
+	}{{settingsFile, i.settingsData}, {keybindingsFile, i.keybindData}} {
+		if len(f.data) == 0 {
+			continue
+		}
+		want := i.desiredContent(f.name, f.data, false)
+		if f.name == settingsFile {
+			want = i.enforcedSettings(want)
+		}
+		if !sameContent(filepath.Join(i.vscodeUser, f.name), want) {
+			return false
+		}
+	}
+	return true
+}
+
+// makeBackup saves the existing config into i.backupDir (a directory or an archive).
+// Respects dry-run and skipBackup flags.
+func (i *Installer) makeBackup() error {
+	if i.skipBackup {
+		i.logf("Backup skipped by user (--no-backup).")
+		return nil
+	}
+	entries := i.backupEntries()
+	if i.dryRun {
+		i.logf("DRY-RUN: would back up %d files to %s", len(entries), i.backupDir)
+		printBackupEntries(entries)
+		return nil
+	}
+	if len(entries) == 0 {
+		i.logf("Nothing to back up.")
+		return nil
+	}
+	if err := i.rememberBackupRoot(); err != nil {
+		i.warnf("cannot record backup location in state file: %v", err)
+	}
+	if i.backupFormat == backupFormatIncremental {
+		if err := i.writeIncrementalBackup(i.backupDir, entries); err != nil {
+			return fmt.Errorf("cannot write incremental backup: %w", err)
+		}
+		return nil
+	}
+	if i.backupFormat == backupFormatEncrypted {
+		if err := i.writeEncryptedBackup(i.backupDir, entries); err != nil {
+			return fmt.Errorf("cannot write encrypted backup: %w", err)
+		}
+		return nil
+	}
+	if i.backupFormat == backupFormatArchive {
+		if err := os.MkdirAll(filepath.Dir(i.backupDir), 0o755); err != nil {
+			return err
+		}
+		if err := writeBackupArchive(i.backupDir, entries); err != nil {
+			return fmt.Errorf("cannot write backup archive: %w", err)
+		}
+		i.logf("backup: %d files -> %s", len(entries), i.backupDir)
+		return nil
+	}
+	if err := os.MkdirAll(i.backupDir, 0o755); err != nil {
+		return err
+	}
+	return i.copyBackupEntries(entries)
+}
+
+// copyBackupEntries copies the entries into the backup folder on a pool of
+// backupWorkers goroutines (full profiles hold thousands of small files)
+// behind one progress bar; results are logged once the bar is done
+func (i *Installer) copyBackupEntries(entries []backupEntry) error {
+	pbar := pterm.DefaultProgressbar.WithTitle("Backup")
+	if !i.silent && !i.quiet {
+		pbar, _ = pbar.WithTotal(len(entries)).Start()
+	}
+	errs := make([]error, len(entries))
+	var mu sync.Mutex
+	parallel(len(entries), backupWorkers, func(idx int) {
+		e := entries[idx]
+		dst := filepath.Join(i.backupDir, filepath.FromSlash(e.Name))
+		if e.Source != "" {
+			errs[idx] = copyFile(e.Source, dst)
+		} else {
+			errs[idx] = writeBytes(dst, e.Data)
+		}
+		mu.Lock()
+		pbar.Increment()
+		mu.Unlock()
+	})
+	if pbar.IsActive {
+		pbar.Stop()
+	}
+	copied := 0
+	for idx, e := range entries {
+		if errs[idx] != nil {
+			i.warnf("cannot backup %s: %v", e.Name, errs[idx])
+			continue
+		}
+		copied++
+		i.logToFile("backup: %s -> %s", e.Original, filepath.Join(i.backupDir, filepath.FromSlash(e.Name)))
+	}
+	i.logf("backup: %d of %d files -> %s", copied, len(entries), i.backupDir)
+	return nil
+}
+
+// backupInfo describes one backup (directory or archive)
+type backupInfo struct {
+	Name   string // timestamp part of the directory / archive name
+	Path   string
+	Format string // one of the backupFormat* constants
+	Time   time.Time
+	Size   int64
+	Files  []string // paths inside the backup, slash-separated; unknown for encrypted backups
+}
+
+func runBackup(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: backup list | backup show <ts> | backup diff <tsA> [<tsB>|--payload]")
+	}
+	sub := args[0]
+	fs, opts := newCommandFlags("backup " + sub)
+	payload := fs.Bool("payload", false, "diff: compare the backup with the payload instead of another backup")
+	pos := parseInterspersed(fs, args[1:])
+
+	inst, err := NewInstaller(*opts)
+	if err != nil {
+		return fmt.Errorf("cannot initialize installer: %w", err)
+	}
+	defer inst.Close()
+
+	backups, err := inst.listBackups()
+	if err != nil {
+		return err
+	}
+	switch sub {
+	case "list":
+		printBackupList(backups)
+		return nil
+	case "show":
+		if len(pos) != 1 {
+			return fmt.Errorf("usage: backup show <ts>")
+		}
+		b, err := findBackup(backups, pos[0])
+		if err != nil {
+			return err
+		}
+		return inst.showBackup(b)
+	case "diff":
+		return inst.diffBackups(backups, pos, *payload)
+	default:
+		return fmt.Errorf("unknown backup command %q (want list, show or diff)", sub)
+	}
+}
+
+// rememberBackupRoot records a custom backup folder in the state file,
+// so listing (and a later restore) finds backups outside the user dir
+func (i *Installer) rememberBackupRoot() error {
+	if i.backupRoot == i.vscodeUser {
+		return nil
+	}
+	return i.updateState(func(st *State) {
+		for _, l := range st.BackupLocations {
+			if l == i.backupRoot {
+				return
+			}
+		}
+		st.BackupLocations = append(st.BackupLocations, i.backupRoot)
+	})
+}
+
+// backupRoots lists every folder that may hold backups: the user dir,
+// --backup-dir and the locations recorded in the state file
+func (i *Installer) backupRoots() []string {
+	roots := []string{i.vscodeUser}
+	if st, err := i.loadState(); err != nil {
+		i.warnf("%v", err)
+	} else {
+		roots = append(roots, st.BackupLocations...)
+	}
+	roots = append(roots, i.backupRoot)
+	seen := make(map[string]bool)
+	res := roots[:0]
+	for _, r := range roots {
+		if !seen[r] {
+			seen[r] = true
+			res = append(res, r)
+		}
+	}
+	return res
+}
+
+// listBackups scans all backup roots for backup_* directories and archives, oldest first
+func (i *Installer) listBackups() ([]backupInfo, error) {
+	var paths []string
+	for _, root := range i.backupRoots() {
+		found, err := filepath.Glob(filepath.Join(root, backupPrefix+"*"))
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, found...)
+	}
+	var res []backupInfo
+	for _, p := range paths {
+		st, err := os.Stat(p)
+		switch {
+		case err != nil:
+			continue
+		case st.IsDir():
+			res = append(res, readBackupInfo(p))
+		case isEncryptedPath(p):
+			b, err := readEncryptedInfo(p)
+			if err != nil {
+				continue
+			}
+			res = append(res, b)
+		case isIncrementalPath(p):
+			b, err := readIncrementalInfo(p)
+			if err != nil {
+				i.warnf("unreadable backup manifest %s: %v", p, err)
+				continue
+			}
+			res = append(res, b)
+		case isArchivePath(p):
+			b, err := readArchiveInfo(p)
+			if err != nil {
+				i.warnf("unreadable backup archive %s: %v", p, err)
+				continue
+			}
+			res = append(res, b)
+		}
+	}
+	sort.Slice(res, func(a, b int) bool { return res[a].Time.Before(res[b].Time) })
+	return res, nil
+}
+
+// readBackupInfo collects name, timestamp, size and file list of a backup dir
+func readBackupInfo(dir string) backupInfo {
+	name := strings.TrimPrefix(filepath.Base(dir), backupPrefix)
+	b := backupInfo{Name: name, Path: dir, Format: backupFormatDir, Time: parseBackupTime(name, dir)}
+	filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			b.Size += info.Size()
+		}
+		rel, _ := filepath.Rel(dir, p)
+		b.Files = append(b.Files, filepath.ToSlash(rel))
+		return nil
+	})
+	return b
+}
+
+// parseBackupTime reads the timestamp from a backup name, falling back to the mtime of path
+func parseBackupTime(name, path string) time.Time {
+	if t, err := time.ParseInLocation(backupTimeLayout, name, time.Local); err == nil {
+		return t
+	}
+	if st, err := os.Stat(path); err == nil {
+		return st.ModTime()
+	}
+	return time.Time{}
+}
+
+// readArchiveInfo collects backupInfo from an archive and its manifest
+func readArchiveInfo(path string) (backupInfo, error) {
+	name := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(path), ".zip"), ".tar.gz")
+	b := backupInfo{Name: strings.TrimPrefix(name, backupPrefix), Path: path, Format: backupFormatArchive}
+	st, err := os.Stat(path)
+	if err != nil {
+		return b, err
+	}
+	b.Size = st.Size()
+	b.Time = parseBackupTime(b.Name, path)
+	files, _, err := readBackupArchive(path)
+	if err != nil {
+		return b, err
+	}
+	for n := range files {
+		b.Files = append(b.Files, n)
+	}
+	sort.Strings(b.Files)
+	return b, nil
+}
+
+// readBackupFiles returns the content of every file in a backup
+func (i *Installer) readBackupFiles(b backupInfo) (map[string][]byte, error) {
+	switch b.Format {
+	case backupFormatEncrypted:
+		return i.readEncryptedFiles(b.Path)
+	case backupFormatArchive:
+		files, _, err := readBackupArchive(b.Path)
+		return files, err
+	case backupFormatIncremental:
+		return readIncrementalFiles(b.Path)
+	}
+	res := make(map[string][]byte, len(b.Files))
+	for _, rel := range b.Files {
+		data, err := os.ReadFile(filepath.Join(b.Path, filepath.FromSlash(rel)))
+		if err != nil {
+			return nil, err
+		}
+		res[rel] = data
+	}
+	return res, nil
+}
+
+func sortedKeys(m map[string][]byte) []string {
+	res := make([]string, 0, len(m))
+	for k := range m {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// findBackup resolves a user-supplied timestamp to one backup
+func findBackup(backups []backupInfo, ts string) (backupInfo, error) {
+	if len(backups) == 0 {
+		return backupInfo{}, fmt.Errorf("no backups found")
+	}
+	if ts == "latest" {
+		return backups[len(backups)-1], nil
+	}
+	ts = strings.TrimPrefix(ts, backupPrefix)
+	var matches []backupInfo
+	for _, b := range backups {
+		if b.Name == ts {
+			return b, nil
+		}
+		if strings.HasPrefix(b.Name, ts) {
+			matches = append(matches, b)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return backupInfo{}, fmt.Errorf("no backup matches %q", ts)
+	case 1:
+		return matches[0], nil
+	default:
+		return backupInfo{}, fmt.Errorf("%q matches %d backups, be more specific", ts, len(matches))
+	}
+}
+
+func printBackupList(backups []backupInfo) {
+	if len(backups) == 0 {
+		pterm.Info.Println("No backups found.")
+		return
+	}
+	rows := [][]string{{"Timestamp", "Size", "Location", "Contents"}}
+	for _, b := range backups {
+		contents := strings.Join(b.Files, ", ")
+		if b.Format == backupFormatEncrypted {
+			contents = "(encrypted)"
+		}
+		rows = append(rows, []string{b.Name, humanBytes(b.Size), filepath.Dir(b.Path), truncate(contents, 60)})
+	}
+	pterm.DefaultTable.WithHasHeader().WithData(rows).Render()
+}
+
+// showBackup prints the diff between each backed up file and its current version
+func (i *Installer) showBackup(b backupInfo) error {
+	pterm.DefaultSection.Printf("Backup %s (%s)\n", b.Name, b.Path)
+	files, err := i.readBackupFiles(b)
+	if err != nil {
+		return err
+	}
+	names := b.Files
+	if b.Format == backupFormatEncrypted {
+		names = sortedKeys(files)
+	}
+	changed := 0
+	for _, rel := range names {
+		old := files[rel]
+		cur, err := i.currentContent(rel)
+		if err != nil {
+			i.warnf("cannot compare %s: %v", rel, err)
+			continue
+		}
+		d := unifiedDiff("backup/"+rel, "current/"+rel, string(old), cur)
+		if d == "" {
+			pterm.Info.Printf("%s: unchanged since backup\n", rel)
+			continue
+		}
+		changed++
+		printDiff(d)
+	}
+	if changed == 0 {
+		pterm.Success.Println("Current config matches the backup.")
+	}
+	return nil
+}
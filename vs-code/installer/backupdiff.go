@@ -0,0 +1,143 @@
+// backupdiff.go
+//
+// `backup diff`: what changed between two backups, or between a backup and
+// the payload the installer would apply. Walking consecutive backups shows
+// what every installer run actually modified. The extension list is compared
+// by id only on the payload side, since extensions.txt carries no versions
+// for unpinned entries.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pterm/pterm"
+)
+
+// diffBackups implements `backup diff <tsA> [<tsB>|--payload]`
+func (i *Installer) diffBackups(backups []backupInfo, pos []string, payload bool) error {
+	if len(pos) < 1 || len(pos) > 2 || (payload && len(pos) == 2) {
+		return fmt.Errorf("usage: backup diff <tsA> [<tsB>|--payload]")
+	}
+	a, err := findBackup(backups, pos[0])
+	if err != nil {
+		return err
+	}
+	oldFiles, err := i.readBackupFiles(a)
+	if err != nil {
+		return err
+	}
+	oldName := "backup-" + a.Name
+
+	var (
+		newFiles map[string][]byte
+		newName  string
+	)
+	switch {
+	case payload:
+		if err := i.preparePayloads(); err != nil {
+			return fmt.Errorf("cannot load payload: %w", err)
+		}
+		newFiles, newName = i.payloadFiles(), "payload"
+		// the payload has no snippets/profiles; only compare what it would write
+		for rel := range oldFiles {
+			if _, ok := newFiles[rel]; !ok {
+				delete(oldFiles, rel)
+			}
+		}
+		if ext, ok := oldFiles[backupExtListName]; ok {
+			oldFiles[backupExtListName] = extensionIDLines(string(ext))
+		}
+	default:
+		var b backupInfo
+		if len(pos) == 2 {
+			b, err = findBackup(backups, pos[1])
+		} else {
+			b, err = nextBackup(backups, a)
+		}
+		if err != nil {
+			return err
+		}
+		if newFiles, err = i.readBackupFiles(b); err != nil {
+			return err
+		}
+		newName = "backup-" + b.Name
+	}
+
+	pterm.DefaultSection.Printf("%s → %s\n", oldName, newName)
+	changed := 0
+	for _, rel := range unionKeys(oldFiles, newFiles) {
+		d := i.redactSecrets(unifiedDiff(oldName+"/"+rel, newName+"/"+rel, string(oldFiles[rel]), string(newFiles[rel])))
+		if d == "" {
+			continue
+		}
+		changed++
+		printDiff(d)
+	}
+	if changed == 0 {
+		pterm.Success.Println("No differences.")
+	} else {
+		pterm.Info.Printf("%d files differ\n", changed)
+	}
+	return nil
+}
+
+// payloadFiles renders the payload under the names used inside backups
+func (i *Installer) payloadFiles() map[string][]byte {
+	res := make(map[string][]byte)
+	if len(i.settingsData) > 0 {
+		res[settingsFile] = i.settingsData
+	}
+	if len(i.keybindData) > 0 {
+		res[keybindingsFile] = i.keybindData
+	}
+	if len(i.extList) > 0 {
+		ids := make([]string, 0, len(i.extList))
+		for _, s := range i.extList {
+			ids = append(ids, s.ID)
+		}
+		res[backupExtListName] = extensionIDLines(strings.Join(ids, "\n"))
+	}
+	return res
+}
+
+// extensionIDLines reduces "id[@version]" lines to sorted, lower-cased ids
+func extensionIDLines(list string) []byte {
+	var ids []string
+	for _, l := range readLinesFromString(list) {
+		id, _, _ := strings.Cut(l, "@")
+		ids = append(ids, strings.ToLower(id))
+	}
+	sort.Strings(ids)
+	if len(ids) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(ids, "\n") + "\n")
+}
+
+// nextBackup returns the backup taken right after b (backups are sorted oldest first)
+func nextBackup(backups []backupInfo, b backupInfo) (backupInfo, error) {
+	for k, x := range backups {
+		if x.Path == b.Path && k+1 < len(backups) {
+			return backups[k+1], nil
+		}
+	}
+	return backupInfo{}, fmt.Errorf("%s is the newest backup — name a second one or use --payload", b.Name)
+}
+
+func unionKeys(a, b map[string][]byte) []string {
+	seen := make(map[string]bool)
+	var res []string
+	for _, m := range []map[string][]byte{a, b} {
+		for k := range m {
+			if !seen[k] {
+				seen[k] = true
+				res = append(res, k)
+			}
+		}
+	}
+	sort.Strings(res)
+	return res
+}
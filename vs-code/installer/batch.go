@@ -0,0 +1,116 @@
+// batch.go
+//
+// Batched install mode (--batch N). The code CLI accepts several
+// --install-extension flags per invocation, so chunking the list into groups
+// of N saves one editor start-up per extension (seconds each on Windows).
+// Results are parsed per extension from the combined output; anything the
+// batch did not confirm falls back to the regular one-by-one retry path.
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pterm/pterm"
+)
+
+// matches e.g. "Extension 'golang.go' v0.40.0 was successfully installed."
+// and "Extension 'golang.go' is already installed."
+var installOKRe = regexp.MustCompile(`Extension '([^']+)'(?: v\S+)? (?:was successfully installed|is already installed)`)
+
+// parseInstallOutput returns the lower-cased names the CLI reported as installed.
+// For .vsix installs the CLI reports the file name, so callers look up both.
+func parseInstallOutput(out string) map[string]bool {
+	res := make(map[string]bool)
+	for _, m := range installOKRe.FindAllStringSubmatch(out, -1) {
+		res[strings.ToLower(m[1])] = true
+	}
+	return res
+}
+
+// batchReported tells whether ext is confirmed in parsed batch output
+func (i *Installer) batchReported(ok map[string]bool, ext extensionSpec) bool {
+	if ok[strings.ToLower(ext.ID)] || ok[strings.ToLower(ext.String())] {
+		return true
+	}
+	src := i.installSource(ext)
+	return ok[strings.ToLower(src)] || ok[strings.ToLower(filepath.Base(src))]
+}
+
+// installBatched installs pending in chunks of batchSize per code process
+func (i *Installer) installBatched(pending []extensionSpec, pbar *pterm.ProgressbarPrinter) {
+	for start := 0; start < len(pending); start += i.batchSize {
+		end := start + i.batchSize
+		if end > len(pending) {
+			end = len(pending)
+		}
+		chunk := pending[start:end]
+		pbar.UpdateTitle(fmt.Sprintf("[batch %d-%d/%d]", start+1, end, len(pending)))
+
+		for _, ext := range i.installChunk(chunk) {
+			// not confirmed by the batch — use the per-extension retry path
+			if err := i.installOne(ext); err != nil {
+				i.errorf("%v", err)
+				if i.strict {
+					return
+				}
+			}
+		}
+		pbar.Add(len(chunk))
+		i.throttle(minSleepMs, maxSleepMs)
+	}
+}
+
+// installChunk runs one code invocation for chunk and returns the entries
+// that were not confirmed (or failed version verification)
+func (i *Installer) installChunk(chunk []extensionSpec) []extensionSpec {
+	endChunk := i.subPhase(fmt.Sprintf("batch of %d", len(chunk)))
+	args := make([]string, 0, 2*len(chunk)+1)
+	names := make([]string, 0, len(chunk))
+	var timeout time.Duration
+	for _, ext := range chunk {
+		timeout += ext.installTimeout()
+		src := i.installSource(ext)
+		args = append(args, "--install-extension", src)
+		names = append(names, src)
+	}
+	args = append(args, "--force")
+	if i.dryRun {
+		i.logf("DRY-RUN: would run: %s %s", i.codeCLIPath, strings.Join(args, " "))
+		for _, ext := range chunk {
+			i.report.Installed = append(i.report.Installed, ext.ID)
+		}
+		return nil
+	}
+
+	i.logf("Installing batch of %d: %s", len(chunk), strings.Join(names, ", "))
+	out, err := runCommandWithTimeout(timeout, i.codeCLIPath, i.codeArgs(args...)...)
+	if err != nil {
+		i.warnf("Batch install exited with error: %v", err)
+	}
+	ok := parseInstallOutput(out)
+	endChunk()
+
+	var failed []extensionSpec
+	for _, ext := range chunk {
+		if !i.batchReported(ok, ext) {
+			i.warnf("Batch did not confirm %s — retrying individually", ext)
+			failed = append(failed, ext)
+			continue
+		}
+		if verr := i.verifyInstalledVersion(ext); verr != nil {
+			i.warnf("%v — retrying individually", verr)
+			failed = append(failed, ext)
+			continue
+		}
+		i.logf("Installed: %s", ext)
+		i.report.Installed = append(i.report.Installed, ext.ID)
+		i.installed.add(ext.ID, ext.Version)
+		i.journalInstall(ext)
+	}
+	return failed
+}
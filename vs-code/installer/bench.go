@@ -0,0 +1,103 @@
+// bench.go
+//
+// Benchmark mode (--bench). Every phase of the apply flow (detection and
+// payload, backup, settings, each extension install, ...) is timed, and a
+// table with the wall time per phase, its share and the total ends the
+// run. The install strategy (serial, --batch N, mirror downloads in
+// parallel) is part of the header, so runs with different strategies can
+// be compared side by side. Without --bench the timers are no-ops.
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pterm/pterm"
+)
+
+// benchPhase is one timed step
+type benchPhase struct {
+	Name     string
+	Duration time.Duration
+	Nested   bool // part of an enclosing phase (single extensions)
+}
+
+// benchTimer collects phase timings of one run
+type benchTimer struct {
+	start  time.Time
+	phases []benchPhase
+}
+
+// phase starts timing name; the returned function stops it. Without
+// --bench both are no-ops.
+func (i *Installer) phase(name string) func() {
+	return i.timePhase(name, false)
+}
+
+// subPhase times a step inside an enclosing phase (shown indented below it)
+func (i *Installer) subPhase(name string) func() {
+	return i.timePhase(name, true)
+}
+
+func (i *Installer) timePhase(name string, nested bool) func() {
+	if i.bench == nil {
+		return func() {}
+	}
+	// the slot is taken at the start, so phases are listed in start order
+	idx := len(i.bench.phases)
+	i.bench.phases = append(i.bench.phases, benchPhase{Name: name, Nested: nested})
+	t0 := time.Now()
+	return func() {
+		i.bench.phases[idx].Duration = time.Since(t0)
+	}
+}
+
+// installStrategy describes how extensions are installed in this run
+func (i *Installer) installStrategy() string {
+	s := "serial"
+	if i.batchSize > 1 {
+		s = fmt.Sprintf("batched (%d per call)", i.batchSize)
+	}
+	if i.mirrorURL != "" {
+		s += fmt.Sprintf(", mirror downloads %d in parallel", downloadWorkers)
+	}
+	if i.noThrottle {
+		s += ", no pauses"
+	}
+	return s
+}
+
+// printBench renders the timing table and logs it
+func (i *Installer) printBench() {
+	if i.bench == nil {
+		return
+	}
+	total := time.Since(i.bench.start)
+	rows := [][]string{{"Phase", "Time", "Share"}}
+	for _, p := range i.bench.phases {
+		name := p.Name
+		if p.Nested {
+			name = "  " + name
+		}
+		share := fmt.Sprintf("%.1f%%", 100*p.Duration.Seconds()/total.Seconds())
+		rows = append(rows, []string{name, formatDuration(p.Duration), share})
+		i.logToFile("bench: %s %s", p.Name, p.Duration)
+	}
+	rows = append(rows, []string{"total", formatDuration(total), "100%"})
+	i.logToFile("bench: total %s (%s)", total, i.installStrategy())
+	pterm.DefaultSection.Println("Timing — " + i.installStrategy())
+	pterm.DefaultTable.WithHasHeader().WithData(rows).Render()
+}
+
+// formatDuration rounds d for the table
+func formatDuration(d time.Duration) string {
+	switch {
+	case d >= time.Minute:
+		return d.Round(time.Second).String()
+	case d >= time.Second:
+		return d.Round(10 * time.Millisecond).String()
+	default:
+		return d.Round(10 * time.Microsecond).String()
+	}
+}
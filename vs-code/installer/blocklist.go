@@ -0,0 +1,80 @@
+// blocklist.go
+//
+// Extension blocklist (blocked.txt, embedded or from --src). One extension ID
+// or glob pattern per line ("publisher.*", "*copilot*"), matched
+// case-insensitively. Blocked entries are never installed even when listed,
+// and blocked extensions already present in the editor are uninstalled.
+
+package main
+
+import (
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	blocklistFile       = "blocked.txt"
+	uninstallTimeoutSec = 30 // timeout for a single code --uninstall-extension
+)
+
+// isBlocked reports whether id matches any blocklist pattern
+func (i *Installer) isBlocked(id string) bool {
+	le := strings.ToLower(id)
+	for _, p := range i.blocklist {
+		if ok, _ := path.Match(strings.ToLower(p), le); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// applyBlocklist drops blocked entries from the install set
+func (i *Installer) applyBlocklist() {
+	if len(i.blocklist) == 0 {
+		return
+	}
+	kept := i.extList[:0]
+	for _, spec := range i.extList {
+		if i.isBlocked(spec.ID) {
+			i.warnf("%s is blocked by %s — will not be installed", spec.ID, blocklistFile)
+			i.report.Blocked = append(i.report.Blocked, spec.ID)
+			continue
+		}
+		kept = append(kept, spec)
+	}
+	i.extList = kept
+}
+
+// enforceBlocklist uninstalls blocked extensions found in the editor
+func (i *Installer) enforceBlocklist() error {
+	if len(i.blocklist) == 0 {
+		return nil
+	}
+	if err := i.ensureCodeCLI(); err != nil {
+		return err
+	}
+	installed, err := i.installedExtensions()
+	if err != nil {
+		return err
+	}
+	for _, e := range installed {
+		if !i.isBlocked(e.ID) {
+			continue
+		}
+		if i.dryRun {
+			i.logf("DRY-RUN: would uninstall blocked extension %s", e.ID)
+			i.report.Uninstalled = append(i.report.Uninstalled, e.ID)
+			continue
+		}
+		out, err := runCommandWithTimeout(uninstallTimeoutSec*time.Second, i.codeCLIPath, i.codeArgs("--uninstall-extension", e.ID)...)
+		if err != nil {
+			i.errorf("Cannot uninstall blocked extension %s: %v\n%s", e.ID, err, out)
+			continue
+		}
+		i.logf("Uninstalled blocked extension %s", e.ID)
+		i.installed.remove(e.ID)
+		i.report.Uninstalled = append(i.report.Uninstalled, e.ID)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+// bootstrap.go
+//
+// `bootstrap` subcommand for dotfiles repositories: GitHub Codespaces and
+// VS Code's "dotfiles" setting clone the repo into a fresh container and
+// run its install script without a terminal. `hypreditors bootstrap` is
+// meant to be that script's only line. It detects the hook by the
+// variables the hosts set (CODESPACES, REMOTE_CONTAINERS,
+// GITPOD_WORKSPACE_ID) or a container and then applies with defaults that
+// fit a throwaway machine:
+//
+//   - every question answered yes, no preset or keymap menus
+//   - no backup (there is nothing of the user's to keep)
+//   - no size estimate and no pauses between extension installs
+//   - plain output without colors and spinners for the creation log
+//
+// Outside a hook (a missing terminal alone, as under cron or CI, is not
+// one) it still applies non-interactively, but keeps backups and the
+// Marketplace throttling of a normal run.
+
+package main
+
+import (
+	"os"
+	"runtime"
+
+	"github.com/pterm/pterm"
+)
+
+func runBootstrap(args []string) error {
+	fs, opts := newCommandFlags("bootstrap")
+	fs.Parse(args)
+
+	opts.AssumeYes = true
+	if hook := dotfilesHook(); hook != "" {
+		opts.SkipBackup = true
+		opts.NoEstimate = true
+		opts.NoThrottle = true
+		pterm.DisableStyling()
+		pterm.Info.Printf("Dotfiles install hook detected (%s): applying with bootstrap defaults\n", hook)
+	} else {
+		pterm.Info.Println("No dotfiles install hook detected: applying non-interactively with backups")
+	}
+	if code := apply(*opts); code != exitOK {
+		return exitCodeError{code}
+	}
+	return nil
+}
+
+// dotfilesHook names the environment that looks like a dotfiles install
+// hook, or returns "" for an ordinary interactive session
+func dotfilesHook() string {
+	switch {
+	case os.Getenv("CODESPACES") == "true":
+		return "codespaces"
+	case os.Getenv("REMOTE_CONTAINERS") == "true":
+		return "dev container"
+	case os.Getenv("GITPOD_WORKSPACE_ID") != "":
+		return "gitpod"
+	case inContainer():
+		return "container"
+	}
+	return ""
+}
+
+// inContainer reports whether the process runs in a Docker/Podman container
+func inContainer() bool {
+	if runtime.GOOS != "linux" {
+		return false
+	}
+	return exists("/.dockerenv") || exists("/run/.containerenv")
+}
@@ -0,0 +1,399 @@
+// bundle.go
+//
+// Air-gapped installs. `bundle create` downloads every listed extension as
+// .vsix and packs it together with the payload files into one zip:
+//
+//   bundle.json            creation time, target platform, extension
+//                          versions and sha256 sums
+//   payload/<file>         settings.json, keybindings.json, extensions.txt, ...
+//   vsix/<id>-<ver>.vsix   the packages
+//
+// `bundle apply <file>` checks the sums, unpacks to a temp dir and runs the
+// normal apply flow with --src and --vsix-dir pointing inside it, so nothing
+// is fetched from the network. Platform-specific extensions (C/C++, ...)
+// need --target (e.g. linux-x64, win32-x64, darwin-arm64) matching the
+// machines the bundle is for.
+
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pterm/pterm"
+)
+
+const (
+	bundleManifestName = "bundle.json"
+	bundlePayloadDir   = "payload"
+	bundleVSIXDir      = "vsix"
+)
+
+// bundleManifest is bundle.json
+type bundleManifest struct {
+	Created    time.Time         `json:"created"`
+	Target     string            `json:"target,omitempty"`
+	Extensions []bundleExtension `json:"extensions"`
+}
+
+type bundleExtension struct {
+	ID      string `json:"id"`
+	Version string `json:"version"`
+	File    string `json:"file"`
+	SHA256  string `json:"sha256"`
+}
+
+func runBundle(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: bundle create [--out <file>] | bundle apply <file> [apply flags]")
+	}
+	switch args[0] {
+	case "create":
+		return runBundleCreate(args[1:])
+	case "apply":
+		return runBundleApply(args[1:])
+	default:
+		return fmt.Errorf("unknown bundle command %q (want create or apply)", args[0])
+	}
+}
+
+func runBundleCreate(args []string) error {
+	fs, opts := newCommandFlags("bundle create")
+	out := fs.String("out", "hypreditors-bundle.zip", "Bundle file to write")
+	registry := fs.String("registry", registryAuto, "Download source: auto, marketplace or openvsx")
+	target := fs.String("target", "", "Target platform of platform-specific extensions (e.g. linux-x64, win32-x64, darwin-arm64)")
+	fs.Parse(args)
+
+	inst, err := openInstaller(opts)
+	if err != nil {
+		return err
+	}
+	defer inst.Close()
+	return inst.createBundle(*out, inst.resolveRegistry(*registry), *target)
+}
+
+// createBundle downloads the install set and writes the bundle to out
+func (i *Installer) createBundle(out, registry, target string) error {
+	files, err := i.payloadSourceFiles()
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 && len(i.extList) == 0 {
+		return errors.New("payload is empty — nothing to bundle")
+	}
+
+	var unpinned []string
+	for _, s := range i.extList {
+		if _, local := i.vsix[strings.ToLower(s.ID)]; !local && s.Version == "" {
+			unpinned = append(unpinned, s.ID)
+		}
+	}
+	meta := map[string]extensionMeta{}
+	if len(unpinned) > 0 {
+		if meta, err = i.fetchExtensionMeta(registry, unpinned); err != nil {
+			return fmt.Errorf("cannot query %s: %w", registry, err)
+		}
+	}
+
+	bm := bundleManifest{Created: time.Now().UTC(), Target: target}
+	sources := make(map[string]string) // bundle entry -> local file
+	paths := make([]string, len(i.extList))
+	versions := make([]string, len(i.extList))
+	errs := make([]error, len(i.extList))
+	parallel(len(i.extList), downloadWorkers, func(idx int) {
+		s := i.extList[idx]
+		paths[idx], versions[idx], errs[idx] = i.fetchBundleVSIX(s, meta, registry, target)
+		pterm.Info.Printf("[%d/%d] %s\n", idx+1, len(i.extList), s.ID)
+	})
+	var failed []string
+	for idx, s := range i.extList {
+		if errs[idx] != nil {
+			i.errorf("%s: %v", s.ID, errs[idx])
+			failed = append(failed, s.ID)
+			continue
+		}
+		p, version := paths[idx], versions[idx]
+		e := bundleExtension{
+			ID: s.ID, Version: version, SHA256: fileHash(p),
+			File: path.Join(bundleVSIXDir, s.ID+"-"+version+".vsix"),
+		}
+		if e.SHA256 == "" {
+			return fmt.Errorf("cannot read %s", p)
+		}
+		bm.Extensions = append(bm.Extensions, e)
+		sources[e.File] = p
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d extensions could not be downloaded: %s", len(failed), strings.Join(failed, ", "))
+	}
+
+	if err := writeBundle(out, files, bm, sources); err != nil {
+		os.Remove(out)
+		return err
+	}
+	st, _ := os.Stat(out)
+	i.logf("Bundle written: %s (%d extensions, %s)", out, len(bm.Extensions), humanBytes(st.Size()))
+	return nil
+}
+
+// fetchBundleVSIX finds the .vsix for s (a --vsix-dir package or one from
+// the download cache) and returns its path and version
+func (i *Installer) fetchBundleVSIX(s extensionSpec, meta map[string]extensionMeta, registry, target string) (string, string, error) {
+	if pkg, ok := i.vsix[strings.ToLower(s.ID)]; ok {
+		return pkg.Path, pkg.Version, nil
+	}
+	version, link := s.Version, ""
+	if version == "" {
+		m, ok := meta[strings.ToLower(s.ID)]
+		if !ok {
+			return "", "", errRegistryNotFound
+		}
+		version, link = m.Version, m.DownloadURL
+	}
+	if link == "" || target != "" {
+		link = bundleVSIXURL(registry, s.ID, version, target)
+	}
+	key := cacheKey(registry, s.ID, version, target)
+	dst, _, err := i.cache.fetch(key, link)
+	if err != nil {
+		return "", "", err
+	}
+	if pkg, err := readVSIXManifest(dst); err != nil {
+		i.cache.forget(key)
+		return "", "", fmt.Errorf("downloaded file is not a .vsix: %w", err)
+	} else if !strings.EqualFold(pkg.ID, s.ID) {
+		i.cache.forget(key)
+		return "", "", fmt.Errorf("downloaded package is %s", pkg.ID)
+	}
+	return dst, version, nil
+}
+
+// bundleVSIXURL is the download URL of one extension version
+func bundleVSIXURL(registry, id, version, target string) string {
+	if registry == registryOpenVSX {
+		ns, name, _ := strings.Cut(id, ".")
+		file := id + "-" + version
+		if target != "" {
+			ns, name = ns+"/"+name, target
+			file += "@" + target
+		}
+		return fmt.Sprintf("%s/api/%s/%s/%s/file/%s.vsix", openVSXURL, ns, name, version, file)
+	}
+	u := vsixURL(galleryServiceURL, id, version)
+	if target != "" {
+		u += "?targetPlatform=" + url.QueryEscape(target)
+	}
+	return u
+}
+
+// payloadSourceFiles returns the payload files as they would be passed to
+// --src: the (possibly preset or packed) embedded ones, or the --src folder
+func (i *Installer) payloadSourceFiles() (map[string][]byte, error) {
+	res := make(map[string][]byte)
+	for name, data := range packTargets() {
+		if i.useEmbedded {
+			if len(*data) > 0 {
+				res[name] = *data
+			}
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(i.baseDir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		res[name] = b
+	}
+	dirFiles, err := i.payloadDirFiles()
+	if err != nil {
+		return nil, err
+	}
+	for name, b := range dirFiles {
+		res[name] = b
+	}
+	return res, nil
+}
+
+func writeBundle(out string, files map[string][]byte, bm bundleManifest, sources map[string]string) error {
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+
+	mf, err := json.MarshalIndent(bm, "", "  ")
+	if err != nil {
+		return err
+	}
+	entries := map[string][]byte{bundleManifestName: mf}
+	for name, data := range files {
+		entries[path.Join(bundlePayloadDir, name)] = data
+	}
+	for _, name := range sortedKeys(entries) {
+		w, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(entries[name]); err != nil {
+			return err
+		}
+	}
+	for _, e := range bm.Extensions {
+		if err := addBundleVSIX(zw, e.File, sources[e.File]); err != nil {
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// addBundleVSIX stores one package; it is a zip already, so not deflated again
+func addBundleVSIX(zw *zip.Writer, name, src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, in)
+	return err
+}
+
+func runBundleApply(args []string) error {
+	fs, opts := newCommandFlags("bundle apply")
+	pos := parseInterspersed(fs, args)
+	if len(pos) != 1 {
+		return errors.New("usage: bundle apply <file> [apply flags]")
+	}
+	if opts.SrcOverride != "" || opts.VSIXDir != "" || opts.Payload != "" {
+		return errors.New("bundle apply takes the payload from the bundle (no --src/--vsix-dir/--payload)")
+	}
+	dir, err := os.MkdirTemp("", "hypreditors-bundle-")
+	if err != nil {
+		return err
+	}
+	bm, err := extractBundle(pos[0], dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		return err
+	}
+	if !opts.Silent {
+		pterm.Info.Printf("Bundle from %s: %d extensions\n", bm.Created.Local().Format("2006-01-02 15:04"), len(bm.Extensions))
+	}
+
+	opts.SrcOverride = filepath.Join(dir, bundlePayloadDir)
+	opts.VSIXDir = filepath.Join(dir, bundleVSIXDir)
+	opts.NoEstimate = true
+	code := apply(*opts)
+	os.RemoveAll(dir)
+	if code != exitOK {
+		return exitCodeError{code}
+	}
+	return nil
+}
+
+// extractBundle unpacks the bundle into dir and verifies the package sums
+func extractBundle(file, dir string) (bundleManifest, error) {
+	var bm bundleManifest
+	zr, err := zip.OpenReader(file)
+	if err != nil {
+		return bm, fmt.Errorf("cannot open bundle: %w", err)
+	}
+	defer zr.Close()
+
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rel, ok := localZipPath(f.Name)
+		if !ok {
+			return bm, fmt.Errorf("bundle entry %q escapes the bundle", f.Name)
+		}
+		if filepath.ToSlash(rel) == bundleManifestName {
+			rc, err := f.Open()
+			if err != nil {
+				return bm, err
+			}
+			err = json.NewDecoder(rc).Decode(&bm)
+			rc.Close()
+			if err != nil {
+				return bm, fmt.Errorf("invalid %s: %w", bundleManifestName, err)
+			}
+			continue
+		}
+		if err := extractZipEntry(f, filepath.Join(dir, rel)); err != nil {
+			return bm, err
+		}
+	}
+	if bm.Created.IsZero() {
+		return bm, fmt.Errorf("%s is not a bundle (no %s)", file, bundleManifestName)
+	}
+
+	sort.Slice(bm.Extensions, func(a, b int) bool { return bm.Extensions[a].ID < bm.Extensions[b].ID })
+	for _, e := range bm.Extensions {
+		rel, ok := localZipPath(e.File)
+		if !ok {
+			return bm, fmt.Errorf("%s: %q escapes the bundle", bundleManifestName, e.File)
+		}
+		sum := fileHash(filepath.Join(dir, rel))
+		if sum == "" {
+			return bm, fmt.Errorf("%s missing from bundle", e.File)
+		}
+		if sum != e.SHA256 {
+			return bm, fmt.Errorf("%s: checksum mismatch (bundle corrupted?)", e.File)
+		}
+	}
+	return bm, nil
+}
+
+// localZipPath returns a zip entry name as a path relative to the folder it
+// is extracted to; ok is false when it would leave that folder (absolute,
+// "..", a volume name). Backslashes count as separators and a drive letter
+// as a volume on every platform, so `..\x` and `C:x` are caught even where
+// the OS would not see them.
+func localZipPath(name string) (string, bool) {
+	slashed := strings.ReplaceAll(name, `\`, "/")
+	p := filepath.FromSlash(slashed)
+	if len(slashed) >= 2 && slashed[1] == ':' {
+		return p, false
+	}
+	return p, filepath.IsLocal(p)
+}
+
+func extractZipEntry(f *zip.File, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, rc); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
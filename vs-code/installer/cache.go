@@ -0,0 +1,447 @@
+// cache.go
+//
+// Download cache for .vsix packages fetched directly (mirror installs,
+// `bundle create`). Packages are stored content-addressed:
+//
+//   <cache>/vsix/objects/<sha256>.vsix   the package
+//   <cache>/vsix/refs/<source>~<id>@<version>[@<target>]   its sha256
+//   <cache>/vsix/partial/<key>.part      an interrupted download
+//
+// with <cache> = ~/.cache/hypreditors ($XDG_CACHE_HOME, ~/Library/Caches
+// on macOS, %LOCALAPPDATA% on Windows). <source> is the registry or the
+// mirror's host and port, so a version is fetched once per source and
+// platform, never taken from another registry's build; characters that are
+// not safe in a file name (the port's ":") are %xx-escaped in the key. An
+// interrupted download is resumed with a Range request, and the same
+// package under two keys is stored once. Downloads of one run go in
+// parallel (downloadWorkers).
+//
+// `cache ls` lists the packages with their integrity (sha256 against the
+// name), `cache prune [--max-size 2G]` drops corrupt and unreferenced ones
+// and evicts the least recently used beyond the size, `cache clear` empties
+// the cache.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pterm/pterm"
+)
+
+const (
+	cacheVSIXDir    = "vsix"
+	downloadWorkers = 4
+)
+
+// cacheDir returns the per-user cache directory
+func cacheDir(home string) string {
+	switch runtime.GOOS {
+	case "windows":
+		if d := os.Getenv("LOCALAPPDATA"); d != "" {
+			return filepath.Join(d, stateDirName, "cache")
+		}
+		return filepath.Join(home, "AppData", "Local", stateDirName, "cache")
+	case "darwin":
+		return filepath.Join(home, "Library", "Caches", stateDirName)
+	default:
+		if d := os.Getenv("XDG_CACHE_HOME"); d != "" {
+			return filepath.Join(d, stateDirName)
+		}
+		return filepath.Join(home, ".cache", stateDirName)
+	}
+}
+
+// vsixCache is the content-addressed package store
+type vsixCache struct {
+	dir      string
+	mu       sync.Mutex
+	download func(url, dst string) error // fetches a missing package
+}
+
+// newVSIXCache opens the package store below the user's cache directory;
+// missing packages are downloaded with download
+func newVSIXCache(home string, download func(url, dst string) error) *vsixCache {
+	return &vsixCache{dir: filepath.Join(cacheDir(home), cacheVSIXDir), download: download}
+}
+
+// cacheKey names one package version of a source, e.g.
+// marketplace~golang.go@0.41.0@linux-x64 or
+// mirror.example%3a8443~golang.go@0.41.0@linux-x64
+func cacheKey(source, id, version, target string) string {
+	k := cacheKeyPart(strings.ToLower(source)) + "~" + cacheKeyPart(strings.ToLower(id)) + "@" + cacheKeyPart(version)
+	if target != "" {
+		k += "@" + cacheKeyPart(target)
+	}
+	return k
+}
+
+// cacheKeyPart escapes one part of a cache key for use in a file name: any
+// byte but a letter, digit, ".", "-" or "_" becomes %xx, so a mirror's port
+// colon (an NTFS stream name) or a path separator never reaches the path
+func cacheKeyPart(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '.', c == '-', c == '_':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02x", c)
+		}
+	}
+	return b.String()
+}
+
+func (c *vsixCache) refPath(key string) string {
+	return filepath.Join(c.dir, "refs", key)
+}
+
+func (c *vsixCache) objectPath(sum string) string {
+	return filepath.Join(c.dir, "objects", sum+".vsix")
+}
+
+// lookup returns the cached package of key, or ""
+func (c *vsixCache) lookup(key string) string {
+	b, err := os.ReadFile(c.refPath(key))
+	if err != nil {
+		return ""
+	}
+	p := c.objectPath(strings.TrimSpace(string(b)))
+	if !exists(p) {
+		return ""
+	}
+	// the modification time is the last use (for pruning)
+	now := time.Now()
+	os.Chtimes(p, now, now)
+	return p
+}
+
+// fetch returns the cached package of key, downloading it from url first
+// when it is not cached yet; hit reports whether no download was needed
+func (c *vsixCache) fetch(key, url string) (path string, hit bool, err error) {
+	if p := c.lookup(key); p != "" {
+		return p, true, nil
+	}
+	part := filepath.Join(c.dir, "partial", key+".part")
+	if err := c.download(url, part); err != nil {
+		return "", false, err
+	}
+	sum := fileHash(part)
+	if sum == "" {
+		return "", false, fmt.Errorf("cannot read %s", part)
+	}
+	obj := c.objectPath(sum)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(obj), 0o755); err != nil {
+		return "", false, err
+	}
+	if exists(obj) {
+		os.Remove(part)
+	} else if err := os.Rename(part, obj); err != nil {
+		return "", false, err
+	}
+	if err := writeBytes(c.refPath(key), []byte(sum+"\n")); err != nil {
+		return "", false, err
+	}
+	return obj, false, nil
+}
+
+// forget drops key, e.g. after the package turned out to be invalid
+func (c *vsixCache) forget(key string) {
+	os.Remove(c.refPath(key))
+}
+
+// resumeDownload GETs url into dst, continuing a partial dst with a Range
+// request; a server that ignores the range sends the whole file again
+func (i *Installer) resumeDownload(url, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	var offset int64
+	if st, err := os.Stat(dst); err == nil {
+		offset = st.Size()
+	}
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := i.doHTTP(downloadClient, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	flags := os.O_CREATE | os.O_WRONLY
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		flags |= os.O_APPEND
+	case http.StatusOK:
+		flags |= os.O_TRUNC
+	case http.StatusRequestedRangeNotSatisfiable:
+		// complete already when the server's size is the partial file's;
+		// otherwise the partial file is stale and fetched again whole
+		if total, ok := strings.CutPrefix(resp.Header.Get("Content-Range"), "bytes */"); ok && total == strconv.FormatInt(offset, 10) {
+			return nil
+		}
+		resp.Body.Close()
+		if err := os.Remove(dst); err != nil {
+			return err
+		}
+		return i.resumeDownload(url, dst)
+	default:
+		return fmt.Errorf("HTTP %s", resp.Status)
+	}
+	out, err := os.OpenFile(dst, flags, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// parallel runs fn for 0..n-1 on up to workers goroutines
+func parallel(n, workers int, fn func(idx int)) {
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				fn(idx)
+			}
+		}()
+	}
+	for idx := 0; idx < n; idx++ {
+		jobs <- idx
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// cacheObject is one stored package with the keys referring to it
+type cacheObject struct {
+	Sum     string
+	Path    string
+	Size    int64
+	Used    time.Time // last use (modification time)
+	Keys    []string
+	Corrupt bool // content does not match its sha256 name
+}
+
+// objects lists the stored packages, least recently used first; with
+// verify each one is hashed. Dangling refs are returned separately.
+func (c *vsixCache) objects(verify bool) ([]*cacheObject, []string, error) {
+	entries, err := os.ReadDir(filepath.Join(c.dir, "objects"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+	bySum := make(map[string]*cacheObject)
+	var res []*cacheObject
+	for _, e := range entries {
+		sum, ok := strings.CutSuffix(e.Name(), ".vsix")
+		fi, ierr := e.Info()
+		if !ok || e.IsDir() || ierr != nil {
+			continue
+		}
+		o := &cacheObject{Sum: sum, Path: filepath.Join(c.dir, "objects", e.Name()), Size: fi.Size(), Used: fi.ModTime()}
+		if verify {
+			o.Corrupt = fileHash(o.Path) != sum
+		}
+		bySum[sum] = o
+		res = append(res, o)
+	}
+	refs, err := os.ReadDir(filepath.Join(c.dir, "refs"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+	var dangling []string
+	for _, r := range refs {
+		b, err := os.ReadFile(filepath.Join(c.dir, "refs", r.Name()))
+		if o, ok := bySum[strings.TrimSpace(string(b))]; err == nil && ok {
+			o.Keys = append(o.Keys, r.Name())
+		} else {
+			dangling = append(dangling, r.Name())
+		}
+	}
+	sort.Slice(res, func(a, b int) bool { return res[a].Used.Before(res[b].Used) })
+	return res, dangling, nil
+}
+
+// remove deletes an object and the keys referring to it
+func (c *vsixCache) remove(o *cacheObject) error {
+	for _, k := range o.Keys {
+		c.forget(k)
+	}
+	return os.Remove(o.Path)
+}
+
+func runCache(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: cache ls | cache prune [--max-size 2G] | cache clear")
+	}
+	sub := args[0]
+	fs, opts := newCommandFlags("cache " + sub)
+	maxSize := fs.String("max-size", "", "prune: evict least recently used packages until the cache is at most this big (e.g. 500M, 2G)")
+	fs.Parse(args[1:])
+
+	inst, err := NewInstaller(*opts)
+	if err != nil {
+		return fmt.Errorf("cannot initialize installer: %w", err)
+	}
+	defer inst.Close()
+
+	switch sub {
+	case "ls", "list":
+		return inst.listCache()
+	case "prune":
+		limit := int64(-1)
+		if *maxSize != "" {
+			if limit, err = parseByteSize(*maxSize); err != nil {
+				return fmt.Errorf("--max-size: %w", err)
+			}
+		}
+		return inst.pruneCache(limit)
+	case "clear":
+		if inst.dryRun {
+			inst.logf("DRY-RUN: would delete %s", inst.cache.dir)
+			return nil
+		}
+		if err := os.RemoveAll(inst.cache.dir); err != nil {
+			return err
+		}
+		inst.logf("Cache cleared: %s", inst.cache.dir)
+		return nil
+	default:
+		return fmt.Errorf("unknown cache command %q (want ls, prune or clear)", sub)
+	}
+}
+
+// listCache prints the stored packages, most recently used first
+func (i *Installer) listCache() error {
+	objs, dangling, err := i.cache.objects(true)
+	if err != nil {
+		return err
+	}
+	if len(objs) == 0 {
+		pterm.Info.Printf("Cache is empty (%s).\n", i.cache.dir)
+		return nil
+	}
+	rows := [][]string{{"Package", "Size", "Last used", "Status"}}
+	var total int64
+	for idx := len(objs) - 1; idx >= 0; idx-- {
+		o := objs[idx]
+		status := "ok"
+		if o.Corrupt {
+			status = "corrupt"
+		}
+		name := strings.Join(o.Keys, ", ")
+		if name == "" {
+			name, status = o.Sum[:12], status+", unreferenced"
+		}
+		rows = append(rows, []string{name, humanBytes(o.Size), o.Used.Local().Format("2006-01-02 15:04"), status})
+		total += o.Size
+	}
+	pterm.DefaultTable.WithHasHeader().WithData(rows).Render()
+	pterm.Info.Printf("%d packages, %s in %s\n", len(objs), humanBytes(total), i.cache.dir)
+	if len(dangling) > 0 {
+		pterm.Warning.Printf("%d entries point at missing packages: %s (`cache prune` removes them)\n", len(dangling), strings.Join(dangling, ", "))
+	}
+	return nil
+}
+
+// pruneCache drops corrupt, unreferenced and stale partial entries and,
+// with limit >= 0, the least recently used packages beyond limit bytes
+func (i *Installer) pruneCache(limit int64) error {
+	objs, dangling, err := i.cache.objects(true)
+	if err != nil {
+		return err
+	}
+	var drop []*cacheObject
+	var keep []*cacheObject
+	var total int64
+	for _, o := range objs {
+		if o.Corrupt || len(o.Keys) == 0 {
+			drop = append(drop, o)
+			continue
+		}
+		keep = append(keep, o)
+		total += o.Size
+	}
+	// keep is least recently used first
+	for len(keep) > 0 && limit >= 0 && total > limit {
+		drop = append(drop, keep[0])
+		total -= keep[0].Size
+		keep = keep[1:]
+	}
+	var freed int64
+	for _, o := range drop {
+		name := strings.Join(o.Keys, ", ")
+		if name == "" {
+			name = o.Sum[:12]
+		}
+		if i.dryRun {
+			i.logf("DRY-RUN: would remove %s (%s)", name, humanBytes(o.Size))
+			continue
+		}
+		if err := i.cache.remove(o); err != nil {
+			i.warnf("cannot remove %s: %v", o.Path, err)
+			continue
+		}
+		freed += o.Size
+		i.logToFile("cache: removed %s (%s)", name, humanBytes(o.Size))
+	}
+	if !i.dryRun {
+		for _, k := range dangling {
+			i.cache.forget(k)
+		}
+		i.cache.dropStalePartials(24 * time.Hour)
+	}
+	i.logf("Cache pruned: %d packages removed, %s freed, %s kept", len(drop), humanBytes(freed), humanBytes(total))
+	return nil
+}
+
+// dropStalePartials removes interrupted downloads older than age
+func (c *vsixCache) dropStalePartials(age time.Duration) {
+	entries, _ := os.ReadDir(filepath.Join(c.dir, "partial"))
+	for _, e := range entries {
+		if fi, err := e.Info(); err == nil && time.Since(fi.ModTime()) > age {
+			os.Remove(filepath.Join(c.dir, "partial", e.Name()))
+		}
+	}
+}
+
+// parseByteSize parses sizes like 2G, 500M, 1.5GB or 1048576
+func parseByteSize(s string) (int64, error) {
+	t := strings.ToUpper(strings.TrimSpace(s))
+	t = strings.TrimSuffix(strings.TrimSuffix(t, "B"), "I")
+	mult := int64(1)
+	if n := len(t); n > 0 {
+		if k := strings.IndexByte("KMGT", t[n-1]); k >= 0 {
+			mult = int64(1) << (10 * (k + 1))
+			t = t[:n-1]
+		}
+	}
+	v, err := strconv.ParseFloat(t, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("bad size %q (want e.g. 500M or 2G)", s)
+	}
+	return int64(v * float64(mult)), nil
+}
@@ -0,0 +1,215 @@
+// cheatsheet.go
+//
+// After keybindings.json is applied, a cheat sheet of the payload's bindings
+// is written next to the log (vscode-keyboard-cheatsheet.md and .html), so
+// new team members can learn the standardized shortcuts. Bindings are
+// grouped by category and described by their comments, as the payload's
+// keybindings.json already has them:
+//
+//   // === 📁 Files and folders ===     <- category, until the next one
+//   { // 📁 New folder                   <- description
+//     "key": "alt+d", "command": "explorer.newFolder" },
+//
+// The manifest's "keyCategories" maps commands (globs allowed) to a category
+// and wins over the comments: {"git.*": "Git", "workbench.action.terminal.*":
+// "Terminal"}. Bindings without a description show their command; removal
+// entries ("-command") are left out.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	cheatSheetName = "vscode-keyboard-cheatsheet"
+	otherCategory  = "Other"
+)
+
+// sectionComment matches a category comment: "// === Title ===" (or ---, ###)
+var sectionComment = regexp.MustCompile(`^//\s*(?:={2,}|-{2,}|#{2,})\s*(.*?)\s*(?:={2,}|-{2,}|#{2,})?\s*$`)
+
+// cheatEntry is one binding of the cheat sheet
+type cheatEntry struct {
+	Category    string
+	Keys        string
+	Description string
+	Command     string
+	When        string
+}
+
+// commentText strips the comment markers
+func commentText(c string) string {
+	c = strings.TrimSpace(c)
+	c = strings.TrimPrefix(c, "//")
+	c = strings.TrimSuffix(strings.TrimPrefix(c, "/*"), "*/")
+	return strings.TrimSpace(c)
+}
+
+// cheatEntries collects the bindings of keybindings.json data with their
+// category and description
+func cheatEntries(data []byte, categories map[string]string) ([]cheatEntry, error) {
+	_, list, err := parseKeybindings(data)
+	if err != nil {
+		return nil, err
+	}
+	patterns := sortedStringKeys(categories)
+	var res []cheatEntry
+	section := ""
+	for _, b := range list {
+		var notes []string
+		for _, l := range b.leading {
+			if m := sectionComment.FindStringSubmatch(l); m != nil {
+				section, notes = m[1], nil
+				continue
+			}
+			notes = append(notes, commentText(l))
+		}
+		if b.cmd == "" || strings.HasPrefix(b.cmd, "-") {
+			continue
+		}
+		e := cheatEntry{Category: section, Keys: b.chord, Command: b.cmd, When: b.when}
+		// the comment right after the opening brace, else after the entry,
+		// else above it
+		if k := jsoncSkipSpace(b.raw, 1); k > 1 {
+			if inner, _ := splitGapComments(b.raw[1:k], true); inner != "" {
+				e.Description = commentText(inner)
+			}
+		}
+		if e.Description == "" && b.trailing != "" {
+			e.Description = commentText(b.trailing)
+		}
+		if e.Description == "" && len(notes) > 0 {
+			e.Description = strings.Join(notes, " ")
+		}
+		for _, p := range patterns {
+			if ok, _ := path.Match(p, b.cmd); ok || p == b.cmd {
+				e.Category = categories[p]
+				break
+			}
+		}
+		if e.Category == "" {
+			e.Category = otherCategory
+		}
+		res = append(res, e)
+	}
+	return res, nil
+}
+
+// cheatCategories returns the categories in order of first appearance
+func cheatCategories(entries []cheatEntry) []string {
+	var res []string
+	for _, e := range entries {
+		if !containsString(res, e.Category) {
+			res = append(res, e.Category)
+		}
+	}
+	// "Other" goes last
+	sort.SliceStable(res, func(a, b int) bool { return res[b] == otherCategory && res[a] != otherCategory })
+	return res
+}
+
+// displayKeys renders a chord for people: "ctrl+k ctrl+s" -> "Ctrl+K Ctrl+S"
+func displayKeys(chord string) string {
+	parts := strings.Fields(chord)
+	for n, p := range parts {
+		mods := strings.Split(p, "+")
+		for k, m := range mods {
+			if m != "" {
+				mods[k] = strings.ToUpper(m[:1]) + m[1:]
+			}
+		}
+		parts[n] = strings.Join(mods, "+")
+	}
+	return strings.Join(parts, " ")
+}
+
+func (e cheatEntry) action() string {
+	if e.Description != "" {
+		return e.Description
+	}
+	return e.Command
+}
+
+// cheatSheetMarkdown renders the cheat sheet as Markdown
+func cheatSheetMarkdown(entries []cheatEntry) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("# Keyboard shortcuts\n")
+	for _, cat := range cheatCategories(entries) {
+		fmt.Fprintf(&buf, "\n## %s\n\n| Keys | Action | Command |\n|---|---|---|\n", cat)
+		for _, e := range entries {
+			if e.Category == cat {
+				fmt.Fprintf(&buf, "| `%s` | %s | `%s` |\n", displayKeys(e.Keys), strings.ReplaceAll(e.action(), "|", `\|`), e.Command)
+			}
+		}
+	}
+	return buf.Bytes()
+}
+
+// cheatSheetHTML renders the cheat sheet as a standalone HTML page
+func cheatSheetHTML(entries []cheatEntry) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Keyboard shortcuts</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+td, th { border: 1px solid #ccc; padding: .3em .6em; text-align: left; }
+kbd { background: #eee; border: 1px solid #bbb; border-radius: 3px; padding: 0 .3em; }
+code { color: #666; }
+</style></head><body>
+<h1>Keyboard shortcuts</h1>
+`)
+	for _, cat := range cheatCategories(entries) {
+		fmt.Fprintf(&buf, "<h2>%s</h2>\n<table>\n<tr><th>Keys</th><th>Action</th><th>Command</th></tr>\n", html.EscapeString(cat))
+		for _, e := range entries {
+			if e.Category != cat {
+				continue
+			}
+			var keys []string
+			for _, p := range strings.Fields(displayKeys(e.Keys)) {
+				keys = append(keys, "<kbd>"+html.EscapeString(p)+"</kbd>")
+			}
+			fmt.Fprintf(&buf, "<tr><td>%s</td><td>%s</td><td><code>%s</code></td></tr>\n",
+				strings.Join(keys, " "), html.EscapeString(e.action()), html.EscapeString(e.Command))
+		}
+		buf.WriteString("</table>\n")
+	}
+	buf.WriteString("</body></html>\n")
+	return buf.Bytes()
+}
+
+// writeCheatSheet writes the cheat sheets of the payload's keybindings next
+// to the log
+func (i *Installer) writeCheatSheet() {
+	if len(i.keybindData) == 0 {
+		return
+	}
+	entries, err := cheatEntries(i.keybindData, i.manifest.KeyCategories)
+	if err != nil {
+		i.warnf("cannot build the keyboard cheat sheet: %v", err)
+		return
+	}
+	if len(entries) == 0 {
+		return
+	}
+	base := filepath.Join(filepath.Dir(i.logPath), cheatSheetName)
+	if i.dryRun {
+		i.logf("DRY-RUN: would write the keyboard cheat sheet to %s.md/.html", base)
+		return
+	}
+	for ext, data := range map[string][]byte{".md": cheatSheetMarkdown(entries), ".html": cheatSheetHTML(entries)} {
+		if err := writeBytes(base+ext, data); err != nil {
+			i.warnf("cannot write %s: %v", base+ext, err)
+			return
+		}
+	}
+	i.logf("Keyboard cheat sheet (%d bindings): %s.md, %s.html", len(entries), base, base)
+}
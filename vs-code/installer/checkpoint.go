@@ -0,0 +1,138 @@
+// checkpoint.go
+//
+// Step checkpoints. The major steps of an apply run — backup, settings,
+// keybindings, extensions — are recorded in state.json as they complete
+// (a step that logged an error is not complete), one checkpoint per target
+// (user dir), so the editors of a matrix run keep their own. A run that
+// fails or is killed leaves its checkpoint behind; the next run on the same
+// target with the same payload resumes: the completed steps are skipped,
+// the others run again. A successful run clears the checkpoint, a
+// rolled-back one (--strict, --transaction) drops it. --from-step <step>
+// starts at that step whatever the checkpoint says, e.g. --from-step
+// extensions after a flaky network.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// checkpointed steps, in run order
+const (
+	stepBackup      = "backup"
+	stepSettings    = "settings"
+	stepKeybindings = "keybindings"
+	stepExtensions  = "extensions"
+)
+
+var runSteps = []string{stepBackup, stepSettings, stepKeybindings, stepExtensions}
+
+// Checkpoint records the completed steps of an unfinished run
+type Checkpoint struct {
+	Target      string    `json:"target"`
+	PayloadHash string    `json:"payloadHash"`
+	Started     time.Time `json:"started"`
+	Done        []string  `json:"done,omitempty"`
+}
+
+// parseStep validates a --from-step value
+func parseStep(s string) (string, error) {
+	if s == "" || containsString(runSteps, s) {
+		return s, nil
+	}
+	return "", fmt.Errorf("unknown step %q (want %s)", s, strings.Join(runSteps, ", "))
+}
+
+// beginCheckpoint decides which steps this run skips (before --from-step,
+// or completed by the interrupted run) and starts the run's checkpoint
+func (i *Installer) beginCheckpoint() {
+	st, err := i.loadState()
+	if err != nil {
+		i.warnf("cannot read checkpoint: %v", err)
+	}
+	var done []string
+	switch prev := st.Checkpoints[i.vscodeUser]; {
+	case i.fromStep != "":
+		for _, s := range runSteps {
+			if s == i.fromStep {
+				break
+			}
+			done = append(done, s)
+		}
+		i.logf("Starting at step %s: skipping %s", i.fromStep, orNone(done))
+	case prev != nil && prev.Target == i.vscodeUser && prev.PayloadHash == i.payloadHash() && len(prev.Done) > 0:
+		done = prev.Done
+		i.logf("Resuming the run of %s: %s already done", prev.Started.Local().Format(time.RFC3339), strings.Join(done, ", "))
+	}
+	i.skipSteps = done
+	i.saveCheckpoint(&Checkpoint{Target: i.vscodeUser, PayloadHash: i.payloadHash(), Started: time.Now(), Done: done})
+}
+
+func orNone(list []string) string {
+	if len(list) == 0 {
+		return "nothing"
+	}
+	return strings.Join(list, ", ")
+}
+
+// skipStep reports whether step was done before this run started
+func (i *Installer) skipStep(step string) bool {
+	return containsString(i.skipSteps, step)
+}
+
+// stepMark is the error state at the start of a step
+type stepMark struct {
+	errors int64
+	status int
+}
+
+func (i *Installer) markStep() stepMark {
+	return stepMark{i.errorCount.Load(), i.failureStatus()}
+}
+
+// stepDone records step as completed if it logged no error since m
+func (i *Installer) stepDone(step string, m stepMark) {
+	if i.errorCount.Load() != m.errors || i.failureStatus() != m.status {
+		return
+	}
+	if err := i.updateState(func(st *State) {
+		if c := st.Checkpoints[i.vscodeUser]; c != nil && !containsString(c.Done, step) {
+			c.Done = append(c.Done, step)
+		}
+	}); err != nil {
+		i.warnf("cannot record step %s: %v", step, err)
+	}
+}
+
+// clearCheckpoint drops the checkpoint: the run finished or was undone
+func (i *Installer) clearCheckpoint() {
+	i.saveCheckpoint(nil)
+}
+
+// saveCheckpoint stores c as the checkpoint of this run's target, nil drops it
+func (i *Installer) saveCheckpoint(c *Checkpoint) {
+	if err := i.updateState(func(st *State) {
+		if c == nil {
+			delete(st.Checkpoints, i.vscodeUser)
+			return
+		}
+		if st.Checkpoints == nil {
+			st.Checkpoints = make(map[string]*Checkpoint)
+		}
+		st.Checkpoints[i.vscodeUser] = c
+	}); err != nil {
+		i.warnf("cannot save checkpoint: %v", err)
+	}
+}
+
+// endCheckpoint drops the checkpoint of a run that ended without errors;
+// otherwise it stays for the next run to resume from
+func (i *Installer) endCheckpoint() {
+	if i.errorCount.Load() == 0 && i.failureStatus() == exitOK {
+		i.clearCheckpoint()
+		return
+	}
+	i.logf("Run incomplete — the next run resumes after the completed steps (--from-step %s to start over)", stepBackup)
+}
@@ -0,0 +1,137 @@
+// commands.go
+//
+// Subcommand dispatch. The first non-flag argument selects a subcommand,
+// everything after it is parsed by the subcommand's own FlagSet (shared
+// switches such as --yes/--dry-run/--src are registered via Options.bind).
+// Without a subcommand the classic interactive apply flow from main() runs.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// subcommand describes one entry of the command table
+type subcommand struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+// commandTable lists all subcommands in the order they are shown in --help.
+// It is a function (not a package var) so commands may print usage themselves.
+func commandTable() []subcommand {
+	return []subcommand{
+		{"apply", "apply the payload (same as running without a command)", runApply},
+		{"update", "list outdated extensions, optionally update the curated ones (--apply)", runUpdate},
+		{"search", "search the registry: search [--add-to extensions.txt] <query>", runSearch},
+		{"plan", "show what apply would change (file diffs, extensions to add/remove) without prompting", runPlan},
+		{"verify", "report drift from the payload (files, keys, extensions); non-zero exit on drift", runVerify},
+		{"status", "per-target health check: last apply, payload, extensions, file drift", runStatus},
+		{"install-service", "schedule a periodic `apply --silent` (systemd timer / launchd / Scheduled Task)", runInstallService},
+		{"pack", "build a self-contained installer: pack --data <dir> --out <file>", runPack},
+		{"bundle", "offline installs: bundle create [--out f.zip] | bundle apply <f.zip>", runBundle},
+		{"serve", "local REST API for frontends: serve [--listen 127.0.0.1:7777] (apply/verify/status jobs, SSE progress)", runServe},
+		{"serve-mirror", "serve a folder of .vsix over HTTP for --marketplace-url on the LAN", runServeMirror},
+		{"self-test", "validate the embedded payload and presets, run the merge engines against golden fixtures, check platform paths", runSelfTest},
+		{"fake-code", "test double of the editor CLI with scripted install outcomes: fake-code init <dir> [--outcome <id>=failure]; use with " + fakeCodeEnv + "=<dir>", runFakeCode},
+		{"version", "binary version, build date, Go version, payload source and hashes", runVersion},
+		{"lint", "report deprecated / renamed settings in the payload and your settings.json; --fix migrates them", runLint},
+		{"new", "scaffold a project's .vscode/ from an embedded template: new <template> <dir>", runNew},
+		{"workspace", "write the manifest's multi-root .code-workspace files: workspace [<name>...]", runWorkspace},
+		{"recommend", "add the extension list to projects' .vscode/extensions.json: recommend [<dir>...]", runRecommend},
+		{"keybindings", "review keyboard changes: keybindings diff [--output json]", runKeybindings},
+		{"export", "export --keybindings [--data <dir>] into the payload | export --devcontainer [--out <file>]", runExport},
+		{"facts", "detected machine facts used by conditional settings (vm, scale, session, ...)", runFacts},
+		{"cache", "download cache: cache ls | cache prune [--max-size 2G] | cache clear", runCache},
+		{"agent", "poll a payload URL and apply new versions: agent --url <https://...zip> [--interval 15m] [--report-url <url>] [--once]", runAgent},
+		{"fleet", "run apply on SSH hosts: fleet apply --hosts hosts.yaml [--parallel 4] [--out <dir>]", runFleet},
+		{"bootstrap", "non-interactive apply for dotfiles install hooks (Codespaces, dev containers): no backup, no pauses", runBootstrap},
+		{"backup", "inspect backups: backup list | backup show <ts> | backup diff <tsA> [<tsB>|--payload]", runBackup},
+	}
+}
+
+func runApply(args []string) error {
+	fs, opts := newCommandFlags("apply")
+	fs.Parse(args)
+	if code := apply(*opts); code != exitOK {
+		return exitCodeError{code}
+	}
+	return nil
+}
+
+// exitCodeError ends a subcommand with its exit code; the command has
+// reported the failure already, so main prints nothing more
+type exitCodeError struct {
+	code int
+}
+
+func (e exitCodeError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
+func runSubcommand(name string, args []string) error {
+	for _, c := range commandTable() {
+		if c.name == name {
+			return c.run(args)
+		}
+	}
+	usage()
+	return fmt.Errorf("unknown command %q", name)
+}
+
+// usage prints top-level help: apply flags plus the subcommand list
+func usage() {
+	prog := filepath.Base(os.Args[0])
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage:\n  %s [flags]            apply payload (interactive)\n  %s <command> [flags]  run a subcommand\n\n", prog, prog)
+	fmt.Fprintln(out, "Commands:")
+	for _, c := range commandTable() {
+		fmt.Fprintf(out, "  %-12s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(out, "\nFlags:")
+	flag.PrintDefaults()
+}
+
+// newCommandFlags creates a FlagSet for a subcommand with the shared switches bound
+func newCommandFlags(name string) (*flag.FlagSet, *Options) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	opts := &Options{}
+	opts.bind(fs)
+	return fs, opts
+}
+
+// parseInterspersed parses args allowing flags after positional arguments
+// ("backup diff <ts> --payload") and returns the positional ones
+func parseInterspersed(fs *flag.FlagSet, args []string) []string {
+	var pos []string
+	for {
+		fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			return pos
+		}
+		pos = append(pos, args[0])
+		args = args[1:]
+	}
+}
+
+// openInstaller builds an Installer for a subcommand and loads the payload.
+// Payload errors are logged but not fatal, same as in the apply flow.
+func openInstaller(opts *Options) (*Installer, error) {
+	inst, err := NewInstaller(*opts)
+	if err != nil {
+		return nil, fmt.Errorf("cannot initialize installer: %w", err)
+	}
+	if err := inst.preparePayloads(); err != nil {
+		inst.errorf("Failed to prepare payloads: %v", err)
+	}
+	if err := inst.loadVSIXDir(); err != nil {
+		inst.errorf("%v", err)
+	}
+	inst.applyBlocklist()
+	return inst, nil
+}
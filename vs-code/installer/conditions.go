@@ -0,0 +1,140 @@
+// conditions.go
+//
+// Conditional settings from the manifest, merged into the settings payload
+// only when their condition holds for the detected facts (facts.go):
+//
+//   "conditionalSettings": [
+//     {"when": "vm", "settings": {"terminal.integrated.gpuAcceleration": "off"}},
+//     {"when": "scale > 1 && os == linux", "settings": {"window.zoomLevel": 1}}
+//   ]
+//
+// A condition is a fact name (true when the fact is "true"), !fact, or a
+// comparison fact OP value with OP one of == != > >= < <= (numeric when
+// both sides are numbers); clauses combine with && and ||, && binding
+// tighter. Blocks are applied in manifest order after the settings
+// fragments and before --set, so a later block and the command line win.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ConditionalSettings is one "conditionalSettings" entry of the manifest
+type ConditionalSettings struct {
+	When     string                     `json:"when"`
+	Settings map[string]json.RawMessage `json:"settings"`
+}
+
+// conditionOps are the comparison operators, two-character ones first
+var conditionOps = []string{"==", "!=", ">=", "<=", ">", "<"}
+
+// evalCondition evaluates a condition against facts
+func evalCondition(cond string, facts map[string]string) (bool, error) {
+	if strings.TrimSpace(cond) == "" {
+		return false, fmt.Errorf("empty condition")
+	}
+	for _, alt := range strings.Split(cond, "||") {
+		all := true
+		for _, clause := range strings.Split(alt, "&&") {
+			ok, err := evalClause(strings.TrimSpace(clause), facts)
+			if err != nil {
+				return false, err
+			}
+			all = all && ok
+		}
+		if all {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// evalClause evaluates one fact, !fact or comparison
+func evalClause(clause string, facts map[string]string) (bool, error) {
+	for _, op := range conditionOps {
+		name, want, ok := strings.Cut(clause, op)
+		if !ok {
+			continue
+		}
+		name, want = strings.TrimSpace(name), strings.Trim(strings.TrimSpace(want), `"'`)
+		got, known := facts[name]
+		if !known {
+			return false, fmt.Errorf("unknown fact %q", name)
+		}
+		return compareFact(got, op, want)
+	}
+	name := strings.TrimSpace(strings.TrimPrefix(clause, "!"))
+	got, known := facts[name]
+	if name == "" || !known {
+		return false, fmt.Errorf("unknown fact %q", name)
+	}
+	return (got == "true") != strings.HasPrefix(clause, "!"), nil
+}
+
+// compareFact compares a fact value with op; ordering needs numbers
+func compareFact(got, op, want string) (bool, error) {
+	g, errG := strconv.ParseFloat(got, 64)
+	w, errW := strconv.ParseFloat(want, 64)
+	numeric := errG == nil && errW == nil
+	switch op {
+	case "==":
+		return got == want || numeric && g == w, nil
+	case "!=":
+		return !(got == want || numeric && g == w), nil
+	}
+	if !numeric {
+		return false, fmt.Errorf("%s %s %s: not numbers", got, op, want)
+	}
+	switch op {
+	case ">":
+		return g > w, nil
+	case ">=":
+		return g >= w, nil
+	case "<":
+		return g < w, nil
+	default:
+		return g <= w, nil
+	}
+}
+
+// applyConditionalSettings merges the manifest's conditional settings whose
+// condition holds into the settings payload
+func (i *Installer) applyConditionalSettings() error {
+	if len(i.manifest.ConditionalSettings) == 0 {
+		return nil
+	}
+	data := i.settingsData
+	applied := 0
+	for n, c := range i.manifest.ConditionalSettings {
+		ok, err := evalCondition(c.When, i.facts())
+		if err != nil {
+			return fmt.Errorf("%s: conditionalSettings[%d] %q: %w", manifestFile, n, c.When, err)
+		}
+		if !ok {
+			i.logToFile("condition %q does not hold, %d settings skipped", c.When, len(c.Settings))
+			continue
+		}
+		keys := make([]string, 0, len(c.Settings))
+		for k := range c.Settings {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if data, err = setSettingsKey(data, k, c.Settings[k]); err != nil {
+				return fmt.Errorf("%s: conditionalSettings[%d]: %s: %w", manifestFile, n, k, err)
+			}
+		}
+		applied += len(keys)
+		i.logf("Condition %q holds: %s", c.When, strings.Join(keys, ", "))
+	}
+	i.settingsData = data
+	if applied > 0 {
+		i.logToFile("applied %d conditional settings", applied)
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+// crypt.go
+//
+// Encrypted backups (--encrypt-backup). Settings of some extensions hold
+// tokens, so backups written to shared locations can be sealed: the archive
+// backup (see archive.go) is built in memory and stored as
+// backup_<ts>.tar.gz.enc, encrypted with AES-256-GCM under a key derived by
+// PBKDF2-SHA256 from a passphrase. The passphrase comes from
+// --backup-key-file, $HYPREDITORS_BACKUP_PASSPHRASE or an interactive prompt.
+//
+// File layout: "HYPRENC1" | salt (16) | nonce (12) | ciphertext+tag
+
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+const (
+	encryptedSuffix     = ".enc"
+	backupPassphraseEnv = "HYPREDITORS_BACKUP_PASSPHRASE"
+	pbkdf2Iterations    = 600000
+	encSaltLen          = 16
+)
+
+var encMagic = []byte("HYPRENC1")
+
+func isEncryptedPath(p string) bool {
+	return strings.HasSuffix(p, encryptedSuffix)
+}
+
+func backupAEAD(pass string, salt []byte) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, pass, salt, pbkdf2Iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptBackupData seals plain with a fresh salt and nonce
+func encryptBackupData(plain []byte, pass string) ([]byte, error) {
+	salt := make([]byte, encSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	aead, err := backupAEAD(pass, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := append(append(append([]byte{}, encMagic...), salt...), nonce...)
+	// the header is authenticated too, so a tampered salt/nonce fails to open
+	return aead.Seal(out, nonce, plain, out), nil
+}
+
+// decryptBackupData reverses encryptBackupData
+func decryptBackupData(data []byte, pass string) ([]byte, error) {
+	if !bytes.HasPrefix(data, encMagic) {
+		return nil, errors.New("not an encrypted backup")
+	}
+	if len(data) < len(encMagic)+encSaltLen {
+		return nil, errors.New("encrypted backup is truncated")
+	}
+	salt := data[len(encMagic) : len(encMagic)+encSaltLen]
+	aead, err := backupAEAD(pass, salt)
+	if err != nil {
+		return nil, err
+	}
+	hdrLen := len(encMagic) + encSaltLen + aead.NonceSize()
+	if len(data) < hdrLen+aead.Overhead() {
+		return nil, errors.New("encrypted backup is truncated")
+	}
+	plain, err := aead.Open(nil, data[len(encMagic)+encSaltLen:hdrLen], data[hdrLen:], data[:hdrLen])
+	if err != nil {
+		return nil, errors.New("wrong passphrase or corrupted backup")
+	}
+	return plain, nil
+}
+
+// backupPassphrase returns the passphrase for encrypting (confirm=true asks
+// twice when prompting) or decrypting backups; it is asked for once per run
+func (i *Installer) backupPassphrase(confirm bool) (string, error) {
+	if i.backupPass != "" {
+		return i.backupPass, nil
+	}
+	switch {
+	case i.backupKeyFile != "":
+		b, err := os.ReadFile(i.backupKeyFile)
+		if err != nil {
+			return "", fmt.Errorf("cannot read backup key file: %w", err)
+		}
+		i.backupPass = strings.TrimRight(string(b), "\r\n")
+	case os.Getenv(backupPassphraseEnv) != "":
+		i.backupPass = os.Getenv(backupPassphraseEnv)
+	default:
+		fd := int(os.Stdin.Fd())
+		if i.silent || !term.IsTerminal(fd) {
+			return "", fmt.Errorf("backup passphrase required: use --backup-key-file or $%s", backupPassphraseEnv)
+		}
+		fmt.Print("Пароль для бэкапа: ")
+		p1, err := term.ReadPassword(fd)
+		fmt.Println()
+		if err != nil {
+			return "", err
+		}
+		if confirm {
+			fmt.Print("Повторите пароль: ")
+			p2, err := term.ReadPassword(fd)
+			fmt.Println()
+			if err != nil {
+				return "", err
+			}
+			if !bytes.Equal(p1, p2) {
+				return "", errors.New("passphrases do not match")
+			}
+		}
+		i.backupPass = string(p1)
+	}
+	if i.backupPass == "" {
+		return "", errors.New("backup passphrase is empty")
+	}
+	return i.backupPass, nil
+}
+
+// writeEncryptedBackup builds the archive in memory and stores it encrypted,
+// so no plaintext copy ever touches the backup location
+func (i *Installer) writeEncryptedBackup(path string, entries []backupEntry) error {
+	pass, err := i.backupPassphrase(true)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	inner := strings.TrimSuffix(path, encryptedSuffix)
+	if err := encodeBackupArchive(&buf, strings.HasSuffix(inner, ".zip"), entries); err != nil {
+		return err
+	}
+	sealed, err := encryptBackupData(buf.Bytes(), pass)
+	if err != nil {
+		return err
+	}
+	if err := writeBytes(path, sealed); err != nil {
+		return err
+	}
+	i.logf("backup: %d files -> %s (encrypted)", len(entries), path)
+	return nil
+}
+
+// readEncryptedInfo describes an encrypted backup without decrypting it;
+// the file list stays empty until the backup is opened
+func readEncryptedInfo(path string) (backupInfo, error) {
+	name := strings.TrimSuffix(filepath.Base(path), encryptedSuffix)
+	name = strings.TrimSuffix(strings.TrimSuffix(name, ".zip"), ".tar.gz")
+	b := backupInfo{Name: strings.TrimPrefix(name, backupPrefix), Path: path, Format: backupFormatEncrypted}
+	st, err := os.Stat(path)
+	if err != nil {
+		return b, err
+	}
+	b.Size = st.Size()
+	b.Time = parseBackupTime(b.Name, path)
+	return b, nil
+}
+
+// readEncryptedFiles decrypts an encrypted backup and returns its files
+func (i *Installer) readEncryptedFiles(path string) (map[string][]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pass, err := i.backupPassphrase(false)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := decryptBackupData(data, pass)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	files, _, err := decodeBackupArchive(strings.TrimSuffix(path, encryptedSuffix), plain)
+	return files, err
+}
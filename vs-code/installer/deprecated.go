@@ -0,0 +1,244 @@
+// deprecated.go
+//
+// `lint` subcommand: a small catalog of renamed and deprecated VS Code /
+// extension settings, checked against the payload and the user's
+// settings.json. Renamed keys (python.pythonPath → python.defaultInterpreterPath,
+// telemetry.enableTelemetry → telemetry.telemetryLevel with its values
+// mapped, ...) can be migrated automatically with `lint --fix`; settings
+// without a direct replacement (python.linting.*) are reported with a hint.
+// Apply warns about the same findings without changing anything.
+//
+// lint exits non-zero when findings remain, like verify on drift.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/pterm/pterm"
+)
+
+// deprecation is one catalog rule
+type deprecation struct {
+	Key    string            // key or glob pattern
+	NewKey string            // replacement key, "" = no direct replacement
+	Values map[string]string // old JSON value -> new JSON value, when the type changed
+	Hint   string
+}
+
+// deprecatedSettings is the rules catalog
+var deprecatedSettings = []deprecation{
+	{Key: "python.pythonPath", NewKey: "python.defaultInterpreterPath"},
+	{Key: "python.linting.*", Hint: "linting moved to the Pylint / Flake8 / Mypy / Ruff extensions and their own settings (pylint.args, flake8.args, ...)"},
+	{Key: "python.formatting.*", Hint: `formatting moved to the Black / autopep8 / Ruff extensions: set "[python]": {"editor.defaultFormatter": ...}`},
+	{Key: "python.sortImports.*", Hint: "use the isort extension (isort.args)"},
+	{Key: "editor.renderIndentGuides", NewKey: "editor.guides.indentation"},
+	{Key: "editor.highlightActiveIndentGuide", NewKey: "editor.guides.highlightActiveIndentation"},
+	{Key: "editor.lightbulb.enabled", NewKey: "editor.lightbulb.enabled", Values: map[string]string{"true": `"onCode"`, "false": `"off"`}},
+	{Key: "workbench.editor.showTabs", NewKey: "workbench.editor.showTabs", Values: map[string]string{"true": `"multiple"`, "false": `"none"`}},
+	{Key: "telemetry.enableTelemetry", NewKey: "telemetry.telemetryLevel", Values: map[string]string{"true": `"all"`, "false": `"off"`}},
+	{Key: "telemetry.enableCrashReporter", Hint: `use telemetry.telemetryLevel ("crash" / "off")`},
+	{Key: "terminal.integrated.shell.*", Hint: "use terminal.integrated.defaultProfile.<os> and terminal.integrated.profiles.<os>"},
+	{Key: "terminal.integrated.shellArgs.*", Hint: "use the args of a terminal.integrated.profiles.<os> entry"},
+	{Key: "workbench.experimental.settingsProfiles.enabled", Hint: "profiles are always available; remove the setting"},
+	{Key: "go.useLanguageServer", Hint: "gopls is always used; remove the setting"},
+}
+
+// lintFinding is one deprecated setting found in a file
+type lintFinding struct {
+	File   string
+	Key    string
+	NewKey string // migrated or suggested replacement
+	Hint   string
+	Fixed  bool
+}
+
+func (f lintFinding) advice() string {
+	if f.NewKey != "" && f.NewKey != f.Key {
+		return "→ " + f.NewKey
+	}
+	if f.NewKey != "" {
+		return "new value format"
+	}
+	return f.Hint
+}
+
+// matchDeprecation returns the rule for key and whether it applies to value
+// (rules with a value map apply to the old values only)
+func matchDeprecation(key string, value []byte) (deprecation, bool) {
+	for _, r := range deprecatedSettings {
+		if ok, _ := path.Match(r.Key, key); !ok {
+			continue
+		}
+		if r.Values != nil {
+			var buf bytes.Buffer
+			if json.Compact(&buf, stripJSONC(value)) != nil {
+				return r, false
+			}
+			if _, old := r.Values[buf.String()]; !old {
+				return r, false
+			}
+		}
+		return r, true
+	}
+	return deprecation{}, false
+}
+
+// lintSettings checks the top-level keys of a settings file; with fix the
+// renamed keys are migrated and the new data returned
+func lintSettings(name string, data []byte, fix bool) ([]lintFinding, []byte, error) {
+	members, _, _, err := jsoncMembers(data)
+	if err != nil {
+		return nil, data, fmt.Errorf("%s: %w", name, err)
+	}
+	have := make(map[string]bool, len(members))
+	for _, m := range members {
+		have[m.Key] = true
+	}
+	var res []lintFinding
+	out := data
+	for _, m := range members {
+		value := data[m.ValueStart:m.End]
+		r, ok := matchDeprecation(m.Key, value)
+		if !ok {
+			continue
+		}
+		f := lintFinding{File: name, Key: m.Key, NewKey: r.NewKey, Hint: r.Hint}
+		if fix && r.NewKey != "" {
+			if r.Values != nil {
+				var buf bytes.Buffer
+				json.Compact(&buf, stripJSONC(value))
+				value = []byte(r.Values[buf.String()])
+			}
+			if r.NewKey != m.Key {
+				if out, _, err = jsoncDelete(out, m.Key); err != nil {
+					return nil, data, err
+				}
+			}
+			// an explicitly set replacement wins over the migrated value
+			if r.NewKey == m.Key || !have[r.NewKey] {
+				if out, err = jsoncSet(out, r.NewKey, value); err != nil {
+					return nil, data, err
+				}
+			}
+			f.Fixed = true
+		}
+		res = append(res, f)
+	}
+	return res, out, nil
+}
+
+func runLint(args []string) error {
+	fs, opts := newCommandFlags("lint")
+	fix := fs.Bool("fix", false, "Migrate renamed settings in your settings.json (and the --src payload files)")
+	fs.Parse(args)
+
+	inst, err := openInstaller(opts)
+	if err != nil {
+		return err
+	}
+	defer inst.Close()
+
+	findings, err := inst.lint(*fix)
+	if err != nil {
+		return err
+	}
+	if len(findings) == 0 {
+		pterm.Success.Println("No deprecated settings found.")
+		return nil
+	}
+	rows := [][]string{{"File", "Setting", "Advice", ""}}
+	open := 0
+	for _, f := range findings {
+		state := "deprecated"
+		if f.Fixed {
+			state = "migrated"
+		} else {
+			open++
+		}
+		rows = append(rows, []string{f.File, f.Key, f.advice(), state})
+	}
+	pterm.DefaultTable.WithHasHeader().WithData(rows).Render()
+	if open > 0 {
+		if !*fix {
+			pterm.Info.Println("Renamed settings can be migrated with `lint --fix`.")
+		}
+		return errors.New("deprecated settings found")
+	}
+	return nil
+}
+
+// lint checks the payload and the user's settings.json; with fix the user's
+// file and, for a --src payload, its settings files on disk are migrated
+func (i *Installer) lint(fix bool) ([]lintFinding, error) {
+	var res []lintFinding
+	files := []string{filepath.Join(i.vscodeUser, settingsFile)}
+	if !i.useEmbedded {
+		files = append(files, filepath.Join(i.baseDir, settingsFile))
+		for _, dir := range fragmentDirs {
+			frags, _ := filepath.Glob(filepath.Join(i.baseDir, dir, "*.json"))
+			files = append(files, frags...)
+		}
+	} else if len(i.settingsData) > 0 {
+		// embedded payloads cannot be fixed in place, only reported
+		found, _, err := lintSettings("payload/"+settingsFile, i.settingsData, false)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, found...)
+	}
+
+	for _, p := range files {
+		data, err := os.ReadFile(p)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		found, out, err := lintSettings(p, data, fix)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case !fix || bytes.Equal(out, data):
+		case i.dryRun:
+			i.logf("DRY-RUN: would migrate deprecated settings in %s", p)
+			for k := range found {
+				found[k].Fixed = false
+			}
+		default:
+			if err := i.safeWrite(p, i.formatSettings(out)); err != nil {
+				return nil, fmt.Errorf("cannot write %s: %w", p, err)
+			}
+			i.logf("Migrated deprecated settings in %s", p)
+		}
+		res = append(res, found...)
+	}
+	return res, nil
+}
+
+// warnDeprecated warns about deprecated settings in the payload and the
+// user's settings.json
+func (i *Installer) warnDeprecated() {
+	var found []lintFinding
+	if len(i.settingsData) > 0 {
+		found, _, _ = lintSettings("payload", i.settingsData, false)
+	}
+	if live, err := os.ReadFile(filepath.Join(i.vscodeUser, settingsFile)); err == nil {
+		more, _, _ := lintSettings("your "+settingsFile, live, false)
+		found = append(found, more...)
+	}
+	for _, f := range found {
+		i.warnf("%s: %s is deprecated (%s)", f.File, f.Key, f.advice())
+	}
+	if len(found) > 0 {
+		i.logf("Run `lint --fix` to migrate renamed settings.")
+	}
+}
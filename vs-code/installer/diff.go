@@ -0,0 +1,169 @@
+// diff.go
+//
+// Minimal line-based unified diff for showing config changes. Editor config
+// files are a few hundred lines, so a plain LCS table is fast enough.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pterm/pterm"
+)
+
+const (
+	diffContext  = 3    // unchanged lines shown around each change
+	diffMaxLines = 5000 // larger inputs are reported as "differ" only
+)
+
+type diffOp struct {
+	kind byte // ' ', '-', '+'
+	text string
+}
+
+// splitLines splits text into lines without the trailing empty line
+func splitLines(s string) []string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines computes the edit script turning a into b
+func diffLines(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	lcs := make([][]int, n+1)
+	for k := range lcs {
+		lcs[k] = make([]int, m+1)
+	}
+	for x := n - 1; x >= 0; x-- {
+		for y := m - 1; y >= 0; y-- {
+			if a[x] == b[y] {
+				lcs[x][y] = lcs[x+1][y+1] + 1
+			} else if lcs[x+1][y] >= lcs[x][y+1] {
+				lcs[x][y] = lcs[x+1][y]
+			} else {
+				lcs[x][y] = lcs[x][y+1]
+			}
+		}
+	}
+	var ops []diffOp
+	x, y := 0, 0
+	for x < n && y < m {
+		switch {
+		case a[x] == b[y]:
+			ops = append(ops, diffOp{' ', a[x]})
+			x++
+			y++
+		case lcs[x+1][y] >= lcs[x][y+1]:
+			ops = append(ops, diffOp{'-', a[x]})
+			x++
+		default:
+			ops = append(ops, diffOp{'+', b[y]})
+			y++
+		}
+	}
+	for ; x < n; x++ {
+		ops = append(ops, diffOp{'-', a[x]})
+	}
+	for ; y < m; y++ {
+		ops = append(ops, diffOp{'+', b[y]})
+	}
+	return ops
+}
+
+// unifiedDiff returns a unified diff of a and b, or "" when they are equal
+func unifiedDiff(aName, bName, a, b string) string {
+	if a == b {
+		return ""
+	}
+	al, bl := splitLines(a), splitLines(b)
+	if len(al) > diffMaxLines || len(bl) > diffMaxLines {
+		return fmt.Sprintf("Files %s and %s differ\n", aName, bName)
+	}
+	ops := diffLines(al, bl)
+
+	// 1-based line numbers in a and b at each op
+	aLine := make([]int, len(ops)+1)
+	bLine := make([]int, len(ops)+1)
+	an, bn := 1, 1
+	for k, op := range ops {
+		aLine[k], bLine[k] = an, bn
+		if op.kind != '+' {
+			an++
+		}
+		if op.kind != '-' {
+			bn++
+		}
+	}
+	var changes []int
+	for k, op := range ops {
+		if op.kind != ' ' {
+			changes = append(changes, k)
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", aName, bName)
+	for c := 0; c < len(changes); {
+		// changes closer than 2*diffContext unchanged lines share a hunk
+		first, last := changes[c], changes[c]
+		for c+1 < len(changes) && changes[c+1]-last <= 2*diffContext+1 {
+			c++
+			last = changes[c]
+		}
+		c++
+		start := first - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := last + diffContext + 1
+		if end > len(ops) {
+			end = len(ops)
+		}
+		na, nb := 0, 0
+		for _, op := range ops[start:end] {
+			if op.kind != '+' {
+				na++
+			}
+			if op.kind != '-' {
+				nb++
+			}
+		}
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", hunkStart(aLine[start], na), na, hunkStart(bLine[start], nb), nb)
+		for _, op := range ops[start:end] {
+			sb.WriteByte(op.kind)
+			sb.WriteString(op.text)
+			sb.WriteByte('\n')
+		}
+	}
+	return sb.String()
+}
+
+// hunkStart follows the unified format: an empty range starts one line earlier
+func hunkStart(line, count int) int {
+	if count == 0 {
+		return line - 1
+	}
+	return line
+}
+
+// printDiff writes a unified diff with colored +/- lines
+func printDiff(diff string) {
+	for _, l := range splitLines(diff) {
+		switch {
+		case strings.HasPrefix(l, "+++"), strings.HasPrefix(l, "---"):
+			pterm.Println(pterm.Bold.Sprint(l))
+		case strings.HasPrefix(l, "@@"):
+			pterm.Println(pterm.Cyan(l))
+		case strings.HasPrefix(l, "+"):
+			pterm.Println(pterm.Green(l))
+		case strings.HasPrefix(l, "-"):
+			pterm.Println(pterm.Red(l))
+		default:
+			pterm.Println(l)
+		}
+	}
+}
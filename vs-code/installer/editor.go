@@ -0,0 +1,371 @@
+// editor.go
+//
+// The VS Code-family editors the installer knows (code, insiders, codium,
+// cursor, windsurf, oss, exploration) and where each keeps its CLI, user
+// dir and extensions (the per-build details: editorpaths.go). --editor
+// picks the target of the run (default: the --install-editor one, else
+// code; several editors: matrix.go); every apply/extension step then works
+// on that editor's paths and CLI. Cursor and Windsurf are VS Code forks
+// with their own config dir (Cursor/User, Windsurf/User) and extensions
+// folder (~/.cursor/extensions, ~/.windsurf/extensions), installing from
+// Open VSX.
+//
+// Editor installation via the system package manager (--install-editor
+// <variant>), so a fresh machine needs nothing but this binary. The first
+// available package manager of the platform is used:
+//
+//   Windows  winget, choco
+//   macOS    brew (casks)
+//   Linux    apt-get, dnf, zypper, pacman, snap
+//
+// Linux package managers run through sudo when not root (sudo asks for the
+// password on the terminal; with --silent it runs as sudo -n); winget raises
+// its own UAC prompt. apt-get, dnf and zypper need the vendor's repository
+// configured (packages.microsoft.com for code/insiders, the VSCodium repo for
+// codium); otherwise the next manager, usually snap, is tried. Afterwards
+// the editor CLI is looked up and run once (`--version`) to verify the
+// installation.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+const editorInstallTimeout = 30 * time.Minute
+
+// editorVariant is one installable editor flavour
+type editorVariant struct {
+	Title    string
+	CLI      string            // CLI name without extension
+	Packages map[string]string // package manager -> package name
+	WinDir   string            // install folder under %LOCALAPPDATA%\Programs
+	WinBin   string            // CLI folder under WinDir, "bin" when empty
+	MacApp   string            // app bundle in /Applications
+	AppDir   string            // config folder under the OS app-data root, holding User/
+	ExtDir   string            // dot folder in home holding extensions/
+	Flatpak  string            // Flathub app id, "" when not packaged there
+	Product  string            // user product.json read from the user data dir, "" when none
+}
+
+var editorVariants = map[string]editorVariant{
+	"code": {
+		Title: "Visual Studio Code",
+		CLI:   "code",
+		Packages: map[string]string{
+			"winget": "Microsoft.VisualStudioCode", "choco": "vscode", "brew": "visual-studio-code",
+			"apt-get": "code", "dnf": "code", "zypper": "code", "snap": "code",
+		},
+		WinDir:  "Microsoft VS Code",
+		MacApp:  "Visual Studio Code.app",
+		AppDir:  "Code",
+		ExtDir:  ".vscode",
+		Flatpak: "com.visualstudio.code",
+	},
+	"insiders": {
+		Title: "Visual Studio Code Insiders",
+		CLI:   "code-insiders",
+		Packages: map[string]string{
+			"winget": "Microsoft.VisualStudioCode.Insiders", "choco": "vscode-insiders", "brew": "visual-studio-code@insiders",
+			"apt-get": "code-insiders", "dnf": "code-insiders", "zypper": "code-insiders", "snap": "code-insiders",
+		},
+		WinDir: "Microsoft VS Code Insiders",
+		MacApp: "Visual Studio Code - Insiders.app",
+		AppDir: "Code - Insiders",
+		ExtDir: ".vscode-insiders",
+	},
+	"exploration": {
+		Title:  "Visual Studio Code - Exploration",
+		CLI:    "code-exploration",
+		WinDir: "Microsoft VS Code Exploration",
+		MacApp: "Visual Studio Code - Exploration.app",
+		AppDir: "Code - Exploration",
+		ExtDir: ".vscode-exploration",
+	},
+	"oss": {
+		Title: "Code - OSS",
+		CLI:   "code-oss",
+		Packages: map[string]string{
+			// Arch's "code" package is the OSS build
+			"pacman": "code",
+		},
+		AppDir:  "Code - OSS",
+		ExtDir:  ".vscode-oss",
+		Flatpak: "com.visualstudio.code-oss",
+	},
+	"codium": {
+		Title: "VSCodium",
+		CLI:   "codium",
+		Packages: map[string]string{
+			"winget": "VSCodium.VSCodium", "choco": "vscodium", "brew": "vscodium",
+			"apt-get": "codium", "dnf": "codium", "zypper": "codium", "snap": "codium",
+		},
+		WinDir:  "VSCodium",
+		MacApp:  "VSCodium.app",
+		AppDir:  "VSCodium",
+		ExtDir:  ".vscode-oss",
+		Flatpak: "com.vscodium.codium",
+		Product: "product.json",
+	},
+	"cursor": {
+		Title: "Cursor",
+		CLI:   "cursor",
+		Packages: map[string]string{
+			"winget": "Anysphere.Cursor", "brew": "cursor",
+		},
+		WinDir: "cursor",
+		WinBin: "resources/app/bin",
+		MacApp: "Cursor.app",
+		AppDir: "Cursor",
+		ExtDir: ".cursor",
+	},
+	"windsurf": {
+		Title: "Windsurf",
+		CLI:   "windsurf",
+		Packages: map[string]string{
+			"winget": "Codeium.Windsurf", "brew": "windsurf", "apt-get": "windsurf",
+		},
+		WinDir: "Windsurf",
+		MacApp: "Windsurf.app",
+		AppDir: "Windsurf",
+		ExtDir: ".windsurf",
+	},
+}
+
+// userDir returns the editor's user config dir (settings.json, keybindings.json)
+func (ed editorVariant) userDir(home string) string {
+	switch runtime.GOOS {
+	case "windows":
+		app := os.Getenv("APPDATA")
+		if app == "" {
+			// fallback
+			app = filepath.Join(home, "AppData", "Roaming")
+		}
+		return filepath.Join(app, ed.AppDir, "User")
+	case "darwin":
+		return filepath.Join(home, "Library", "Application Support", ed.AppDir, "User")
+	default:
+		return filepath.Join(home, ".config", ed.AppDir, "User")
+	}
+}
+
+// extensionsDir returns the editor's user extensions folder
+func (ed editorVariant) extensionsDir(home string) string {
+	return filepath.Join(home, ed.ExtDir, "extensions")
+}
+
+// findEditorCLI finds the CLI of the target editor; the code target keeps
+// accepting whichever VS Code build's CLI is in PATH
+func (i *Installer) findEditorCLI() (string, error) {
+	if i.editor.CLI == "code" || os.Getenv(fakeCodeEnv) != "" {
+		if p, err := findCodeCLI(); err == nil || os.Getenv(fakeCodeEnv) != "" {
+			return p, err
+		}
+	}
+	if p := i.editor.findCLI(); p != "" {
+		return p, nil
+	}
+	return "", fmt.Errorf("%s CLI (%s) not found in PATH", i.editor.Title, i.editor.CLI)
+}
+
+// packageManagers lists the managers tried on this platform, in order
+func packageManagers() []string {
+	switch runtime.GOOS {
+	case "windows":
+		return []string{"winget", "choco"}
+	case "darwin":
+		return []string{"brew"}
+	default:
+		return []string{"apt-get", "dnf", "zypper", "pacman", "snap"}
+	}
+}
+
+// editorNames lists the accepted --install-editor values
+func editorNames() string {
+	var names []string
+	for n := range editorVariants {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return strings.Join(names, "|")
+}
+
+// packageInstallCmd is the non-interactive install command for pkg
+func packageInstallCmd(pm, pkg string) []string {
+	switch pm {
+	case "winget":
+		return []string{"winget", "install", "--id", pkg, "-e", "--silent", "--accept-package-agreements", "--accept-source-agreements"}
+	case "choco":
+		return []string{"choco", "install", pkg, "-y"}
+	case "brew":
+		return []string{"brew", "install", "--cask", pkg}
+	case "apt-get":
+		return []string{"apt-get", "install", "-y", pkg}
+	case "dnf":
+		return []string{"dnf", "install", "-y", pkg}
+	case "zypper":
+		return []string{"zypper", "--non-interactive", "install", pkg}
+	case "pacman":
+		return []string{"pacman", "-S", "--needed", "--noconfirm", pkg}
+	case "snap":
+		return []string{"snap", "install", pkg, "--classic"}
+	}
+	return nil
+}
+
+// needsSudo reports whether pm must run as root
+func needsSudo(pm string) bool {
+	switch pm {
+	case "apt-get", "dnf", "zypper", "pacman", "snap":
+		return os.Geteuid() != 0
+	}
+	return false
+}
+
+// installEditor installs the editor variant unless its CLI is already
+// present and points the installer at the CLI
+func (i *Installer) installEditor(name string) error {
+	ed, ok := editorVariants[name]
+	if !ok {
+		return fmt.Errorf("unknown editor %q (want %s)", name, editorNames())
+	}
+	if p := ed.findCLI(); p != "" {
+		i.logf("%s already installed (%s)", ed.Title, p)
+		i.codeCLIPath = p
+		return nil
+	}
+
+	var tried []string
+	for _, pm := range packageManagers() {
+		pkg, ok := ed.Packages[pm]
+		if !ok {
+			continue
+		}
+		if _, err := exec.LookPath(pm); err != nil {
+			continue
+		}
+		cmd := packageInstallCmd(pm, pkg)
+		if needsSudo(pm) {
+			if _, err := exec.LookPath("sudo"); err != nil {
+				return fmt.Errorf("%s needs root and sudo is not available", pm)
+			}
+			if i.silent {
+				cmd = append([]string{"sudo", "-n"}, cmd...)
+			} else {
+				cmd = append([]string{"sudo"}, cmd...)
+			}
+		}
+		if !i.assumeYes {
+			ok, err := askYesNoDefaultYes(i.input(), fmt.Sprintf("Установить %s: %s?", ed.Title, strings.Join(cmd, " ")), true)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				i.logf("User chose not to install %s", ed.Title)
+				return nil
+			}
+		}
+		if i.dryRun {
+			i.logf("DRY-RUN: would run: %s", strings.Join(cmd, " "))
+			return nil
+		}
+		i.logf("Installing %s: %s", ed.Title, strings.Join(cmd, " "))
+		var err error
+		if i.silent {
+			var out string
+			out, err = runCommandWithTimeout(editorInstallTimeout, cmd[0], cmd[1:]...)
+			i.logToFile("%s", strings.TrimSpace(out))
+		} else {
+			err = runAttached(editorInstallTimeout, cmd)
+		}
+		if err != nil {
+			i.warnf("%s failed: %v", strings.Join(cmd, " "), err)
+			tried = append(tried, pm)
+			continue
+		}
+		return i.verifyEditor(ed)
+	}
+	if len(tried) == 0 {
+		return fmt.Errorf("no supported package manager found for %s (tried %s)", ed.Title, strings.Join(packageManagers(), ", "))
+	}
+	return fmt.Errorf("cannot install %s (failed: %s)", ed.Title, strings.Join(tried, ", "))
+}
+
+// verifyEditor checks that the freshly installed CLI exists and runs
+func (i *Installer) verifyEditor(ed editorVariant) error {
+	p := ed.findCLI()
+	if p == "" {
+		return fmt.Errorf("%s installed, but the %s CLI was not found (open a new terminal so PATH is refreshed)", ed.Title, ed.CLI)
+	}
+	out, err := runCommandWithTimeout(listTimeoutSec*time.Second, p, "--version")
+	if err != nil {
+		return fmt.Errorf("%s --version failed: %v: %s", p, err, strings.TrimSpace(out))
+	}
+	version, _, _ := strings.Cut(strings.TrimSpace(out), "\n")
+	i.logf("%s %s installed, CLI: %s", ed.Title, version, p)
+	i.codeCLIPath = p
+	return nil
+}
+
+// findCLI looks the CLI up in PATH and in the default install locations,
+// which a fresh install may not have added to this process's PATH yet
+func (ed editorVariant) findCLI() string {
+	names := []string{ed.CLI}
+	if runtime.GOOS == "windows" {
+		names = []string{ed.CLI + ".cmd", ed.CLI + ".exe"}
+	}
+	for _, n := range names {
+		if p, err := exec.LookPath(n); err == nil {
+			return p
+		}
+	}
+	var candidates []string
+	switch runtime.GOOS {
+	case "windows":
+		bin := "bin"
+		if ed.WinBin != "" {
+			bin = filepath.FromSlash(ed.WinBin)
+		}
+		for _, root := range []string{filepath.Join(os.Getenv("LOCALAPPDATA"), "Programs"), os.Getenv("ProgramFiles")} {
+			if root != "" {
+				candidates = append(candidates, filepath.Join(root, ed.WinDir, bin, ed.CLI+".cmd"))
+			}
+		}
+	case "darwin":
+		candidates = []string{"/opt/homebrew/bin/" + ed.CLI, "/usr/local/bin/" + ed.CLI,
+			filepath.Join("/Applications", ed.MacApp, "Contents", "Resources", "app", "bin", ed.CLI)}
+	default:
+		candidates = []string{"/snap/bin/" + ed.CLI, "/usr/bin/" + ed.CLI}
+		if ed.Flatpak != "" {
+			candidates = append(candidates, flatpakExports(ed.Flatpak)...)
+		}
+	}
+	for _, c := range candidates {
+		if exists(c) {
+			return c
+		}
+	}
+	return ""
+}
+
+// runAttached runs cmd with the terminal attached, so sudo and installers
+// can prompt and show their progress
+func runAttached(timeout time.Duration, cmd []string) error {
+	if len(cmd) == 0 {
+		return errors.New("empty command")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	c := exec.CommandContext(ctx, cmd[0], cmd[1:]...)
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return c.Run()
+}
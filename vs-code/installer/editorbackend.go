@@ -0,0 +1,167 @@
+// editorbackend.go
+//
+// Backends for editors outside the VS Code family. Each one has its own
+// folder in the payload (data/<name>/ when embedded, <src>/<name>/ with
+// --src) holding that editor's files as they are deployed, and shares the
+// file pipeline of the main apply: an unchanged file is reported up to date,
+// a dry run prints the diff instead of writing, the file it replaces is kept
+// next to it as <file>.backup_<timestamp>, and the write itself is
+// journaled and restored on failure (safeWrite).
+//
+// A backend is chosen with its flag (--notepadpp, --lapce, --pulsar, --geany,
+// --kakoune) and replaces the VS Code apply; several flags run their
+// backends in table order with one summary.
+
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// editorBackend is one non-VS Code editor the payload can be deployed to
+type editorBackend struct {
+	Flag     string
+	Title    string
+	Apply    func(i *Installer) error
+	Selected func(o *Options) bool // the Options field of Flag
+}
+
+// editorBackends is the backend table, in run order
+var editorBackends = []editorBackend{
+	{"notepadpp", "Notepad++", (*Installer).applyNotepadPP, func(o *Options) bool { return o.NotepadPP }},
+	{"lapce", "Lapce", (*Installer).applyLapce, func(o *Options) bool { return o.Lapce }},
+	{"pulsar", "Pulsar", (*Installer).applyPulsar, func(o *Options) bool { return o.Pulsar }},
+	{"geany", "Geany", (*Installer).applyGeany, func(o *Options) bool { return o.Geany }},
+	{"kakoune", "Kakoune", (*Installer).applyKakoune, func(o *Options) bool { return o.Kakoune }},
+}
+
+// selectedBackends returns the backends whose flag is set in opts
+func selectedBackends(opts Options) []editorBackend {
+	var res []editorBackend
+	for _, b := range editorBackends {
+		if b.Selected(&opts) {
+			res = append(res, b)
+		}
+	}
+	return res
+}
+
+// applyBackends runs the selected backends; it reports whether any failed
+func (i *Installer) applyBackends(backends []editorBackend) bool {
+	failed := false
+	for _, b := range backends {
+		i.logf("%s: deploying the payload's %s/ folder", b.Title, b.Flag)
+		if err := b.Apply(i); err != nil {
+			i.errorf("%s apply failed: %v", b.Title, err)
+			failed = true
+		}
+	}
+	i.printSummary()
+	return failed
+}
+
+// backendFiles returns the files of the payload folder dir, by path relative
+// to it (slash-separated); empty when the payload has no such folder
+func (i *Installer) backendFiles(dir string) (map[string][]byte, error) {
+	if i.useEmbedded {
+		res := make(map[string][]byte)
+		root := path.Join(embeddedDirRoot, dir)
+		err := fs.WalkDir(embeddedDirFS, root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			b, err := fs.ReadFile(embeddedDirFS, p)
+			if err != nil {
+				return err
+			}
+			res[strings.TrimPrefix(p, root+"/")] = b
+			return nil
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		return res, nil
+	}
+	return readDirFiles(filepath.Join(i.baseDir, dir))
+}
+
+// readDirFiles reads every file below root, by path relative to it
+// (slash-separated); empty when root does not exist
+func readDirFiles(root string) (map[string][]byte, error) {
+	res := make(map[string][]byte)
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return fmt.Errorf("cannot read %s: %w", p, err)
+		}
+		rel, _ := filepath.Rel(root, p)
+		res[filepath.ToSlash(rel)] = b
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return res, nil
+}
+
+// readBackendDirs reads the backend folders of the payload folder dir, by
+// payload-relative path, for pack
+func readBackendDirs(dir string) (map[string][]byte, error) {
+	res := make(map[string][]byte)
+	for _, b := range editorBackends {
+		files, err := readDirFiles(filepath.Join(dir, b.Flag))
+		if err != nil {
+			return nil, err
+		}
+		for name, data := range files {
+			res[b.Flag+"/"+name] = data
+		}
+	}
+	return res, nil
+}
+
+// isBackendPath reports whether a payload-relative path is a file of one of
+// the backend folders
+func isBackendPath(name string) bool {
+	dir, file, ok := strings.Cut(name, "/")
+	if !ok || file == "" {
+		return false
+	}
+	for _, b := range editorBackends {
+		if b.Flag == dir {
+			return true
+		}
+	}
+	return false
+}
+
+// deployFile writes one backend file: item names it in the log and report
+func (i *Installer) deployFile(item, dst string, data []byte) error {
+	if sameContent(dst, data) {
+		i.report.UpToDate = append(i.report.UpToDate, item)
+		return nil
+	}
+	if i.dryRun {
+		i.simulateWrite(item, dst, data)
+		return nil
+	}
+	if !i.skipBackup && exists(dst) {
+		if err := copyFile(dst, dst+"."+filepath.Base(i.backupDir)); err != nil {
+			return fmt.Errorf("cannot back up %s: %w", dst, err)
+		}
+	}
+	if err := i.safeWrite(dst, data); err != nil {
+		return fmt.Errorf("cannot write %s: %w", dst, err)
+	}
+	i.report.Written = append(i.report.Written, item)
+	i.logf("%s written (%s)", item, dst)
+	return nil
+}
@@ -0,0 +1,156 @@
+// editorpaths.go
+//
+// Where an installed build of an editor keeps its data. The variant table
+// (editor.go) has the defaults — <config>/<AppDir>/User for settings and
+// ~/<ExtDir>/extensions for extensions — but builds differ:
+//
+//   native   a product.json next to the CLI names the real folders:
+//            nameShort for the user data dir ("Code - OSS" for Arch's
+//            `code`), dataFolderName for the extensions (".vscode-oss")
+//   snap     classic confinement, same folders as a native install
+//   flatpak  the CLI is the exported launcher (…/flatpak/exports/bin/<id>);
+//            the sandbox moves the config to ~/.var/app/<id>/config, the
+//            extensions stay in the (shared) home
+//
+// --user-data-dir <dir> replaces the user data dir for builds started that
+// way (portable setups, several profiles side by side): settings go to
+// <dir>/User and every CLI call gets the same --user-data-dir.
+//
+// VSCodium also reads a product.json from the user data dir (next to User/,
+// wherever that is), which is where the mirror's gallery is configured.
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// packagings of an installed build
+const (
+	packagingNative  = "native"
+	packagingSnap    = "snap"
+	packagingFlatpak = "flatpak"
+)
+
+// editorPaths is where one installed build keeps its data
+type editorPaths struct {
+	CLI       string // "" when the build was not found
+	Packaging string
+	UserDir   string // settings.json, keybindings.json
+	ExtDir    string // installed extensions
+}
+
+// productInfo is the part of a build's product.json naming its folders
+type productInfo struct {
+	NameShort      string `json:"nameShort"`
+	DataFolderName string `json:"dataFolderName"`
+}
+
+// flatpakExports returns the launchers a Flatpak install of id exports
+func flatpakExports(id string) []string {
+	res := []string{filepath.Join("/var/lib/flatpak/exports/bin", id)}
+	if home, err := os.UserHomeDir(); err == nil {
+		res = append(res, filepath.Join(home, ".local", "share", "flatpak", "exports", "bin", id))
+	}
+	return res
+}
+
+// paths locates the installed build of ed; table defaults when none is found
+func (ed editorVariant) paths(home string) editorPaths {
+	cli := ed.findCLI()
+	if cli == "" {
+		return editorPaths{Packaging: packagingNative, UserDir: ed.userDir(home), ExtDir: ed.extensionsDir(home)}
+	}
+	return pathsFor(home, cli, ed)
+}
+
+// pathsFor returns the folders of the build behind cli, a build of ed
+func pathsFor(home, cli string, ed editorVariant) editorPaths {
+	p := editorPaths{CLI: cli, Packaging: packagingOf(cli)}
+	if prod, ok := readProduct(cli); ok {
+		if prod.NameShort != "" {
+			ed.AppDir = prod.NameShort
+		}
+		if prod.DataFolderName != "" {
+			ed.ExtDir = prod.DataFolderName
+		}
+	}
+	p.UserDir, p.ExtDir = ed.userDir(home), ed.extensionsDir(home)
+	if p.Packaging == packagingFlatpak {
+		p.UserDir = filepath.Join(home, ".var", "app", filepath.Base(cli), "config", ed.AppDir, "User")
+	}
+	return p
+}
+
+// userProduct returns the user product.json of an ed build whose settings
+// live in userDir, "" when ed reads none
+func (ed editorVariant) userProduct(userDir string) string {
+	if ed.Product == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(userDir), ed.Product)
+}
+
+// packagingOf tells how the build behind cli was installed
+func packagingOf(cli string) string {
+	slashed := filepath.ToSlash(cli)
+	switch {
+	case strings.Contains(slashed, "/flatpak/exports/bin/"):
+		return packagingFlatpak
+	case strings.HasPrefix(slashed, "/snap/"):
+		return packagingSnap
+	}
+	return packagingNative
+}
+
+// readProduct reads the product.json of the build behind cli
+func readProduct(cli string) (productInfo, bool) {
+	if !filepath.IsAbs(cli) {
+		return productInfo{}, false
+	}
+	if p, err := filepath.EvalSymlinks(cli); err == nil {
+		cli = p
+	}
+	bin := filepath.Dir(cli)
+	base := strings.TrimSuffix(filepath.Base(cli), filepath.Ext(cli))
+	candidates := []string{
+		filepath.Join(bin, "..", "resources", "app", "product.json"), // Linux, Windows
+		filepath.Join(bin, "..", "product.json"),                     // macOS (Contents/Resources/app/bin)
+		filepath.Join("/usr/lib", base, "product.json"),              // distro builds started by a script
+		filepath.Join("/usr/share", base, "resources", "app", "product.json"),
+		filepath.Join("/opt", base, "resources", "app", "product.json"),
+	}
+	for _, c := range candidates {
+		b, err := os.ReadFile(c)
+		if err != nil {
+			continue
+		}
+		var prod productInfo
+		if json.Unmarshal(b, &prod) == nil {
+			return prod, true
+		}
+	}
+	return productInfo{}, false
+}
+
+// variantOfCLI guesses the variant of the build behind cli from its name:
+// a Flatpak id or CLI name, else the longest CLI name it contains (code)
+func variantOfCLI(cli string) editorVariant {
+	base := strings.ToLower(strings.TrimSuffix(filepath.Base(cli), filepath.Ext(cli)))
+	if packagingOf(cli) == packagingFlatpak {
+		base = strings.ToLower(filepath.Base(cli))
+	}
+	best := editorVariants["code"]
+	for _, ed := range editorVariants {
+		if base == ed.CLI || (ed.Flatpak != "" && base == strings.ToLower(ed.Flatpak)) {
+			return ed
+		}
+		if strings.Contains(base, ed.CLI) && len(ed.CLI) > len(best.CLI) {
+			best = ed
+		}
+	}
+	return best
+}
@@ -0,0 +1,131 @@
+// estimate.go
+//
+// Pre-install impact estimate: download size per extension (HEAD on the
+// registry .vsix URL), an estimated total install time and a warning for
+// extensions known to bundle large native binaries, shown before the
+// interactive selection so users on metered connections can deselect them.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pterm/pterm"
+)
+
+const (
+	largeExtensionBytes = 30 << 20 // packages above this are flagged as large
+	estimateBytesPerSec = 2 << 20  // assumed download throughput for the time estimate
+	estimateOverheadSec = 6        // average CLI start-up + unpack per extension
+)
+
+// extensions that download platform binaries on top of (or inside) the .vsix
+var heavyExtensions = map[string]string{
+	"ms-vscode.cpptools":          "downloads native IntelliSense engine and debugger",
+	"ms-python.vscode-pylance":    "bundles the Pylance language server",
+	"ms-dotnettools.csharp":       "downloads .NET language server and debugger",
+	"ms-dotnettools.csdevkit":     "downloads .NET tooling on first start",
+	"rust-lang.rust-analyzer":     "bundles the rust-analyzer binary",
+	"redhat.java":                 "bundles a JRE and the JDT language server",
+	"ms-toolsai.jupyter":          "pulls several companion extensions",
+	"ms-vscode-remote.remote-ssh": "downloads VS Code Server on first connect",
+}
+
+// sizeEstimate is the expected download for one extension
+type sizeEstimate struct {
+	ID    string
+	Bytes int64 // -1 when unknown
+	Local bool  // installed from --vsix-dir, no download
+	Note  string
+}
+
+// estimateInstall collects download sizes for specs
+func (i *Installer) estimateInstall(specs []extensionSpec) ([]sizeEstimate, error) {
+	var remote []string
+	for _, s := range specs {
+		if _, ok := i.vsix[strings.ToLower(s.ID)]; !ok {
+			remote = append(remote, s.ID)
+		}
+	}
+	meta := map[string]extensionMeta{}
+	if len(remote) > 0 {
+		var err error
+		if meta, err = i.fetchExtensionMeta(i.resolveRegistry(registryAuto), remote); err != nil {
+			return nil, err
+		}
+	}
+
+	res := make([]sizeEstimate, 0, len(specs))
+	for _, s := range specs {
+		e := sizeEstimate{ID: s.ID, Bytes: -1, Note: heavyExtensions[strings.ToLower(s.ID)]}
+		if pkg, ok := i.vsix[strings.ToLower(s.ID)]; ok {
+			e.Local = true
+			if st, err := os.Stat(pkg.Path); err == nil {
+				e.Bytes = st.Size()
+			}
+		} else if m, ok := meta[strings.ToLower(s.ID)]; ok && m.DownloadURL != "" {
+			if n, err := i.downloadSize(m.DownloadURL); err == nil {
+				e.Bytes = n
+			}
+		}
+		if e.Note == "" && e.Bytes > largeExtensionBytes {
+			e.Note = "large package"
+		}
+		res = append(res, e)
+	}
+	return res, nil
+}
+
+// printEstimate shows sizes, total download and estimated install time
+func (i *Installer) printEstimate(specs []extensionSpec) {
+	est, err := i.estimateInstall(specs)
+	if err != nil {
+		i.warnf("cannot estimate download size: %v", err)
+		return
+	}
+	var total int64
+	unknown := 0
+	rows := [][]string{{"Extension", "Size", "Note"}}
+	for _, e := range est {
+		size := "?"
+		switch {
+		case e.Local:
+			size = humanBytes(e.Bytes) + " (local)"
+		case e.Bytes >= 0:
+			size = humanBytes(e.Bytes)
+			total += e.Bytes
+		default:
+			unknown++
+		}
+		if e.Note != "" {
+			i.warnf("%s: %s", e.ID, e.Note)
+		}
+		rows = append(rows, []string{e.ID, size, e.Note})
+	}
+	pterm.DefaultTable.WithHasHeader().WithData(rows).Render()
+
+	eta := time.Duration(len(specs))*(estimateOverheadSec*time.Second+(minSleepMs+maxSleepMs)/2*time.Millisecond) +
+		time.Duration(total/estimateBytesPerSec)*time.Second
+	msg := fmt.Sprintf("Download: %s, estimated time: ~%s", humanBytes(total), eta.Round(time.Second))
+	if unknown > 0 {
+		msg += fmt.Sprintf(" (%d sizes unknown)", unknown)
+	}
+	i.logf("%s", msg)
+}
+
+// humanBytes formats a byte count as KiB/MiB/GiB
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGT"[exp])
+}
@@ -0,0 +1,209 @@
+// export.go
+//
+// `export --keybindings` captures the user's hand-tuned keybindings back into
+// the payload: the live keybindings.json (JSONC) is normalized and written to
+// the data folder (--data, default the --src folder or ./data), ready to be
+// committed and shipped. Entries are rewritten with their members in the
+// order key, command, when, args and "when" clauses single-spaced, then
+// normalized like the merged file of append mode (keynormalize.go:
+// canonical chords, no empty or duplicate entries, sorted per section).
+//
+// The comments above and after each entry and the file's header comment
+// (the payload's, if it has one) are kept. With --dry-run the diff against
+// the payload file is shown instead.
+//
+// `export --devcontainer` turns the payload into a devcontainer.json
+// fragment, so the same setup is used in Dev Containers and Codespaces:
+//
+//   {"customizations": {"vscode": {"extensions": [...], "settings": {...}}}}
+//
+// The settings are the payload's as apply would write them (fragments,
+// conditions, --set); keys holding a resolved secret are left out, so no
+// token ends up in a repository.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pterm/pterm"
+)
+
+func runExport(args []string) error {
+	fs, opts := newCommandFlags("export")
+	keys := fs.Bool("keybindings", false, "Export your keybindings.json into the payload")
+	devcontainer := fs.Bool("devcontainer", false, "Print a devcontainer.json fragment with the payload's extensions and settings")
+	data := fs.String("data", "", "--keybindings: payload folder to write to (default: --src, else ./data)")
+	out := fs.String("out", "", "--devcontainer: write the fragment to this file instead of stdout")
+	fs.Parse(args)
+
+	switch {
+	case *keys == *devcontainer:
+		return errors.New("export what? (want --keybindings or --devcontainer)")
+	case *devcontainer:
+		if *out == "" {
+			// stdout carries the fragment only; progress still goes to the log file
+			pterm.DisableOutput()
+		}
+		inst, err := openInstaller(opts)
+		if err != nil {
+			return err
+		}
+		defer inst.Close()
+		return inst.exportDevcontainer(*out)
+	}
+
+	dir := *data
+	if dir == "" {
+		dir = opts.SrcOverride
+	}
+	if dir == "" {
+		dir = presetsRoot
+	}
+	inst, err := NewInstaller(*opts)
+	if err != nil {
+		return fmt.Errorf("cannot initialize installer: %w", err)
+	}
+	defer inst.Close()
+	return inst.exportKeybindings(dir)
+}
+
+// exportedKeybinding is a keybindings.json entry in payload member order
+type exportedKeybinding struct {
+	Key     string          `json:"key"`
+	Command string          `json:"command"`
+	When    string          `json:"when,omitempty"`
+	Args    json.RawMessage `json:"args,omitempty"`
+}
+
+// normalizeKeybindings rewrites keybindings.json data in payload form;
+// header replaces the file's own when not empty. It returns the new data
+// and the number of entries dropped.
+func normalizeKeybindings(data, header []byte) ([]byte, int, error) {
+	own, list, err := parseKeybindings(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(header) == 0 {
+		header = own
+	}
+	for n, b := range list {
+		var e exportedKeybinding
+		if err := json.Unmarshal(stripJSONC(b.raw), &e); err != nil {
+			return nil, 0, fmt.Errorf("entry %s: %w", strings.TrimSpace(string(b.raw)), err)
+		}
+		e.Key = b.chord
+		e.When = strings.Join(whenClauses(e.When), " && ")
+		list[n].raw = encodeJSONValue(e, "  ")
+		list[n].key = b.chord
+		list[n].canon = string(list[n].raw)
+	}
+	entries, dropped := normalizeBindings(list)
+	return formatKeybindings(header, entries), dropped, nil
+}
+
+// exportKeybindings writes the user's keybindings.json, normalized, to dir
+func (i *Installer) exportKeybindings(dir string) error {
+	src := filepath.Join(i.vscodeUser, keybindingsFile)
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return fmt.Errorf("cannot read %s: %w", src, err)
+	}
+	dst := filepath.Join(dir, keybindingsFile)
+	cur, err := os.ReadFile(dst)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("cannot read %s: %w", dst, err)
+	}
+	var header []byte
+	if cur != nil {
+		header, _, _ = parseKeybindings(cur)
+	}
+	out, dropped, err := normalizeKeybindings(data, header)
+	if err != nil {
+		return fmt.Errorf("%s: %w", src, err)
+	}
+	if dropped > 0 {
+		i.logf("%s: %d duplicate or empty entries dropped", keybindingsFile, dropped)
+	}
+	if bytes.Equal(out, cur) {
+		pterm.Success.Printf("%s is up to date\n", dst)
+		return nil
+	}
+	if i.dryRun {
+		i.logf("DRY-RUN: would write %s", dst)
+		printDiff(unifiedDiff("payload/"+keybindingsFile, "exported/"+keybindingsFile, string(cur), string(out)))
+		return nil
+	}
+	if err := writeBytes(dst, out); err != nil {
+		return fmt.Errorf("cannot write %s: %w", dst, err)
+	}
+	pterm.Success.Printf("Exported %s -> %s\n", src, dst)
+	return nil
+}
+
+// devcontainerFragment is the part of devcontainer.json export writes
+type devcontainerFragment struct {
+	Customizations struct {
+		VSCode struct {
+			Extensions []string               `json:"extensions"`
+			Settings   map[string]interface{} `json:"settings,omitempty"`
+		} `json:"vscode"`
+	} `json:"customizations"`
+}
+
+// exportDevcontainer prints (or writes to out) the payload as a
+// devcontainer.json fragment
+func (i *Installer) exportDevcontainer(out string) error {
+	var frag devcontainerFragment
+	vsc := &frag.Customizations.VSCode
+	vsc.Extensions = []string{}
+	for _, e := range i.extList {
+		id := e.ID
+		if e.Version != "" {
+			id += "@" + e.Version
+		}
+		vsc.Extensions = append(vsc.Extensions, id)
+	}
+	if len(bytes.TrimSpace(stripJSONC(i.settingsData))) > 0 {
+		v, err := parseJSONC(i.settingsData)
+		if err != nil {
+			return fmt.Errorf("%s: %w", settingsFile, err)
+		}
+		settings, _ := v.(map[string]interface{})
+		for k, val := range settings {
+			enc := string(encodeJSONValue(val, ""))
+			if i.redactSecrets(enc) != enc {
+				i.warnf("%s holds a secret — left out of the devcontainer settings", k)
+				delete(settings, k)
+			}
+		}
+		vsc.Settings = settings
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(frag); err != nil {
+		return err
+	}
+	data := buf.Bytes()
+	if out == "" {
+		os.Stdout.Write(data)
+		return nil
+	}
+	if i.dryRun {
+		i.logf("DRY-RUN: would write %s", out)
+		return nil
+	}
+	if err := writeBytes(out, data); err != nil {
+		return fmt.Errorf("cannot write %s: %w", out, err)
+	}
+	pterm.Success.Printf("Wrote devcontainer customizations to %s\n", out)
+	return nil
+}
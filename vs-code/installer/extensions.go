@@ -0,0 +1,182 @@
+// extensions.go
+//
+// Extension list entries. A line of extensions.txt is an extension ID,
+// optionally pinned to a version and followed by per-extension overrides
+// of the install policy:
+//
+//   golang.go
+//   ms-python.python@2024.10.0
+//   ms-vscode.cpptools timeout=180 retries=5
+//
+// Pinned entries are installed as `code --install-extension id@version`
+// and verified against `code --list-extensions --show-versions` afterwards.
+// timeout is in seconds (or a Go duration like 3m), retries is the number
+// of attempts; both default to the global installTimeoutSec / retries.
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	extensionIDRe      = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9-]*\.[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+	extensionVersionRe = regexp.MustCompile(`^[0-9]+(\.[0-9]+)*(-[0-9A-Za-z.-]+)?$`)
+)
+
+// extensionSpec is one entry of the curated extensions list
+type extensionSpec struct {
+	ID      string
+	Version string        // pinned version; empty means latest
+	Timeout time.Duration // per-attempt timeout override; 0 = installTimeoutSec
+	Retries int           // attempts override; 0 = retries
+}
+
+// installTimeout is the effective per-attempt timeout for s
+func (s extensionSpec) installTimeout() time.Duration {
+	if s.Timeout > 0 {
+		return s.Timeout
+	}
+	return installTimeoutSec * time.Second
+}
+
+// attempts is the effective number of install attempts for s
+func (s extensionSpec) attempts() int {
+	if s.Retries > 0 {
+		return s.Retries
+	}
+	return retries
+}
+
+// String returns the form accepted by `code --install-extension`
+func (s extensionSpec) String() string {
+	if s.Version == "" {
+		return s.ID
+	}
+	return s.ID + "@" + s.Version
+}
+
+// parseExtensionSpec parses "publisher.name[@version] [key=value ...]"
+func parseExtensionSpec(line string) (extensionSpec, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return extensionSpec{}, fmt.Errorf("empty extension entry")
+	}
+	id, ver, pinned := strings.Cut(fields[0], "@")
+	if !extensionIDRe.MatchString(id) {
+		return extensionSpec{}, fmt.Errorf("invalid extension id %q", id)
+	}
+	if pinned && !extensionVersionRe.MatchString(ver) {
+		return extensionSpec{}, fmt.Errorf("invalid version %q for %s", ver, id)
+	}
+	spec := extensionSpec{ID: id, Version: ver}
+	for _, opt := range fields[1:] {
+		if err := spec.setOption(opt); err != nil {
+			return extensionSpec{}, fmt.Errorf("%s: %w", id, err)
+		}
+	}
+	return spec, nil
+}
+
+// setOption applies one key=value override
+func (s *extensionSpec) setOption(opt string) error {
+	key, val, ok := strings.Cut(opt, "=")
+	if !ok {
+		return fmt.Errorf("option %q is not key=value", opt)
+	}
+	switch key {
+	case "timeout":
+		d, err := parseSeconds(val)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("bad timeout %q", val)
+		}
+		s.Timeout = d
+	case "retries":
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 1 {
+			return fmt.Errorf("bad retries %q", val)
+		}
+		s.Retries = n
+	default:
+		return fmt.Errorf("unknown option %q", key)
+	}
+	return nil
+}
+
+// parseSeconds accepts plain seconds ("180") or a Go duration ("3m")
+func parseSeconds(v string) (time.Duration, error) {
+	if n, err := strconv.Atoi(v); err == nil {
+		return time.Duration(n) * time.Second, nil
+	}
+	return time.ParseDuration(v)
+}
+
+// parseExtensionList parses all lines; invalid entries are dropped and reported
+// together in the returned error so the valid part of the list stays usable.
+func parseExtensionList(lines []string) ([]extensionSpec, error) {
+	var (
+		res  []extensionSpec
+		bad  []string
+		seen = make(map[string]struct{})
+	)
+	for _, l := range lines {
+		spec, err := parseExtensionSpec(l)
+		if err != nil {
+			bad = append(bad, err.Error())
+			continue
+		}
+		key := strings.ToLower(spec.ID)
+		if _, dup := seen[key]; dup {
+			continue
+		}
+		seen[key] = struct{}{}
+		res = append(res, spec)
+	}
+	if len(bad) > 0 {
+		return res, fmt.Errorf("extensions list: %s", strings.Join(bad, "; "))
+	}
+	return res, nil
+}
+
+// findSpec returns the curated entry for id (case-insensitive)
+func findSpec(specs []extensionSpec, id string) (extensionSpec, bool) {
+	for _, s := range specs {
+		if strings.EqualFold(s.ID, id) {
+			return s, true
+		}
+	}
+	return extensionSpec{}, false
+}
+
+// installedVersion returns the installed version of id, or "" when absent
+func installedVersion(set []installedExtension, id string) string {
+	for _, e := range set {
+		if strings.EqualFold(e.ID, id) {
+			return e.Version
+		}
+	}
+	return ""
+}
+
+// verifyInstalledVersion checks that a pinned spec ended up installed at that version
+func (i *Installer) verifyInstalledVersion(spec extensionSpec) error {
+	if spec.Version == "" || i.dryRun {
+		return nil
+	}
+	if _, err := i.installedExtensions(); err != nil {
+		return fmt.Errorf("cannot verify version of %s: %w", spec.ID, err)
+	}
+	e, _ := i.installed.lookup(spec.ID)
+	got := e.Version
+	switch {
+	case got == "":
+		return fmt.Errorf("%s is not installed after install command", spec.ID)
+	case got != spec.Version:
+		return fmt.Errorf("version mismatch for %s: want %s, installed %s", spec.ID, spec.Version, got)
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+// facts.go
+//
+// Facts about the machine and session the installer runs on, detected at
+// apply time for conditional settings (conditions.go) and shown by the
+// `facts` subcommand:
+//
+//   os, arch     runtime.GOOS / GOARCH
+//   vm           "true" inside a virtual machine, virt names the hypervisor
+//   scale        the largest display scale factor ("1", "1.5", "2")
+//   session      wayland, x11 or tty (Linux)
+//   desktop      $XDG_CURRENT_DESKTOP (Hyprland, GNOME, KDE, ...)
+//   hostname, cpus
+//
+// Detection is best effort and never fails: whatever cannot be found out
+// gets its neutral value (vm false, scale 1, empty strings).
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pterm/pterm"
+)
+
+const factTimeout = 5 * time.Second
+
+// vmVendors are DMI / model strings of the common hypervisors
+var vmVendors = []string{"virtualbox", "vmware", "qemu", "kvm", "xen", "parallels", "bochs", "hyper-v", "virtual machine", "innotek"}
+
+func runFacts(args []string) error {
+	fs, _ := newCommandFlags("facts")
+	output := fs.String("output", "text", "Report format: text or json")
+	fs.Parse(args)
+	facts := detectFacts()
+	switch *output {
+	case "json":
+		b, err := json.MarshalIndent(facts, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+	case "text":
+		rows := [][]string{{"Fact", "Value"}}
+		for _, k := range sortedStringKeys(facts) {
+			rows = append(rows, []string{k, orDash(facts[k])})
+		}
+		pterm.DefaultTable.WithHasHeader().WithData(rows).Render()
+	default:
+		return fmt.Errorf("unknown --output %q (want text or json)", *output)
+	}
+	return nil
+}
+
+// facts returns the detected facts, detecting them on first use
+func (i *Installer) facts() map[string]string {
+	if i.factCache == nil {
+		i.factCache = detectFacts()
+		for _, k := range sortedStringKeys(i.factCache) {
+			i.logToFile("fact %s = %s", k, i.factCache[k])
+		}
+	}
+	return i.factCache
+}
+
+// detectFacts collects all facts
+func detectFacts() map[string]string {
+	facts := map[string]string{
+		"os":      runtime.GOOS,
+		"arch":    runtime.GOARCH,
+		"cpus":    strconv.Itoa(runtime.NumCPU()),
+		"desktop": os.Getenv("XDG_CURRENT_DESKTOP"),
+		"session": detectSession(),
+		"scale":   strconv.FormatFloat(detectScale(), 'f', -1, 64),
+		"vm":      "false",
+		"virt":    "",
+	}
+	if h, err := os.Hostname(); err == nil {
+		facts["hostname"] = h
+	}
+	if virt := detectVirt(); virt != "" {
+		facts["vm"] = "true"
+		facts["virt"] = virt
+	}
+	return facts
+}
+
+// detectSession returns the Linux graphical session type
+func detectSession() string {
+	if runtime.GOOS != "linux" {
+		return ""
+	}
+	switch {
+	case os.Getenv("XDG_SESSION_TYPE") != "":
+		return os.Getenv("XDG_SESSION_TYPE")
+	case os.Getenv("WAYLAND_DISPLAY") != "":
+		return "wayland"
+	case os.Getenv("DISPLAY") != "":
+		return "x11"
+	}
+	return "tty"
+}
+
+// detectScale returns the largest display scale factor, 1 when unknown
+func detectScale() float64 {
+	scale := 1.0
+	switch runtime.GOOS {
+	case "linux":
+		if out, err := runCommandWithTimeout(factTimeout, "hyprctl", "monitors", "-j"); err == nil {
+			var monitors []struct {
+				Scale float64 `json:"scale"`
+			}
+			if json.Unmarshal([]byte(out), &monitors) == nil {
+				for _, m := range monitors {
+					scale = maxFloat(scale, m.Scale)
+				}
+				return scale
+			}
+		}
+		for _, env := range []string{"GDK_SCALE", "QT_SCALE_FACTOR"} {
+			if f, err := strconv.ParseFloat(os.Getenv(env), 64); err == nil {
+				scale = maxFloat(scale, f)
+			}
+		}
+	case "darwin":
+		if out, err := runCommandWithTimeout(factTimeout, "system_profiler", "SPDisplaysDataType"); err == nil && strings.Contains(out, "Retina") {
+			scale = 2
+		}
+	}
+	return scale
+}
+
+// detectVirt returns the hypervisor name inside a virtual machine, "" on
+// bare metal
+func detectVirt() string {
+	switch runtime.GOOS {
+	case "linux":
+		// systemd knows best; it exits non-zero (printing "none") on bare metal
+		if out, err := runCommandWithTimeout(factTimeout, "systemd-detect-virt", "--vm"); err == nil {
+			return strings.TrimSpace(out)
+		}
+		for _, f := range []string{"/sys/class/dmi/id/sys_vendor", "/sys/class/dmi/id/product_name"} {
+			if b, err := os.ReadFile(f); err == nil {
+				if v := matchVMVendor(string(b)); v != "" {
+					return v
+				}
+			}
+		}
+		if b, err := os.ReadFile("/proc/cpuinfo"); err == nil {
+			for _, line := range strings.Split(string(b), "\n") {
+				if strings.HasPrefix(line, "flags") && strings.Contains(line, " hypervisor") {
+					return "hypervisor"
+				}
+			}
+		}
+	case "darwin":
+		if out, err := runCommandWithTimeout(factTimeout, "sysctl", "-n", "kern.hv_vmm_present"); err == nil && strings.TrimSpace(out) == "1" {
+			return "hypervisor"
+		}
+	case "windows":
+		if out, err := runCommandWithTimeout(factTimeout, "powershell", "-NoProfile", "-Command",
+			"(Get-CimInstance Win32_ComputerSystem | ForEach-Object { $_.Manufacturer + ' ' + $_.Model })"); err == nil {
+			return matchVMVendor(out)
+		}
+	}
+	return ""
+}
+
+// matchVMVendor returns the hypervisor named in a vendor / model string
+func matchVMVendor(s string) string {
+	s = strings.ToLower(s)
+	for _, v := range vmVendors {
+		if strings.Contains(s, v) {
+			return v
+		}
+	}
+	return ""
+}
+
+func maxFloat(a, b float64) float64 {
+	if b > a {
+		return b
+	}
+	return a
+}
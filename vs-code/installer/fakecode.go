@@ -0,0 +1,448 @@
+// fakecode.go
+//
+// `fake-code`: a test double of the editor CLI for exercising the installer
+// end-to-end without VS Code (CI containers, integration tests). It answers
+// --version, --list-extensions [--show-versions], --install-extension
+// (IDs, id@version and .vsix files, several per call) and
+// --uninstall-extension with the output of the real CLI, and keeps the
+// installed extensions in an extensions folder as the editor does
+// (<id>-<version>/package.json plus the extensions.json registry; the
+// default folder or --extensions-dir), so the inventory cache, `verify` and
+// the keybinding command check see what was installed.
+//
+// Each install has a scripted outcome, by extension ID or glob ("*" is the
+// default) in <dir>/fake-code.json:
+//
+//   success       installed right away
+//   slow          installed after slowDelay (default 5s; past the install
+//                 timeout it exercises the timeout path)
+//   rate-limited  fails with HTTP 429 for the first rateLimitedAttempts
+//                 attempts (default 2), then succeeds: exercises the retries
+//   failure       always fails
+//
+// Integration-test mode: with HYPREDITORS_FAKE_CODE=<dir> every run uses
+// <dir>/code (code.cmd on Windows), a shim calling `fake-code --state <dir>`,
+// instead of looking for the editor; the folder is created on first use.
+// `fake-code init <dir> --outcome 'thang-nm.*=failure'` scripts it up
+// front. Combined with --sandbox nothing outside the sandbox is touched:
+//
+//   HYPREDITORS_FAKE_CODE=/tmp/fc hypreditors apply --sandbox --silent
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	fakeCodeEnv          = "HYPREDITORS_FAKE_CODE"
+	fakeCodeStateFile    = "fake-code.json"
+	fakeCodeVersion      = "1.99.0"
+	fakeDefaultVersion   = "1.0.0" // version of installs that name none
+	fakeSlowDelay        = 5 * time.Second
+	fakeRateLimitedTries = 2
+)
+
+// fake-code install outcomes
+const (
+	outcomeSuccess     = "success"
+	outcomeSlow        = "slow"
+	outcomeRateLimited = "rate-limited"
+	outcomeFailure     = "failure"
+)
+
+// fakeCodeState is <dir>/fake-code.json
+type fakeCodeState struct {
+	Version             string            `json:"version"`
+	Outcomes            map[string]string `json:"outcomes,omitempty"`            // extension ID or glob -> outcome
+	SlowDelay           string            `json:"slowDelay,omitempty"`           // duration of "slow" installs
+	RateLimitedAttempts int               `json:"rateLimitedAttempts,omitempty"` // failed attempts of "rate-limited" installs
+	Attempts            map[string]int    `json:"attempts,omitempty"`            // install attempts so far, by lower-cased ID
+}
+
+// fakeRegistryEntry is one entry of the extensions folder's extensions.json
+type fakeRegistryEntry struct {
+	Identifier struct {
+		ID string `json:"id"`
+	} `json:"identifier"`
+	Version          string `json:"version"`
+	RelativeLocation string `json:"relativeLocation"`
+}
+
+func loadFakeCodeState(dir string) (fakeCodeState, error) {
+	st := fakeCodeState{Version: fakeCodeVersion}
+	b, err := os.ReadFile(filepath.Join(dir, fakeCodeStateFile))
+	if os.IsNotExist(err) {
+		return st, nil
+	}
+	if err != nil {
+		return st, err
+	}
+	if err := json.Unmarshal(b, &st); err != nil {
+		return st, fmt.Errorf("corrupt %s: %w", fakeCodeStateFile, err)
+	}
+	return st, nil
+}
+
+func (st fakeCodeState) save(dir string) error {
+	b, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeBytes(filepath.Join(dir, fakeCodeStateFile), append(b, '\n'))
+}
+
+// outcome returns the scripted outcome for id: exact ID, then the globs in
+// lexical order, then "*"
+func (st fakeCodeState) outcome(id string) string {
+	var globs []string
+	for p, o := range st.Outcomes {
+		if strings.EqualFold(p, id) {
+			return o
+		}
+		if p != "*" && strings.ContainsAny(p, "*?[") {
+			globs = append(globs, p)
+		}
+	}
+	sort.Strings(globs)
+	for _, p := range globs {
+		if ok, _ := path.Match(strings.ToLower(p), strings.ToLower(id)); ok {
+			return st.Outcomes[p]
+		}
+	}
+	if o, ok := st.Outcomes["*"]; ok {
+		return o
+	}
+	return outcomeSuccess
+}
+
+// fakeCodeCLI returns the shim of the fake CLI in dir, creating the folder,
+// the shim and a default state as needed
+func fakeCodeCLI(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	shim := filepath.Join(dir, "code")
+	script := fmt.Sprintf("#!/bin/sh\nexec %s fake-code --state %s \"$@\"\n", shellQuote(exe), shellQuote(dir))
+	if runtime.GOOS == "windows" {
+		shim += ".cmd"
+		script = fmt.Sprintf("@\"%s\" fake-code --state \"%s\" %%*\r\n", exe, dir)
+	}
+	if !sameContent(shim, []byte(script)) {
+		if err := writeBytes(shim, []byte(script)); err != nil {
+			return "", err
+		}
+		if err := os.Chmod(shim, 0o755); err != nil {
+			return "", err
+		}
+	}
+	if !exists(filepath.Join(dir, fakeCodeStateFile)) {
+		if err := (fakeCodeState{Version: fakeCodeVersion}).save(dir); err != nil {
+			return "", err
+		}
+	}
+	return shim, nil
+}
+
+func runFakeCode(args []string) error {
+	dir := os.Getenv(fakeCodeEnv)
+	if len(args) > 1 && args[0] == "--state" {
+		dir, args = args[1], args[2:]
+	}
+	if len(args) > 0 && args[0] == "init" {
+		return runFakeCodeInit(args[1:])
+	}
+	if dir == "" {
+		return errors.New("usage: fake-code [--state <dir>] <code CLI arguments> | fake-code init <dir> [--outcome <id|glob>=<outcome>]... (or set " + fakeCodeEnv + ")")
+	}
+	st, err := loadFakeCodeState(dir)
+	if err != nil {
+		return err
+	}
+
+	var (
+		list, versions, force bool
+		installs, uninstalls  []string
+		extDir                string
+	)
+	for k := 0; k < len(args); k++ {
+		next := func() string {
+			if k+1 < len(args) {
+				k++
+				return args[k]
+			}
+			return ""
+		}
+		switch args[k] {
+		case "--version", "-v":
+			fmt.Printf("%s\n0000000000000000000000000000000000000000\n%s\n", st.Version, runtime.GOARCH)
+			return nil
+		case "--list-extensions":
+			list = true
+		case "--show-versions":
+			versions = true
+		case "--force":
+			force = true
+		case "--install-extension":
+			installs = append(installs, next())
+		case "--uninstall-extension":
+			uninstalls = append(uninstalls, next())
+		case "--extensions-dir":
+			extDir = next()
+		case "--user-data-dir", "--profile", "--category":
+			next()
+		}
+	}
+	if extDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		extDir = extensionsDir(home, "code")
+	}
+	reg, err := readFakeRegistry(extDir)
+	if err != nil {
+		return err
+	}
+
+	if list {
+		sort.Slice(reg, func(a, b int) bool { return reg[a].Identifier.ID < reg[b].Identifier.ID })
+		for _, e := range reg {
+			if versions {
+				fmt.Printf("%s@%s\n", e.Identifier.ID, e.Version)
+			} else {
+				fmt.Println(e.Identifier.ID)
+			}
+		}
+		return nil
+	}
+
+	var failed []string
+	if len(installs) > 0 {
+		fmt.Println("Installing extensions...")
+	}
+	for _, src := range installs {
+		id, ver := parseFakeInstallSource(src)
+		if id == "" {
+			fmt.Printf("Extension '%s' not found.\n", src)
+			failed = append(failed, src)
+			continue
+		}
+		if have := fakeInstalledVersion(reg, id); have != "" && !force && (ver == "" || have == ver) {
+			fmt.Printf("Extension '%s' v%s is already installed. Use '--force' option to update to latest version or provide '@<version>' to install a specific version, for example: '%s@1.2.3'.\n", id, have, id)
+			continue
+		}
+		if err := st.attempt(dir, id); err != nil {
+			fmt.Println(err)
+			failed = append(failed, id)
+			continue
+		}
+		if ver == "" {
+			ver = fakeDefaultVersion
+		}
+		if reg, err = installFakeExtension(extDir, reg, id, ver); err != nil {
+			return err
+		}
+		fmt.Printf("Extension '%s' v%s was successfully installed.\n", id, ver)
+	}
+	for _, id := range uninstalls {
+		before := len(reg)
+		if reg, err = uninstallFakeExtension(extDir, reg, id); err != nil {
+			return err
+		}
+		if len(reg) == before {
+			fmt.Printf("Extension '%s' is not installed.\n", id)
+			failed = append(failed, id)
+			continue
+		}
+		fmt.Printf("Extension '%s' was successfully uninstalled!\n", id)
+	}
+	if len(failed) > 0 {
+		// plain output and exit status 1, like the real CLI
+		fmt.Printf("Failed Installing Extensions: %s\n", strings.Join(failed, ", "))
+		os.Exit(1)
+	}
+	return nil
+}
+
+// attempt plays the scripted outcome of one install attempt of id
+func (st *fakeCodeState) attempt(dir, id string) error {
+	if st.Attempts == nil {
+		st.Attempts = make(map[string]int)
+	}
+	key := strings.ToLower(id)
+	st.Attempts[key]++
+	if err := st.save(dir); err != nil {
+		return err
+	}
+	switch o := st.outcome(id); o {
+	case outcomeSuccess:
+	case outcomeSlow:
+		delay := fakeSlowDelay
+		if d, err := time.ParseDuration(st.SlowDelay); err == nil {
+			delay = d
+		}
+		time.Sleep(delay)
+	case outcomeRateLimited:
+		tries := st.RateLimitedAttempts
+		if tries <= 0 {
+			tries = fakeRateLimitedTries
+		}
+		if st.Attempts[key] <= tries {
+			return fmt.Errorf("Error while installing extension %s: Request failed with status code 429 (Too Many Requests)", id)
+		}
+	case outcomeFailure:
+		return fmt.Errorf("Error while installing extension %s: Failed Installing Extensions: %s", id, id)
+	default:
+		return fmt.Errorf("fake-code: unknown outcome %q for %s (want %s, %s, %s or %s)", o, id, outcomeSuccess, outcomeSlow, outcomeRateLimited, outcomeFailure)
+	}
+	return nil
+}
+
+// parseFakeInstallSource returns the ID and version (may be "") of an
+// --install-extension argument
+func parseFakeInstallSource(src string) (id, ver string) {
+	if strings.HasSuffix(strings.ToLower(src), ".vsix") {
+		pkg, err := readVSIXManifest(src)
+		if err != nil {
+			return "", ""
+		}
+		return pkg.ID, pkg.Version
+	}
+	spec, err := parseExtensionSpec(src)
+	if err != nil {
+		return "", ""
+	}
+	return spec.ID, spec.Version
+}
+
+func readFakeRegistry(extDir string) ([]fakeRegistryEntry, error) {
+	var reg []fakeRegistryEntry
+	b, err := os.ReadFile(filepath.Join(extDir, "extensions.json"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &reg); err != nil {
+		return nil, fmt.Errorf("corrupt %s: %w", filepath.Join(extDir, "extensions.json"), err)
+	}
+	return reg, nil
+}
+
+func writeFakeRegistry(extDir string, reg []fakeRegistryEntry) error {
+	if reg == nil {
+		reg = []fakeRegistryEntry{}
+	}
+	b, err := json.Marshal(reg)
+	if err != nil {
+		return err
+	}
+	return writeBytes(filepath.Join(extDir, "extensions.json"), b)
+}
+
+func fakeInstalledVersion(reg []fakeRegistryEntry, id string) string {
+	for _, e := range reg {
+		if strings.EqualFold(e.Identifier.ID, id) {
+			return e.Version
+		}
+	}
+	return ""
+}
+
+// installFakeExtension creates the extension's folder and registers it,
+// replacing an installed version
+func installFakeExtension(extDir string, reg []fakeRegistryEntry, id, ver string) ([]fakeRegistryEntry, error) {
+	reg, err := uninstallFakeExtension(extDir, reg, id)
+	if err != nil {
+		return reg, err
+	}
+	publisher, name, _ := strings.Cut(id, ".")
+	manifest, _ := json.MarshalIndent(map[string]string{"publisher": publisher, "name": name, "version": ver}, "", "  ")
+	rel := strings.ToLower(id) + "-" + ver
+	if err := writeBytes(filepath.Join(extDir, rel, "package.json"), manifest); err != nil {
+		return reg, err
+	}
+	e := fakeRegistryEntry{Version: ver, RelativeLocation: rel}
+	e.Identifier.ID = strings.ToLower(id)
+	reg = append(reg, e)
+	return reg, writeFakeRegistry(extDir, reg)
+}
+
+// uninstallFakeExtension removes the extension's folder and registration
+func uninstallFakeExtension(extDir string, reg []fakeRegistryEntry, id string) ([]fakeRegistryEntry, error) {
+	kept := reg[:0]
+	found := false
+	for _, e := range reg {
+		if !strings.EqualFold(e.Identifier.ID, id) {
+			kept = append(kept, e)
+			continue
+		}
+		found = true
+		if err := os.RemoveAll(filepath.Join(extDir, e.RelativeLocation)); err != nil {
+			return reg, err
+		}
+	}
+	if !found {
+		return kept, nil
+	}
+	return kept, writeFakeRegistry(extDir, kept)
+}
+
+// fakeOutcomeArgs collects repeated --outcome <id|glob>=<outcome> switches
+type fakeOutcomeArgs map[string]string
+
+func (a fakeOutcomeArgs) String() string { return "" }
+
+func (a fakeOutcomeArgs) Set(s string) error {
+	id, o, ok := strings.Cut(s, "=")
+	switch {
+	case !ok || id == "":
+		return fmt.Errorf("want <id|glob>=<outcome>, got %q", s)
+	case o != outcomeSuccess && o != outcomeSlow && o != outcomeRateLimited && o != outcomeFailure:
+		return fmt.Errorf("unknown outcome %q (want %s, %s, %s or %s)", o, outcomeSuccess, outcomeSlow, outcomeRateLimited, outcomeFailure)
+	}
+	a[id] = o
+	return nil
+}
+
+// runFakeCodeInit creates (or re-scripts) a fake CLI folder
+func runFakeCodeInit(args []string) error {
+	fs := flag.NewFlagSet("fake-code init", flag.ExitOnError)
+	outcomes := fakeOutcomeArgs{}
+	fs.Var(outcomes, "outcome", "Scripted install outcome: <id|glob>=success|slow|rate-limited|failure (repeatable; \"*\" sets the default)")
+	slow := fs.Duration("slow-delay", fakeSlowDelay, "How long a \"slow\" install takes")
+	tries := fs.Int("rate-limited-attempts", fakeRateLimitedTries, "Attempts a \"rate-limited\" install fails before it succeeds")
+	version := fs.String("version", fakeCodeVersion, "Editor version reported by --version")
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return errors.New("usage: fake-code init <dir> [--outcome <id|glob>=<outcome>]... [--slow-delay 5s] [--rate-limited-attempts 2] [--version 1.99.0]")
+	}
+	dir := args[0]
+	fs.Parse(args[1:])
+	shim, err := fakeCodeCLI(dir)
+	if err != nil {
+		return err
+	}
+	st := fakeCodeState{Version: *version, Outcomes: outcomes, SlowDelay: slow.String(), RateLimitedAttempts: *tries}
+	if err := st.save(filepath.Dir(shim)); err != nil {
+		return err
+	}
+	fmt.Printf("Fake editor CLI: %s\nUse it with: %s=%s\n", shim, fakeCodeEnv, filepath.Dir(shim))
+	return nil
+}
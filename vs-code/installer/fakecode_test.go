@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testMainEnv makes the test binary run main() instead of the tests, so it
+// can stand in for the installer (and for the fake CLI, which re-executes it)
+const testMainEnv = "HYPREDITORS_TEST_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(testMainEnv) != "" {
+		main()
+		os.Exit(exitOK)
+	}
+	os.Exit(m.Run())
+}
+
+// TestSandboxApply runs `apply --sandbox-dir` against the fake CLI and checks
+// what the run left in the sandbox
+func TestSandboxApply(t *testing.T) {
+	tmp := t.TempDir()
+	sandbox := filepath.Join(tmp, "sandbox")
+	reportPath := filepath.Join(tmp, "report.json")
+	cmd := exec.Command(os.Args[0], "apply", "--sandbox-dir", sandbox, "--silent", "--no-estimate",
+		"--batch", "50", "--report", reportPath)
+	cmd.Env = append(os.Environ(), testMainEnv+"=1", fakeCodeEnv+"="+filepath.Join(tmp, "fake-code"))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("apply failed: %v\n%s", err, out)
+	}
+
+	// the sandbox run moved its home to <sandbox>/home
+	home := filepath.Join(sandbox, "home")
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("APPDATA", filepath.Join(home, "AppData", "Roaming"))
+	user := userVSCodeDir(home)
+
+	settings, err := os.ReadFile(filepath.Join(user, settingsFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := parseJSONC(settings)
+	if err != nil {
+		t.Fatalf("written %s does not parse: %v", settingsFile, err)
+	}
+	want, _ := parseJSONC(embeddedSettings)
+	for k := range want.(map[string]interface{}) {
+		if _, ok := got.(map[string]interface{})[k]; !ok {
+			t.Errorf("%s: %s missing", settingsFile, k)
+		}
+	}
+	if b, err := os.ReadFile(filepath.Join(user, keybindingsFile)); err != nil {
+		t.Error(err)
+	} else if _, err := parseJSONC(b); err != nil {
+		t.Errorf("written %s does not parse: %v", keybindingsFile, err)
+	}
+
+	b, err := os.ReadFile(reportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rep reportFile
+	if err := json.Unmarshal(b, &rep); err != nil {
+		t.Fatal(err)
+	}
+	if len(rep.Installed) == 0 || len(rep.Failed) > 0 {
+		t.Fatalf("installed %d, failed %v", len(rep.Installed), rep.Failed)
+	}
+	entries, err := os.ReadDir(editorVariants["code"].extensionsDir(home))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range rep.Installed {
+		found := false
+		for _, e := range entries {
+			found = found || strings.HasPrefix(strings.ToLower(e.Name()), strings.ToLower(id)+"-")
+		}
+		if !found {
+			t.Errorf("%s reported installed, not in the sandbox extensions folder", id)
+		}
+	}
+}
+
+// TestApplyVerifyPolicy applies a payload with a locked key and expects
+// verify to find no drift in the settings.json apply wrote
+func TestApplyVerifyPolicy(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	if err := os.MkdirAll(src, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir("data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join("data", e.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(src, e.Name()), b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	policy := `{"hypreditors.test.locked": true}`
+	if err := os.WriteFile(filepath.Join(src, policyFile), []byte(policy), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	sandbox := filepath.Join(tmp, "sandbox")
+	env := append(os.Environ(), testMainEnv+"=1", fakeCodeEnv+"="+filepath.Join(tmp, "fake-code"))
+	apply := exec.Command(os.Args[0], "apply", "--sandbox-dir", sandbox, "--src", src, "--silent", "--no-estimate", "--batch", "50")
+	apply.Env = env
+	if out, err := apply.CombinedOutput(); err != nil {
+		t.Fatalf("apply failed: %v\n%s", err, out)
+	}
+	verify := exec.Command(os.Args[0], "verify", "--sandbox-dir", sandbox, "--src", src)
+	verify.Env = env
+	if out, err := verify.CombinedOutput(); err != nil {
+		t.Fatalf("verify after apply: %v\n%s", err, out)
+	}
+}
@@ -0,0 +1,352 @@
+// fleet.go
+//
+// `fleet apply --hosts hosts.yaml`: run the installer on a list of machines
+// over SSH. For every host the installer binary is streamed over the
+// connection into a temporary folder (with --src the folder is packed into
+// it first, see pack.go), run there as `apply --silent --report ...` and
+// removed again; the JSON report it leaves is fetched back and saved as
+// <out>/<host>.json. A matrix of all hosts ends the run.
+//
+// hosts.yaml (read with yaml.go) is a list of hosts, either plain or with
+// per-host settings:
+//
+//   hosts:
+//     - dev1.example.com
+//     - host: alice@build-2
+//       binary: ./dist/hypreditors-linux-arm64   # other OS/arch than this one
+//       args: --keymap vim                         # extra apply flags
+//
+// Remote hosts need a POSIX shell (Linux, macOS) and key authentication;
+// ssh runs in batch mode. Payload switches (--payload, --keymap, --set,
+// --marketplace-url, --no-backup, ...) are passed on to every host.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pterm/pterm"
+)
+
+const fleetWorkers = 4
+
+// fleetHost is one entry of hosts.yaml
+type fleetHost struct {
+	Host   string
+	Binary string   // installer for the host's platform (default: this executable)
+	Args   []string // extra apply flags
+}
+
+// fleetResult is the outcome on one host
+type fleetResult struct {
+	Host     string
+	Platform string
+	Report   *reportFile
+	Err      error
+}
+
+func runFleet(args []string) error {
+	if len(args) == 0 || args[0] != "apply" {
+		return errors.New("usage: fleet apply --hosts hosts.yaml [--parallel 4] [--out <dir>]")
+	}
+	fs, opts := newCommandFlags("fleet apply")
+	hostsFile := fs.String("hosts", "", "YAML list of SSH hosts (user@host), optionally with binary/args per host")
+	workers := fs.Int("parallel", fleetWorkers, "Hosts provisioned at the same time")
+	out := fs.String("out", "", "Folder for the per-host JSON reports (default: fleet-<timestamp>)")
+	fs.Parse(args[1:])
+	if *hostsFile == "" {
+		return errors.New("fleet apply: --hosts is required")
+	}
+	if opts.Layers != "" {
+		return errors.New("fleet apply cannot be combined with --layers (the layer files stay on this machine); put the settings into the --src payload")
+	}
+	// these name files on this machine and would be lost on the hosts
+	for _, f := range []struct{ flag, value, instead string }{
+		{"--mandatory-settings", opts.MandatorySettings, `put them into policy.json or the manifest "mandatorySettings" of the --src payload`},
+		{"--ca-cert", opts.CACert, "install the certificate on the hosts and pass its path in their args:"},
+		{"--vsix-dir", opts.VSIXDir, "copy the folder to the hosts and pass its path in their args:"},
+	} {
+		if f.value != "" {
+			return fmt.Errorf("fleet apply cannot be combined with %s (it names a path on this machine); %s", f.flag, f.instead)
+		}
+	}
+	data, err := os.ReadFile(*hostsFile)
+	if err != nil {
+		return err
+	}
+	hosts, err := parseFleetHosts(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", *hostsFile, err)
+	}
+	if len(hosts) == 0 {
+		return fmt.Errorf("%s: no hosts", *hostsFile)
+	}
+	if _, err := exec.LookPath("ssh"); err != nil {
+		return errors.New("ssh not found in PATH")
+	}
+	if *out == "" {
+		*out = "fleet-" + time.Now().Format("2006-01-02_15-04-05")
+	}
+
+	inst, err := NewInstaller(*opts)
+	if err != nil {
+		return fmt.Errorf("cannot initialize installer: %w", err)
+	}
+	defer inst.Close()
+
+	if opts.ReportURL != "" {
+		inst.warnf("--report-url is not passed on to the hosts — their reports are saved in %s", *out)
+	}
+	bins, err := inst.fleetBinaries(hosts)
+	if err != nil {
+		return err
+	}
+	applyArgs := fleetApplyArgs(opts)
+	if inst.dryRun {
+		for _, h := range hosts {
+			inst.logf("DRY-RUN: would run `%s` on %s", strings.Join(append(applyArgs, h.Args...), " "), h.Host)
+		}
+		return nil
+	}
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		return err
+	}
+
+	results := make([]fleetResult, len(hosts))
+	var mu sync.Mutex
+	done := 0
+	parallel(len(hosts), *workers, func(idx int) {
+		h := hosts[idx]
+		hostArgs := append(append([]string{}, applyArgs...), h.Args...)
+		res := inst.fleetApplyHost(h, bins, hostArgs, *out)
+		mu.Lock()
+		defer mu.Unlock()
+		results[idx] = res
+		done++
+		if res.Err != nil {
+			inst.errorf("[%d/%d] %s: %v", done, len(hosts), h.Host, res.Err)
+		} else {
+			inst.logf("[%d/%d] %s: exit %d", done, len(hosts), h.Host, res.Report.ExitCode)
+		}
+	})
+	return inst.printFleetMatrix(results, *out)
+}
+
+// parseFleetHosts reads hosts.yaml (yaml.go): a list, optionally under
+// "hosts:", of host names or of host/binary/args mappings
+func parseFleetHosts(data []byte) ([]fleetHost, error) {
+	doc, err := parseYAML(data)
+	if err != nil {
+		return nil, err
+	}
+	if m, ok := doc.(map[string]interface{}); ok {
+		for k := range m {
+			if k != "hosts" {
+				return nil, fmt.Errorf("unknown key %q (want hosts)", k)
+			}
+		}
+		doc = m["hosts"]
+	}
+	items, ok := doc.([]interface{})
+	if !ok && doc != nil {
+		return nil, errors.New("expected a list of hosts")
+	}
+	hosts := make([]fleetHost, 0, len(items))
+	for n, item := range items {
+		var h fleetHost
+		switch v := item.(type) {
+		case string:
+			h.Host = v
+		case map[string]interface{}:
+			for key, val := range v {
+				switch key {
+				case "host", "binary":
+					s, ok := val.(string)
+					if !ok {
+						return nil, fmt.Errorf("entry %d: %s must be a string", n+1, key)
+					}
+					if key == "host" {
+						h.Host = s
+					} else {
+						h.Binary = s
+					}
+				case "args":
+					switch a := val.(type) {
+					case string:
+						h.Args = strings.Fields(a)
+					case []interface{}:
+						for _, arg := range a {
+							s, ok := arg.(string)
+							if !ok {
+								return nil, fmt.Errorf("entry %d: args must be strings", n+1)
+							}
+							h.Args = append(h.Args, s)
+						}
+					default:
+						return nil, fmt.Errorf("entry %d: args must be a string or a list", n+1)
+					}
+				default:
+					return nil, fmt.Errorf("entry %d: unknown key %q (want host, binary, args)", n+1, key)
+				}
+			}
+		default:
+			return nil, fmt.Errorf("entry %d: expected a host name or a host: mapping", n+1)
+		}
+		if err := checkSSHHost(h.Host); err != nil {
+			return nil, fmt.Errorf("entry %d: %w", n+1, err)
+		}
+		hosts = append(hosts, h)
+	}
+	return hosts, nil
+}
+
+// fleetApplyArgs is the apply command line run on every host: the payload
+// switches of this run, without the ones naming local paths (the --src
+// payload travels inside the binary; --mandatory-settings, --ca-cert and
+// --vsix-dir are refused before) and without --report-url, whose token
+// file stays here too (the fleet collects the reports itself)
+func fleetApplyArgs(opts *Options) []string {
+	o := *opts
+	o.SrcOverride, o.BackupDir, o.UserDataDir = "", "", ""
+	o.ReportURL, o.ReportTokenFile = "", ""
+	return serviceArgs(&o)
+}
+
+// fleetBinaries reads every installer binary the hosts need, keyed by
+// path ("" is this executable); with --src the payload is packed into each
+func (i *Installer) fleetBinaries(hosts []fleetHost) (map[string][]byte, error) {
+	bins := make(map[string][]byte)
+	for _, h := range hosts {
+		if _, ok := bins[h.Binary]; ok {
+			continue
+		}
+		path := h.Binary
+		if path == "" {
+			exe, err := os.Executable()
+			if err != nil {
+				return nil, fmt.Errorf("cannot determine exe path: %w", err)
+			}
+			path = exe
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if i.srcOverride != "" {
+			if b, _, err = packInto(b, i.baseDir); err != nil {
+				return nil, err
+			}
+		}
+		bins[h.Binary] = b
+	}
+	return bins, nil
+}
+
+// remotePlatform maps `uname -sm` output to GOOS/GOARCH
+func remotePlatform(uname string) string {
+	f := strings.Fields(strings.ToLower(uname))
+	if len(f) != 2 {
+		return ""
+	}
+	arch := f[1]
+	switch arch {
+	case "x86_64":
+		arch = "amd64"
+	case "aarch64", "armv8l":
+		arch = "arm64"
+	case "i386", "i686":
+		arch = "386"
+	}
+	return f[0] + "/" + arch
+}
+
+// fleetApplyHost runs the installer on one host and saves its report
+func (i *Installer) fleetApplyHost(h fleetHost, bins map[string][]byte, args []string, out string) fleetResult {
+	res := fleetResult{Host: h.Host}
+	if res.Err = checkSSHHost(h.Host); res.Err != nil {
+		return res
+	}
+	uname, err := sshRun(sshTimeout, h.Host, "uname -sm", nil)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	res.Platform = remotePlatform(uname)
+	if local := runtime.GOOS + "/" + runtime.GOARCH; h.Binary == "" && res.Platform != local {
+		res.Err = fmt.Errorf("host is %s, this installer is %s — set binary: for it in the hosts file", res.Platform, local)
+		return res
+	}
+	quoted := make([]string, len(args))
+	for n, a := range args {
+		quoted[n] = shellQuote(a)
+	}
+	script := `d=$(mktemp -d) || exit 1
+trap 'rm -rf "$d"' EXIT
+cat > "$d/hypreditors" && chmod +x "$d/hypreditors" || exit 1
+"$d/hypreditors" ` + strings.Join(quoted, " ") + ` --report "$d/report.json" >/dev/null
+rc=$?
+cat "$d/report.json" 2>/dev/null
+exit $rc
+`
+	i.logToFile("fleet: %s (%s): %s", h.Host, res.Platform, strings.Join(args, " "))
+	stdout, runErr := sshRun(remoteInstallTimeout, h.Host, script, bins[h.Binary])
+	var rep reportFile
+	if err := json.Unmarshal([]byte(stdout), &rep); err != nil {
+		if runErr == nil {
+			runErr = errors.New("the installer left no report")
+		}
+		res.Err = runErr
+		return res
+	}
+	res.Report = &rep
+	if runErr != nil && rep.ExitCode == exitOK {
+		res.Err = runErr
+	}
+	name := strings.NewReplacer("@", "_", ":", "_", "/", "_", "\\", "_").Replace(h.Host) + ".json"
+	if err := writeBytes(filepath.Join(out, name), []byte(stdout)); err != nil {
+		i.warnf("cannot save the report of %s: %v", h.Host, err)
+	}
+	return res
+}
+
+// printFleetMatrix renders the per-host outcome and fails if any host did
+func (i *Installer) printFleetMatrix(results []fleetResult, out string) error {
+	rows := [][]string{{"Host", "Platform", "Result", "Exit", "Installed", "Failed", "Files written"}}
+	failed := 0
+	for _, r := range results {
+		row := []string{r.Host, r.Platform, "ok", "", "", "", ""}
+		if r.Report != nil {
+			row[3] = fmt.Sprint(r.Report.ExitCode)
+			row[4] = fmt.Sprint(len(r.Report.Installed))
+			row[5] = fmt.Sprint(len(r.Report.Failed))
+			row[6] = fmt.Sprint(len(r.Report.Written))
+		}
+		switch {
+		case r.Err != nil:
+			row[2] = "error: " + truncate(r.Err.Error(), 50)
+			failed++
+		case r.Report.ExitCode != exitOK:
+			row[2] = "failed"
+			failed++
+		}
+		rows = append(rows, row)
+		i.logToFile("fleet: %s: %s", r.Host, strings.Join(row[2:], " "))
+	}
+	pterm.DefaultSection.Println("Fleet")
+	pterm.DefaultTable.WithHasHeader().WithData(rows).Render()
+	i.logf("Reports saved in %s", out)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d hosts failed", failed, len(results))
+	}
+	i.logf("All %d hosts applied", len(results))
+	return nil
+}
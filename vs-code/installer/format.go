@@ -0,0 +1,197 @@
+// format.go
+//
+// Deterministic formatting of the settings.json the installer writes. By
+// default the payload is written as authored (its key order, indentation and
+// comments). With --json-indent (2, 4, tab, ...) and/or --json-sort-keys
+// (manifest: "jsonIndent", "sortKeys") the settings payload is re-rendered
+// once, before anything is planned, merged or written:
+//
+//   - one top-level key per line, values indented consistently (keys of
+//     nested objects sorted)
+//   - keys in payload order, or sorted with --json-sort-keys
+//   - comments before a key and at the end of its line move with the key;
+//     comments inside nested values are lost
+//
+// Because the payload itself is normalized, repeated runs, three-way merges
+// and dotfile-repo diffs all see the same bytes.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// jsonStyle is the requested settings.json layout; the zero value keeps the
+// payload as authored
+type jsonStyle struct {
+	Indent   string
+	SortKeys bool
+}
+
+func (s jsonStyle) isZero() bool {
+	return s.Indent == "" && !s.SortKeys
+}
+
+// parseJSONIndent turns "2", "4" or "tab" into the indent string
+func parseJSONIndent(s string) (string, error) {
+	if s == "" {
+		return "", nil
+	}
+	if s == "tab" || s == `\t` {
+		return "\t", nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 || n > 8 {
+		return "", fmt.Errorf("bad JSON indent %q (want 1-8 or tab)", s)
+	}
+	return strings.Repeat(" ", n), nil
+}
+
+// jsoncChunk is one top-level member with the comments that belong to it
+type jsoncChunk struct {
+	key      string
+	leading  []string // comments on the lines above the member
+	value    []byte
+	trailing string // comment after the member on its line
+}
+
+// formatJSONC re-renders a JSONC object in the given style
+func formatJSONC(data []byte, style jsonStyle) ([]byte, error) {
+	members, open, close, err := jsoncMembers(data)
+	if err != nil {
+		return nil, err
+	}
+	indent := style.Indent
+	if indent == "" {
+		indent = "  "
+	}
+
+	var chunks []jsoncChunk
+	gapStart := open + 1
+	for idx, m := range members {
+		trailing, leading := splitGapComments(data[gapStart:m.Start], idx > 0)
+		if idx > 0 {
+			chunks[idx-1].trailing = trailing
+		}
+		v, err := parseJSONC(data[m.ValueStart:m.End])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", m.Key, err)
+		}
+		chunks = append(chunks, jsoncChunk{key: m.Key, leading: leading, value: encodeJSONValue(v, indent)})
+		gapStart = m.End
+	}
+	trailing, footer := splitGapComments(data[gapStart:close], len(chunks) > 0)
+	if len(chunks) > 0 {
+		chunks[len(chunks)-1].trailing = trailing
+	}
+	if style.SortKeys {
+		sort.SliceStable(chunks, func(a, b int) bool { return chunks[a].key < chunks[b].key })
+	}
+
+	var out bytes.Buffer
+	if header := bytes.TrimSpace(data[:open]); len(header) > 0 {
+		out.Write(header)
+		out.WriteByte('\n')
+	}
+	out.WriteString("{\n")
+	for idx, c := range chunks {
+		for _, l := range c.leading {
+			out.WriteString(indent + l + "\n")
+		}
+		name, _ := json.Marshal(c.key)
+		out.WriteString(indent + string(name) + ": ")
+		out.Write(c.value)
+		if idx < len(chunks)-1 {
+			out.WriteByte(',')
+		}
+		if c.trailing != "" {
+			out.WriteString(" " + c.trailing)
+		}
+		out.WriteByte('\n')
+	}
+	for _, l := range footer {
+		out.WriteString(indent + l + "\n")
+	}
+	out.WriteString("}\n")
+	return out.Bytes(), nil
+}
+
+// encodeJSONValue renders a top-level member value indented with indent
+func encodeJSONValue(v interface{}, indent string) []byte {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent(indent, indent)
+	if err := enc.Encode(v); err != nil {
+		b, _ := json.Marshal(v)
+		return b
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n")
+}
+
+// splitGapComments returns the comments of the whitespace/comma/comment gap
+// between two members: the one on the first line (belonging to the member
+// before, when there is one) and those on the following lines
+func splitGapComments(gap []byte, hasPrev bool) (trailing string, leading []string) {
+	firstLine := hasPrev
+	for k := 0; k < len(gap); {
+		switch {
+		case gap[k] == '\n':
+			firstLine = false
+			k++
+		case bytes.HasPrefix(gap[k:], []byte("//")):
+			end := bytes.IndexByte(gap[k:], '\n')
+			if end < 0 {
+				end = len(gap) - k
+			}
+			c := strings.TrimRight(string(gap[k:k+end]), " \t\r")
+			if firstLine && trailing == "" {
+				trailing = c
+			} else {
+				leading = append(leading, c)
+			}
+			k += end
+		case bytes.HasPrefix(gap[k:], []byte("/*")):
+			end := bytes.Index(gap[k+2:], []byte("*/"))
+			if end < 0 {
+				end = len(gap) - k - 2
+			} else {
+				end += 2
+			}
+			c := string(gap[k : k+2+end])
+			if firstLine && trailing == "" && !strings.Contains(c, "\n") {
+				trailing = c
+			} else {
+				for j, l := range strings.Split(c, "\n") {
+					if l = strings.TrimSpace(l); j > 0 && strings.HasPrefix(l, "*") {
+						l = " " + l
+					}
+					leading = append(leading, l)
+				}
+			}
+			k += 2 + end
+		default:
+			k++
+		}
+	}
+	return trailing, leading
+}
+
+// formatSettings applies the configured style to settings data; with the
+// default style or on parse errors the data is returned unchanged
+func (i *Installer) formatSettings(data []byte) []byte {
+	if i.jsonStyle.isZero() || len(bytes.TrimSpace(data)) == 0 {
+		return data
+	}
+	out, err := formatJSONC(data, i.jsonStyle)
+	if err != nil {
+		i.warnf("cannot format %s: %v — written as is", settingsFile, err)
+		return data
+	}
+	return out
+}
@@ -0,0 +1,243 @@
+// fragments.go
+//
+// Settings composed from fragments: every settings.d/*.json of the payload
+// (data/settings.d/ when embedded, data/<preset>/settings.d/ for presets,
+// <src>/settings.d/ with --src) is deep-merged into settings.json in lexical
+// file order, like conf.d. Objects merge key by key (so "[go]" blocks from
+// several fragments combine), anything else is replaced by the later file.
+// Keys keep their place in settings.json; new keys are appended in fragment
+// order, their values formatted as in the fragment.
+//
+// Language fragments languages/<id>.json (go.json, python.json, ...) hold
+// the settings of one language and are merged afterwards as the
+// language-scoped block "[<id>]", so a language preset is self-contained.
+// Overrides address keys inside such blocks as "[go].editor.tabSize".
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	settingsFragmentsDir = "settings.d"
+	languagesDir         = "languages"
+)
+
+// fragmentDirs are the payload folders holding settings fragments
+var fragmentDirs = []string{settingsFragmentsDir, languagesDir}
+
+// payloadDirs are all payload folders of JSON files, shipped by pack,
+// bundle and presets along with the top-level payload files
+var payloadDirs = append(append([]string{}, fragmentDirs...), migrationsDir, workspacePayloadDir)
+
+// embeddedDirFiles are the files of the embedded payload's folders (path
+// relative to the payload, e.g. "settings.d/ui.json" -> content). They are
+// read from embeddedDirRoot of embeddedDirFS (data/ or the chosen preset's
+// folder of the embedded data, the zip of a packed payload) on first use,
+// so runs and subcommands that never need them don't hold copies in memory.
+var (
+	embeddedDirFS    fs.FS = embeddedData
+	embeddedDirRoot        = presetsRoot
+	embeddedDirFiles map[string][]byte
+)
+
+// embeddedPayloadDirFiles returns embeddedDirFiles, reading them first if needed
+func embeddedPayloadDirFiles() map[string][]byte {
+	if embeddedDirFiles == nil {
+		embeddedDirFiles = readEmbeddedDirs(embeddedDirFS, embeddedDirRoot)
+	}
+	return embeddedDirFiles
+}
+
+// hasEmbeddedDirFiles reports whether the embedded payload has folder files
+// without reading them
+func hasEmbeddedDirFiles() bool {
+	if embeddedDirFiles != nil {
+		return len(embeddedDirFiles) > 0
+	}
+	for _, dir := range payloadDirs {
+		entries, _ := fs.ReadDir(embeddedDirFS, path.Join(embeddedDirRoot, dir))
+		for _, e := range entries {
+			if !e.IsDir() && isPayloadDirPath(path.Join(dir, e.Name())) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isPayloadDirPath reports whether a payload-relative path is a file of one
+// of the payload folders
+func isPayloadDirPath(name string) bool {
+	dir, file := path.Split(name)
+	return strings.HasSuffix(file, ".json") && containsString(payloadDirs, strings.TrimSuffix(dir, "/"))
+}
+
+// readEmbeddedDirs reads the payload folders under root of fsys
+func readEmbeddedDirs(fsys fs.FS, root string) map[string][]byte {
+	res := make(map[string][]byte)
+	for _, dir := range payloadDirs {
+		entries, err := fs.ReadDir(fsys, path.Join(root, dir))
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			name := path.Join(dir, e.Name())
+			if e.IsDir() || !isPayloadDirPath(name) {
+				continue
+			}
+			if b, err := fs.ReadFile(fsys, path.Join(root, name)); err == nil {
+				res[name] = b
+			}
+		}
+	}
+	return res
+}
+
+// readPayloadDirs reads the payload folders under dir from disk
+func readPayloadDirs(dir string) (map[string][]byte, error) {
+	res := make(map[string][]byte)
+	for _, sub := range payloadDirs {
+		paths, err := filepath.Glob(filepath.Join(dir, sub, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range paths {
+			b, err := os.ReadFile(p)
+			if err != nil {
+				return nil, fmt.Errorf("cannot read %s: %w", p, err)
+			}
+			res[path.Join(sub, filepath.Base(p))] = b
+		}
+	}
+	return res, nil
+}
+
+// payloadDirFiles returns the payload folders' files of the payload source
+func (i *Installer) payloadDirFiles() (map[string][]byte, error) {
+	if i.useEmbedded {
+		return embeddedPayloadDirFiles(), nil
+	}
+	return readPayloadDirs(i.baseDir)
+}
+
+// filesIn returns the files of one payload folder, by payload-relative path
+func filesIn(files map[string][]byte, dir string) map[string][]byte {
+	res := make(map[string][]byte)
+	for name, b := range files {
+		if path.Dir(name) == dir {
+			res[name] = b
+		}
+	}
+	return res
+}
+
+// mergeSettingsFragments merges the fragments into the settings payload:
+// settings.d/ first, then the language fragments
+func (i *Installer) mergeSettingsFragments() error {
+	files, err := i.payloadDirFiles()
+	if err != nil {
+		return err
+	}
+	frags := make(map[string][]byte)
+	for _, dir := range fragmentDirs {
+		for name, b := range filesIn(files, dir) {
+			frags[name] = b
+		}
+	}
+	if len(frags) == 0 {
+		return nil
+	}
+	data, err := mergeFragments(i.settingsData, frags)
+	if err != nil {
+		return err
+	}
+	i.settingsData = data
+	i.logf("Merged %d settings fragments (%s)", len(frags), strings.Join(fragmentDirs, ", "))
+	return nil
+}
+
+// mergeFragments merges fragments (payload-relative path -> JSONC object)
+// into base: each folder in fragmentDirs order, files in lexical order.
+// A language fragment languages/<id>.json is merged as "[<id>]": {...}.
+func mergeFragments(base []byte, frags map[string][]byte) ([]byte, error) {
+	data := base
+	cur := map[string]interface{}{}
+	if len(strings.TrimSpace(string(stripJSONC(data)))) > 0 {
+		v, err := parseJSONC(data)
+		obj, ok := v.(map[string]interface{})
+		if err != nil || !ok {
+			return nil, fmt.Errorf("%s is not a JSON object", settingsFile)
+		}
+		cur = obj
+	}
+	set := func(key string, raw []byte, v interface{}) error {
+		old, exists := cur[key]
+		_, oldObj := old.(map[string]interface{})
+		_, newObj := v.(map[string]interface{})
+		if exists && oldObj && newObj {
+			v = deepMerge(old, v)
+			raw = encodeJSONValue(v, "  ")
+		}
+		cur[key] = v
+		var err error
+		data, err = jsoncSet(data, key, raw)
+		return err
+	}
+
+	for _, dir := range fragmentDirs {
+		for _, name := range sortedKeys(filesIn(frags, dir)) {
+			frag := frags[name]
+			if dir == languagesDir {
+				v, err := parseJSONC(frag)
+				if _, ok := v.(map[string]interface{}); err != nil || !ok {
+					return nil, fmt.Errorf("%s: not a JSON object", name)
+				}
+				key := "[" + strings.TrimSuffix(path.Base(name), ".json") + "]"
+				if err := set(key, bytes.TrimSpace(frag), v); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			members, _, _, err := jsoncMembers(frag)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			for _, m := range members {
+				raw := frag[m.ValueStart:m.End]
+				v, err := parseJSONC(raw)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %s: %w", name, m.Key, err)
+				}
+				if err := set(m.Key, raw, v); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return data, nil
+}
+
+// deepMerge merges src over dst: objects key by key, other values replaced
+func deepMerge(dst, src interface{}) interface{} {
+	d, ok1 := dst.(map[string]interface{})
+	s, ok2 := src.(map[string]interface{})
+	if !ok1 || !ok2 {
+		return src
+	}
+	out := make(map[string]interface{}, len(d)+len(s))
+	for k, v := range d {
+		out[k] = v
+	}
+	for k, v := range s {
+		out[k] = deepMerge(out[k], v)
+	}
+	return out
+}
@@ -0,0 +1,90 @@
+// geany.go
+//
+// Geany (--geany). The payload's geany/ folder holds
+//
+//   geany.conf              the main preferences
+//   keybindings.conf        likewise
+//   colorschemes/*.conf     color schemes
+//   plugins/<name>/*.conf   plugin preferences (e.g.
+//                           plugins/saveactions/saveactions.conf)
+//
+// all written to Geany's config folder: $XDG_CONFIG_HOME/geany
+// (~/.config/geany) on Linux and macOS, %APPDATA%\geany on Windows. Geany
+// saves geany.conf when it exits, so it should be closed first.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+const geanyDir = "geany"
+
+// geanyTopFiles are the payload files written to the top of the config folder
+var geanyTopFiles = []string{"geany.conf", "keybindings.conf"}
+
+// geanyConfigDir is Geany's config folder
+func geanyConfigDir(home string) string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.Getenv("APPDATA"), "geany")
+	}
+	if config := os.Getenv("XDG_CONFIG_HOME"); config != "" {
+		return filepath.Join(config, "geany")
+	}
+	return filepath.Join(home, ".config", "geany")
+}
+
+// geanyPayloadFile reports whether name (relative to geany/) is deployed
+func geanyPayloadFile(name string) bool {
+	dir, ext := path.Dir(name), path.Ext(name)
+	switch {
+	case containsString(geanyTopFiles, name):
+		return true
+	case dir == "colorschemes":
+		return ext == ".conf"
+	case strings.HasPrefix(name, "plugins/") && strings.Count(name, "/") == 2:
+		return ext == ".conf"
+	}
+	return false
+}
+
+// applyGeany deploys the payload's geany/ folder
+func (i *Installer) applyGeany() error {
+	files, err := i.backendFiles(geanyDir)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("the payload has no %s/ folder", geanyDir)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	conf := geanyConfigDir(home)
+	i.logf("Geany config folder: %s", conf)
+
+	var errs []error
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !geanyPayloadFile(name) {
+			i.warnf("%s/%s is not a Geany payload file — skipped", geanyDir, name)
+			continue
+		}
+		if err := i.deployFile("geany:"+name, filepath.Join(conf, filepath.FromSlash(name)), files[name]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
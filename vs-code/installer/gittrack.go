@@ -0,0 +1,266 @@
+// gittrack.go
+//
+// Git history of the editor config (--git). The managed files are committed
+// right before and right after every apply, so `git log -p` shows what each
+// run changed and `git checkout` is a manual rollback. When the user dir
+// already lives inside a git work tree (a dotfiles repo) the commits go
+// there, touching only the managed paths; otherwise a repo is initialized
+// in the user dir with a .gitignore that admits just the managed files.
+// When settings.json holds resolved secrets, the commit is built in a
+// scratch index with the placeholders in their place, so no value reaches
+// the history; git status then shows the live file as modified.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const gitTimeout = 30 * time.Second
+
+// gitIgnore keeps caches, backups and workspace storage out of a fresh repo
+const gitIgnore = `# managed by hypreditors: only the config files are tracked
+*
+!.gitignore
+!settings.json
+!keybindings.json
+!snippets/
+!snippets/**
+!profiles/
+!profiles/**
+`
+
+// gitRepo is the repository tracking the user dir
+type gitRepo struct {
+	top   string // work tree root
+	index string // index file, "" = the repo's own
+}
+
+func (g gitRepo) run(args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), gitTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", g.top}, args...)...)
+	if g.index != "" {
+		cmd.Env = append(os.Environ(), "GIT_INDEX_FILE="+g.index)
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return string(out), errors.New(strings.TrimSpace(string(out)))
+	}
+	return string(out), nil
+}
+
+// openGitRepo finds the repository containing the user dir or creates one
+func (i *Installer) openGitRepo() (gitRepo, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return gitRepo{}, errors.New("git not found in PATH")
+	}
+	out, err := runCommandWithTimeout(gitTimeout, "git", "-C", i.vscodeUser, "rev-parse", "--show-toplevel")
+	if err == nil {
+		return gitRepo{top: strings.TrimSpace(out)}, nil
+	}
+	if i.dryRun {
+		i.logf("DRY-RUN: would initialize a git repo in %s", i.vscodeUser)
+		return gitRepo{}, nil
+	}
+	g := gitRepo{top: i.vscodeUser}
+	if _, err := g.run("init"); err != nil {
+		return gitRepo{}, err
+	}
+	if err := writeBytes(filepath.Join(i.vscodeUser, ".gitignore"), []byte(gitIgnore)); err != nil {
+		return gitRepo{}, err
+	}
+	i.logf("Initialized git repo for config history in %s", i.vscodeUser)
+	return g, nil
+}
+
+// gitManagedPaths lists the existing managed paths of the user dir
+func (i *Installer) gitManagedPaths(isNewRepo bool) []string {
+	var res []string
+	names := []string{settingsFile, keybindingsFile, "snippets", "profiles"}
+	if isNewRepo {
+		names = append(names, ".gitignore")
+	}
+	for _, n := range names {
+		if p := filepath.Join(i.vscodeUser, n); exists(p) {
+			res = append(res, p)
+		}
+	}
+	return res
+}
+
+// gitCommit commits the managed files with msg when they changed (--git)
+func (i *Installer) gitCommit(msg string) {
+	if !i.gitTrack {
+		return
+	}
+	g, err := i.openGitRepo()
+	if err != nil {
+		i.warnf("git tracking disabled: %v", err)
+		i.gitTrack = false
+		return
+	}
+	if i.dryRun {
+		i.logf("DRY-RUN: would commit managed config files: %q", msg)
+		return
+	}
+	paths := i.gitManagedPaths(samePath(g.top, i.vscodeUser))
+	if len(paths) == 0 {
+		return
+	}
+	if len(i.secrets) > 0 {
+		i.gitCommitRedacted(g, paths, msg)
+		return
+	}
+	if _, err := g.run(append([]string{"add", "-A", "--"}, paths...)...); err != nil {
+		i.warnf("git add failed: %v", err)
+		return
+	}
+	// nothing staged for the managed paths: no empty commit
+	if _, err := g.run(append([]string{"diff", "--cached", "--quiet", "--"}, paths...)...); err == nil {
+		i.logToFile("git: no changes to commit (%s)", msg)
+		return
+	}
+	args := append(g.identity(), "commit", "-q", "-m", msg)
+	// --only semantics: unrelated staged changes of a dotfiles repo stay staged
+	if _, err := g.run(append(append(args, "--"), paths...)...); err != nil {
+		i.warnf("git commit failed: %v", err)
+		return
+	}
+	i.logf("git: committed %q in %s", msg, g.top)
+}
+
+// identity supplies a committer when the user has none configured
+func (g gitRepo) identity() []string {
+	if out, _ := g.run("config", "user.email"); strings.TrimSpace(out) == "" {
+		return []string{"-c", "user.name=hypreditors", "-c", "user.email=hypreditors@localhost"}
+	}
+	return nil
+}
+
+// gitCommitRedacted commits the managed paths with their resolved secrets
+// turned back into placeholders. The tree is built in a scratch index, so
+// unrelated staged changes of a dotfiles repo stay as they are.
+func (i *Installer) gitCommitRedacted(g gitRepo, paths []string, msg string) {
+	scratch, err := os.MkdirTemp("", "hypreditors-git-*")
+	if err != nil {
+		i.warnf("git commit failed: %v", err)
+		return
+	}
+	defer os.RemoveAll(scratch)
+	t := gitRepo{top: g.top, index: filepath.Join(scratch, "index")}
+
+	head, err := g.run("rev-parse", "-q", "--verify", "HEAD")
+	head = strings.TrimSpace(head)
+	if err == nil {
+		if _, err := t.run("read-tree", "HEAD"); err != nil {
+			i.warnf("git commit failed: %v", err)
+			return
+		}
+	}
+	if _, err := t.run(append([]string{"add", "-A", "--"}, paths...)...); err != nil {
+		i.warnf("git add failed: %v", err)
+		return
+	}
+	if err := i.gitStageRedacted(t, paths, scratch); err != nil {
+		i.warnf("git add failed: %v", err)
+		return
+	}
+	tree, err := t.run("write-tree")
+	if err != nil {
+		i.warnf("git commit failed: %v", err)
+		return
+	}
+	tree = strings.TrimSpace(tree)
+	args := append(g.identity(), "commit-tree", tree, "-m", msg)
+	if head != "" {
+		if old, _ := g.run("rev-parse", "HEAD^{tree}"); strings.TrimSpace(old) == tree {
+			i.logToFile("git: no changes to commit (%s)", msg)
+			return
+		}
+		args = append(args, "-p", head)
+	}
+	commit, err := g.run(args...)
+	if err != nil {
+		i.warnf("git commit failed: %v", err)
+		return
+	}
+	if _, err := g.run("update-ref", "-m", "commit: "+msg, "HEAD", strings.TrimSpace(commit)); err != nil {
+		i.warnf("git commit failed: %v", err)
+		return
+	}
+	// the repo's index follows the new commit for the managed paths only
+	if _, err := g.run(append([]string{"reset", "-q", "--"}, paths...)...); err != nil {
+		i.warnf("git reset failed: %v", err)
+	}
+	i.logf("git: committed %q in %s (secrets as placeholders)", msg, g.top)
+}
+
+// gitStageRedacted replaces the staged blobs of files holding resolved
+// secrets with their placeholder version
+func (i *Installer) gitStageRedacted(t gitRepo, paths []string, scratch string) error {
+	n := 0
+	for _, root := range paths {
+		err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			data, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			masked := i.unresolveSecrets(data)
+			if string(masked) == string(data) {
+				return nil
+			}
+			rel, err := relRealPath(t.top, p)
+			if err != nil {
+				return err
+			}
+			n++
+			tmp := filepath.Join(scratch, fmt.Sprintf("blob%d", n))
+			if err := os.WriteFile(tmp, masked, 0o600); err != nil {
+				return err
+			}
+			sha, err := t.run("hash-object", "-w", "--", tmp)
+			if err != nil {
+				return err
+			}
+			_, err = t.run("update-index", "--add", "--cacheinfo", "100644,"+strings.TrimSpace(sha)+","+filepath.ToSlash(rel))
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// relRealPath is p relative to root, both with symlinks resolved (git
+// reports the work tree that way)
+func relRealPath(root, p string) (string, error) {
+	if r, err := filepath.EvalSymlinks(root); err == nil {
+		root = r
+	}
+	if r, err := filepath.EvalSymlinks(p); err == nil {
+		p = r
+	}
+	return filepath.Rel(root, p)
+}
+
+// gitApplyMessage describes the apply run for the after-commit
+func (i *Installer) gitApplyMessage() string {
+	msg := "hypreditors: apply payload " + shortHash(i.payloadHash())
+	if len(i.report.Written) > 0 {
+		msg += " (" + strings.Join(i.report.Written, ", ") + ")"
+	}
+	return msg
+}
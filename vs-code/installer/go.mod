@@ -2,7 +2,11 @@ module vscode-installer
 
 go 1.25.2
 
-require github.com/pterm/pterm v0.12.82
+require (
+	github.com/fsnotify/fsnotify v1.8.0
+	github.com/pterm/pterm v0.12.82
+	golang.org/x/term v0.32.0
+)
 
 require (
 	atomicgo.dev/cursor v0.2.0 // indirect
@@ -15,6 +19,5 @@ require (
 	github.com/rivo/uniseg v0.4.7 // indirect
 	github.com/xo/terminfo v0.0.0-20220910002029-abceb7e1c41e // indirect
 	golang.org/x/sys v0.33.0 // indirect
-	golang.org/x/term v0.32.0 // indirect
 	golang.org/x/text v0.26.0 // indirect
 )
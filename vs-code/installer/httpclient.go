@@ -0,0 +1,145 @@
+// httpclient.go
+//
+// Shared HTTP access. Registry queries (Marketplace, Open VSX, mirrors),
+// size estimates and .vsix downloads all go through one transport, so
+// connections are kept alive and reused across the run instead of one
+// handshake per request. Requests that fail with a network error, 429 or
+// a 5xx are retried with exponential backoff and jitter.
+//
+// --ca-cert adds a PEM bundle to the system roots, for corporate proxies
+// that re-sign TLS traffic; --debug writes every request (method, URL,
+// status, time, retries) to the log file.
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"time"
+)
+
+const (
+	httpRetries      = 3 // retries after the first attempt
+	httpRetryBackoff = 500 * time.Millisecond
+	httpRetryMax     = 8 * time.Second
+)
+
+// httpTransport is shared by all clients, so the pool of idle
+// connections is shared too
+var httpTransport = &http.Transport{
+	Proxy:                 http.ProxyFromEnvironment,
+	ForceAttemptHTTP2:     true,
+	TLSHandshakeTimeout:   10 * time.Second,
+	ResponseHeaderTimeout: registryTimeoutSec * time.Second,
+	IdleConnTimeout:       90 * time.Second,
+	MaxIdleConns:          32,
+	MaxIdleConnsPerHost:   downloadWorkers,
+}
+
+// registryClient is for metadata requests with a small, bounded answer
+var registryClient = &http.Client{Transport: httpTransport, Timeout: registryTimeoutSec * time.Second}
+
+// downloadClient has no overall timeout (large packages on slow links),
+// only the wait for the response is limited; a broken transfer is resumed
+// by the next fetch
+var downloadClient = &http.Client{Transport: httpTransport}
+
+// configureHTTP applies --ca-cert to the shared transport and --debug to
+// this installer's requests
+func (i *Installer) configureHTTP(caFile string, debug bool) error {
+	i.httpDebug = debug
+	if caFile == "" {
+		return nil
+	}
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return fmt.Errorf("--ca-cert: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		// no system roots available (older Windows builds): only the bundle
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return fmt.Errorf("--ca-cert: no PEM certificates in %s", caFile)
+	}
+	httpTransport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	i.logToFile("Trusting the certificates of %s in addition to the system roots", caFile)
+	return nil
+}
+
+// retryable reports whether a request that ended with resp/err is worth
+// sending again
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// retryDelay is the wait before attempt n (1-based): exponential backoff
+// with jitter, or the server's Retry-After when it sends seconds
+func retryDelay(n int, resp *http.Response) time.Duration {
+	if resp != nil {
+		var secs int
+		if _, err := fmt.Sscanf(resp.Header.Get("Retry-After"), "%d", &secs); err == nil && secs > 0 {
+			if d := time.Duration(secs) * time.Second; d < httpRetryMax {
+				return d
+			}
+			return httpRetryMax
+		}
+	}
+	d := httpRetryBackoff << (n - 1)
+	if d > httpRetryMax {
+		d = httpRetryMax
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// doHTTP sends req with client, retrying transient failures. A non-2xx
+// status that is not retried (or still fails after the last attempt) is
+// returned as the response, for the caller to judge. With --debug every
+// attempt is written to the log file.
+func (i *Installer) doHTTP(client *http.Client, req *http.Request) (*http.Response, error) {
+	// a body that cannot be replayed is sent once
+	attempts := httpRetries
+	if req.Body != nil && req.GetBody == nil {
+		attempts = 0
+	}
+	for n := 0; ; n++ {
+		if n > 0 && req.Body != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+		t0 := time.Now()
+		resp, err := client.Do(req)
+		if i.httpDebug {
+			status := ""
+			if err != nil {
+				status = err.Error()
+			} else {
+				status = resp.Status
+			}
+			i.logToFile("HTTP %s %s -> %s (%s, attempt %d)", req.Method, req.URL.Redacted(), status,
+				time.Since(t0).Round(time.Millisecond), n+1)
+		}
+		if n == attempts || !retryable(resp, err) {
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(retryDelay(n+1, resp)):
+		}
+	}
+}
@@ -0,0 +1,91 @@
+// installstore.go
+//
+// The installed-extension state of the target editor, shared by everything
+// in a run that reads or changes it: the install loop and batches, version
+// verification, the transaction journal, the blocklist, watch mode, and
+// the reports. It is filled from `code --list-extensions --show-versions`
+// (cached, inventory.go) and kept current by the run's own installs and
+// uninstalls. All access goes through a mutex, so parallel installs, the
+// watch loop and jobs started over the API never see a half-updated list.
+// IDs are matched case-insensitively, as the Marketplace does; the case the
+// editor reported is kept for display.
+
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// extensionStore is the mutex-protected set of installed extensions
+type extensionStore struct {
+	mu   sync.RWMutex
+	byID map[string]installedExtension // lower-cased id -> entry
+}
+
+func newExtensionStore() *extensionStore {
+	return &extensionStore{byID: make(map[string]installedExtension)}
+}
+
+// load replaces the contents with a fresh listing
+func (s *extensionStore) load(list []installedExtension) {
+	byID := make(map[string]installedExtension, len(list))
+	for _, e := range list {
+		byID[strings.ToLower(e.ID)] = e
+	}
+	s.mu.Lock()
+	s.byID = byID
+	s.mu.Unlock()
+}
+
+// lookup returns the entry of id; Version is "" when unknown
+func (s *extensionStore) lookup(id string) (installedExtension, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, ok := s.byID[strings.ToLower(id)]
+	return e, ok
+}
+
+// satisfies reports whether spec is installed (at its pinned version, when pinned)
+func (s *extensionStore) satisfies(spec extensionSpec) bool {
+	e, ok := s.lookup(spec.ID)
+	return ok && (spec.Version == "" || e.Version == spec.Version)
+}
+
+// add records an install; version is "" when the CLI did not say
+func (s *extensionStore) add(id, version string) {
+	s.mu.Lock()
+	s.byID[strings.ToLower(id)] = installedExtension{ID: id, Version: version}
+	s.mu.Unlock()
+}
+
+// remove records an uninstall
+func (s *extensionStore) remove(id string) {
+	s.mu.Lock()
+	delete(s.byID, strings.ToLower(id))
+	s.mu.Unlock()
+}
+
+// list returns a snapshot sorted by id
+func (s *extensionStore) list() []installedExtension {
+	s.mu.RLock()
+	res := make([]installedExtension, 0, len(s.byID))
+	for _, e := range s.byID {
+		res = append(res, e)
+	}
+	s.mu.RUnlock()
+	sort.Slice(res, func(a, b int) bool { return strings.ToLower(res[a].ID) < strings.ToLower(res[b].ID) })
+	return res
+}
+
+// installedExtensions lists the editor's extensions into the shared store
+// and returns a snapshot
+func (i *Installer) installedExtensions() ([]installedExtension, error) {
+	list, err := i.listInstalledExtensionVersions(i.codeCLIPath)
+	if err != nil {
+		return nil, err
+	}
+	i.installed.load(list)
+	return i.installed.list(), nil
+}
@@ -0,0 +1,110 @@
+// inventory.go
+//
+// Cached extension inventory. `code --list-extensions` starts the whole
+// editor runtime and takes seconds on machines with many extensions, and
+// apply, status, verify, plan and watch all ask for it. The answer is kept
+// in <cache>/inventory.json per editor CLI, together with a fingerprint of
+// the editor's extensions folder: the modification times and sizes of the
+// folder itself, its extensions.json registry and the .obsolete list, all
+// of which change on every install, update or uninstall. A fingerprint
+// mismatch (or a folder that cannot be read) means asking the CLI again.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const inventoryFileName = "inventory.json"
+
+// inventoryEntry is the cached answer of one editor CLI
+type inventoryEntry struct {
+	Fingerprint string               `json:"fingerprint"`
+	Listed      time.Time            `json:"listed"`
+	Extensions  []installedExtension `json:"extensions"`
+}
+
+// inventoryMu serializes reads and writes of the inventory file within
+// the process (concurrent steps may list extensions at the same time)
+var inventoryMu sync.Mutex
+
+func inventoryPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(cacheDir(home), inventoryFileName)
+}
+
+// inventoryFingerprint identifies the state of the extensions folder of
+// the editor behind cli; "" when it cannot be determined (no caching)
+func inventoryFingerprint(cli string) string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	dir := extensionsDir(home, cli)
+	st, err := os.Stat(dir)
+	if err != nil {
+		return ""
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%d\n", cli, st.ModTime().UnixNano())
+	for _, name := range []string{"extensions.json", ".obsolete"} {
+		if fi, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			fmt.Fprintf(h, "%s %d %d\n", name, fi.ModTime().UnixNano(), fi.Size())
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func readInventory() map[string]inventoryEntry {
+	res := make(map[string]inventoryEntry)
+	if b, err := os.ReadFile(inventoryPath()); err == nil {
+		json.Unmarshal(b, &res)
+	}
+	return res
+}
+
+// cachedInventory returns the cached list of cli if fp still matches
+func cachedInventory(cli, fp string) ([]installedExtension, bool) {
+	if fp == "" {
+		return nil, false
+	}
+	inventoryMu.Lock()
+	defer inventoryMu.Unlock()
+	e, ok := readInventory()[cli]
+	if !ok || e.Fingerprint != fp {
+		return nil, false
+	}
+	return e.Extensions, true
+}
+
+// storeInventory records the list of cli under fp; failures only cost the
+// next run a CLI call
+func storeInventory(cli, fp string, list []installedExtension) {
+	p := inventoryPath()
+	if fp == "" || p == "" {
+		return
+	}
+	inventoryMu.Lock()
+	defer inventoryMu.Unlock()
+	all := readInventory()
+	all[cli] = inventoryEntry{Fingerprint: fp, Listed: time.Now().UTC(), Extensions: list}
+	b, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return
+	}
+	// write and rename, so a concurrent run never reads half a file
+	tmp := p + ".tmp"
+	if writeBytes(tmp, append(b, '\n')) == nil {
+		os.Rename(tmp, p)
+	}
+}
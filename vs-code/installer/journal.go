@@ -0,0 +1,230 @@
+// journal.go
+//
+// Transactional apply (--transaction). Every change of the run is recorded
+// in a journal, <state>/journal.json, as soon as it is made: a file write
+// with the content and sha256 the file had before and the sha256 it was
+// given, an extension install with the version installed before it (if
+// any). A run that ends in failure (any exit* code, or a --strict stop) is
+// rolled back from the journal, latest change first: files get their
+// previous content back unless they were changed again after the run wrote
+// them, and with --rollback-extensions the extensions the run added are
+// uninstalled (one it upgraded keeps the new version and is reported). A
+// successful run deletes the journal; a journal left behind by a killed
+// run is rolled back when the next transactional run starts.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const journalFileName = "journal.json"
+
+// journal operations
+const (
+	journalWrite   = "write"
+	journalInstall = "install"
+)
+
+// journalEntry is one change made by the run
+type journalEntry struct {
+	Op           string `json:"op"`
+	Path         string `json:"path,omitempty"`
+	Existed      bool   `json:"existed,omitempty"`
+	Prior        []byte `json:"prior,omitempty"`     // content before the run
+	PriorHash    string `json:"priorHash,omitempty"` // sha256 of Prior
+	Hash         string `json:"hash,omitempty"`      // sha256 of what the run wrote
+	ID           string `json:"id,omitempty"`
+	PriorVersion string `json:"priorVersion,omitempty"` // installed version before the run, "" if none
+}
+
+// journal is the decoded journal.json of a transactional run
+type journal struct {
+	Started time.Time      `json:"started"`
+	Target  string         `json:"target"`
+	Entries []journalEntry `json:"entries"`
+
+	path      string
+	installed []installedExtension // extensions before the run's installs
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// save writes the journal atomically (temp file + rename)
+func (j *journal) save() error {
+	if err := os.MkdirAll(filepath.Dir(j.path), 0o755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := j.path + ".tmp"
+	if err := os.WriteFile(tmp, append(b, '\n'), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, j.path)
+}
+
+// beginTransaction starts the journal of a --transaction run, rolling back
+// the journal of an interrupted earlier run first
+func (i *Installer) beginTransaction() error {
+	if !i.transaction || i.dryRun {
+		return nil
+	}
+	p := filepath.Join(stateDir(i.homeDir), journalFileName)
+	if b, err := os.ReadFile(p); err == nil {
+		var prev journal
+		if err := json.Unmarshal(b, &prev); err != nil {
+			return fmt.Errorf("corrupt %s: %w", p, err)
+		}
+		i.warnf("The transactional run of %s was interrupted — rolling back its %d changes", prev.Started.Local().Format(time.RFC3339), len(prev.Entries))
+		i.rollbackJournal(&prev)
+		i.clearCheckpoint()
+	}
+	i.txn = &journal{Started: time.Now().UTC(), Target: i.vscodeUser, path: p}
+	return i.txn.save()
+}
+
+// record appends e to the journal and persists it
+func (i *Installer) record(e journalEntry) {
+	i.txn.Entries = append(i.txn.Entries, e)
+	if err := i.txn.save(); err != nil {
+		i.warnf("cannot update transaction journal: %v", err)
+	}
+}
+
+// journalWrite records that data was written over the file captured in c
+func (i *Installer) journalWrite(c safetyCopy, data []byte) {
+	if i.txn == nil {
+		return
+	}
+	for k := range i.txn.Entries {
+		// a file written twice keeps its pre-run content
+		if e := &i.txn.Entries[k]; e.Op == journalWrite && e.Path == c.Path {
+			e.Hash = sha256Hex(data)
+			if err := i.txn.save(); err != nil {
+				i.warnf("cannot update transaction journal: %v", err)
+			}
+			return
+		}
+	}
+	e := journalEntry{Op: journalWrite, Path: c.Path, Existed: c.Existed, Hash: sha256Hex(data)}
+	if c.Existed {
+		e.Prior, e.PriorHash = c.Data, sha256Hex(c.Data)
+	}
+	i.record(e)
+}
+
+// journalInstall records that ext was installed
+func (i *Installer) journalInstall(ext extensionSpec) {
+	if i.txn == nil {
+		return
+	}
+	i.record(journalEntry{Op: journalInstall, ID: ext.ID, PriorVersion: installedVersion(i.txn.installed, ext.ID)})
+}
+
+// endTransaction closes the journal: a successful run drops it, a failed
+// one is rolled back (rolledBack is true then)
+func (i *Installer) endTransaction() (rolledBack bool) {
+	if i.txn == nil {
+		return false
+	}
+	if i.failureStatus() == exitOK {
+		if err := os.Remove(i.txn.path); err != nil && !os.IsNotExist(err) {
+			i.warnf("cannot remove transaction journal: %v", err)
+		}
+		i.txn = nil
+		return false
+	}
+	i.errorf("Run failed — rolling back its %d changes", len(i.txn.Entries))
+	i.rollbackTransaction()
+	return true
+}
+
+// rollbackTransaction undoes the changes journaled by this run
+func (i *Installer) rollbackTransaction() {
+	i.rollbackJournal(i.txn)
+	i.txn = nil
+	i.safety, i.report.Written = nil, nil
+	i.clearCheckpoint()
+}
+
+// rollbackJournal undoes the journaled changes, latest first, and removes
+// the journal file
+func (i *Installer) rollbackJournal(j *journal) {
+	for k := len(j.Entries) - 1; k >= 0; k-- {
+		e := j.Entries[k]
+		switch e.Op {
+		case journalWrite:
+			i.rollbackWrite(e)
+		case journalInstall:
+			i.rollbackInstall(e)
+		}
+	}
+	if err := os.Remove(j.path); err != nil && !os.IsNotExist(err) {
+		i.warnf("cannot remove transaction journal: %v", err)
+	}
+}
+
+func (i *Installer) rollbackWrite(e journalEntry) {
+	if cur := fileHash(e.Path); cur != e.Hash {
+		i.warnf("Not rolling back %s: changed since this run wrote it", e.Path)
+		return
+	}
+	if !e.Existed {
+		if err := os.Remove(e.Path); err != nil && !os.IsNotExist(err) {
+			i.errorf("Rollback of %s failed: %v", e.Path, err)
+			return
+		}
+		i.logf("Rolled back %s (removed, it did not exist before)", e.Path)
+		return
+	}
+	if sha256Hex(e.Prior) != e.PriorHash {
+		i.errorf("Rollback of %s failed: journaled content does not match its hash", e.Path)
+		return
+	}
+	if err := writeBytes(e.Path, e.Prior); err != nil {
+		i.errorf("Rollback of %s failed: %v", e.Path, err)
+		return
+	}
+	i.logf("Rolled back %s", e.Path)
+}
+
+func (i *Installer) rollbackInstall(e journalEntry) {
+	switch {
+	case !i.rollbackExts:
+		i.logf("Extension %s installed by the failed run is kept (--rollback-extensions uninstalls it)", e.ID)
+		return
+	case e.PriorVersion != "":
+		i.warnf("Extension %s was upgraded from %s by the failed run — not rolled back", e.ID, e.PriorVersion)
+		return
+	}
+	if err := i.ensureCodeCLI(); err != nil {
+		i.errorf("Cannot uninstall %s: code CLI not found: %v", e.ID, err)
+		return
+	}
+	out, err := runCommandWithTimeout(uninstallTimeoutSec*time.Second, i.codeCLIPath, i.codeArgs("--uninstall-extension", e.ID)...)
+	if err != nil {
+		i.errorf("Cannot uninstall %s: %v\n%s", e.ID, err, out)
+		return
+	}
+	kept := i.report.Installed[:0]
+	for _, id := range i.report.Installed {
+		if id != e.ID {
+			kept = append(kept, id)
+		}
+	}
+	i.report.Installed = kept
+	i.installed.remove(e.ID)
+	i.logf("Rolled back extension %s (uninstalled)", e.ID)
+}
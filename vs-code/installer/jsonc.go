@@ -0,0 +1,366 @@
+// jsonc.go
+//
+// VS Code config files are JSONC: JSON with // and /* */ comments and
+// trailing commas. stripJSONC turns them into plain JSON for encoding/json
+// by blanking them out, so offsets in the result are offsets in the source
+// and parse errors can name the line and column; strings (including
+// escaped quotes) are left untouched. jsoncSet and
+// jsoncDelete edit a top-level key in place so comments and layout survive.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+// stripJSONC replaces comments and trailing commas in JSONC data with
+// spaces (newlines are kept)
+func stripJSONC(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	inStr := false
+	blank := func(c byte) byte {
+		if c == '\n' || c == '\r' {
+			return c
+		}
+		return ' '
+	}
+	for k := 0; k < len(data); k++ {
+		c := data[k]
+		if inStr {
+			out = append(out, c)
+			switch c {
+			case '\\':
+				if k+1 < len(data) {
+					k++
+					out = append(out, data[k])
+				}
+			case '"':
+				inStr = false
+			}
+			continue
+		}
+		switch {
+		case c == '"':
+			inStr = true
+			out = append(out, c)
+		case c == '/' && k+1 < len(data) && data[k+1] == '/':
+			for k < len(data) && data[k] != '\n' {
+				out = append(out, blank(data[k]))
+				k++
+			}
+			if k < len(data) {
+				out = append(out, '\n')
+			}
+		case c == '/' && k+1 < len(data) && data[k+1] == '*':
+			end := bytes.Index(data[k+2:], []byte("*/"))
+			if end < 0 {
+				end = len(data) - k - 2
+			} else {
+				end += 2
+			}
+			for _, b := range data[k : k+2+end] {
+				out = append(out, blank(b))
+			}
+			k += 1 + end
+		case c == ']' || c == '}':
+			// blank a trailing comma before the closing bracket
+			trimmed := bytes.TrimRight(out, " \t\r\n")
+			if len(trimmed) > 0 && trimmed[len(trimmed)-1] == ',' {
+				out[len(trimmed)-1] = ' '
+			}
+			out = append(out, c)
+		default:
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// parseJSONC decodes JSONC data into generic values (numbers as json.Number)
+func parseJSONC(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(stripJSONC(data)))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, jsonErrorAt(data, err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("%s: unexpected data after the JSON value", positionAt(data, int(dec.InputOffset())))
+	}
+	return v, nil
+}
+
+// jsonErrorAt prefixes a decoding error of (stripped) data with the line
+// and column it occurred at
+func jsonErrorAt(data []byte, err error) error {
+	var (
+		syntax *json.SyntaxError
+		typ    *json.UnmarshalTypeError
+	)
+	switch {
+	case errors.As(err, &syntax):
+		// Offset is just past the offending byte
+		return fmt.Errorf("%s: %w", positionAt(data, int(syntax.Offset)-1), err)
+	case errors.As(err, &typ):
+		return fmt.Errorf("%s: %w", positionAt(data, int(typ.Offset)), err)
+	case errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF):
+		return fmt.Errorf("%s: unexpected end of input", positionAt(data, len(data)))
+	}
+	return err
+}
+
+// positionAt formats a byte offset in data as "line L, column C" (columns
+// count characters)
+func positionAt(data []byte, off int) string {
+	off = max(0, min(off, len(data)))
+	line := bytes.Count(data[:off], []byte("\n")) + 1
+	start := bytes.LastIndexByte(data[:off], '\n') + 1
+	return fmt.Sprintf("line %d, column %d", line, utf8.RuneCount(data[start:off])+1)
+}
+
+// jsoncMember locates one top-level "key": value pair in JSONC data
+type jsoncMember struct {
+	Key        string
+	Start      int // opening quote of the key
+	ValueStart int
+	End        int // just past the value
+}
+
+// jsoncMembers lists the top-level members of a JSONC object together with
+// the offsets of its opening and closing braces
+func jsoncMembers(data []byte) (members []jsoncMember, open, close int, err error) {
+	k := jsoncSkipSpace(data, 0)
+	if k >= len(data) || data[k] != '{' {
+		return nil, 0, 0, errors.New("not a JSON object")
+	}
+	open = k
+	for k++; ; {
+		k = jsoncSkipSpace(data, k)
+		if k >= len(data) {
+			return nil, 0, 0, errors.New("unterminated object")
+		}
+		switch data[k] {
+		case '}':
+			return members, open, k, nil
+		case ',':
+			k++
+			continue
+		case '"':
+		default:
+			return nil, 0, 0, fmt.Errorf("unexpected %q at offset %d", data[k], k)
+		}
+		m := jsoncMember{Start: k}
+		end, err := jsoncSkipString(data, k)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		if err := json.Unmarshal(data[k:end], &m.Key); err != nil {
+			return nil, 0, 0, err
+		}
+		k = jsoncSkipSpace(data, end)
+		if k >= len(data) || data[k] != ':' {
+			return nil, 0, 0, fmt.Errorf("missing ':' after %q", m.Key)
+		}
+		m.ValueStart = jsoncSkipSpace(data, k+1)
+		if m.End, err = jsoncSkipValue(data, m.ValueStart); err != nil {
+			return nil, 0, 0, err
+		}
+		members = append(members, m)
+		k = m.End
+	}
+}
+
+// jsoncSkipSpace returns the offset of the next token after k, skipping
+// whitespace and comments
+func jsoncSkipSpace(data []byte, k int) int {
+	for k < len(data) {
+		switch {
+		case data[k] == ' ' || data[k] == '\t' || data[k] == '\r' || data[k] == '\n':
+			k++
+		case bytes.HasPrefix(data[k:], []byte("//")):
+			for k < len(data) && data[k] != '\n' {
+				k++
+			}
+		case bytes.HasPrefix(data[k:], []byte("/*")):
+			end := bytes.Index(data[k+2:], []byte("*/"))
+			if end < 0 {
+				return len(data)
+			}
+			k += end + 4
+		default:
+			return k
+		}
+	}
+	return k
+}
+
+// jsoncSkipString returns the offset just past the string starting at k
+func jsoncSkipString(data []byte, k int) (int, error) {
+	for k++; k < len(data); k++ {
+		switch data[k] {
+		case '\\':
+			k++
+		case '"':
+			return k + 1, nil
+		}
+	}
+	return 0, errors.New("unterminated string")
+}
+
+// jsoncSkipValue returns the offset just past the value starting at k
+func jsoncSkipValue(data []byte, k int) (int, error) {
+	if k >= len(data) {
+		return 0, errors.New("missing value")
+	}
+	switch data[k] {
+	case '"':
+		return jsoncSkipString(data, k)
+	case '{', '[':
+		depth := 0
+		for k < len(data) {
+			k = jsoncSkipSpace(data, k)
+			if k >= len(data) {
+				break
+			}
+			switch data[k] {
+			case '"':
+				end, err := jsoncSkipString(data, k)
+				if err != nil {
+					return 0, err
+				}
+				k = end
+				continue
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+				if depth == 0 {
+					return k + 1, nil
+				}
+			}
+			k++
+		}
+		return 0, errors.New("unterminated value")
+	default:
+		start := k
+		for k < len(data) && !bytes.ContainsRune([]byte(" \t\r\n,}]/"), rune(data[k])) {
+			k++
+		}
+		if k == start {
+			return 0, fmt.Errorf("missing value at offset %d", k)
+		}
+		return k, nil
+	}
+}
+
+// jsoncSet sets the top-level key to the encoded value, keeping the rest of
+// the file (comments, order, formatting) as it is. A new key is appended as
+// the last member.
+func jsoncSet(data []byte, key string, value []byte) ([]byte, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		data = []byte("{\n}\n")
+	}
+	members, open, close, err := jsoncMembers(data)
+	if err != nil {
+		return nil, err
+	}
+	var out []byte
+	for k := len(members) - 1; k >= 0; k-- {
+		if m := members[k]; m.Key == key {
+			out = append(out, data[:m.ValueStart]...)
+			out = append(out, value...)
+			return append(out, data[m.End:]...), nil
+		}
+	}
+	name, _ := json.Marshal(key)
+	entry := string(name) + ": " + string(value)
+	if len(members) == 0 {
+		out = append(out, data[:open+1]...)
+		out = append(out, "\n  "+entry+"\n"...)
+		return append(out, data[close:]...), nil
+	}
+	last := members[len(members)-1]
+	out = append(out, data[:last.End]...)
+	out = append(out, ",\n"+jsoncIndent(data, last.Start)+entry...)
+	return append(out, data[last.End:]...), nil
+}
+
+// jsoncIndent is the leading whitespace of the line holding offset k
+func jsoncIndent(data []byte, k int) string {
+	start := bytes.LastIndexByte(data[:k], '\n') + 1
+	end := start
+	for end < k && (data[end] == ' ' || data[end] == '\t') {
+		end++
+	}
+	return string(data[start:end])
+}
+
+// jsoncDelete removes every occurrence of the top-level key, together with
+// its line (and a trailing // comment) when the member stands on a line of
+// its own
+func jsoncDelete(data []byte, key string) ([]byte, bool, error) {
+	removed := false
+	for {
+		members, _, _, err := jsoncMembers(data)
+		if err != nil {
+			return nil, false, err
+		}
+		idx := -1
+		for k, m := range members {
+			if m.Key == key {
+				idx = k
+				break
+			}
+		}
+		if idx < 0 {
+			return data, removed, nil
+		}
+		m := members[idx]
+		start, end := m.Start, m.End
+		for end < len(data) && (data[end] == ' ' || data[end] == '\t') {
+			end++
+		}
+		if next := jsoncSkipSpace(data, m.End); end < len(data) && data[end] == ',' {
+			end++
+		} else if next < len(data) && data[next] == ',' {
+			// separating comma on a later line
+			data = append(data[:next:next], data[next+1:]...)
+		} else if idx > 0 {
+			// last member: drop the comma after the previous one instead
+			if c := bytes.LastIndexByte(data[members[idx-1].End:start], ','); c >= 0 {
+				c += members[idx-1].End
+				data = append(data[:c:c], data[c+1:]...)
+				start, end = start-1, end-1
+			}
+		}
+		lineStart := bytes.LastIndexByte(data[:start], '\n') + 1
+		rest := end
+		for rest < len(data) && (data[rest] == ' ' || data[rest] == '\t' || data[rest] == '\r') {
+			rest++
+		}
+		if bytes.HasPrefix(data[rest:], []byte("//")) {
+			// a trailing comment goes with the member
+			for rest < len(data) && data[rest] != '\n' {
+				rest++
+			}
+		}
+		if len(bytes.TrimSpace(data[lineStart:start])) == 0 && rest < len(data) && data[rest] == '\n' {
+			start, end = lineStart, rest+1
+		} else if len(bytes.TrimSpace(data[lineStart:start])) == 0 {
+			for end < len(data) && (data[end] == ' ' || data[end] == '\t') {
+				end++
+			}
+		} else {
+			for start > lineStart && (data[start-1] == ' ' || data[start-1] == '\t') {
+				start--
+			}
+		}
+		data = append(data[:start:start], data[end:]...)
+		removed = true
+	}
+}
@@ -0,0 +1,152 @@
+// kakoune.go
+//
+// Kakoune (--kakoune). The payload's kakoune/ folder holds
+//
+//   kakrc          the user configuration
+//   autoload/**    scripts Kakoune sources at startup, subfolders included
+//   plug.kak.ref   the plug.kak tag or commit id to bootstrap (not deployed)
+//
+// written to Kakoune's config folder: $KAKOUNE_CONFIG_DIR, else
+// $XDG_CONFIG_HOME/kak (~/.config/kak). A user autoload/ folder replaces
+// the system one; creating it is reported, linking the system scripts back
+// in is left to the user. When the kakrc uses plug.kak and it is missing,
+// plug.kak is bootstrapped at the pinned ref: fetched into
+// <config>/plugins/plug.kak, where its documented kakrc snippet sources it;
+// the plugins it declares are installed by plug.kak itself (:plug-install).
+// Without plug.kak.ref nothing is fetched: an unpinned clone would run
+// whatever the repository holds that day.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	kakouneDir          = "kakoune"
+	kakouneRC           = "kakrc"
+	kakouneAutoload     = "autoload"
+	plugKakRepo         = "https://github.com/andreyorst/plug.kak.git"
+	plugKakRefFile      = "plug.kak.ref"
+	plugKakCloneTimeout = 2 * time.Minute
+)
+
+// kakouneConfigDir is Kakoune's config folder
+func kakouneConfigDir(home string) string {
+	if dir := os.Getenv("KAKOUNE_CONFIG_DIR"); dir != "" {
+		return dir
+	}
+	if config := os.Getenv("XDG_CONFIG_HOME"); config != "" {
+		return filepath.Join(config, "kak")
+	}
+	return filepath.Join(home, ".config", "kak")
+}
+
+// applyKakoune deploys the payload's kakoune/ folder
+func (i *Installer) applyKakoune() error {
+	files, err := i.backendFiles(kakouneDir)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("the payload has no %s/ folder", kakouneDir)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	conf := kakouneConfigDir(home)
+	i.logf("Kakoune config folder: %s", conf)
+	if !exists(filepath.Join(conf, kakouneAutoload)) {
+		for name := range files {
+			if strings.HasPrefix(name, kakouneAutoload+"/") {
+				i.warnf("%s creates %s, which replaces Kakoune's system autoload folder — link it in if you rely on it",
+					kakouneDir+"/"+kakouneAutoload, filepath.Join(conf, kakouneAutoload))
+				break
+			}
+		}
+	}
+
+	var errs []error
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if name == plugKakRefFile {
+			continue
+		}
+		if name != kakouneRC && !strings.HasPrefix(name, kakouneAutoload+"/") {
+			i.warnf("%s/%s is not a Kakoune payload file — skipped", kakouneDir, name)
+			continue
+		}
+		if err := i.deployFile("kakoune:"+name, filepath.Join(conf, filepath.FromSlash(name)), files[name]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if strings.Contains(string(files[kakouneRC]), "plug.kak") {
+		if err := i.bootstrapPlugKak(conf, strings.TrimSpace(string(files[plugKakRefFile]))); err != nil {
+			errs = append(errs, fmt.Errorf("plug.kak: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// plugKakRefPattern is a tag or commit id; nothing git would take for an option
+var plugKakRefPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/-]*$`)
+
+// validPlugKakRef reports whether ref may be passed to git fetch
+func validPlugKakRef(ref string) bool {
+	return plugKakRefPattern.MatchString(ref) && !strings.Contains(ref, "..")
+}
+
+// bootstrapPlugKak fetches plug.kak at ref into the config folder unless
+// it is there
+func (i *Installer) bootstrapPlugKak(conf, ref string) error {
+	dst := filepath.Join(conf, "plugins", "plug.kak")
+	if exists(dst) {
+		i.report.Skipped = append(i.report.Skipped, "kakoune:plug.kak")
+		return nil
+	}
+	switch {
+	case ref == "":
+		return fmt.Errorf("not bootstrapped: pin a tag or commit id in %s/%s", kakouneDir, plugKakRefFile)
+	case !validPlugKakRef(ref):
+		return fmt.Errorf("%s/%s: invalid ref %q", kakouneDir, plugKakRefFile, ref)
+	}
+	if i.dryRun {
+		i.logf("DRY-RUN: would fetch %s at %s into %s", plugKakRepo, ref, dst)
+		i.report.Installed = append(i.report.Installed, "kakoune:plug.kak")
+		return nil
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		return errors.New("git not found")
+	}
+	// init + fetch of the one ref works for tags and commit ids alike
+	for _, args := range [][]string{
+		{"init", "-q", dst},
+		{"-C", dst, "fetch", "-q", "--depth", "1", plugKakRepo, ref},
+		{"-C", dst, "checkout", "-q", "--detach", "FETCH_HEAD"},
+	} {
+		if out, err := runCommandWithTimeout(plugKakCloneTimeout, "git", args...); err != nil {
+			os.RemoveAll(dst)
+			step := args[0]
+			if step == "-C" {
+				step = args[2]
+			}
+			return fmt.Errorf("git %s failed: %v: %s", step, err, strings.TrimSpace(out))
+		}
+	}
+	i.report.Installed = append(i.report.Installed, "kakoune:plug.kak")
+	i.logf("plug.kak %s fetched into %s — run :plug-install in Kakoune for its plugins", ref, dst)
+	return nil
+}
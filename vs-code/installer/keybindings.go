@@ -0,0 +1,251 @@
+// keybindings.go
+//
+// Append mode for keybindings.json (--keybindings-mode append, manifest
+// "keybindingsMode"). keybindings.json is an array, so overwriting it drops
+// every binding the user made; in append mode the written file is
+//
+//   1. the payload's removal entries ("command": "-...") — first, so they
+//      only unbind defaults and never a binding of the user's
+//   2. the payload's bindings
+//   3. the user's own bindings, last so they win on the same key
+//
+// with each part normalized on its own (keynormalize.go): canonical
+// chords, exact duplicates removed, sorted within sections. Entries of the
+// previously applied payload (merge.go) that the new payload no longer has
+// are dropped from the user's part, so bindings removed from the payload go
+// away too. Apart from the "key" value an entry is kept as written (member
+// order, comments). Conflicting bindings of the user's and the payload are
+// resolved by keyconflicts.go.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// keybindings.json modes
+const (
+	keybindingsOverwrite = "overwrite"
+	keybindingsAppend    = "append"
+)
+
+// parseKeybindingsMode validates a --keybindings-mode value
+func parseKeybindingsMode(s string) (string, error) {
+	switch s {
+	case "", keybindingsOverwrite, keybindingsAppend:
+		return s, nil
+	}
+	return "", fmt.Errorf("unknown keybindings mode %q (want %s or %s)", s, keybindingsOverwrite, keybindingsAppend)
+}
+
+// keybinding is one element of keybindings.json
+type keybinding struct {
+	raw      []byte
+	canon    string // compact JSON with sorted keys, for duplicate detection
+	cmd      string
+	key      string // "key" as written
+	chord    string // canonical "key" (keynormalize.go)
+	when     string
+	leading  []string // comments on the lines above the entry
+	trailing string   // comment after the entry on its line
+	end      int      // offset just past the entry
+}
+
+// parseKeybindings splits a JSONC array into its elements; header is the
+// text before the opening bracket (usually a comment)
+func parseKeybindings(data []byte) (header []byte, list []keybinding, err error) {
+	k := jsoncSkipSpace(data, 0)
+	if len(bytes.TrimSpace(stripJSONC(data))) == 0 {
+		return bytes.TrimSpace(data), nil, nil
+	}
+	if k >= len(data) || data[k] != '[' {
+		return nil, nil, errors.New("not a JSON array")
+	}
+	header = bytes.TrimSpace(data[:k])
+	gapStart := k + 1
+	for k++; ; {
+		k = jsoncSkipSpace(data, k)
+		if k >= len(data) {
+			return nil, nil, errors.New("unterminated array")
+		}
+		switch data[k] {
+		case ']':
+			if n := len(list); n > 0 {
+				list[n-1].trailing, _ = splitGapComments(data[gapStart:k], true)
+			}
+			return header, list, nil
+		case ',':
+			k++
+			continue
+		}
+		trailing, leading := splitGapComments(data[gapStart:k], len(list) > 0)
+		if n := len(list); n > 0 {
+			list[n-1].trailing = trailing
+		}
+		end, err := jsoncSkipValue(data, k)
+		if err != nil {
+			return nil, nil, err
+		}
+		raw := data[k:end]
+		v, err := parseJSONC(raw)
+		if err != nil {
+			return nil, nil, err
+		}
+		canon, _ := json.Marshal(v)
+		b := keybinding{raw: raw, canon: string(canon), leading: leading, end: end}
+		if obj, ok := v.(map[string]interface{}); ok {
+			b.cmd, _ = obj["command"].(string)
+			b.when, _ = obj["when"].(string)
+			b.key, _ = obj["key"].(string)
+			b.chord = canonicalChord(b.key)
+		}
+		list = append(list, b)
+		k, gapStart = end, end
+	}
+}
+
+// mergeKeybindings builds the append-mode keybindings.json from the
+// previously applied payload (may be nil), the user's file and the payload.
+// resolve decides conflicts between a binding of the user's and one of the
+// payload; nil keeps both.
+func mergeKeybindings(base, live, payload []byte, resolve func(bindingConflict) string) (out []byte, kept int, err error) {
+	header, theirs, err := parseKeybindings(payload)
+	if err != nil {
+		return nil, 0, fmt.Errorf("payload: %w", err)
+	}
+	liveHeader, ours, err := parseKeybindings(live)
+	if err != nil {
+		return nil, 0, fmt.Errorf("your %s: %w", keybindingsFile, err)
+	}
+	if len(header) == 0 {
+		header = liveHeader
+	}
+	canonicalizeKeys(theirs)
+	canonicalizeKeys(ours)
+	stale := make(map[string]bool)
+	if base != nil {
+		if _, old, err := parseKeybindings(base); err == nil {
+			canonicalizeKeys(old)
+			for _, b := range old {
+				stale[b.canon] = true
+			}
+		}
+	}
+
+	seen := make(map[string]bool)
+	var payloadList, userList []keybinding
+	for _, pass := range []bool{true, false} {
+		for _, b := range theirs {
+			if strings.HasPrefix(b.cmd, "-") == pass && !seen[b.canon] {
+				seen[b.canon] = true
+				payloadList = append(payloadList, b)
+			}
+		}
+	}
+	for _, b := range ours {
+		if !stale[b.canon] && !seen[b.canon] {
+			seen[b.canon] = true
+			userList = append(userList, b)
+		}
+	}
+
+	dropped := make(map[string]bool)
+	for _, u := range userList {
+		for _, p := range payloadList {
+			c := bindingConflict{Mine: u, Payload: p}
+			if !c.conflicts() || dropped[u.canon] || dropped[p.canon] {
+				continue
+			}
+			choice := conflictBoth
+			if resolve != nil {
+				choice = resolve(c)
+			}
+			switch choice {
+			case conflictMine:
+				dropped[p.canon] = true
+			case conflictPayload:
+				dropped[u.canon] = true
+			}
+		}
+	}
+	// each part is normalized on its own, so the user's bindings stay last
+	var parts [2][]keybinding
+	for n, part := range [][]keybinding{payloadList, userList} {
+		for _, b := range part {
+			if !dropped[b.canon] {
+				parts[n] = append(parts[n], b)
+			}
+		}
+		parts[n], _ = normalizeBindings(parts[n])
+	}
+	list := append(parts[0], parts[1]...)
+	kept = len(parts[1])
+
+	return formatKeybindings(header, list), kept, nil
+}
+
+// formatKeybindings writes keybindings.json from its header and entries,
+// each with its comments
+func formatKeybindings(header []byte, list []keybinding) []byte {
+	var buf bytes.Buffer
+	if len(header) > 0 {
+		buf.Write(header)
+		buf.WriteByte('\n')
+	}
+	buf.WriteString("[\n")
+	for n, b := range list {
+		for _, l := range b.leading {
+			buf.WriteString("  " + l + "\n")
+		}
+		buf.WriteString("  ")
+		buf.Write(b.raw)
+		if n < len(list)-1 {
+			buf.WriteByte(',')
+		}
+		if b.trailing != "" {
+			buf.WriteString(" " + b.trailing)
+		}
+		buf.WriteByte('\n')
+	}
+	buf.WriteString("]\n")
+	return buf.Bytes()
+}
+
+// appendKeybindings is desiredContent for keybindings.json in append mode
+func (i *Installer) appendKeybindings(payload []byte, interactive bool) []byte {
+	live, err := os.ReadFile(filepath.Join(i.vscodeUser, keybindingsFile))
+	if err != nil {
+		return payload
+	}
+	base, err := os.ReadFile(i.appliedPath(keybindingsFile))
+	if err != nil {
+		base = nil
+	}
+	resolve, save := i.keyConflictResolver(interactive)
+	out, kept, err := mergeKeybindings(base, live, payload, resolve)
+	if err != nil {
+		if interactive {
+			i.warnf("%s: cannot append (%v) — overwriting instead", keybindingsFile, err)
+		}
+		return payload
+	}
+	save()
+	if interactive {
+		i.logf("%s: payload bindings added, %d of your bindings kept", keybindingsFile, kept)
+	}
+	return out
+}
+
+// expectedKeybindings is the keybindings.json verify and watch compare with
+func (i *Installer) expectedKeybindings() []byte {
+	if i.bindingsMode == keybindingsAppend {
+		return i.appendKeybindings(i.keybindData, false)
+	}
+	return i.keybindData
+}
@@ -0,0 +1,193 @@
+// keybindingsdiff.go
+//
+// `keybindings diff` reviews keyboard changes before they are accepted: the
+// user's keybindings.json is compared with what apply would write (append
+// mode included), binding by binding, and every change is listed under its
+// command:
+//
+//   adds       a chord the file does not bind yet
+//   overrides  a chord (in the same "when" context) bound to another command
+//   unbinds    a payload removal entry ("-command") taking a default away
+//   removes    a binding of the file the result no longer has
+//
+// A text diff of the file is `plan`'s job; this groups by what the keys do.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pterm/pterm"
+)
+
+// keybinding changes
+const (
+	keyAdds      = "adds"
+	keyOverrides = "overrides"
+	keyUnbinds   = "unbinds"
+	keyRemoves   = "removes"
+)
+
+// keybindingChange is one row of `keybindings diff`
+type keybindingChange struct {
+	Command  string `json:"command"`
+	Change   string `json:"change"`
+	Key      string `json:"key"`
+	When     string `json:"when,omitempty"`
+	Previous string `json:"previous,omitempty"` // overrides: the command bound before
+}
+
+func runKeybindings(args []string) (err error) {
+	if len(args) == 0 || args[0] != "diff" {
+		return fmt.Errorf("usage: keybindings diff [--output json]")
+	}
+	fs, opts := newCommandFlags("keybindings diff")
+	output := fs.String("output", "text", "Report format: text or json")
+	fs.Parse(args[1:])
+	if *output != "text" && *output != "json" {
+		return fmt.Errorf("unknown --output %q (want text or json)", *output)
+	}
+	if *output == "json" {
+		// stdout carries the JSON document only; progress still goes to the log file
+		pterm.DisableOutput()
+		defer func() {
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "keybindings diff:", err)
+			}
+		}()
+	}
+
+	inst, err := openInstaller(opts)
+	if err != nil {
+		return err
+	}
+	defer inst.Close()
+	if len(inst.keybindData) == 0 {
+		return fmt.Errorf("the payload has no %s", keybindingsFile)
+	}
+	cur, err := os.ReadFile(filepath.Join(inst.vscodeUser, keybindingsFile))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	changes, err := diffKeybindings(cur, inst.desiredContent(keybindingsFile, inst.keybindData, false))
+	if err != nil {
+		return err
+	}
+
+	if *output == "json" {
+		if changes == nil {
+			changes = []keybindingChange{}
+		}
+		b, err := json.MarshalIndent(changes, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+		return nil
+	}
+	if len(changes) == 0 {
+		pterm.Success.Println("No keyboard changes.")
+		return nil
+	}
+	rows := [][]string{{"Command", "Change", "Key", "When"}}
+	last := ""
+	for _, c := range changes {
+		cmd := c.Command
+		if cmd == last {
+			cmd = ""
+		}
+		last = c.Command
+		change := c.Change
+		if c.Previous != "" {
+			change += " " + c.Previous
+		}
+		rows = append(rows, []string{cmd, change, c.Key, orDash(c.When)})
+	}
+	pterm.DefaultTable.WithHasHeader().WithData(rows).Render()
+	return nil
+}
+
+// bindingSlot identifies where a binding fires: its chord in its context
+func bindingSlot(b keybinding) string {
+	return b.chord + "\n" + strings.Join(whenClauses(b.when), " && ")
+}
+
+// diffKeybindings lists the changes from the current keybindings.json data
+// (may be nil) to the wanted one, sorted by command
+func diffKeybindings(cur, want []byte) ([]keybindingChange, error) {
+	_, before, err := parseKeybindings(cur)
+	if err != nil {
+		return nil, fmt.Errorf("your %s: %w", keybindingsFile, err)
+	}
+	_, after, err := parseKeybindings(want)
+	if err != nil {
+		return nil, fmt.Errorf("payload: %w", err)
+	}
+	// slot -> commands bound there (removals aside), slot+command -> listed
+	index := func(list []keybinding) (map[string][]string, map[string]bool) {
+		slots, has := make(map[string][]string), make(map[string]bool)
+		for _, b := range list {
+			if b.cmd == "" {
+				continue
+			}
+			s := bindingSlot(b)
+			if !strings.HasPrefix(b.cmd, "-") {
+				slots[s] = append(slots[s], b.cmd)
+			}
+			has[s+"\n"+b.cmd] = true
+		}
+		return slots, has
+	}
+	beforeSlots, beforeHas := index(before)
+	afterSlots, afterHas := index(after)
+
+	var res []keybindingChange
+	row := func(b keybinding, change, prev string) {
+		res = append(res, keybindingChange{Command: strings.TrimPrefix(b.cmd, "-"), Change: change, Key: b.chord, When: b.when, Previous: prev})
+	}
+	for _, b := range after {
+		s := bindingSlot(b)
+		if b.cmd == "" || beforeHas[s+"\n"+b.cmd] {
+			continue
+		}
+		// commands of the slot the result no longer binds (in append mode
+		// the user's stay and win, so that is just an addition)
+		var prev []string
+		for _, c := range beforeSlots[s] {
+			if !afterHas[s+"\n"+c] {
+				prev = append(prev, c)
+			}
+		}
+		switch {
+		case strings.HasPrefix(b.cmd, "-"):
+			row(b, keyUnbinds, "")
+		case len(prev) > 0:
+			row(b, keyOverrides, strings.Join(prev, ", "))
+		default:
+			row(b, keyAdds, "")
+		}
+	}
+	for _, b := range before {
+		s := bindingSlot(b)
+		if b.cmd == "" || afterHas[s+"\n"+b.cmd] || strings.HasPrefix(b.cmd, "-") {
+			continue
+		}
+		// replaced by another command on the same slot: shown as an override
+		if len(afterSlots[s]) > 0 {
+			continue
+		}
+		row(b, keyRemoves, "")
+	}
+	sort.SliceStable(res, func(a, b int) bool {
+		if res[a].Command != res[b].Command {
+			return res[a].Command < res[b].Command
+		}
+		return res[a].Key < res[b].Key
+	})
+	return res, nil
+}
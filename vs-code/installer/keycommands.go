@@ -0,0 +1,198 @@
+// keycommands.go
+//
+// After the extensions are installed, the commands of the payload's
+// keybindings are checked against what the editor can actually run: the
+// commands contributed by installed extensions (their package.json under
+// ~/.vscode/extensions, ~/.vscode-insiders/extensions or
+// ~/.vscode-oss/extensions), those of the editor's built-in extensions
+// (resources/app/extensions next to the CLI) and the editor's core command
+// namespaces (workbench.*, editor.*, cursor*, ...). A binding whose command
+// none of them provides is most likely a typo or needs an extension the
+// list lacks; it is only warned about, never removed.
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// coreCommandPrefixes are the namespaces of commands implemented by the
+// editor itself rather than an extension
+var coreCommandPrefixes = []string{
+	"workbench.", "editor.", "cursor", "delete", "scroll", "list.", "search.",
+	"notebook.", "debug.", "explorer.", "filesExplorer.", "notifications.",
+	"breadcrumbs.", "problems.", "scm.", "settings.", "keybindings.", "testing.",
+	"inlineChat.", "interactive.", "repl.", "outline.", "timeline.", "actions.",
+	"history.", "diffEditor.", "quickInput.", "default:",
+}
+
+// coreCommands are the editor's commands outside those namespaces
+var coreCommands = map[string]bool{
+	"undo": true, "redo": true, "tab": true, "outdent": true, "type": true,
+	"selectAll": true, "runCommands": true, "expandLineSelection": true,
+	"lineBreakInsert": true, "removeSecondaryCursors": true,
+	"acceptSelectedSuggestion": true, "selectNextSuggestion": true,
+	"selectPrevSuggestion": true, "hideSuggestWidget": true,
+	"toggleSuggestionDetails": true, "insertBestCompletion": true,
+	"closeFindWidget": true, "closeReferenceSearch": true,
+	"closeParameterHints": true, "showNextParameterHint": true,
+	"showPrevParameterHint": true, "copyFilePath": true,
+	"copyRelativeFilePath": true, "revealFileInOS": true, "openInTerminal": true,
+	"renameFile": true, "moveFileToTrash": true, "inQuickOpen": true,
+}
+
+// builtinCommandPrefixes stand in for the built-in extensions when their
+// folder cannot be found (snap, flatpak and other repackaged editors)
+var builtinCommandPrefixes = []string{
+	"git.", "markdown.", "emmet.", "typescript.", "javascript.", "npm.",
+	"merge-conflict.", "references-view.", "css.", "html.", "json.",
+}
+
+// extensionsDir returns the user extensions folder of the editor behind cli
+func extensionsDir(home, cli string) string {
+	if sandboxExtensions != "" {
+		return sandboxExtensions
+	}
+	return pathsFor(home, cli, variantOfCLI(cli)).ExtDir
+}
+
+// builtinExtensionsDirs returns the candidate folders of the editor's
+// built-in extensions, relative to its CLI (bin/code)
+func builtinExtensionsDirs(cli string) []string {
+	if p, err := filepath.EvalSymlinks(cli); err == nil {
+		cli = p
+	}
+	bin := filepath.Dir(cli)
+	return []string{
+		filepath.Join(bin, "..", "resources", "app", "extensions"), // Linux, Windows
+		filepath.Join(bin, "..", "extensions"),                     // macOS (Contents/Resources/app/bin)
+	}
+}
+
+// extensionCommands adds the commands the extensions in dir contribute; with
+// only set, extensions whose id is not in it are skipped (folders of
+// uninstalled versions linger until the editor cleans them up); it reports
+// whether dir could be read
+func extensionCommands(dir string, only map[string]bool, cmds map[string]bool) bool {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(dir, e.Name(), "package.json"))
+		if err != nil {
+			continue
+		}
+		var pkg struct {
+			Publisher   string `json:"publisher"`
+			Name        string `json:"name"`
+			Contributes struct {
+				Commands    json.RawMessage `json:"commands"`
+				Keybindings json.RawMessage `json:"keybindings"`
+			} `json:"contributes"`
+		}
+		if json.Unmarshal(b, &pkg) != nil {
+			continue
+		}
+		if only != nil && !only[strings.ToLower(pkg.Publisher+"."+pkg.Name)] {
+			continue
+		}
+		// both are an object or an array of objects with a "command"
+		for _, raw := range []json.RawMessage{pkg.Contributes.Commands, pkg.Contributes.Keybindings} {
+			var list []struct {
+				Command string `json:"command"`
+			}
+			if json.Unmarshal(raw, &list) != nil {
+				var one struct {
+					Command string `json:"command"`
+				}
+				json.Unmarshal(raw, &one)
+				list = append(list, one)
+			}
+			for _, c := range list {
+				if c.Command != "" {
+					cmds[c.Command] = true
+				}
+			}
+		}
+	}
+	return true
+}
+
+// hasCommandPrefix reports whether cmd starts with one of prefixes
+func hasCommandPrefix(cmd string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(cmd, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// unknownKeybindingCommands returns the commands of the keybindings that
+// nothing in cmds, the core commands or the given prefixes provides
+func unknownKeybindingCommands(data []byte, cmds map[string]bool, prefixes []string) ([]string, error) {
+	_, list, err := parseKeybindings(data)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var res []string
+	for _, b := range list {
+		// removals only unbind and are harmless when nothing is bound
+		if b.cmd == "" || strings.HasPrefix(b.cmd, "-") || seen[b.cmd] {
+			continue
+		}
+		seen[b.cmd] = true
+		if !cmds[b.cmd] && !coreCommands[b.cmd] && !hasCommandPrefix(b.cmd, prefixes) {
+			res = append(res, b.cmd)
+		}
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+// checkKeybindingCommands warns about payload keybindings pointing to
+// commands no installed extension provides
+func (i *Installer) checkKeybindingCommands() {
+	if len(i.keybindData) == 0 || i.dryRun || i.ensureCodeCLI() != nil {
+		return
+	}
+	installed, err := i.installedExtensions()
+	if err != nil {
+		i.warnf("cannot list installed extensions: %v — keybinding commands not checked", err)
+		return
+	}
+	home, _ := os.UserHomeDir()
+	only := make(map[string]bool, len(installed))
+	for _, e := range installed {
+		only[strings.ToLower(e.ID)] = true
+	}
+	cmds := make(map[string]bool)
+	extensionCommands(extensionsDir(home, i.codeCLIPath), only, cmds)
+	prefixes := append([]string{}, coreCommandPrefixes...)
+	builtin := false
+	for _, dir := range builtinExtensionsDirs(i.codeCLIPath) {
+		builtin = extensionCommands(dir, nil, cmds) || builtin
+	}
+	if !builtin {
+		i.logToFile("keybindings: built-in extensions not found next to %s", i.codeCLIPath)
+		prefixes = append(prefixes, builtinCommandPrefixes...)
+	}
+	unknown, err := unknownKeybindingCommands(i.keybindData, cmds, prefixes)
+	if err != nil {
+		i.warnf("%s: cannot check commands: %v", keybindingsFile, err)
+		return
+	}
+	for _, c := range unknown {
+		i.warnf("%s: no installed extension provides command %s", keybindingsFile, c)
+	}
+	i.logToFile("keybindings: commands checked against %d extension commands, %d unknown", len(cmds), len(unknown))
+}
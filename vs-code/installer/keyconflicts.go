@@ -0,0 +1,171 @@
+// keyconflicts.go
+//
+// Keybinding conflicts in append mode (keybindings.go): a binding of the
+// user's and one of the payload on the same chord, for different commands,
+// in overlapping "when" contexts. VS Code would silently let the later one
+// (the user's) win; instead each conflict is shown and the user picks
+//
+//   1) keep mine      the payload binding is left out
+//   2) take payload   the user's binding is dropped
+//   3) keep both      both stay, the user's wins where both apply
+//
+// Answers are remembered per target (next to the applied payload, merge.go)
+// so the same conflict is not asked again. Non-interactive runs (--yes,
+// --silent) keep both and log the conflict. Two "when" contexts overlap
+// unless one has a clause the other negates ("editorTextFocus" vs
+// "!editorTextFocus", "x == a" vs "x != a").
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pterm/pterm"
+)
+
+// conflict resolutions
+const (
+	conflictMine    = "mine"
+	conflictPayload = "payload"
+	conflictBoth    = "both"
+)
+
+const keyChoicesFile = "keybindings.choices.json"
+
+// bindingConflict is a user binding clashing with a payload binding
+type bindingConflict struct {
+	Mine    keybinding
+	Payload keybinding
+}
+
+func (c bindingConflict) id() string {
+	return c.Payload.canon + "\n" + c.Mine.canon
+}
+
+// conflicts reports whether both bindings fire on the same chord for
+// different commands in overlapping contexts
+func (c bindingConflict) conflicts() bool {
+	m, p := c.Mine, c.Payload
+	if m.chord == "" || m.chord != p.chord || m.cmd == p.cmd {
+		return false
+	}
+	if strings.HasPrefix(m.cmd, "-") || strings.HasPrefix(p.cmd, "-") {
+		return false
+	}
+	return whenOverlaps(m.when, p.when)
+}
+
+// whenOverlaps reports whether two "when" expressions can hold at once
+func whenOverlaps(a, b string) bool {
+	if strings.Contains(a, "||") || strings.Contains(b, "||") {
+		return true
+	}
+	ca, cb := whenClauses(a), whenClauses(b)
+	for _, x := range ca {
+		for _, y := range cb {
+			if negates(x, y) || negates(y, x) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// whenClauses splits an && expression into its normalized clauses
+func whenClauses(s string) []string {
+	var res []string
+	for _, c := range strings.Split(s, "&&") {
+		if c = strings.Join(strings.Fields(c), " "); c != "" {
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+// negates reports whether clause x is the negation of y
+func negates(x, y string) bool {
+	if strings.HasPrefix(x, "!") && !strings.ContainsAny(x, "=<>") {
+		return strings.TrimSpace(x[1:]) == y
+	}
+	if l, r, ok := strings.Cut(x, " == "); ok {
+		return y == l+" != "+r
+	}
+	return false
+}
+
+// loadKeyChoices reads the remembered conflict answers of this target
+func (i *Installer) loadKeyChoices() map[string]string {
+	choices := make(map[string]string)
+	if b, err := os.ReadFile(i.appliedPath(keyChoicesFile)); err == nil {
+		if err := json.Unmarshal(b, &choices); err != nil {
+			i.warnf("ignoring %s: %v", keyChoicesFile, err)
+		}
+	}
+	return choices
+}
+
+// keyConflictResolver returns a conflict resolver and a function saving the
+// answers given; without interactive (plan, verify) only remembered answers
+// are used and the rest keep both
+func (i *Installer) keyConflictResolver(interactive bool) (func(bindingConflict) string, func()) {
+	choices := i.loadKeyChoices()
+	changed := false
+	resolve := func(c bindingConflict) string {
+		if choice, ok := choices[c.id()]; ok {
+			if interactive {
+				i.logToFile("keybindings: %s conflict resolved as remembered (%s)", c.Mine.chord, choice)
+			}
+			return choice
+		}
+		if !interactive {
+			return conflictBoth
+		}
+		if i.assumeYes {
+			i.warnf("%s: %s is bound to %s (yours) and %s (payload) — both kept, yours wins", keybindingsFile, c.Mine.chord, c.Mine.cmd, c.Payload.cmd)
+			return conflictBoth
+		}
+		choice, ok := askKeyConflict(i, c)
+		if ok {
+			choices[c.id()] = choice
+			changed = true
+		}
+		return choice
+	}
+	save := func() {
+		if !changed || i.dryRun {
+			return
+		}
+		b, _ := json.MarshalIndent(choices, "", "  ")
+		if err := writeBytes(i.appliedPath(keyChoicesFile), b); err != nil {
+			i.warnf("cannot remember keybinding choices: %v", err)
+		}
+	}
+	return resolve, save
+}
+
+// askKeyConflict shows a conflict and asks how to resolve it; without an
+// answer (end of input) both are kept and nothing is remembered
+func askKeyConflict(i *Installer, c bindingConflict) (string, bool) {
+	pterm.DefaultSection.Printf("Конфликт привязок: %s\n", c.Mine.chord)
+	fmt.Printf("  ваша:    %s\n", c.Mine.raw)
+	fmt.Printf("  payload: %s\n", c.Payload.raw)
+	for {
+		fmt.Print("1) оставить мою  2) взять из payload  3) оставить обе [3]: ")
+		txt, err := i.input().ReadString('\n')
+		if err != nil {
+			return conflictBoth, false
+		}
+		switch strings.TrimSpace(txt) {
+		case "1":
+			return conflictMine, true
+		case "2":
+			return conflictPayload, true
+		case "", "3":
+			return conflictBoth, true
+		}
+		pterm.Warning.Println("Введите 1, 2 или 3")
+	}
+}
@@ -0,0 +1,215 @@
+// keymaps.go
+//
+// Keymap presets from the payload's keymaps.json catalog, chosen with
+// --keymap <name> or, in an interactive apply, from a short menu:
+//
+//   {
+//     "vim": {
+//       "description": "Vim emulation (VSCodeVim)",
+//       "extensions": ["vscodevim.vim"],
+//       "settings": {"vim.useSystemClipboard": true},
+//       "keybindings": [{"key": "ctrl+h", "command": "workbench.action.navigateLeft"}]
+//     }
+//   }
+//
+// The chosen keymap adds its extensions (extensions.txt syntax) to the
+// extension list, its settings on top of the settings fragments and its
+// keybindings after the payload's, so the payload itself stays keymap
+// neutral. "default" (or no choice) adds nothing.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pterm/pterm"
+)
+
+const (
+	keymapsFile   = "keymaps.json"
+	defaultKeymap = "default"
+)
+
+// keymapPreset is one entry of keymaps.json
+type keymapPreset struct {
+	Description string                     `json:"description,omitempty"`
+	Extensions  []string                   `json:"extensions,omitempty"`
+	Settings    map[string]json.RawMessage `json:"settings,omitempty"`
+	Keybindings []json.RawMessage          `json:"keybindings,omitempty"`
+}
+
+// keymapCatalog reads keymaps.json from the payload source; a missing file
+// is an empty catalog
+func (i *Installer) keymapCatalog() (map[string]keymapPreset, error) {
+	data := embeddedKeymaps
+	if !i.useEmbedded {
+		p := filepath.Join(i.baseDir, keymapsFile)
+		if !exists(p) {
+			return nil, nil
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read %s: %w", p, err)
+		}
+		data = b
+	}
+	if len(bytes.TrimSpace(stripJSONC(data))) == 0 {
+		return nil, nil
+	}
+	var catalog map[string]keymapPreset
+	if err := decodeJSONC(data, &catalog); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", keymapsFile, err)
+	}
+	return catalog, nil
+}
+
+// keymapNames lists the catalog's keymaps in sorted order
+func keymapNames(catalog map[string]keymapPreset) []string {
+	var res []string
+	for name := range catalog {
+		if name != defaultKeymap {
+			res = append(res, name)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// chooseKeymap asks which keymap to use when the payload has a catalog and
+// none was given on the command line
+func (i *Installer) chooseKeymap(reader *bufio.Reader) error {
+	if i.keymap != "" || i.assumeYes {
+		return nil
+	}
+	catalog, err := i.keymapCatalog()
+	if err != nil {
+		return err
+	}
+	names := keymapNames(catalog)
+	if len(names) == 0 {
+		return nil
+	}
+	fmt.Println("Раскладки клавиш:")
+	fmt.Println("    0) default")
+	for idx, name := range names {
+		fmt.Printf("  %3d) %-10s %s\n", idx+1, name, catalog[name].Description)
+	}
+	for {
+		fmt.Print("Выберите раскладку (номер или имя) [0]: ")
+		txt, err := reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		txt = strings.TrimSpace(txt)
+		if txt == "" || txt == "0" || txt == defaultKeymap {
+			return nil
+		}
+		if n, err := strconv.Atoi(txt); err == nil && n >= 1 && n <= len(names) {
+			txt = names[n-1]
+		}
+		if containsString(names, txt) {
+			i.keymap = txt
+			return nil
+		}
+		pterm.Warning.Printf("Нет такой раскладки: %s\n", txt)
+	}
+}
+
+// applyKeymap adds the chosen keymap to the payload
+func (i *Installer) applyKeymap() error {
+	if i.keymap == "" || i.keymap == defaultKeymap {
+		return nil
+	}
+	catalog, err := i.keymapCatalog()
+	if err != nil {
+		return err
+	}
+	km, ok := catalog[i.keymap]
+	if !ok {
+		return fmt.Errorf("unknown keymap %q (available: %s)", i.keymap, orDash(strings.Join(keymapNames(catalog), ", ")))
+	}
+
+	specs, err := parseExtensionList(km.Extensions)
+	if err != nil {
+		return fmt.Errorf("%s: %s: %w", keymapsFile, i.keymap, err)
+	}
+	for _, spec := range specs {
+		if !listsExtension(i.extList, spec.ID) {
+			i.extList = append(i.extList, spec)
+		}
+	}
+
+	keys := make([]string, 0, len(km.Settings))
+	for k := range km.Settings {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	data := i.settingsData
+	for _, k := range keys {
+		if data, err = setSettingsKey(data, k, km.Settings[k]); err != nil {
+			return fmt.Errorf("%s: %s: %s: %w", keymapsFile, i.keymap, k, err)
+		}
+	}
+	i.settingsData = data
+
+	if len(km.Keybindings) > 0 {
+		out, err := appendJSONCArray(i.keybindData, km.Keybindings)
+		if err != nil {
+			return fmt.Errorf("%s: %w", keybindingsFile, err)
+		}
+		i.keybindData = out
+	}
+	i.logf("Keymap %s: %d extensions, %d settings, %d keybindings", i.keymap, len(specs), len(keys), len(km.Keybindings))
+	return nil
+}
+
+// listsExtension reports whether the list has the extension id
+func listsExtension(list []extensionSpec, id string) bool {
+	for _, s := range list {
+		if strings.EqualFold(s.ID, id) {
+			return true
+		}
+	}
+	return false
+}
+
+// appendJSONCArray appends elements to a JSONC array after its last entry,
+// leaving the rest of the text as it is
+func appendJSONCArray(data []byte, elems []json.RawMessage) ([]byte, error) {
+	if len(bytes.TrimSpace(stripJSONC(data))) == 0 {
+		data = []byte(strings.TrimSpace(string(data)) + "\n[\n]\n")
+	}
+	_, list, err := parseKeybindings(data)
+	if err != nil {
+		return nil, err
+	}
+	var add bytes.Buffer
+	for _, e := range elems {
+		if add.Len() > 0 || len(list) > 0 {
+			add.WriteByte(',')
+		}
+		add.WriteString("\n  ")
+		add.WriteString(compactJSON(e))
+	}
+	at := 0
+	if len(list) > 0 {
+		at = list[len(list)-1].end
+		// a trailing comma after the last entry stays its separator
+		if k := jsoncSkipSpace(data, at); k < len(data) && data[k] == ',' {
+			at = k + 1
+			add.Next(1)
+		}
+	} else {
+		at = jsoncSkipSpace(data, 0) + 1
+	}
+	out := append(append(append([]byte{}, data[:at]...), add.Bytes()...), data[at:]...)
+	return out, nil
+}
@@ -0,0 +1,134 @@
+// keynormalize.go
+//
+// Normalization of keybindings.json, run on export (export.go) and before
+// the merged file of append mode (keybindings.go) is written:
+//
+//   - chords are canonical: lower case, single spaces between the parts of
+//     a chord, modifiers in VS Code's order ctrl, shift, alt, cmd/meta/win
+//     ("Shift+Ctrl+P" -> "ctrl+shift+p")
+//   - empty entries (no command, or no key outside a "-command" removal)
+//     are dropped, their comments move to the next entry
+//   - exact duplicates are dropped, the first one stays
+//   - entries are sorted by chord within each "// === Section ===" block
+//
+// The sort is stable, so bindings of the same chord keep their order and
+// with it their precedence; bindings of different chords never affect each
+// other. Sections stay where they are.
+
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// modifierOrder ranks the modifiers as VS Code writes them
+var modifierOrder = map[string]int{"ctrl": 1, "shift": 2, "alt": 3, "cmd": 4, "meta": 4, "win": 4}
+
+// canonicalChord normalizes a "key" value
+func canonicalChord(key string) string {
+	parts := strings.Fields(strings.ToLower(key))
+	for n, p := range parts {
+		mods := strings.Split(p, "+")
+		if len(mods) < 2 || strings.HasSuffix(p, "++") {
+			// "+" itself as the key: "ctrl++" splits into "", ""
+			continue
+		}
+		last := len(mods) - 1
+		sort.SliceStable(mods[:last], func(a, b int) bool {
+			return modifierOrder[mods[a]] < modifierOrder[mods[b]]
+		})
+		parts[n] = strings.Join(mods, "+")
+	}
+	return strings.Join(parts, " ")
+}
+
+// withKey returns the binding with its "key" member rewritten to chord
+func withKey(b keybinding, chord string) keybinding {
+	members, _, _, err := jsoncMembers(b.raw)
+	if err != nil {
+		return b
+	}
+	for _, m := range members {
+		if m.Key != "key" {
+			continue
+		}
+		v, _ := json.Marshal(chord)
+		b.raw = append(append(append([]byte{}, b.raw[:m.ValueStart]...), v...), b.raw[m.End:]...)
+		if parsed, err := parseJSONC(b.raw); err == nil {
+			canon, _ := json.Marshal(parsed)
+			b.canon = string(canon)
+		}
+		b.key = chord
+		break
+	}
+	return b
+}
+
+// canonicalizeKeys rewrites the keys of all bindings to their canonical
+// chords, so duplicates are found whatever the spelling
+func canonicalizeKeys(list []keybinding) {
+	for n, b := range list {
+		if b.key != b.chord {
+			list[n] = withKey(b, b.chord)
+		}
+	}
+}
+
+// normalizeBindings applies the normalization to a list of bindings and
+// returns the result with the number of entries dropped
+func normalizeBindings(list []keybinding) ([]keybinding, int) {
+	var res []keybinding
+	var pending []string // comments of dropped entries
+	seen := make(map[string]bool)
+	dropped := 0
+	canonicalizeKeys(list)
+	for _, b := range list {
+		// a keyless removal unbinds the command from every key: it stays
+		if b.cmd == "" || (b.chord == "" && !strings.HasPrefix(b.cmd, "-")) || seen[b.canon] {
+			pending = append(pending, b.leading...)
+			dropped++
+			continue
+		}
+		seen[b.canon] = true
+		if len(pending) > 0 {
+			b.leading = append(pending, b.leading...)
+			pending = nil
+		}
+		res = append(res, b)
+	}
+
+	// sort each section: a run of entries from one section comment to the next
+	start := 0
+	for k := 1; k <= len(res); k++ {
+		if k < len(res) && !startsSection(res[k]) {
+			continue
+		}
+		run := res[start:k]
+		// the section comment stays at the top whatever sorts there, the
+		// entry's own comments below it go along with the entry
+		head := sectionHead(run[0].leading)
+		run[0].leading = run[0].leading[len(head):]
+		sort.SliceStable(run, func(a, b int) bool { return run[a].chord < run[b].chord })
+		run[0].leading = append(head, run[0].leading...)
+		start = k
+	}
+	return res, dropped
+}
+
+// startsSection reports whether a binding has a section comment above it
+func startsSection(b keybinding) bool {
+	return len(sectionHead(b.leading)) > 0
+}
+
+// sectionHead returns the comment lines up to and including the last
+// section comment
+func sectionHead(leading []string) []string {
+	for k := len(leading) - 1; k >= 0; k-- {
+		if sectionComment.MatchString(leading[k]) {
+			return append([]string{}, leading[:k+1]...)
+		}
+	}
+	return nil
+}
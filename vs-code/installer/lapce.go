@@ -0,0 +1,100 @@
+// lapce.go
+//
+// Lapce (--lapce). The payload's lapce/ folder holds
+//
+//   settings.toml   written to Lapce's config folder
+//   keymaps.toml    likewise
+//   plugins/<dir>/  unpacked plugins (a volt.toml and its files, as Lapce
+//                   keeps them), copied file by file to Lapce's plugins
+//                   folder; plugins installed by hand are left alone
+//
+// Lapce names its folders after the stable build: ~/.config/lapce-stable
+// and ~/.local/share/lapce-stable/plugins on Linux (the XDG variables are
+// honored), ~/Library/Application Support/dev.lapce.Lapce-Stable on macOS,
+// %APPDATA%\lapce\Lapce-Stable\{config,data} on Windows. An existing
+// ~/.config/lapce (older builds) is used instead when lapce-stable is
+// missing. Lapce picks changed settings up while running.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+const (
+	lapceDir        = "lapce"
+	lapceSettings   = "settings.toml"
+	lapceKeymaps    = "keymaps.toml"
+	lapcePluginsDir = "plugins"
+)
+
+// lapceFolders returns Lapce's config folder and plugins folder
+func lapceFolders(home string) (string, string) {
+	switch runtime.GOOS {
+	case "darwin":
+		dir := filepath.Join(home, "Library", "Application Support", "dev.lapce.Lapce-Stable")
+		return dir, filepath.Join(dir, lapcePluginsDir)
+	case "windows":
+		dir := filepath.Join(os.Getenv("APPDATA"), "lapce", "Lapce-Stable")
+		return filepath.Join(dir, "config"), filepath.Join(dir, "data", lapcePluginsDir)
+	}
+	config := os.Getenv("XDG_CONFIG_HOME")
+	if config == "" {
+		config = filepath.Join(home, ".config")
+	}
+	data := os.Getenv("XDG_DATA_HOME")
+	if data == "" {
+		data = filepath.Join(home, ".local", "share")
+	}
+	conf := filepath.Join(config, "lapce-stable")
+	if legacy := filepath.Join(config, "lapce"); !exists(conf) && exists(legacy) {
+		conf = legacy
+	}
+	return conf, filepath.Join(data, "lapce-stable", lapcePluginsDir)
+}
+
+// applyLapce deploys the payload's lapce/ folder
+func (i *Installer) applyLapce() error {
+	files, err := i.backendFiles(lapceDir)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("the payload has no %s/ folder", lapceDir)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	conf, plugins := lapceFolders(home)
+	i.logf("Lapce config folder: %s", conf)
+
+	var errs []error
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var dst string
+		switch {
+		case name == lapceSettings || name == lapceKeymaps:
+			dst = filepath.Join(conf, name)
+		case strings.HasPrefix(name, lapcePluginsDir+"/") && strings.Count(name, "/") >= 2:
+			dst = filepath.Join(plugins, filepath.FromSlash(strings.TrimPrefix(name, lapcePluginsDir+"/")))
+		default:
+			i.warnf("%s/%s is not a Lapce payload file — skipped", lapceDir, name)
+			continue
+		}
+		if err := i.deployFile("lapce:"+name, dst, files[name]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
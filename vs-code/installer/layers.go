@@ -0,0 +1,252 @@
+// layers.go
+//
+// Layered manifests: `--layers org.yaml,team.yaml,user.yaml` stacks YAML
+// (or JSON) files on top of the payload, in order, so an organisation can
+// publish a base config that teams and individuals extend. A layer may hold
+//
+//   settings:          # deep-merged into settings.json; null removes a key
+//     editor.fontSize: 14
+//     "[go]":
+//       editor.tabSize: 4
+//   extensions:        # added to the extension set (a pin replaces the earlier one)
+//     - golang.go@0.41.0
+//   removeExtensions:  # taken out of the set inherited so far
+//     - ms-python.python
+//
+// and any manifest.json key (marketplaceUrl, mandatorySettings, projects,
+// ...), deep-merged into the manifest. Later layers win. --set and the
+// other command-line switches still apply on top of the last layer.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// layer is one decoded layer file
+type layer struct {
+	Path     string
+	Settings map[string]interface{}
+	Add      []extensionSpec
+	Remove   []string
+	Manifest map[string]interface{} // every other top-level key
+}
+
+// parseLayerPaths splits the --layers value into absolute paths
+func parseLayerPaths(arg string) ([]string, error) {
+	var res []string
+	for _, p := range strings.Split(arg, ",") {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return nil, fmt.Errorf("bad --layers path %s: %w", p, err)
+		}
+		res = append(res, abs)
+	}
+	return res, nil
+}
+
+// readLayer reads and validates one layer file
+func readLayer(path string) (layer, error) {
+	l := layer{Path: path}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return l, fmt.Errorf("cannot read layer: %w", err)
+	}
+	var v interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		v, err = parseYAML(data)
+	default:
+		v, err = parseJSONC(data)
+	}
+	if err != nil {
+		return l, fmt.Errorf("%s: %w", path, err)
+	}
+	if v == nil {
+		return l, nil
+	}
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return l, fmt.Errorf("%s: a layer must be a mapping", path)
+	}
+	for k, val := range obj {
+		switch k {
+		case "settings":
+			if val == nil {
+				continue
+			}
+			if l.Settings, ok = val.(map[string]interface{}); !ok {
+				return l, fmt.Errorf("%s: settings must be a mapping", path)
+			}
+		case "extensions":
+			ids, err := layerStrings(val)
+			if err != nil {
+				return l, fmt.Errorf("%s: extensions: %w", path, err)
+			}
+			specs, err := parseExtensionList(ids)
+			if err != nil {
+				return l, fmt.Errorf("%s: %w", path, err)
+			}
+			l.Add = specs
+		case "removeExtensions":
+			if l.Remove, err = layerStrings(val); err != nil {
+				return l, fmt.Errorf("%s: removeExtensions: %w", path, err)
+			}
+		default:
+			if l.Manifest == nil {
+				l.Manifest = map[string]interface{}{}
+			}
+			l.Manifest[k] = val
+		}
+	}
+	return l, nil
+}
+
+// layerStrings decodes a list of strings
+func layerStrings(v interface{}) ([]string, error) {
+	if v == nil {
+		return nil, nil
+	}
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("must be a list")
+	}
+	var res []string
+	for _, e := range list {
+		s, ok := e.(string)
+		if !ok {
+			return nil, fmt.Errorf("%v is not a string", e)
+		}
+		res = append(res, s)
+	}
+	return res, nil
+}
+
+// loadLayers reads the --layers files and merges their manifest keys into
+// the payload manifest
+func (i *Installer) loadLayers() error {
+	i.layers = nil
+	for _, p := range i.layerFiles {
+		l, err := readLayer(p)
+		if err != nil {
+			return err
+		}
+		if len(l.Manifest) > 0 {
+			b, err := json.Marshal(i.manifest)
+			if err != nil {
+				return err
+			}
+			var cur interface{}
+			if err := json.Unmarshal(b, &cur); err != nil {
+				return err
+			}
+			b, err = json.Marshal(mergeLayerValue(cur, l.Manifest))
+			if err != nil {
+				return err
+			}
+			m, err := parseManifest(b)
+			if err != nil {
+				return fmt.Errorf("%s: %w", p, err)
+			}
+			i.manifest = m
+		}
+		i.layers = append(i.layers, l)
+	}
+	return nil
+}
+
+// applyLayers merges the layers' settings and extension changes into the
+// payload, in --layers order
+func (i *Installer) applyLayers() error {
+	for _, l := range i.layers {
+		data := i.settingsData
+		cur := map[string]interface{}{}
+		if len(strings.TrimSpace(string(stripJSONC(data)))) > 0 {
+			v, err := parseJSONC(data)
+			obj, ok := v.(map[string]interface{})
+			if err != nil || !ok {
+				return fmt.Errorf("%s is not a JSON object", settingsFile)
+			}
+			cur = obj
+		} else if len(l.Settings) > 0 {
+			data = []byte("{}\n")
+		}
+		keys := make([]string, 0, len(l.Settings))
+		for k := range l.Settings {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			v := l.Settings[k]
+			var err error
+			if v == nil {
+				data, _, err = jsoncDelete(data, k)
+			} else {
+				data, err = jsoncSet(data, k, encodeJSONValue(mergeLayerValue(cur[k], v), "  "))
+			}
+			if err != nil {
+				return fmt.Errorf("layer %s: %s: %w", l.Path, k, err)
+			}
+		}
+		i.settingsData = data
+
+		added := 0
+		for _, s := range l.Add {
+			if n := specIndex(i.extList, s.ID); n >= 0 {
+				i.extList[n] = s
+				continue
+			}
+			i.extList = append(i.extList, s)
+			added++
+		}
+		removed := 0
+		for _, id := range l.Remove {
+			if n := specIndex(i.extList, id); n >= 0 {
+				i.extList = append(i.extList[:n], i.extList[n+1:]...)
+				removed++
+			}
+		}
+		i.logf("Applied layer %s: %d settings, +%d/-%d extensions", filepath.Base(l.Path), len(keys), added, removed)
+	}
+	return nil
+}
+
+// specIndex returns the position of id in specs (case-insensitive), or -1
+func specIndex(specs []extensionSpec, id string) int {
+	for n, s := range specs {
+		if strings.EqualFold(s.ID, id) {
+			return n
+		}
+	}
+	return -1
+}
+
+// mergeLayerValue merges src over dst like deepMerge, except that a null in
+// src removes the key
+func mergeLayerValue(dst, src interface{}) interface{} {
+	s, ok := src.(map[string]interface{})
+	if !ok {
+		return src
+	}
+	d, _ := dst.(map[string]interface{})
+	out := make(map[string]interface{}, len(d)+len(s))
+	for k, v := range d {
+		out[k] = v
+	}
+	for k, v := range s {
+		if v == nil {
+			delete(out, k)
+			continue
+		}
+		out[k] = mergeLayerValue(out[k], v)
+	}
+	return out
+}
@@ -0,0 +1,185 @@
+// link.go
+//
+// Symlink mode (--link, needs --src). Instead of copying, settings.json,
+// keybindings.json and snippets/ of the source folder (typically a
+// dotfiles checkout) are linked into the user dir, so edits made in
+// VS Code land in the checkout and a `git pull` there is live at once.
+// The linked files are the source's as they are, so a payload that the run
+// would transform (fragments, layers, overrides, keymaps, secrets ...) is
+// refused: the transformed files or resolved secrets would otherwise end up
+// in the checkout. For the same reason nothing writes through a link while
+// --link is on: mandatory settings, removals and watch's reconciling report
+// the linked file instead of editing the checkout.
+//
+// A target that already links to the source is left alone, a link to
+// somewhere else is replaced, and a real file or folder is renamed to
+// <name>.pre-link first. On Windows symlinks need Developer Mode or an
+// elevated shell; without them folders fall back to a directory junction
+// and files to a hard link (same volume only).
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"time"
+)
+
+const (
+	snippetsDir   = "snippets"
+	preLinkSuffix = ".pre-link"
+	mklinkTimeout = 10 * time.Second
+)
+
+// linkTarget reports where dst points: the link target for symlinks and
+// junctions, "" for anything else
+func linkTarget(dst string) string {
+	fi, err := os.Lstat(dst)
+	if err != nil || fi.Mode()&(os.ModeSymlink|os.ModeIrregular) == 0 {
+		return ""
+	}
+	t, err := os.Readlink(dst)
+	if err != nil {
+		return ""
+	}
+	if !filepath.IsAbs(t) {
+		t = filepath.Join(filepath.Dir(dst), t)
+	}
+	return filepath.Clean(t)
+}
+
+// isLinkedTo reports whether dst already is src: a link to it or, for the
+// Windows hard link fallback, the same file
+func isLinkedTo(dst, src string) bool {
+	if linkTarget(dst) == filepath.Clean(src) {
+		return true
+	}
+	a, err := os.Stat(src)
+	if err != nil || a.IsDir() {
+		return false
+	}
+	b, err := os.Lstat(dst)
+	return err == nil && os.SameFile(a, b)
+}
+
+// makeLink links dst to src, with the Windows fallbacks
+func makeLink(src, dst string) error {
+	err := os.Symlink(src, dst)
+	if err == nil || runtime.GOOS != "windows" {
+		return err
+	}
+	fi, serr := os.Stat(src)
+	if serr != nil {
+		return err
+	}
+	if fi.IsDir() {
+		if _, jerr := runCommandWithTimeout(mklinkTimeout, "cmd", "/c", "mklink", "/J", dst, src); jerr != nil {
+			return fmt.Errorf("%w (junction fallback failed too: %v)", err, jerr)
+		}
+		return nil
+	}
+	if lerr := os.Link(src, dst); lerr != nil {
+		return fmt.Errorf("%w (enable Developer Mode or run elevated; hard link fallback failed: %v)", err, lerr)
+	}
+	return nil
+}
+
+// linkedToSource reports whether writing dst would edit the source folder:
+// dst or its folder resolves into it, or dst is a hard link of its file
+func (i *Installer) linkedToSource(dst string) bool {
+	base, err := filepath.EvalSymlinks(i.baseDir)
+	if err != nil {
+		return false
+	}
+	real, err := filepath.EvalSymlinks(dst)
+	if err != nil {
+		dir, derr := filepath.EvalSymlinks(filepath.Dir(dst))
+		if derr != nil {
+			return false
+		}
+		real = filepath.Join(dir, filepath.Base(dst))
+	}
+	if rel, err := filepath.Rel(base, real); err == nil && filepath.IsLocal(rel) {
+		return true
+	}
+	return isLinkedTo(dst, filepath.Join(i.baseDir, filepath.Base(dst)))
+}
+
+// checkLinkable refuses --link when the prepared payload differs from the
+// source files that would be linked
+func (i *Installer) checkLinkable() error {
+	for name, data := range map[string][]byte{settingsFile: i.settingsData, keybindingsFile: i.keybindData} {
+		src, err := os.ReadFile(filepath.Join(i.baseDir, name))
+		if err != nil {
+			if len(data) > 0 {
+				return fmt.Errorf("--link: %s is not a file of %s but the payload has one", name, i.baseDir)
+			}
+			continue
+		}
+		wv, werr := parseJSONC(data)
+		sv, serr := parseJSONC(src)
+		if werr == nil && serr == nil && reflect.DeepEqual(wv, sv) {
+			continue
+		}
+		if werr != nil && serr != nil && bytes.Equal(data, src) {
+			continue
+		}
+		return fmt.Errorf("--link: %s of the payload is transformed (fragments, layers, overrides, keymaps or secrets) and would be written into %s — apply without --link", name, i.baseDir)
+	}
+	return nil
+}
+
+// linkPayloadFile links name of the source folder into the user dir
+func (i *Installer) linkPayloadFile(name string) error {
+	src := filepath.Join(i.baseDir, name)
+	dst := filepath.Join(i.vscodeUser, name)
+	if !exists(src) {
+		i.warnf("%s not found in %s — nothing to link", name, i.baseDir)
+		return nil
+	}
+	if isLinkedTo(dst, src) {
+		i.logf("%s already linked to %s", name, src)
+		i.report.UpToDate = append(i.report.UpToDate, name)
+		return nil
+	}
+	if i.dryRun {
+		i.logf("DRY-RUN: would link %s -> %s", dst, src)
+		return nil
+	}
+	if err := os.MkdirAll(i.vscodeUser, 0o755); err != nil {
+		return err
+	}
+	keep := ""
+	if linkTarget(dst) != "" {
+		if err := os.Remove(dst); err != nil {
+			return fmt.Errorf("cannot replace link %s: %w", dst, err)
+		}
+	} else if _, err := os.Lstat(dst); err == nil {
+		keep = dst + preLinkSuffix
+		if err := os.RemoveAll(keep); err != nil {
+			return err
+		}
+		if err := os.Rename(dst, keep); err != nil {
+			return fmt.Errorf("cannot move %s aside: %w", dst, err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := makeLink(src, dst); err != nil {
+		if keep != "" {
+			os.Rename(keep, dst)
+		}
+		return fmt.Errorf("cannot link %s: %w", dst, err)
+	}
+	if keep != "" {
+		i.logf("Kept the previous %s as %s", name, keep)
+	}
+	i.report.Written = append(i.report.Written, name)
+	i.logf("Linked %s -> %s", dst, src)
+	return nil
+}
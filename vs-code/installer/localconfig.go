@@ -0,0 +1,147 @@
+// localconfig.go
+//
+// Per-user installer config that travels with neither the payload nor the
+// binary: $XDG_CONFIG_HOME/hypreditors/config.json (~/.config/hypreditors on
+// Linux, ~/Library/Application Support/hypreditors on macOS,
+// %APPDATA%\hypreditors on Windows).
+//
+//   { "protectedKeys": ["window.zoomLevel", "editor.fontSize", "terminal.*"] }
+//
+// Protected keys (exact or glob patterns) are never modified by the
+// installer: the payload, --set and settings.remove.json leave them at the
+// user's value, or absent when the user hasn't set them, and --watch accepts
+// their drift. Only mandatory settings (admin policy) override them.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+const localConfigName = "config.json"
+
+// LocalConfig is the decoded per-user config.json
+type LocalConfig struct {
+	// ProtectedKeys are settings keys / patterns the installer never touches
+	ProtectedKeys []string `json:"protectedKeys,omitempty"`
+}
+
+// configDir returns the per-user config directory
+func configDir(home string) string {
+	switch runtime.GOOS {
+	case "windows":
+		if d := os.Getenv("APPDATA"); d != "" {
+			return filepath.Join(d, stateDirName)
+		}
+		return filepath.Join(home, "AppData", "Roaming", stateDirName)
+	case "darwin":
+		return filepath.Join(home, "Library", "Application Support", stateDirName)
+	default:
+		if d := os.Getenv("XDG_CONFIG_HOME"); d != "" {
+			return filepath.Join(d, stateDirName)
+		}
+		return filepath.Join(home, ".config", stateDirName)
+	}
+}
+
+func (i *Installer) localConfigPath() string {
+	return filepath.Join(configDir(i.homeDir), localConfigName)
+}
+
+// loadLocalConfig reads config.json; a missing file yields an empty config
+func (i *Installer) loadLocalConfig() error {
+	p := i.localConfigPath()
+	b, err := os.ReadFile(p)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("cannot read %s: %w", p, err)
+	}
+	var c LocalConfig
+	if err := json.Unmarshal(stripJSONC(b), &c); err != nil {
+		return fmt.Errorf("invalid %s: %w", p, err)
+	}
+	for _, k := range c.ProtectedKeys {
+		if _, err := path.Match(k, ""); err != nil {
+			return fmt.Errorf("%s: bad protected key pattern %q", p, k)
+		}
+	}
+	i.local = c
+	return nil
+}
+
+// isProtectedKey reports whether key is protected by the local config
+func (i *Installer) isProtectedKey(key string) bool {
+	if i.isMandatoryKey(key) {
+		return false
+	}
+	for _, p := range i.local.ProtectedKeys {
+		if ok, _ := path.Match(p, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// applyProtectedKeys makes the settings payload carry the user's current
+// value of every protected key (and drop protected keys the user hasn't set),
+// so writing the payload leaves them as they are
+func (i *Installer) applyProtectedKeys() error {
+	if len(i.local.ProtectedKeys) == 0 || len(i.settingsData) == 0 {
+		return nil
+	}
+	live := make(map[string][]byte)
+	if b, err := os.ReadFile(filepath.Join(i.vscodeUser, settingsFile)); err == nil {
+		members, _, _, err := jsoncMembers(b)
+		if err != nil {
+			return fmt.Errorf("cannot parse your %s to keep protected keys: %w", settingsFile, err)
+		}
+		for _, m := range members {
+			live[m.Key] = b[m.ValueStart:m.End]
+		}
+	}
+	members, _, _, err := jsoncMembers(i.settingsData)
+	if err != nil {
+		return fmt.Errorf("%s: %w", settingsFile, err)
+	}
+	payload := make(map[string][]byte)
+	for _, m := range members {
+		payload[m.Key] = i.settingsData[m.ValueStart:m.End]
+	}
+
+	data := i.settingsData
+	var kept []string
+	for _, k := range sortedKeys(live) {
+		if !i.isProtectedKey(k) || string(payload[k]) == string(live[k]) {
+			continue
+		}
+		if data, err = jsoncSet(data, k, live[k]); err != nil {
+			return err
+		}
+		kept = append(kept, k)
+	}
+	for _, k := range sortedKeys(payload) {
+		if _, set := live[k]; set || !i.isProtectedKey(k) {
+			continue
+		}
+		if data, _, err = jsoncDelete(data, k); err != nil {
+			return err
+		}
+		kept = append(kept, k)
+	}
+	if len(kept) == 0 {
+		return nil
+	}
+	sort.Strings(kept)
+	i.settingsData = data
+	i.logf("Protected keys left as you have them: %s", strings.Join(kept, ", "))
+	return nil
+}
@@ -0,0 +1,118 @@
+// mackeys.go
+//
+// The payload's keybindings are written once, with Linux/Windows modifiers.
+// On macOS every "ctrl+" in a binding's key becomes "cmd+" (in each part of
+// a chord, "ctrl+k ctrl+s" -> "cmd+k cmd+s"), so the same payload feels
+// native on a Mac keyboard. Bindings that stay on ctrl there as well are
+// left alone: the built-in macKeepCtrl list (ctrl+tab, ctrl+`, ...) and the
+// manifest's "macKeepCtrl" list of keys or commands (globs allowed):
+//
+//   "macKeepCtrl": ["ctrl+c", "workbench.action.terminal.*"]
+//
+// Parts that already use cmd are not touched.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"runtime"
+	"strings"
+)
+
+// macKeepCtrl are keys that use ctrl on macOS too
+var macKeepCtrl = []string{
+	"ctrl+tab", "ctrl+shift+tab", "ctrl+`", "ctrl+shift+`", "ctrl+space",
+	"ctrl+-", "ctrl+shift+-",
+}
+
+// macChord translates one "key" value to macOS modifiers
+func macChord(key string) string {
+	parts := strings.Fields(strings.ToLower(key))
+	for n, p := range parts {
+		mods := strings.Split(p, "+")
+		if containsString(mods, "cmd") {
+			continue
+		}
+		for k, m := range mods[:len(mods)-1] {
+			if m == "ctrl" {
+				mods[k] = "cmd"
+			}
+		}
+		parts[n] = strings.Join(mods, "+")
+	}
+	return strings.Join(parts, " ")
+}
+
+// matchesBinding reports whether a binding is on a list of keys or
+// commands (globs allowed)
+func matchesBinding(b keybinding, list []string) bool {
+	for _, p := range list {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if p == b.chord || p == strings.ToLower(b.cmd) {
+			return true
+		}
+		if ok, _ := path.Match(p, b.chord); ok {
+			return true
+		}
+		if ok, _ := path.Match(p, strings.ToLower(b.cmd)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// macKeybindings rewrites the keys of keybindings.json data for macOS and
+// returns the new data with the number of bindings changed
+func macKeybindings(data []byte, keep []string) ([]byte, int, error) {
+	_, list, err := parseKeybindings(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	out := append([]byte{}, data...)
+	changed := 0
+	// from the last binding back, so earlier offsets stay valid
+	for n := len(list) - 1; n >= 0; n-- {
+		b := list[n]
+		if !strings.Contains(b.chord, "ctrl+") || matchesBinding(b, keep) {
+			continue
+		}
+		mac := macChord(b.chord)
+		if mac == b.chord {
+			continue
+		}
+		start := b.end - len(b.raw)
+		members, _, _, err := jsoncMembers(b.raw)
+		if err != nil {
+			continue
+		}
+		for _, m := range members {
+			if m.Key != "key" {
+				continue
+			}
+			v, _ := json.Marshal(mac)
+			at, end := start+m.ValueStart, start+m.End
+			out = append(out[:at], append(v, out[end:]...)...)
+			changed++
+		}
+	}
+	return out, changed, nil
+}
+
+// translateMacKeys switches the payload's keybindings to cmd on macOS
+func (i *Installer) translateMacKeys() error {
+	if runtime.GOOS != "darwin" || len(i.keybindData) == 0 {
+		return nil
+	}
+	keep := append(append([]string{}, macKeepCtrl...), i.manifest.MacKeepCtrl...)
+	out, changed, err := macKeybindings(i.keybindData, keep)
+	if err != nil {
+		return fmt.Errorf("%s: %w", keybindingsFile, err)
+	}
+	if changed > 0 {
+		i.keybindData = out
+		i.logf("%s: %d bindings switched from ctrl to cmd for macOS", keybindingsFile, changed)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+// macos.go
+//
+// macOS deployment from Jamf / MDM policies. Policies run the installer as
+// root without a TTY, but the config belongs to the user at the console:
+// a root run re-executes itself as the console user (launchctl asuser +
+// sudo -u, so the editor CLI, Homebrew and every written file run and
+// belong to that user) and passes the exit code on. With nobody logged in
+// there is nothing to configure and the run fails with exitFailure, so the
+// policy is retried at the next check-in; HYPREDITORS_RUN_AS_ROOT=1 skips
+// the mapping and configures root itself.
+//
+// Silent runs on macOS also send their warnings and errors to unified
+// logging (the system `logger`, tag hypreditors), next to the log file;
+// the rest stays in the log file, one `logger` per line would be too slow:
+//
+//   log show --last 1h --predicate 'eventMessage CONTAINS "hypreditors"'
+//
+// Periodic reconcile is the launchd agent of install-service.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	runAsRootEnv      = "HYPREDITORS_RUN_AS_ROOT"
+	consoleUserEnv    = "HYPREDITORS_CONSOLE_USER" // set in the re-executed child
+	unifiedLogTag     = "hypreditors"
+	unifiedLogTimeout = 5 * time.Second
+)
+
+// consoleUser returns the name and uid of the user logged in at the
+// console; ok is false at the login window or during Setup Assistant
+func consoleUser() (name, uid string, ok bool) {
+	out, err := runCommandWithTimeout(serviceCmdTimeout, "stat", "-f", "%Su:%u", "/dev/console")
+	if err != nil {
+		return "", "", false
+	}
+	name, uid, _ = strings.Cut(strings.TrimSpace(out), ":")
+	switch name {
+	case "", "root", "loginwindow", "_mbsetupuser":
+		return "", "", false
+	}
+	return name, uid, true
+}
+
+// runAsConsoleUser re-executes a root run on macOS as the console user;
+// handled is false when this process should go on itself
+func runAsConsoleUser() (code int, handled bool) {
+	if runtime.GOOS != "darwin" || os.Geteuid() != 0 || os.Getenv(runAsRootEnv) != "" || os.Getenv(consoleUserEnv) != "" {
+		return exitOK, false
+	}
+	name, uid, ok := consoleUser()
+	if !ok {
+		fmt.Fprintf(os.Stderr, "ERROR: running as root and nobody is logged in at the console — nothing to configure (set %s=1 to configure root)\n", runAsRootEnv)
+		return exitFailure, true
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ERROR: cannot determine exe path:", err)
+		return exitFailure, true
+	}
+	args := append([]string{"asuser", uid, "sudo", "-n", "-u", name, "-H", consoleUserEnv + "=" + name, exe}, os.Args[1:]...)
+	cmd := exec.Command("launchctl", args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	var exitErr *exec.ExitError
+	switch err := cmd.Run(); {
+	case errors.As(err, &exitErr):
+		return exitErr.ExitCode(), true
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "ERROR: cannot run as console user %s: %v\n", name, err)
+		return exitFailure, true
+	}
+	return exitOK, true
+}
+
+// unifiedLog sends a warning or error to macOS unified logging; level is
+// the syslog priority (warning, err)
+func (i *Installer) unifiedLog(level, msg string) {
+	if !i.osLog {
+		return
+	}
+	runCommandWithTimeout(unifiedLogTimeout, "logger", "-t", unifiedLogTag, "-p", "user."+level, msg)
+}
@@ -1,27 +1,42 @@
 // main.go
 //
 // Cross-platform VS Code Custom Installer
-// - Embeds settings.json, keybindings.json and extensions.txt (via //go:embed)
+// - Embeds settings.json (+ settings.d/ fragments), keybindings.json and extensions.txt (via //go:embed), plus named presets from data/<name>/
 // - Interactive choices: apply settings, apply keybindings, install extensions
+// - Extension entries may be pinned: publisher.name@1.2.3 (see extensions.go)
 // - Creates backups (optional), writes files to user VS Code config dir
 // - Installs extensions with timeout, retries and random backoff
 // - Writes human-readable log to ~/vscode-custom-install.log (or %USERPROFILE% on Windows)
-// - Flags: --yes (non-interactive accept all), --dry-run, --src <path>, --no-backup
+// - Flags: --yes (non-interactive accept all), --dry-run, --src <path>, --no-backup, --backup-archive, --backup-incremental,
+//   --backup-dir <path>, --encrypt-backup, --backup-key-file <path>,
+//   --merge, --git, --vsix-dir <path>, --batch N, --watch [--watch-interval 5m] [--allow-keys k1,k2],
+//   --marketplace-url <url>, --payload <preset>, --install-editor <editor>, --editor <name>[,...]|all, --user-data-dir <dir>,
+//   --silent [--mandatory-settings <file>], --quiet, --force, --set key=value, --set-json key=<json>,
+//   --json-indent 2|4|tab, --json-sort-keys, --keybindings-mode overwrite|append,
+//   --keymap <name>, --bench, --link, --scan <dir>, --workspace-settings <dir>, --theia <dir>, --notepadpp, --lapce, --pulsar,
+//   --geany, --kakoune, --remote user@host[,...]
+// - Subcommands (see commands.go): apply, update, search, plan, verify, status, install-service, pack, bundle,
+//   serve-mirror, version, lint, new, workspace, recommend, keybindings,
+//   export, facts, cache, bootstrap, backup
 //
 // Usage:
-//   go build -o vscode-installer main.go
+//   go build -o vscode-installer .
 //   ./vscode-installer           # interactive
 //   ./vscode-installer --yes     # accept defaults (apply all)
 //   ./vscode-installer --dry-run # show actions but do not perform writes/installs
 //   ./vscode-installer --no-backup  # skip backup
+//   ./vscode-installer update [--apply]  # report outdated extensions, update curated ones
 //
 // Put your custom files in ./data/ (settings.json, keybindings.json, extensions.txt) before building,
 // or modify the embedded files below.
+// Additional named presets go into ./data/<name>/ (see presets.go).
+// Project templates for `new` go into ./data/templates/<name>/ (see scaffold.go).
 
 package main
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	_ "embed"
 	"errors"
@@ -33,14 +48,17 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/pterm/pterm"
 )
 
 // ---------------------- EMBED your custom files here ----------------------
-// Create a folder data/ with settings.json, keybindings.json and extensions.txt.
+// Create a folder data/ with settings.json, keybindings.json, extensions.txt, blocked.txt
+// and manifest.json.
 // If they are not present at build-time, embedded variables will be empty.
 
 //go:embed data/settings.json
@@ -52,6 +70,21 @@ var embeddedKeybindings []byte
 //go:embed data/extensions.txt
 var embeddedExtensions []byte
 
+//go:embed data/blocked.txt
+var embeddedBlocklist []byte
+
+//go:embed data/manifest.json
+var embeddedManifest []byte
+
+//go:embed data/settings.remove.json
+var embeddedRemoveList []byte
+
+//go:embed data/keymaps.json
+var embeddedKeymaps []byte
+
+//go:embed data/policy.json
+var embeddedPolicy []byte
+
 // -------------------------------------------------------------------------
 
 // configuration constants
@@ -61,44 +94,321 @@ const (
 	extensionsFile    = "extensions.txt"
 	settingsFile      = "settings.json"
 	keybindingsFile   = "keybindings.json"
-	installTimeoutSec = 40              // timeout for single extension install
-	retries           = 3               // attempts per extension
-	minSleepMs        = 800             // min random sleep between installs (ms)
-	maxSleepMs        = 2500            // max random sleep between installs (ms)
-	listTimeoutSec    = 10              // timeout for code --list-extensions
+	installTimeoutSec = 40   // timeout for single extension install
+	retries           = 3    // attempts per extension
+	minSleepMs        = 800  // min random sleep between installs (ms)
+	maxSleepMs        = 2500 // max random sleep between installs (ms)
+	listTimeoutSec    = 10   // timeout for code --list-extensions
 )
 
 // Installer holds runtime state
 type Installer struct {
-	baseDir      string // dir of exe (or src if --src)
-	homeDir      string
-	vscodeUser   string
-	backupDir    string
-	logPath      string
-	codeCLIPath  string
-	useEmbedded  bool // whether to use embedded files or external from baseDir
-	dryRun       bool
-	assumeYes    bool
-	srcOverride  string // path provided with --src
-	settingsData []byte
-	keybindData  []byte
-	extList      []string
-	logger       *os.File
-	skipBackup   bool
+	baseDir       string // dir of exe (or src if --src)
+	homeDir       string
+	vscodeUser    string
+	backupDir     string
+	logPath       string
+	codeCLIPath   string
+	useEmbedded   bool // whether to use embedded files or external from baseDir
+	dryRun        bool
+	assumeYes     bool
+	srcOverride   string // path provided with --src
+	settingsData  []byte
+	keybindData   []byte
+	extList       []extensionSpec
+	logger        *os.File
+	skipBackup    bool
+	vsixDir       string                 // --vsix-dir with local .vsix packages
+	vsix          map[string]vsixPackage // local packages by lower-cased id
+	batchSize     int                    // extensions per code invocation (--batch), <=1 means one by one
+	blocklist     []string               // blocked extension ids / patterns
+	noEstimate    bool                   // skip the pre-install size estimate
+	manifest      Manifest
+	mandatory     map[string]interface{}
+	policyKeys    map[string]bool // the mandatory keys locked by policy.json
+	overrides     []settingOverride
+	removeKeys    []string
+	local         LocalConfig
+	jsonStyle     jsonStyle
+	factCache     map[string]string
+	secrets       []string          // resolved secret values, JSON-escaped, longest first
+	secretNames   map[string]string // resolved secret value -> its name
+	migrations    []migration
+	bindingsMode  string
+	keymap        string
+	mirrorURL     string     // gallery mirror (--marketplace-url / manifest), empty = editor default
+	cache         *vsixCache // download cache for .vsix from the mirror and bundles
+	report        runReport
+	backupFormat  string          // backupFormatDir, backupFormatArchive, backupFormatIncremental or backupFormatEncrypted
+	backupRoot    string          // folder holding backup_<ts> entries (--backup-dir or the user dir)
+	backupKeyFile string          // --backup-key-file with the backup passphrase
+	backupPass    string          // passphrase for encrypted backups, asked for once per run
+	watchInterval time.Duration   // --watch: how often extensions are reconciled
+	allowKeys     []string        // settings key patterns users may change freely (--allow-keys)
+	safety        []safetyCopy    // originals of files overwritten during this run
+	merge         bool            // --merge: three-way merge payload files with the user's edits
+	stdin         *bufio.Reader   // shared reader for interactive questions
+	answers       map[string]bool // answers given "for all remaining targets" (session.go)
+	remaining     int             // targets of this run after the current one (editor matrix)
+	httpDebug     bool            // log every HTTP request (--debug, httpclient.go)
+	userDataDir   string          // --user-data-dir of a real run (absolute), "" otherwise
+	gitTrack      bool            // --git: commit managed files before and after the apply
+	preset        string          // embedded payload preset chosen with --payload or interactively
+	editorInstall string          // --install-editor: editor variant to install via the package manager
+	editor        editorVariant   // --editor: the editor whose config and extensions the run targets
+	silent        bool            // --silent: no prompts, errors to stderr, exit codes, machine log
+	quiet         bool            // --quiet: no prompts, warnings and errors to stderr, exit codes
+	exitStatus    int             // first failure of a silent run (exit* constants)
+	mandatoryFile string          // --mandatory-settings file
+	osLog         bool            // silent macOS runs also log to unified logging (macos.go)
+	sandbox       string          // --sandbox folder, "" for a real run
+	layerFiles    []string        // --layers files, in order
+	layers        []layer         // decoded layerFiles
+	force         bool            // --force: apply even if the state says the payload is already applied
+	strict        bool            // --strict: stop at the first error and roll back (strict.go)
+	errorCount    atomic.Int64    // errors logged so far (errorf runs in install workers too)
+	appliedPrev   []safetyCopy    // merge bases replaced by this run, for the strict rollback
+	transaction   bool            // --transaction: journal the run's changes, roll back a failed run (journal.go)
+	rollbackExts  bool            // --rollback-extensions: a rollback also uninstalls the run's extensions
+	txn           *journal        // journal of the running transaction, nil otherwise
+	installed     *extensionStore // installed extensions of the target editor (installstore.go)
+	fromStep      string          // --from-step: first step to run (checkpoint.go)
+	skipSteps     []string        // steps done before this run started
+	noThrottle    bool            // skip the random pauses between installs (bootstrap)
+	link          bool            // --link: symlink the --src files into the user dir instead of copying
+	bench         *benchTimer     // --bench: phase timings, nil when off
+}
+
+// Options holds the command-line switches shared by the apply flow and subcommands
+type Options struct {
+	DryRun            bool
+	AssumeYes         bool
+	SrcOverride       string
+	SkipBackup        bool
+	VSIXDir           string
+	Batch             int
+	NoEstimate        bool
+	Marketplace       string
+	BackupArchive     bool
+	BackupIncremental bool
+	BackupDir         string
+	EncryptBackup     bool
+	BackupKeyFile     string
+	Watch             bool
+	WatchInterval     time.Duration
+	AllowKeys         string
+	Merge             bool
+	Git               bool
+	Payload           string
+	InstallEditor     string
+	Editor            string
+	UserDataDir       string
+	Silent            bool
+	Quiet             bool
+	MandatorySettings string
+	Layers            string
+	Force             bool
+	Strict            bool
+	Transaction       bool
+	RollbackExts      bool
+	FromStep          string
+	Overrides         []settingArg
+	JSONIndent        string
+	JSONSortKeys      bool
+	KeybindingsMode   string
+	Keymap            string
+	Link              bool
+	Bench             bool
+	Scan              string
+	WorkspaceSettings string
+	Theia             string
+	NotepadPP         bool
+	Lapce             bool
+	Pulsar            bool
+	Geany             bool
+	Kakoune           bool
+	Remote            string
+	AllUsers          bool
+	Sandbox           bool
+	SandboxDir        string
+	CACert            string
+	Report            string
+	ReportURL         string
+	ReportTokenFile   string
+	Ansible           bool
+	Debug             bool
+	NoThrottle        bool            // no pauses between installs (set by bootstrap, no flag)
+	NoHeader          bool            // banner already shown (set by the editor matrix, no flag)
+	Answers           map[string]bool // answers "for all" shared by the editor matrix (no flag)
+	Remaining         int             // editors of the matrix after this one (no flag)
+}
+
+// bind registers the shared switches on fs
+func (o *Options) bind(fs *flag.FlagSet) {
+	fs.BoolVar(&o.AssumeYes, "yes", false, "Assume 'yes' for all questions (non-interactive)")
+	fs.BoolVar(&o.DryRun, "dry-run", false, "Dry run - show actions but don't write files or install extensions")
+	fs.StringVar(&o.SrcOverride, "src", "", "Use external folder with settings.json/keybindings.json/extensions.txt instead of embedded payloads")
+	fs.StringVar(&o.Payload, "payload", "", "Use the named embedded payload preset (a data/<name>/ folder at build time)")
+	fs.BoolVar(&o.SkipBackup, "no-backup", false, "Don't create backup of existing user settings (skip backup)")
+	fs.BoolVar(&o.BackupArchive, "backup-archive", false, "Store the backup as a single backup_<ts>.tar.gz (.zip on Windows)")
+	fs.BoolVar(&o.BackupIncremental, "backup-incremental", false, "Store backup contents content-addressed so repeated runs share unchanged files")
+	fs.StringVar(&o.BackupDir, "backup-dir", "", "Store backups in this folder instead of the VS Code user dir")
+	fs.BoolVar(&o.EncryptBackup, "encrypt-backup", false, "Encrypt the backup archive (AES-256-GCM) with a passphrase")
+	fs.StringVar(&o.BackupKeyFile, "backup-key-file", "", "File holding the backup passphrase (default: $"+backupPassphraseEnv+" or a prompt)")
+	fs.StringVar(&o.VSIXDir, "vsix-dir", "", "Folder with local *.vsix packages: installed from disk instead of the network")
+	fs.IntVar(&o.Batch, "batch", 0, "Install N extensions per code invocation (faster start-up, esp. on Windows)")
+	fs.BoolVar(&o.Force, "force", false, "Apply even when the state file says this payload version is already applied")
+	fs.BoolVar(&o.Strict, "strict", false, "Stop at the first error (backup, write, extension install), roll back the files written so far and exit non-zero")
+	fs.BoolVar(&o.Transaction, "transaction", false, "Journal every change of the run and roll the config files back when the run fails")
+	fs.BoolVar(&o.RollbackExts, "rollback-extensions", false, "With --transaction: a rollback also uninstalls the extensions added by the failed run")
+	fs.StringVar(&o.FromStep, "from-step", "", "Start at this step ("+strings.Join(runSteps, ", ")+"), skipping the ones before it; default: resume after the steps an interrupted run completed")
+	fs.BoolVar(&o.NoEstimate, "no-estimate", false, "Don't query download sizes before the interactive extension selection")
+	fs.BoolVar(&o.Git, "git", false, "Commit the managed config files to git before and after the apply (repo created in the user dir unless it already is in one)")
+	fs.BoolVar(&o.Merge, "merge", false, "Three-way merge settings/keybindings: keep your edits made since the last apply, still pick up payload changes")
+	fs.BoolVar(&o.Watch, "watch", false, "Keep running after the apply and reconcile drifted files/extensions back to the payload")
+	fs.DurationVar(&o.WatchInterval, "watch-interval", 5*time.Minute, "With --watch: how often installed extensions are reconciled")
+	fs.StringVar(&o.AllowKeys, "allow-keys", "", "With --watch: comma-separated settings keys/patterns users may change freely (e.g. editor.fontSize,workbench.*)")
+	fs.StringVar(&o.Editor, "editor", "", "Target editor ("+editorNames()+"), a comma-separated list of them, or all (every installed one); default: the --install-editor one, else code")
+	fs.StringVar(&o.UserDataDir, "user-data-dir", "", "The editor's user data dir when it is started with --user-data-dir (portable or side-by-side setups); settings go to <dir>/User")
+	fs.StringVar(&o.InstallEditor, "install-editor", "", "Install the editor first via the system package manager ("+editorNames()+")")
+	fs.BoolVar(&o.Silent, "silent", false, "Unattended deployment: implies --yes, never prompts, machine-scoped log, defined exit codes")
+	fs.BoolVar(&o.Quiet, "quiet", false, "Print only warnings and errors (to stderr): implies --yes, defined exit codes as with --silent, the log stays in the home folder")
+	fs.Var(settingArgs{list: &o.Overrides}, "set", "Override a setting on top of the payload: key=value (repeatable)")
+	fs.Var(settingArgs{list: &o.Overrides, json: true}, "set-json", "Override a setting with a JSON value: key=<json> (repeatable)")
+	fs.StringVar(&o.JSONIndent, "json-indent", "", "Re-render settings.json with this indent (2, 4, tab); default: as authored")
+	fs.BoolVar(&o.JSONSortKeys, "json-sort-keys", false, "Re-render settings.json with its keys sorted")
+	fs.StringVar(&o.KeybindingsMode, "keybindings-mode", "", "keybindings.json: overwrite (default) or append (keep your bindings, add the payload's)")
+	fs.StringVar(&o.Keymap, "keymap", "", "Keymap preset from the payload's keymaps.json (vim, emacs, ...; default: none)")
+	fs.BoolVar(&o.Bench, "bench", false, "Time every phase (detection, backup, settings, each extension) and print a timing table at the end")
+	fs.BoolVar(&o.Link, "link", false, "Symlink settings.json, keybindings.json and snippets/ from --src into the user dir instead of copying")
+	fs.StringVar(&o.Scan, "scan", "", "Merge the payload's workspace/ files into .vscode/ of every git repository below this folder (instead of the user-level apply)")
+	fs.StringVar(&o.WorkspaceSettings, "workspace-settings", "", "Merge only the payload's workspace/settings.json into <dir>/.vscode/settings.json (instead of the user-level apply)")
+	fs.StringVar(&o.Theia, "theia", "", "Write the payload into a Theia/Gitpod workspace: <dir>/.theia/settings.json and vscode.extensions of <dir>/.gitpod.yml (instead of the user-level apply)")
+	fs.BoolVar(&o.NotepadPP, "notepadpp", false, "Windows: deploy the payload's notepadpp/ folder (config.xml, themes, Plugin Admin plugin list) to Notepad++ (instead of the user-level apply)")
+	fs.BoolVar(&o.Lapce, "lapce", false, "Deploy the payload's lapce/ folder (settings.toml, keymaps.toml, plugins) to Lapce (instead of the user-level apply)")
+	fs.BoolVar(&o.Pulsar, "pulsar", false, "Deploy the payload's pulsar/ folder (config.cson and friends, packages.txt via ppm install) to Pulsar or Atom (instead of the user-level apply)")
+	fs.BoolVar(&o.Geany, "geany", false, "Deploy the payload's geany/ folder (geany.conf, color schemes, plugin prefs) to Geany (instead of the user-level apply)")
+	fs.BoolVar(&o.Kakoune, "kakoune", false, "Deploy the payload's kakoune/ folder (kakrc, autoload scripts; bootstraps plug.kak) to Kakoune (instead of the user-level apply)")
+	fs.StringVar(&o.Remote, "remote", "", "Apply settings and extensions to the VS Code Server of these SSH hosts (user@host[,user@host2]) instead of locally")
+	fs.BoolVar(&o.Sandbox, "sandbox", false, "Apply into a throwaway temp folder (fake home, user dir and extensions dir) instead of the real profile, for CI")
+	fs.StringVar(&o.SandboxDir, "sandbox-dir", "", "Like --sandbox, in this folder (reuse it to verify the result)")
+	fs.BoolVar(&o.AllUsers, "all-users", false, "Windows, elevated: write the payload into the Default profile and every existing user profile instead of the current user (lab images)")
+	fs.StringVar(&o.MandatorySettings, "mandatory-settings", "", "JSON file with settings enforced in settings.json on every run")
+	fs.StringVar(&o.Layers, "layers", "", "Comma-separated YAML/JSON layer files (org.yaml,team.yaml,user.yaml) applied in order on top of the payload")
+	fs.StringVar(&o.CACert, "ca-cert", "", "PEM bundle trusted in addition to the system roots (corporate TLS proxies)")
+	fs.BoolVar(&o.Ansible, "ansible", false, "Ansible module mode: like --silent, stdout is one JSON object with changed/failed/diff")
+	fs.StringVar(&o.Report, "report", "", "Write the run report (installed/failed/written items, exit code) as JSON to this file")
+	fs.StringVar(&o.ReportURL, "report-url", "", "POST the JSON run report (host, user, target, results) to this webhook at the end")
+	fs.StringVar(&o.ReportTokenFile, "report-token-file", "", "File holding the --report-url bearer token (default: $"+reportTokenEnv+")")
+	fs.BoolVar(&o.Debug, "debug", false, "Log every HTTP request (method, URL, status, time, retries) to the log file")
+	fs.StringVar(&o.Marketplace, "marketplace-url", "", "Gallery service URL of a Marketplace mirror / Open VSX instance for queries and downloads")
 }
 
 // NewInstaller builds Installer and prepares logging
-func NewInstaller(dryRun, assumeYes bool, srcOverride string, skipBackup bool) (*Installer, error) {
+func NewInstaller(opts Options) (*Installer, error) {
 	inst := &Installer{
-		dryRun:      dryRun,
-		assumeYes:   assumeYes,
-		srcOverride: srcOverride,
-		skipBackup:  skipBackup,
+		answers:     opts.Answers,
+		remaining:   opts.Remaining,
+		dryRun:      opts.DryRun,
+		assumeYes:   opts.AssumeYes,
+		srcOverride: opts.SrcOverride,
+		skipBackup:  opts.SkipBackup,
+		batchSize:   opts.Batch,
+		noEstimate:  opts.NoEstimate,
+		mirrorURL:   opts.Marketplace,
+		merge:       opts.Merge,
+		gitTrack:    opts.Git,
+		silent:      opts.Silent,
+		quiet:       opts.Quiet,
+		force:       opts.Force,
+		strict:      opts.Strict,
+		keymap:      opts.Keymap,
+		noThrottle:  opts.NoThrottle,
+		link:        opts.Link,
+	}
+	inst.installed = newExtensionStore()
+	if inst.quiet {
+		inst.assumeYes = true
+	}
+	if inst.silent {
+		inst.assumeYes = true
+		inst.osLog = runtime.GOOS == "darwin"
+	}
+	// --rollback-extensions implies --transaction
+	inst.transaction, inst.rollbackExts = opts.Transaction || opts.RollbackExts, opts.RollbackExts
+	if opts.Bench {
+		inst.bench = &benchTimer{start: time.Now()}
+	}
+	if opts.MandatorySettings != "" {
+		abs, err := filepath.Abs(opts.MandatorySettings)
+		if err != nil {
+			return nil, fmt.Errorf("bad --mandatory-settings path: %w", err)
+		}
+		inst.mandatoryFile = abs
+	}
+	layers, err := parseLayerPaths(opts.Layers)
+	if err != nil {
+		return nil, err
+	}
+	inst.layerFiles = layers
+	overrides, err := parseSettingOverrides(opts.Overrides)
+	if err != nil {
+		return nil, err
+	}
+	inst.overrides = overrides
+	indent, err := parseJSONIndent(opts.JSONIndent)
+	if err != nil {
+		return nil, fmt.Errorf("--json-indent: %w", err)
+	}
+	inst.jsonStyle = jsonStyle{Indent: indent, SortKeys: opts.JSONSortKeys}
+	if inst.bindingsMode, err = parseKeybindingsMode(opts.KeybindingsMode); err != nil {
+		return nil, fmt.Errorf("--keybindings-mode: %w", err)
+	}
+	if inst.fromStep, err = parseStep(opts.FromStep); err != nil {
+		return nil, fmt.Errorf("--from-step: %w", err)
+	}
+	if inst.link && (opts.SrcOverride == "" || opts.Merge) {
+		return nil, errors.New("--link needs --src and cannot be combined with --merge")
+	}
+	if opts.InstallEditor != "" {
+		if _, ok := editorVariants[opts.InstallEditor]; !ok {
+			return nil, fmt.Errorf("unknown --install-editor %q (want %s)", opts.InstallEditor, editorNames())
+		}
+		inst.editorInstall = opts.InstallEditor
+	}
+	target := opts.Editor
+	if target == "" {
+		target = opts.InstallEditor
+	}
+	if target == "" {
+		target = "code"
+	}
+	ed, ok := editorVariants[target]
+	if !ok {
+		return nil, fmt.Errorf("unknown --editor %q (want %s)", target, editorNames())
+	}
+	inst.editor = ed
+	inst.watchInterval = opts.WatchInterval
+	if inst.watchInterval <= 0 {
+		inst.watchInterval = 5 * time.Minute
+	}
+	for _, k := range strings.Split(opts.AllowKeys, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			inst.allowKeys = append(inst.allowKeys, k)
+		}
+	}
+
+	if opts.VSIXDir != "" {
+		abs, err := filepath.Abs(opts.VSIXDir)
+		if err != nil {
+			return nil, fmt.Errorf("bad --vsix-dir path: %w", err)
+		}
+		inst.vsixDir = abs
 	}
 
 	// baseDir: exe dir by default, or srcOverride when provided
-	if srcOverride != "" {
-		abs, err := filepath.Abs(srcOverride)
+	if inst.srcOverride != "" {
+		abs, err := filepath.Abs(inst.srcOverride)
 		if err != nil {
 			return nil, fmt.Errorf("bad --src path: %w", err)
 		}
@@ -111,36 +421,94 @@ func NewInstaller(dryRun, assumeYes bool, srcOverride string, skipBackup bool) (
 		}
 		inst.baseDir = filepath.Dir(exe)
 		// decide whether embedded resources are present
-		if len(embeddedSettings) > 0 || len(embeddedKeybindings) > 0 || len(embeddedExtensions) > 0 {
+		if len(embeddedSettings) > 0 || len(embeddedKeybindings) > 0 || len(embeddedExtensions) > 0 || hasEmbeddedDirFiles() {
 			inst.useEmbedded = true
 		} else {
 			inst.useEmbedded = false
 		}
 	}
+	if opts.Payload != "" {
+		if err := inst.usePreset(opts.Payload); err != nil {
+			return nil, err
+		}
+	}
 
+	if opts.Sandbox || opts.SandboxDir != "" {
+		if err := checkSandboxOptions(opts); err != nil {
+			return nil, err
+		}
+		dir, err := enterSandbox(opts.SandboxDir, inst.editor)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create sandbox: %w", err)
+		}
+		inst.sandbox = dir
+	}
 	home, err := os.UserHomeDir()
 	if err != nil {
 		return nil, fmt.Errorf("cannot determine home dir: %w", err)
 	}
 	inst.homeDir = home
+	inst.cache = newVSIXCache(home, inst.resumeDownload)
+	if err := inst.loadLocalConfig(); err != nil {
+		return nil, err
+	}
 
-	// determine vscode user config dir
-	inst.vscodeUser = userVSCodeDir(home)
+	// determine vscode user config dir: the sandbox's, --user-data-dir or
+	// wherever the installed build keeps it (editorpaths.go)
+	switch {
+	case inst.sandbox != "":
+		inst.vscodeUser = filepath.Join(sandboxUserData, "User")
+	case opts.UserDataDir != "":
+		abs, err := filepath.Abs(opts.UserDataDir)
+		if err != nil {
+			return nil, fmt.Errorf("bad --user-data-dir path: %w", err)
+		}
+		inst.userDataDir = abs
+		inst.vscodeUser = filepath.Join(abs, "User")
+	default:
+		inst.vscodeUser = inst.editor.paths(home).UserDir
+	}
 	if inst.vscodeUser == "" {
 		return nil, fmt.Errorf("unsupported OS: %s", runtime.GOOS)
 	}
 
-	// prepare log path in home dir
-	inst.logPath = filepath.Join(inst.homeDir, logFileName)
-	logFile, err := os.OpenFile(inst.logPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
-	if err != nil {
-		return nil, fmt.Errorf("cannot open log file %s: %w", inst.logPath, err)
+	// prepare log path in home dir (machine-scoped with --silent)
+	if err := inst.openLog(); err != nil {
+		return nil, err
+	}
+	if err := inst.configureHTTP(opts.CACert, opts.Debug); err != nil {
+		return nil, err
 	}
-	inst.logger = logFile
 
 	// prepare backup dir under vscode user dir (timestamped) — creation deferred until user confirms
 	ts := time.Now().Format("2006-01-02_15-04-05")
-	inst.backupDir = filepath.Join(inst.vscodeUser, backupPrefix+ts)
+	inst.backupRoot = inst.vscodeUser
+	if opts.BackupDir != "" {
+		abs, err := filepath.Abs(opts.BackupDir)
+		if err != nil {
+			return nil, fmt.Errorf("bad --backup-dir path: %w", err)
+		}
+		inst.backupRoot = abs
+	}
+	inst.backupKeyFile = opts.BackupKeyFile
+	inst.backupDir = filepath.Join(inst.backupRoot, backupPrefix+ts)
+	switch {
+	case opts.EncryptBackup && opts.BackupIncremental:
+		return nil, errors.New("--encrypt-backup cannot be combined with --backup-incremental")
+	case opts.BackupArchive && opts.BackupIncremental:
+		return nil, errors.New("--backup-archive cannot be combined with --backup-incremental")
+	case opts.EncryptBackup:
+		inst.backupFormat = backupFormatEncrypted
+		inst.backupDir += archiveExt() + encryptedSuffix
+	case opts.BackupIncremental:
+		inst.backupFormat = backupFormatIncremental
+		inst.backupDir += incrementalSuffix
+	case opts.BackupArchive:
+		inst.backupFormat = backupFormatArchive
+		inst.backupDir += archiveExt()
+	default:
+		inst.backupFormat = backupFormatDir
+	}
 
 	return inst, nil
 }
@@ -151,14 +519,28 @@ func (i *Installer) Close() {
 	}
 }
 
+// input returns the reader for interactive questions (one per process, so
+// buffered input is never lost between questions)
+func (i *Installer) input() *bufio.Reader {
+	if i.stdin == nil {
+		i.stdin = bufio.NewReader(os.Stdin)
+	}
+	return i.stdin
+}
+
+// logToFile writes a timestamped line to the log file only
+func (i *Installer) logToFile(format string, a ...interface{}) {
+	if i.logger != nil {
+		t := time.Now().Format("2006-01-02 15:04:05")
+		fmt.Fprintln(i.logger, t+" "+fmt.Sprintf(format, a...))
+	}
+}
+
 // log both to stdout (pretty) and to logfile
 func (i *Installer) logf(format string, a ...interface{}) {
 	msg := fmt.Sprintf(format, a...)
 	// write with timestamp to log file
-	if i.logger != nil {
-		t := time.Now().Format("2006-01-02 15:04:05")
-		fmt.Fprintln(i.logger, t+" "+msg)
-	}
+	i.logToFile("%s", msg)
 	// also print compact info via pterm
 	pterm.Info.Println(msg)
 }
@@ -170,16 +552,25 @@ func (i *Installer) warnf(format string, a ...interface{}) {
 		t := time.Now().Format("2006-01-02 15:04:05")
 		fmt.Fprintln(i.logger, t+" WARNING: "+msg)
 	}
+	i.unifiedLog("warning", msg)
+	if i.quiet {
+		fmt.Fprintln(os.Stderr, "WARNING: "+msg)
+	}
 	pterm.Warning.Println(msg)
 }
 
 // error (red)
 func (i *Installer) errorf(format string, a ...interface{}) {
 	msg := fmt.Sprintf(format, a...)
+	i.errorCount.Add(1)
 	if i.logger != nil {
 		t := time.Now().Format("2006-01-02 15:04:05")
 		fmt.Fprintln(i.logger, t+" ERROR: "+msg)
 	}
+	i.unifiedLog("err", msg)
+	if i.silent || i.quiet {
+		fmt.Fprintln(os.Stderr, "ERROR: "+msg)
+	}
 	pterm.Error.Println(msg)
 }
 
@@ -188,23 +579,15 @@ func (i *Installer) errorf(format string, a ...interface{}) {
 // ----------------------------------------------------------------------------
 
 func userVSCodeDir(home string) string {
-	switch runtime.GOOS {
-	case "windows":
-		app := os.Getenv("APPDATA")
-		if app == "" {
-			// fallback
-			return filepath.Join(home, "AppData", "Roaming", "Code", "User")
-		}
-		return filepath.Join(app, "Code", "User")
-	case "darwin":
-		return filepath.Join(home, "Library", "Application Support", "Code", "User")
-	default:
-		return filepath.Join(home, ".config", "Code", "User")
-	}
+	return editorVariants["code"].userDir(home)
 }
 
 // findCodeCLI tries various candidates for the 'code' CLI
 func findCodeCLI() (string, error) {
+	// integration tests run against the fake CLI (fakecode.go)
+	if dir := os.Getenv(fakeCodeEnv); dir != "" {
+		return fakeCodeCLI(dir)
+	}
 	candidates := []string{
 		"code", "code-insiders", "code.cmd", "code.exe", "codium", "codium.exe",
 	}
@@ -221,6 +604,24 @@ func exists(path string) bool {
 	return err == nil
 }
 
+// samePath reports whether a and b name the same file: cleaned, symlinks
+// resolved, and case-insensitively where the file system usually is
+// (Windows, macOS), so "C:/Users/x" from git matches C:\users\x
+func samePath(a, b string) bool {
+	norm := func(p string) string {
+		p = filepath.Clean(filepath.FromSlash(p))
+		if r, err := filepath.EvalSymlinks(p); err == nil {
+			p = r
+		}
+		return p
+	}
+	a, b = norm(a), norm(b)
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
 func copyFile(src, dst string) error {
 	in, err := os.Open(src)
 	if err != nil {
@@ -250,6 +651,12 @@ func writeBytes(dst string, data []byte) error {
 	return os.WriteFile(dst, data, 0o644)
 }
 
+// sameContent reports whether path exists and holds exactly data
+func sameContent(path string, data []byte) bool {
+	cur, err := os.ReadFile(path)
+	return err == nil && bytes.Equal(cur, data)
+}
+
 func readLinesFromString(s string) []string {
 	var res []string
 	sc := bufio.NewScanner(strings.NewReader(s))
@@ -281,29 +688,64 @@ func readLinesFromFile(path string) ([]string, error) {
 	return res, sc.Err()
 }
 
-// list installed extensions via code CLI (with timeout)
-func listInstalledExtensions(codeCLI string) ([]string, error) {
+// list installed extensions via code CLI (inventory cache, see inventory.go)
+func (i *Installer) listInstalledExtensions(codeCLI string) ([]string, error) {
+	installed, err := i.listInstalledExtensionVersions(codeCLI)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]string, 0, len(installed))
+	for _, e := range installed {
+		res = append(res, e.ID)
+	}
+	return res, nil
+}
+
+// installedExtension is one line of `code --list-extensions --show-versions`
+type installedExtension struct {
+	ID      string `json:"id"`
+	Version string `json:"version"`
+}
+
+// list installed extensions together with their versions: from the
+// inventory cache while the extensions folder is unchanged, else via the CLI
+func (i *Installer) listInstalledExtensionVersions(codeCLI string) ([]installedExtension, error) {
+	fp := inventoryFingerprint(codeCLI)
+	if res, ok := cachedInventory(codeCLI, fp); ok {
+		return res, nil
+	}
+	res, err := i.queryInstalledExtensionVersions(codeCLI)
+	if err == nil {
+		storeInventory(codeCLI, fp, res)
+	}
+	return res, err
+}
+
+// queryInstalledExtensionVersions asks the CLI (with timeout)
+func (i *Installer) queryInstalledExtensionVersions(codeCLI string) ([]installedExtension, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), listTimeoutSec*time.Second)
 	defer cancel()
-	cmd := exec.CommandContext(ctx, codeCLI, "--list-extensions")
+	cmd := exec.CommandContext(ctx, codeCLI, i.codeArgs("--list-extensions", "--show-versions")...)
 	out, err := cmd.Output()
 	if err != nil {
 		return nil, err
 	}
-	var res []string
+	var res []installedExtension
 	for _, l := range strings.Split(string(out), "\n") {
-		if t := strings.TrimSpace(l); t != "" {
-			res = append(res, t)
+		t := strings.TrimSpace(l)
+		if t == "" {
+			continue
 		}
+		id, ver, _ := strings.Cut(t, "@")
+		res = append(res, installedExtension{ID: id, Version: ver})
 	}
 	return res, nil
 }
 
 // case-insensitive contains for installed set
 func installedContains(set []string, ext string) bool {
-	le := strings.ToLower(ext)
 	for _, s := range set {
-		if strings.ToLower(s) == le {
+		if strings.EqualFold(s, ext) {
 			return true
 		}
 	}
@@ -320,6 +762,13 @@ func randSleep(minMs, maxMs int) {
 	time.Sleep(time.Duration(ms) * time.Millisecond)
 }
 
+// throttle pauses between installs unless throttling is off (bootstrap)
+func (i *Installer) throttle(minMs, maxMs int) {
+	if !i.noThrottle {
+		randSleep(minMs, maxMs)
+	}
+}
+
 // run a command with combined output and timeout
 func runCommandWithTimeout(timeout time.Duration, name string, args ...string) (string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
@@ -351,7 +800,7 @@ func askYesNoDefaultYes(reader *bufio.Reader, question string, defaultYes bool)
 	return first == "y", nil
 }
 
-func chooseExtensionsInteractive(reader *bufio.Reader, all []string) ([]string, error) {
+func chooseExtensionsInteractive(reader *bufio.Reader, all []extensionSpec) ([]extensionSpec, error) {
 	// simple interactive chooser: show enumerated list and allow:
 	// - "all" or "a" to choose all
 	// - comma-separated numbers like "1,3,5-7"
@@ -366,67 +815,112 @@ func chooseExtensionsInteractive(reader *bufio.Reader, all []string) ([]string,
 	fmt.Println("  none / пусто    — пропустить установку")
 	fmt.Println("  1,3,5-7         — установить перечисленные номера")
 	fmt.Print("Выберите (all/none/числа): ")
+	return readSelection(reader, all)
+}
 
-	txt, err := reader.ReadString('\n')
-	if err != nil {
-		return nil, err
-	}
-	txt = strings.TrimSpace(txt)
-	if txt == "" || strings.EqualFold(txt, "none") {
-		return []string{}, nil
-	}
-	if strings.EqualFold(txt, "all") || strings.EqualFold(txt, "a") {
-		return all, nil
-	}
-
-	// parse selection
-	parts := strings.Split(txt, ",")
-	var sel []string
-	for _, p := range parts {
-		p = strings.TrimSpace(p)
-		if p == "" {
-			continue
+// readSelection reads an "all / none / 1,3,5-7" answer and returns the
+// chosen entries; an answer with invalid parts is explained and asked again
+// instead of going on with what could be understood
+func readSelection(reader *bufio.Reader, all []extensionSpec) ([]extensionSpec, error) {
+	for {
+		txt, err := reader.ReadString('\n')
+		if err != nil && (err != io.EOF || strings.TrimSpace(txt) == "") {
+			return nil, err
 		}
-		if strings.Contains(p, "-") {
-			rng := strings.SplitN(p, "-", 2)
-			if len(rng) != 2 {
-				continue
-			}
-			start := parseIntOrZero(rng[0]) - 1
-			end := parseIntOrZero(rng[1]) - 1
-			if start < 0 || end < 0 || start >= len(all) || end >= len(all) || end < start {
-				continue
-			}
-			for k := start; k <= end; k++ {
+		txt = strings.TrimSpace(txt)
+		if txt == "" || strings.EqualFold(txt, "none") {
+			fmt.Println("Ничего не выбрано.")
+			return []extensionSpec{}, nil
+		}
+		if strings.EqualFold(txt, "all") || strings.EqualFold(txt, "a") {
+			fmt.Printf("Выбраны все (%d).\n", len(all))
+			return all, nil
+		}
+		idx, perr := parseSelection(txt, len(all))
+		if perr == nil {
+			sel := make([]extensionSpec, 0, len(idx))
+			names := make([]string, 0, len(idx))
+			for _, k := range idx {
 				sel = append(sel, all[k])
+				names = append(names, fmt.Sprintf("%d) %s", k+1, all[k]))
 			}
-		} else {
-			idx := parseIntOrZero(p) - 1
-			if idx >= 0 && idx < len(all) {
-				sel = append(sel, all[idx])
-			}
+			fmt.Printf("Выбрано %d: %s\n", len(sel), strings.Join(names, ", "))
+			return sel, nil
 		}
-	}
-	// dedupe
-	m := make(map[string]struct{})
-	var out []string
-	for _, s := range sel {
-		if _, ok := m[s]; !ok {
-			m[s] = struct{}{}
-			out = append(out, s)
+		fmt.Println("Не удалось разобрать выбор:")
+		for _, e := range perr.(interface{ Unwrap() []error }).Unwrap() {
+			fmt.Println("  -", e)
+		}
+		if err == io.EOF {
+			return nil, perr
 		}
+		fmt.Printf("Введите all, none или номера от 1 до %d (например 1,3,5-7): ", len(all))
 	}
-	return out, nil
 }
 
-func parseIntOrZero(s string) int {
-	s = strings.TrimSpace(s)
-	if s == "" {
-		return 0
+// selectionError is one part of a "1,3,5-7" answer that is not a valid
+// number or range
+type selectionError struct {
+	Part   string
+	Reason string
+}
+
+func (e *selectionError) Error() string {
+	return fmt.Sprintf("%q: %s", e.Part, e.Reason)
+}
+
+// parseSelection parses comma-separated numbers and ranges (1-based) into
+// indexes of a list of n entries, in input order without duplicates. Every
+// invalid part is reported (errors.Join of *selectionError).
+func parseSelection(txt string, n int) ([]int, error) {
+	var (
+		res  []int
+		errs []error
+		seen = make(map[int]bool)
+	)
+	number := func(part, s string) (int, bool) {
+		v, err := strconv.Atoi(strings.TrimSpace(s))
+		switch {
+		case err != nil:
+			errs = append(errs, &selectionError{part, "not a number"})
+		case v < 1 || v > n:
+			errs = append(errs, &selectionError{part, fmt.Sprintf("%d is out of range 1-%d", v, n)})
+		default:
+			return v - 1, true
+		}
+		return 0, false
+	}
+	for _, part := range strings.Split(txt, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		from, to, isRange := strings.Cut(part, "-")
+		start, ok := number(part, from)
+		end := start
+		if isRange {
+			var okEnd bool
+			end, okEnd = number(part, to)
+			ok = ok && okEnd
+		}
+		if !ok {
+			continue
+		}
+		if end < start {
+			errs = append(errs, &selectionError{part, "range end is before its start"})
+			continue
+		}
+		for k := start; k <= end; k++ {
+			if !seen[k] {
+				seen[k] = true
+				res = append(res, k)
+			}
+		}
+	}
+	if len(errs) == 0 && len(res) == 0 {
+		errs = append(errs, &selectionError{txt, "no numbers given"})
 	}
-	var v int
-	fmt.Sscanf(s, "%d", &v)
-	return v
+	return res, errors.Join(errs...)
 }
 
 // ----------------------------------------------------------------------------
@@ -434,16 +928,66 @@ func parseIntOrZero(s string) int {
 // ----------------------------------------------------------------------------
 
 func (i *Installer) preparePayloads() error {
+	if err := i.loadManifest(); err != nil {
+		return err
+	}
+	if err := i.loadLayers(); err != nil {
+		return err
+	}
+	if err := i.loadMandatorySettings(i.mandatoryFile); err != nil {
+		return err
+	}
+	if err := i.loadRemoveList(); err != nil {
+		return err
+	}
+	if err := i.loadMigrations(); err != nil {
+		return err
+	}
+	if i.mirrorURL == "" {
+		i.mirrorURL = i.manifest.MarketplaceURL
+	}
+	if i.jsonStyle.Indent == "" {
+		indent, err := parseJSONIndent(i.manifest.JSONIndent)
+		if err != nil {
+			return fmt.Errorf("%s: %w", manifestFile, err)
+		}
+		i.jsonStyle.Indent = indent
+	}
+	i.jsonStyle.SortKeys = i.jsonStyle.SortKeys || i.manifest.SortKeys
+	if i.bindingsMode == "" {
+		mode, err := parseKeybindingsMode(i.manifest.KeybindingsMode)
+		if err != nil {
+			return fmt.Errorf("%s: %w", manifestFile, err)
+		}
+		i.bindingsMode = mode
+	}
+	if i.mirrorURL != "" {
+		i.useMirror(i.mirrorURL)
+	}
 	// if useEmbedded, load embedded variables; otherwise read files from baseDir
 	if i.useEmbedded {
 		i.settingsData = embeddedSettings
 		i.keybindData = embeddedKeybindings
-		i.extList = readLinesFromString(string(embeddedExtensions))
+		i.blocklist = readLinesFromString(string(embeddedBlocklist))
+		specs, err := parseExtensionList(readLinesFromString(string(embeddedExtensions)))
+		i.extList = specs
+		if err != nil {
+			return err
+		}
 	} else {
 		// load files from baseDir
 		settingsPath := filepath.Join(i.baseDir, settingsFile)
 		keybindPath := filepath.Join(i.baseDir, keybindingsFile)
 		extPath := filepath.Join(i.baseDir, extensionsFile)
+		blockPath := filepath.Join(i.baseDir, blocklistFile)
+
+		if exists(blockPath) {
+			lines, err := readLinesFromFile(blockPath)
+			if err != nil {
+				return fmt.Errorf("cannot read %s: %w", blockPath, err)
+			}
+			i.blocklist = lines
+		}
 
 		if exists(settingsPath) {
 			b, err := os.ReadFile(settingsPath)
@@ -466,15 +1010,54 @@ func (i *Installer) preparePayloads() error {
 			if err != nil {
 				return fmt.Errorf("cannot read %s: %w", extPath, err)
 			}
-			i.extList = lines
+			specs, err := parseExtensionList(lines)
+			i.extList = specs
+			if err != nil {
+				return fmt.Errorf("%s: %w", extPath, err)
+			}
 		}
 	}
+	if err := i.mergeSettingsFragments(); err != nil {
+		return err
+	}
+	if err := i.applyLayers(); err != nil {
+		return err
+	}
+	if err := i.applyKeymap(); err != nil {
+		return err
+	}
+	if err := i.translateMacKeys(); err != nil {
+		return err
+	}
+	if err := i.applyConditionalSettings(); err != nil {
+		return err
+	}
+	if err := i.applyTrustSettings(); err != nil {
+		return err
+	}
+	if err := i.applySettingOverrides(); err != nil {
+		return err
+	}
+	if err := i.resolveSecrets(); err != nil {
+		return err
+	}
+	if err := i.applyProtectedKeys(); err != nil {
+		return err
+	}
+	i.settingsData = i.formatSettings(i.settingsData)
+	if i.link {
+		return i.checkLinkable()
+	}
 	return nil
 }
 
 func (i *Installer) ensureCodeCLI() error {
+	// already resolved (e.g. by --install-editor)
+	if i.codeCLIPath != "" {
+		return nil
+	}
 	// try to find code CLI
-	c, err := findCodeCLI()
+	c, err := i.findEditorCLI()
 	if err != nil {
 		return err
 	}
@@ -482,69 +1065,52 @@ func (i *Installer) ensureCodeCLI() error {
 	return nil
 }
 
-// makeBackup creates backup dir and copies existing settings/keybindings
-// Respects dry-run and skipBackup flags.
-func (i *Installer) makeBackup() error {
-	if i.skipBackup {
-		i.logf("Backup skipped by user (--no-backup).")
-		return nil
-	}
-	if i.dryRun {
-		i.logf("DRY-RUN: would create backup dir %s and copy existing files", i.backupDir)
-		return nil
-	}
-	// create backup dir
-	if err := os.MkdirAll(i.backupDir, 0o755); err != nil {
-		return err
-	}
-	// copy existing settings and keybindings if present
-	for _, nm := range []string{settingsFile, keybindingsFile} {
-		src := filepath.Join(i.vscodeUser, nm)
-		if exists(src) {
-			dst := filepath.Join(i.backupDir, nm)
-			if err := copyFile(src, dst); err != nil {
-				i.warnf("cannot backup %s: %v", nm, err)
-			} else {
-				i.logf("backup: %s -> %s", src, dst)
-			}
-		} else {
-			i.logf("no existing %s to backup", nm)
+func (i *Installer) applySettings() error {
+	if i.link {
+		if err := i.linkPayloadFile(settingsFile); err != nil {
+			return err
 		}
+		// snippets belong to no question of their own; they go with the settings
+		return i.linkPayloadFile(snippetsDir)
 	}
-	return nil
+	return i.applyPayloadFile(settingsFile, i.settingsData)
 }
 
-func (i *Installer) applySettings() error {
-	if len(i.settingsData) == 0 {
-		i.warnf("settings.json payload is empty — пропускаю")
-		return nil
+func (i *Installer) applyKeybindings() error {
+	if i.link {
+		return i.linkPayloadFile(keybindingsFile)
 	}
-	dst := filepath.Join(i.vscodeUser, settingsFile)
-	if i.dryRun {
-		i.logf("DRY-RUN: would write %s (%d bytes)", dst, len(i.settingsData))
+	return i.applyPayloadFile(keybindingsFile, i.keybindData)
+}
+
+// applyPayloadFile writes one payload file (merged with the user's edits
+// under --merge) into the user dir unless it is already identical
+func (i *Installer) applyPayloadFile(name string, payload []byte) error {
+	if len(payload) == 0 {
+		i.warnf("%s payload is empty — пропускаю", name)
 		return nil
 	}
-	if err := writeBytes(dst, i.settingsData); err != nil {
-		return fmt.Errorf("cannot write settings.json: %w", err)
+	dst := filepath.Join(i.vscodeUser, name)
+	data := i.desiredContent(name, payload, true)
+	if name == settingsFile {
+		data = i.enforcedSettings(data)
 	}
-	i.logf("Applied settings.json -> %s", dst)
-	return nil
-}
-
-func (i *Installer) applyKeybindings() error {
-	if len(i.keybindData) == 0 {
-		i.warnf("keybindings.json payload is empty — пропускаю")
+	if sameContent(dst, data) {
+		i.logf("%s already up to date", name)
+		i.report.UpToDate = append(i.report.UpToDate, name)
+		i.rememberApplied(name, payload)
 		return nil
 	}
-	dst := filepath.Join(i.vscodeUser, keybindingsFile)
 	if i.dryRun {
-		i.logf("DRY-RUN: would write %s (%d bytes)", dst, len(i.keybindData))
+		i.simulateWrite(name, dst, data)
 		return nil
 	}
-	if err := writeBytes(dst, i.keybindData); err != nil {
-		return fmt.Errorf("cannot write keybindings.json: %w", err)
+	if err := i.safeWrite(dst, data); err != nil {
+		return fmt.Errorf("cannot write %s: %w", name, err)
 	}
-	i.logf("Applied keybindings.json -> %s", dst)
+	i.rememberApplied(name, payload)
+	i.report.Written = append(i.report.Written, name)
+	i.logf("Applied %s -> %s", name, dst)
 	return nil
 }
 
@@ -560,7 +1126,7 @@ func (i *Installer) installExtensionsInteractive(reader *bufio.Reader) error {
 		return i.installExtensions(i.extList)
 	}
 	// ask user
-	apply, err := askYesNoDefaultYes(reader, fmt.Sprintf("Установить %d расширений?", len(i.extList)), true)
+	apply, err := i.askForAll("extensions.install", fmt.Sprintf("Установить %d расширений?", len(i.extList)), true, i.remaining)
 	if err != nil {
 		return err
 	}
@@ -569,12 +1135,17 @@ func (i *Installer) installExtensionsInteractive(reader *bufio.Reader) error {
 		return nil
 	}
 
+	// show download sizes so metered users can deselect heavy ones
+	if !i.noEstimate {
+		i.printEstimate(i.extList)
+	}
+
 	// choose all or subset
 	choice, err := askYesNoDefaultYes(reader, "Установить все расширения (yes) или выбрать подмножество (no)?", true)
 	if err != nil {
 		return err
 	}
-	var toInstall []string
+	var toInstall []extensionSpec
 	if choice {
 		toInstall = i.extList
 	} else {
@@ -592,66 +1163,107 @@ func (i *Installer) installExtensionsInteractive(reader *bufio.Reader) error {
 	return i.installExtensions(toInstall)
 }
 
-// installExtensions installs the provided extension IDs with retries/timeouts
-func (i *Installer) installExtensions(toInstall []string) error {
+// installExtensions installs the provided extensions with retries/timeouts
+func (i *Installer) installExtensions(toInstall []extensionSpec) error {
 	// need code CLI
 	if err := i.ensureCodeCLI(); err != nil {
 		return fmt.Errorf("code CLI not found: %w", err)
 	}
 
-	// get installed list once
-	installed, err := listInstalledExtensions(i.codeCLIPath)
+	// get installed list once; installs below keep the store current
+	installed, err := i.installedExtensions()
 	if err != nil {
 		i.warnf("cannot list installed extensions: %v — continuing without dedupe", err)
 	}
+	if i.txn != nil {
+		i.txn.installed = installed
+	}
 
-	total := len(toInstall)
-	pbar, _ := pterm.DefaultProgressbar.WithTotal(total).WithTitle("Installing extensions").Start()
-	for idx, ext := range toInstall {
-		pbar.UpdateTitle(fmt.Sprintf("[%d/%d] %s", idx+1, total, ext))
-		// skip if already installed
-		if installed != nil && installedContains(installed, ext) {
+	// skip if already installed (at the pinned version, when pinned)
+	var pending []extensionSpec
+	for _, ext := range toInstall {
+		if i.installed.satisfies(ext) {
 			i.logf("Already installed, skipping: %s", ext)
-			pbar.Increment()
+			i.report.Skipped = append(i.report.Skipped, ext.ID)
 			continue
 		}
-		// attempt install with retries
-		success := false
-		var lastOut string
-		for attempt := 1; attempt <= retries; attempt++ {
-			if i.dryRun {
-				i.logf("DRY-RUN: would run: %s --install-extension %s", i.codeCLIPath, ext)
-				success = true
-				break
-			}
-			i.logf("Installing %s (attempt %d/%d)", ext, attempt, retries)
-			out, err := runCommandWithTimeout(time.Second*installTimeoutSec, i.codeCLIPath, "--install-extension", ext, "--force")
-			lastOut = out
-			if err == nil {
-				i.logf("Installed: %s", ext)
-				success = true
-				// update installed slice to contain ext
-				installed = append(installed, ext)
-				break
+		pending = append(pending, ext)
+	}
+
+	endFetch := i.subPhase("mirror downloads")
+	i.prefetchMirror(pending)
+	endFetch()
+	total := len(toInstall)
+	pbar := pterm.DefaultProgressbar.WithTitle("Installing extensions")
+	if !i.silent && !i.quiet {
+		// silent and quiet runs keep the bar inactive with Total 0, which
+		// turns its updates into no-ops (it drives the cursor even with
+		// output disabled)
+		pbar, _ = pbar.WithTotal(total).Start()
+	}
+	pbar.Add(total - len(pending))
+	if i.batchSize > 1 {
+		i.installBatched(pending, pbar)
+	} else {
+		for idx, ext := range pending {
+			pbar.UpdateTitle(fmt.Sprintf("[%d/%d] %s", total-len(pending)+idx+1, total, ext))
+			if err := i.installOne(ext); err != nil {
+				i.errorf("%v", err)
+				if i.strict {
+					break
+				}
 			}
-			// detect timeout
-			if errors.Is(err, context.DeadlineExceeded) {
-				i.warnf("Timeout installing %s (attempt %d)", ext, attempt)
-			} else {
-				i.warnf("Error installing %s: %v", ext, err)
+			pbar.Increment()
+			// random pause to avoid Hammering Marketplace
+			i.throttle(minSleepMs, maxSleepMs)
+		}
+	}
+	if pbar.IsActive {
+		pbar.Stop()
+	}
+	return nil
+}
+
+// installOne installs a single extension with retries, timeout and backoff.
+// It always passes --force so an already installed extension is updated in place
+// (or moved to the pinned version); pinned versions are verified afterwards.
+func (i *Installer) installOne(ext extensionSpec) error {
+	var lastOut string
+	attempts := ext.attempts()
+	defer i.subPhase(ext.String())()
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if i.dryRun {
+			i.logf("DRY-RUN: would run: %s --install-extension %s", i.codeCLIPath, i.installSource(ext))
+			i.report.Installed = append(i.report.Installed, ext.ID)
+			return nil
+		}
+		src := i.installSource(ext)
+		i.logf("Installing %s (attempt %d/%d)", src, attempt, attempts)
+		out, err := runCommandWithTimeout(ext.installTimeout(), i.codeCLIPath, i.codeArgs("--install-extension", src, "--force")...)
+		lastOut = out
+		if err == nil {
+			if verr := i.verifyInstalledVersion(ext); verr != nil {
+				// the CLI succeeded but gave us something else — retrying won't help
+				i.report.Failed = append(i.report.Failed, ext.ID)
+				return verr
 			}
-			// small backoff before retry
-			randSleep(1200, 2200)
+			i.logf("Installed: %s", ext)
+			i.report.Installed = append(i.report.Installed, ext.ID)
+			i.installed.add(ext.ID, ext.Version)
+			i.journalInstall(ext)
+			return nil
 		}
-		if !success {
-			i.errorf("Failed to install %s after %d attempts. Last output:\n%s", ext, retries, lastOut)
+		// detect timeout
+		if errors.Is(err, context.DeadlineExceeded) {
+			i.warnf("Timeout installing %s (attempt %d)", ext, attempt)
+		} else {
+			i.warnf("Error installing %s: %v", ext, err)
 		}
-		pbar.Increment()
-		// random pause to avoid Hammering Marketplace
-		randSleep(minSleepMs, maxSleepMs)
+		// small backoff before retry
+		i.throttle(1200, 2200)
 	}
-	pbar.Stop()
-	return nil
+	i.report.Failed = append(i.report.Failed, ext.ID)
+	return fmt.Errorf("failed to install %s after %d attempts. Last output:\n%s", ext, attempts, lastOut)
 }
 
 // ----------------------------------------------------------------------------
@@ -661,133 +1273,423 @@ func (i *Installer) installExtensions(toInstall []string) error {
 func main() {
 	rand.Seed(time.Now().UnixNano())
 
+	// MDM policies run as root: the config is the console user's
+	if code, handled := runAsConsoleUser(); handled {
+		os.Exit(code)
+	}
+
+	// a payload appended by `pack` replaces the embedded one
+	if err := loadAppendedPayload(); err != nil {
+		pterm.Warning.Println("Ignoring appended payload:", err)
+	}
+
+	// subcommands take over the whole command line
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		if err := runSubcommand(os.Args[1], os.Args[2:]); err != nil {
+			var exit exitCodeError
+			if errors.As(err, &exit) {
+				os.Exit(exit.code)
+			}
+			pterm.Error.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// CLI flags
-	var (
-		flagYes     = flag.Bool("yes", false, "Assume 'yes' for all questions (non-interactive)")
-		flagDry     = flag.Bool("dry-run", false, "Dry run - show actions but don't write files or install extensions")
-		flagSrc     = flag.String("src", "", "Use external folder with settings.json/keybindings.json/extensions.txt instead of embedded payloads")
-		flagNoBackup = flag.Bool("no-backup", false, "Don't create backup of existing user settings (skip backup)")
-		flagHelp    = flag.Bool("help", false, "Show help")
-	)
+	var opts Options
+	opts.bind(flag.CommandLine)
+	flagHelp := flag.Bool("help", false, "Show help")
+	flag.Usage = usage
 	flag.Parse()
 	if *flagHelp {
 		flag.Usage()
 		return
 	}
+	if code := apply(opts); code != exitOK {
+		os.Exit(code)
+	}
+}
 
-	// pretty header
-	pterm.DefaultBigText.WithLetters(pterm.NewLettersFromString("HYPR • VS CODE")).Render()
-	fmt.Println()
-	pterm.DefaultSection.Println("VS Code Custom Installer — interactive, cross-platform")
-	fmt.Println()
+// enforceSettings removes the obsolete settings and enforces the mandatory
+// ones; every apply runs it, also one that has nothing else to do
+func (i *Installer) enforceSettings() {
+	end := i.phase("removed / mandatory settings")
+	defer end()
+	if err := i.applyRemovedSettings(); err != nil {
+		i.errorf("Failed to remove settings: %v", err)
+		i.fail(exitConfig)
+	}
+	if err := i.applyMandatorySettings(); err != nil {
+		i.errorf("Failed to enforce mandatory settings: %v", err)
+		i.fail(exitConfig)
+	}
+	if err := i.applyTrustedFolders(); err != nil {
+		i.warnf("%v", err)
+	}
+}
+
+// apply is the classic interactive apply flow (also the `apply` subcommand)
+func apply(opts Options) int {
+	// several editors: the flow below runs once per editor
+	if names, err := editorMatrix(opts.Editor); err != nil || names != nil {
+		return applyMatrix(opts, names, err)
+	}
+	var ansibleOut *os.File
+	if opts.Ansible {
+		opts.Silent = true
+		ansibleOut = startAnsible()
+	}
+	if opts.Silent || opts.Quiet {
+		pterm.DisableOutput()
+	} else if !opts.NoHeader {
+		// pretty header
+		pterm.DefaultBigText.WithLetters(pterm.NewLettersFromString("HYPR • VS CODE")).Render()
+		fmt.Println()
+		pterm.DefaultSection.Println("VS Code Custom Installer — interactive, cross-platform")
+		fmt.Println()
+	}
 
-	installer, err := NewInstaller(*flagDry, *flagYes, *flagSrc, *flagNoBackup)
+	installer, err := NewInstaller(opts)
 	if err != nil {
+		if ansibleOut != nil {
+			writeAnsible(ansibleOut, ansibleResult{Failed: true, RC: exitFailure, Msg: "cannot initialize installer: " + err.Error()})
+			return exitFailure
+		}
+		if opts.Silent || opts.Quiet {
+			fmt.Fprintln(os.Stderr, "ERROR: cannot initialize installer:", err)
+			return exitFailure
+		}
 		pterm.Fatal.Println("Cannot initialize installer:", err)
-		return
+		return exitFailure
 	}
 	defer installer.Close()
+	defer func() {
+		installer.writeReport(opts.Report)
+		installer.postReport(opts.ReportURL, opts.ReportTokenFile)
+		if ansibleOut != nil {
+			writeAnsible(ansibleOut, installer.ansibleResult())
+		}
+	}()
+
+	endDetect := installer.phase("detection & payload")
+	if err := installer.choosePreset(installer.input()); err != nil {
+		installer.errorf("Cannot choose payload preset: %v", err)
+	}
+	if err := installer.chooseKeymap(installer.input()); err != nil {
+		installer.errorf("Cannot choose keymap: %v", err)
+	}
+
+	// a broken payload file would be written verbatim — refuse the whole run
+	if err := installer.validatePayload(); err != nil {
+		installer.errorf("%v", err)
+		installer.errorf("Payload rejected — nothing was applied.")
+		installer.fail(exitPayload)
+		endDetect()
+		return installer.exitCode()
+	}
 
 	// prepare payloads (embedded or external)
 	if err := installer.preparePayloads(); err != nil {
 		installer.errorf("Failed to prepare payloads: %v", err)
+		installer.fail(exitPayload)
+		// --link would link the source files anyway: nothing more is done
+		if installer.link {
+			return installer.failureStatus()
+		}
 		// continue, because maybe user only wants to install extensions (which may be present)
 	}
+	if code, stop := installer.strictAbort(); stop {
+		return code
+	}
+	installer.warnDeprecated()
+	if err := installer.loadVSIXDir(); err != nil {
+		installer.errorf("%v", err)
+	}
+	installer.applyBlocklist()
+	endDetect()
 
 	// banner
-	installer.logf("Target VS Code user config: %s", installer.vscodeUser)
+	installer.logf("Target %s user config: %s", installer.editor.Title, installer.vscodeUser)
 	installer.logf("Backup dir will be: %s", installer.backupDir)
 	installer.logf("Log file: %s", installer.logPath)
+	if installer.sandbox != "" {
+		installer.logf("Sandbox: %s (the real profile is not touched)", installer.sandbox)
+	}
+	if installer.preset != "" {
+		installer.logf("Payload preset: %s", installer.preset)
+	}
+	if opts.Scan != "" {
+		if err := installer.scanProjects(opts.Scan, installer.input()); err != nil {
+			installer.errorf("Project scan failed: %v", err)
+			installer.fail(exitConfig)
+		}
+		return installer.exitCode()
+	}
+	if opts.WorkspaceSettings != "" {
+		if err := installer.applyWorkspaceSettings(opts.WorkspaceSettings); err != nil {
+			installer.errorf("Workspace settings not applied: %v", err)
+			installer.fail(exitConfig)
+		}
+		return installer.exitCode()
+	}
+	if opts.Theia != "" {
+		if err := installer.applyTheia(opts.Theia); err != nil {
+			installer.errorf("Theia workspace not written: %v", err)
+			installer.fail(exitConfig)
+		}
+		return installer.exitCode()
+	}
+	if backends := selectedBackends(opts); len(backends) > 0 {
+		if installer.applyBackends(backends) {
+			installer.fail(exitConfig)
+		}
+		return installer.exitCode()
+	}
+	if opts.AllUsers {
+		if err := installer.applyAllUsers(); err != nil {
+			installer.errorf("All-users apply failed: %v", err)
+			installer.fail(exitConfig)
+		}
+		return installer.exitCode()
+	}
+	if opts.Remote != "" {
+		if err := installer.applyRemote(opts.Remote); err != nil {
+			installer.errorf("Remote apply failed: %v", err)
+			installer.fail(exitConfig)
+		}
+		return installer.exitCode()
+	}
+	if installer.reportPayloadState() && !installer.force {
+		// an unchanged payload still gets its removals and mandatory settings
+		installer.enforceSettings()
+		pterm.Success.Println("Nothing to do — run with --force to apply anyway.")
+		if opts.Watch {
+			installer.watch()
+		}
+		return installer.exitCode()
+	}
+
+	if err := installer.beginTransaction(); err != nil {
+		installer.errorf("Cannot start transaction: %v", err)
+		installer.fail(exitFailure)
+		return installer.exitCode()
+	}
+	installer.beginCheckpoint()
 
 	// interactive flow
-	reader := bufio.NewReader(os.Stdin)
+	reader := installer.input()
+
+	if installer.editorInstall != "" {
+		end := installer.phase("editor install")
+		if err := installer.installEditor(installer.editorInstall); err != nil {
+			installer.errorf("Editor installation failed: %v", err)
+		}
+		end()
+	}
+	if code, stop := installer.strictAbort(); stop {
+		return code
+	}
 
 	// ensure code CLI presence (we will only error out when needed)
+	end := installer.phase("editor CLI")
 	_ = installer.ensureCodeCLI() // not fatal yet
+	end()
+
+	installer.gitCommit("hypreditors: snapshot before apply " + time.Now().Format(time.RFC3339))
 
 	// Ask whether to create backup (new behavior)
 	doBackup := false
-	if installer.assumeYes && !installer.skipBackup {
+	backupDone := installer.skipStep(stepBackup)
+	if installer.assumeYes && !installer.skipBackup && !backupDone {
 		// auto backup by default when --yes and not explicitly skipped
 		doBackup = true
-	} else if installer.skipBackup {
+	} else if installer.skipBackup || backupDone {
 		doBackup = false
 	} else {
-		ask, _ := askYesNoDefaultYes(reader, "Создать бэкап текущих настроек перед изменением?", true)
+		ask, _ := installer.askForAll("backup", "Создать бэкап текущих настроек перед изменением?", true, installer.remaining)
 		doBackup = ask
 	}
 
-	if doBackup {
-		installer.logf("Backup: creating backup directory and saving existing settings.")
-		if !installer.dryRun {
-			if err := os.MkdirAll(installer.backupDir, 0o755); err != nil {
-				installer.errorf("Cannot create backup dir: %v", err)
-			}
-		}
+	if backupDone {
+		installer.logf("Skipped backup (step already done)")
+	} else if doBackup && installer.payloadUnchanged() {
+		installer.logf("Config already matches the payload — no backup needed.")
+		installer.stepDone(stepBackup, installer.markStep())
+	} else if doBackup {
+		installer.logf("Backup: saving existing settings to %s", installer.backupDir)
+		m := installer.markStep()
+		end := installer.phase("backup")
 		if err := installer.makeBackup(); err != nil {
-			installer.warnf("Backup step failed: %v", err)
+			if installer.strict {
+				installer.errorf("Backup step failed: %v", err)
+				installer.fail(exitConfig)
+			} else {
+				installer.warnf("Backup step failed: %v", err)
+			}
+		} else {
+			installer.stepDone(stepBackup, m)
 		}
+		end()
 	} else {
 		installer.logf("User chose to skip backup.")
 	}
+	if code, stop := installer.strictAbort(); stop {
+		return code
+	}
 
-	// Ask 3 questions (settings, keybinds, extensions)
-	applySettings := false
-	applyKeybinds := false
-	installExts := false
+	// the user's settings are migrated to the payload's keys before anything is merged
+	end = installer.phase("migrations")
+	if err := installer.applyMigrations(); err != nil {
+		installer.errorf("Failed to migrate settings: %v", err)
+		installer.fail(exitConfig)
+	}
+	end()
+	if code, stop := installer.strictAbort(); stop {
+		return code
+	}
 
-	if installer.assumeYes {
-		applySettings = true
-		applyKeybinds = true
-		installExts = true
-	} else {
-		ok, _ := askYesNoDefaultYes(reader, "Применить settings.json?", true)
-		applySettings = ok
-		ok2, _ := askYesNoDefaultYes(reader, "Применить keybindings.json?", true)
-		applyKeybinds = ok2
-		ok3, _ := askYesNoDefaultYes(reader, "Установить расширения из списка?", true)
-		installExts = ok3
+	// Ask 3 questions (settings, keybinds, extensions); steps already done
+	// (checkpoint, --from-step) are not asked again
+	applySettings := !installer.skipStep(stepSettings)
+	applyKeybinds := !installer.skipStep(stepKeybindings)
+	installExts := !installer.skipStep(stepExtensions)
+
+	if !installer.assumeYes {
+		if applySettings {
+			applySettings, _ = installer.askForAll("settings", "Применить settings.json?", true, installer.remaining)
+		}
+		if applyKeybinds {
+			applyKeybinds, _ = installer.askForAll("keybindings", "Применить keybindings.json?", true, installer.remaining)
+		}
+		if installExts {
+			installExts, _ = installer.askForAll("extensions", "Установить расширения из списка?", true, installer.remaining)
+		}
 	}
 
 	// apply settings
 	if applySettings {
+		m := installer.markStep()
+		end := installer.phase("settings")
 		if err := installer.applySettings(); err != nil {
 			installer.errorf("Failed to apply settings: %v", err)
+			installer.fail(exitConfig)
 		}
+		end()
+		installer.stepDone(stepSettings, m)
 	} else {
 		installer.logf("Skipped applying settings.json")
 	}
+	if code, stop := installer.strictAbort(); stop {
+		return code
+	}
 
 	// apply keybindings
 	if applyKeybinds {
+		m := installer.markStep()
+		end := installer.phase("keybindings")
 		if err := installer.applyKeybindings(); err != nil {
 			installer.errorf("Failed to apply keybindings: %v", err)
+			installer.fail(exitConfig)
 		}
+		if err := installer.applyProfileKeybindings(); err != nil {
+			installer.errorf("Failed to apply profile keybindings: %v", err)
+			installer.fail(exitConfig)
+		}
+		installer.writeCheatSheet()
+		end()
+		installer.stepDone(stepKeybindings, m)
 	} else {
 		installer.logf("Skipped applying keybindings.json")
 	}
+	if code, stop := installer.strictAbort(); stop {
+		return code
+	}
+
+	// obsolete settings are removed and mandatory ones enforced whatever was chosen above
+	installer.enforceSettings()
+	if code, stop := installer.strictAbort(); stop {
+		return code
+	}
 
 	// install extensions
 	if installExts {
+		m := installer.markStep()
+		end := installer.phase("extensions")
+		if err := installer.configureCodiumGallery(); err != nil {
+			installer.warnf("Cannot configure VSCodium gallery: %v", err)
+		}
 		// if payload extList empty but external src provided with no extensions file, warn
 		if len(installer.extList) == 0 {
 			installer.warnf("No extensions found in payload (embedded or src). Nothing to install.")
 		} else {
+			var err error
 			if installer.assumeYes {
-				installer.installExtensions(installer.extList)
+				err = installer.installExtensions(installer.extList)
 			} else {
-				if err := installer.installExtensionsInteractive(reader); err != nil {
-					installer.errorf("Extensions installation failed: %v", err)
+				err = installer.installExtensionsInteractive(reader)
+			}
+			if err != nil {
+				installer.errorf("Extensions installation failed: %v", err)
+				if installer.codeCLIPath == "" {
+					installer.fail(exitNoEditor)
+				} else {
+					installer.fail(exitExtensions)
 				}
 			}
 		}
+		end()
+		installer.stepDone(stepExtensions, m)
 	} else {
 		installer.logf("Skipped installing extensions")
 	}
+	if code, stop := installer.strictAbort(); stop {
+		return code
+	}
+
+	// blocked extensions are removed even when installation was skipped
+	if len(installer.blocklist) > 0 {
+		end := installer.phase("blocklist")
+		if err := installer.enforceBlocklist(); err != nil {
+			installer.errorf("Blocklist enforcement failed: %v", err)
+			installer.fail(exitExtensions)
+		}
+		end()
+	}
+	if code, stop := installer.strictAbort(); stop {
+		return code
+	}
+	// a failed transaction is undone before the run is recorded
+	if installer.endTransaction() {
+		return installer.exitCode()
+	}
+
+	// bindings to commands nothing provides are only reported
+	if applyKeybinds {
+		end := installer.phase("keybinding commands check")
+		installer.checkKeybindingCommands()
+		end()
+	}
 
 	// finish
+	end = installer.phase("git / state")
+	installer.gitCommit(installer.gitApplyMessage())
+	if err := installer.recordRun(); err != nil {
+		installer.warnf("cannot record run in state file: %v", err)
+	}
+	installer.endCheckpoint()
+	end()
+	installer.printSummary()
+	installer.printBench()
 	pterm.Success.Println("All done — installer finished.")
 	installer.logf("Finished at %s", time.Now().Format(time.RFC3339))
-	installer.logf("Backup dir: %s", installer.backupDir)
+	if exists(installer.backupDir) {
+		installer.logf("Backup dir: %s", installer.backupDir)
+	}
 	installer.logf("Log file: %s", installer.logPath)
+
+	if opts.Watch {
+		installer.watch()
+	}
+	return installer.exitCode()
 }
@@ -0,0 +1,83 @@
+// manifest.go
+//
+// Payload manifest (manifest.json next to settings.json, embedded or from
+// --src). It carries payload-wide options that don't belong into the editor
+// files themselves. Every field is optional; command-line flags win over the
+// manifest.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const manifestFile = "manifest.json"
+
+// Manifest is the decoded manifest.json
+type Manifest struct {
+	// Version names the payload revision (e.g. "12"), recorded per run and
+	// shown in "already applied" messages (see payloadversion.go)
+	Version string `json:"version,omitempty"`
+	// MarketplaceURL is a gallery-compatible service URL (internal Marketplace
+	// mirror or an Open VSX instance's /vscode/gallery endpoint)
+	MarketplaceURL string `json:"marketplaceUrl,omitempty"`
+	// JSONIndent and SortKeys set the settings.json layout (see format.go)
+	JSONIndent string `json:"jsonIndent,omitempty"`
+	SortKeys   bool   `json:"sortKeys,omitempty"`
+	// KeybindingsMode is overwrite (default) or append (see keybindings.go)
+	KeybindingsMode string `json:"keybindingsMode,omitempty"`
+	// MacKeepCtrl are keys or commands whose ctrl stays ctrl on macOS (see mackeys.go)
+	MacKeepCtrl []string `json:"macKeepCtrl,omitempty"`
+	// KeyCategories map commands to cheat sheet categories (see cheatsheet.go)
+	KeyCategories map[string]string `json:"keyCategories,omitempty"`
+	// ProfileKeybindings are keybinding variants per VS Code profile (see profilekeys.go)
+	ProfileKeybindings map[string]ProfileKeybindings `json:"profileKeybindings,omitempty"`
+	// Projects get the extension list as .vscode/extensions.json recommendations (see recommend.go)
+	Projects []string `json:"projects,omitempty"`
+	// WorkspaceTrust manages workspace trust settings and trusted folders, when opted in (see trust.go)
+	WorkspaceTrust *WorkspaceTrust `json:"workspaceTrust,omitempty"`
+	// Workspaces are .code-workspace files stamped out by `workspace` (see workspaces.go)
+	Workspaces map[string]WorkspaceFile `json:"workspaces,omitempty"`
+	// MandatorySettings are settings.json keys enforced on every run (see silent.go)
+	MandatorySettings map[string]interface{} `json:"mandatorySettings,omitempty"`
+	// ConditionalSettings apply only where their condition holds (see conditions.go)
+	ConditionalSettings []ConditionalSettings `json:"conditionalSettings,omitempty"`
+}
+
+// parseManifest decodes manifest data (JSONC); empty or comment-only data
+// yields an empty manifest
+func parseManifest(data []byte) (Manifest, error) {
+	var m Manifest
+	if len(bytes.TrimSpace(stripJSONC(data))) == 0 {
+		return m, nil
+	}
+	if err := decodeJSONC(data, &m); err != nil {
+		return m, fmt.Errorf("invalid %s: %w", manifestFile, err)
+	}
+	return m, nil
+}
+
+// loadManifest reads the manifest from the payload source
+func (i *Installer) loadManifest() error {
+	data := embeddedManifest
+	if !i.useEmbedded {
+		p := filepath.Join(i.baseDir, manifestFile)
+		if !exists(p) {
+			return nil
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return fmt.Errorf("cannot read %s: %w", p, err)
+		}
+		data = b
+	}
+	m, err := parseManifest(data)
+	if err != nil {
+		return err
+	}
+	i.manifest = m
+	return nil
+}
@@ -0,0 +1,326 @@
+// marketplace.go
+//
+// Extension registry metadata. Microsoft builds of VS Code talk to the
+// Visual Studio Marketplace gallery API, VSCodium / Code-OSS builds, Cursor and Windsurf use
+// Open VSX. Only the small subset of both APIs the installer needs lives here.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	openVSXURL         = "https://open-vsx.org"
+	registryTimeoutSec = 20 // timeout for a single registry request
+	galleryPageSize    = 50 // extensions per gallery query
+)
+
+// registry names accepted by --registry
+const (
+	registryAuto        = "auto"
+	registryMarketplace = "marketplace"
+	registryOpenVSX     = "openvsx"
+)
+
+// gallery API query flags and filter types (see vscode extensionGalleryService)
+const (
+	galleryIncludeVersions          = 0x1
+	galleryIncludeFiles             = 0x2
+	galleryIncludeStatistics        = 0x100
+	galleryIncludeLatestVersionOnly = 0x200
+	galleryFilterTarget             = 8
+	galleryFilterExtensionName      = 7
+	galleryFilterSearchText         = 10
+	gallerySortNone                 = 0
+	gallerySortInstallCount         = 4
+)
+
+// extensionMeta is what we know about an extension from a registry
+type extensionMeta struct {
+	ID          string
+	Version     string // latest published version
+	DisplayName string
+	Description string
+	Installs    int64
+	DownloadURL string // .vsix of the latest version, when the query asked for files
+}
+
+// registryFor picks the registry matching the editor build behind codeCLI
+func registryFor(codeCLI string) string {
+	name := strings.ToLower(filepath.Base(codeCLI))
+	if strings.Contains(name, "codium") || strings.Contains(name, "code-oss") || strings.Contains(name, "cursor") || strings.Contains(name, "windsurf") {
+		return registryOpenVSX
+	}
+	return registryMarketplace
+}
+
+// resolveRegistry turns "auto" into the registry of the detected editor
+// (Marketplace when no CLI is found); explicit names are returned as-is.
+// A configured mirror always wins.
+func (i *Installer) resolveRegistry(name string) string {
+	if i.mirrorURL != "" {
+		// a mirror speaks the gallery protocol whatever the editor build is
+		return registryMarketplace
+	}
+	if name != registryAuto {
+		return name
+	}
+	if i.codeCLIPath == "" {
+		if err := i.ensureCodeCLI(); err != nil {
+			return registryMarketplace
+		}
+	}
+	return registryFor(i.codeCLIPath)
+}
+
+// fetchExtensionMeta returns metadata for ids keyed by lower-cased id.
+// Extensions unknown to the registry are simply absent from the result.
+func (i *Installer) fetchExtensionMeta(registry string, ids []string) (map[string]extensionMeta, error) {
+	switch registry {
+	case registryMarketplace:
+		return i.queryMarketplace(ids)
+	case registryOpenVSX:
+		return i.queryOpenVSX(ids)
+	default:
+		return nil, fmt.Errorf("unknown registry %q", registry)
+	}
+}
+
+// gallery API response (only the fields we read)
+type galleryResponse struct {
+	Results []struct {
+		Extensions []galleryExtension `json:"extensions"`
+	} `json:"results"`
+}
+
+type galleryExtension struct {
+	ExtensionName    string `json:"extensionName"`
+	DisplayName      string `json:"displayName"`
+	ShortDescription string `json:"shortDescription"`
+	Publisher        struct {
+		PublisherName string `json:"publisherName"`
+	} `json:"publisher"`
+	Versions []struct {
+		Version string `json:"version"`
+		Files   []struct {
+			AssetType string `json:"assetType"`
+			Source    string `json:"source"`
+		} `json:"files"`
+	} `json:"versions"`
+	Statistics []struct {
+		StatisticName string  `json:"statisticName"`
+		Value         float64 `json:"value"`
+	} `json:"statistics"`
+}
+
+func (g galleryExtension) meta() extensionMeta {
+	m := extensionMeta{
+		ID:          g.Publisher.PublisherName + "." + g.ExtensionName,
+		DisplayName: g.DisplayName,
+		Description: g.ShortDescription,
+	}
+	if len(g.Versions) > 0 {
+		m.Version = g.Versions[0].Version
+		for _, f := range g.Versions[0].Files {
+			if f.AssetType == "Microsoft.VisualStudio.Services.VSIXPackage" {
+				m.DownloadURL = f.Source
+			}
+		}
+	}
+	for _, st := range g.Statistics {
+		if st.StatisticName == "install" {
+			m.Installs = int64(st.Value)
+		}
+	}
+	return m
+}
+
+type galleryCriterion struct {
+	FilterType int    `json:"filterType"`
+	Value      string `json:"value"`
+}
+
+// galleryQuery posts one extensionquery request and returns the decoded extensions
+func (i *Installer) galleryQuery(criteria []galleryCriterion, pageSize, sortBy, flags int) ([]galleryExtension, error) {
+	body := map[string]interface{}{
+		"filters": []interface{}{map[string]interface{}{
+			"criteria":   append([]galleryCriterion{{galleryFilterTarget, "Microsoft.VisualStudio.Code"}}, criteria...),
+			"pageNumber": 1,
+			"pageSize":   pageSize,
+			"sortBy":     sortBy,
+		}},
+		"flags": flags,
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, galleryServiceURL+"/extensionquery", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json;api-version=3.0-preview.1")
+	var res galleryResponse
+	if err := i.doJSON(req, &res); err != nil {
+		return nil, fmt.Errorf("marketplace query: %w", err)
+	}
+	var out []galleryExtension
+	for _, r := range res.Results {
+		out = append(out, r.Extensions...)
+	}
+	return out, nil
+}
+
+func (i *Installer) queryMarketplace(ids []string) (map[string]extensionMeta, error) {
+	res := make(map[string]extensionMeta)
+	for start := 0; start < len(ids); start += galleryPageSize {
+		end := start + galleryPageSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		var criteria []galleryCriterion
+		for _, id := range ids[start:end] {
+			criteria = append(criteria, galleryCriterion{galleryFilterExtensionName, id})
+		}
+		exts, err := i.galleryQuery(criteria, end-start, gallerySortNone,
+			galleryIncludeVersions|galleryIncludeFiles|galleryIncludeStatistics|galleryIncludeLatestVersionOnly)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range exts {
+			m := e.meta()
+			res[strings.ToLower(m.ID)] = m
+		}
+	}
+	return res, nil
+}
+
+// Open VSX extension endpoint response (only the fields we read)
+type openVSXExtension struct {
+	Namespace     string `json:"namespace"`
+	Name          string `json:"name"`
+	Version       string `json:"version"`
+	DisplayName   string `json:"displayName"`
+	Description   string `json:"description"`
+	DownloadCount int64  `json:"downloadCount"`
+	Files         struct {
+		Download string `json:"download"`
+	} `json:"files"`
+}
+
+func (o openVSXExtension) meta() extensionMeta {
+	return extensionMeta{
+		ID:          o.Namespace + "." + o.Name,
+		Version:     o.Version,
+		DisplayName: o.DisplayName,
+		Description: o.Description,
+		Installs:    o.DownloadCount,
+		DownloadURL: o.Files.Download,
+	}
+}
+
+func (i *Installer) queryOpenVSX(ids []string) (map[string]extensionMeta, error) {
+	res := make(map[string]extensionMeta)
+	for _, id := range ids {
+		ns, name, ok := strings.Cut(id, ".")
+		if !ok {
+			continue
+		}
+		req, err := http.NewRequest(http.MethodGet, openVSXURL+"/api/"+url.PathEscape(ns)+"/"+url.PathEscape(name), nil)
+		if err != nil {
+			return nil, err
+		}
+		var ext openVSXExtension
+		if err := i.doJSON(req, &ext); err != nil {
+			if errors.Is(err, errRegistryNotFound) {
+				continue
+			}
+			return nil, fmt.Errorf("open vsx query %s: %w", id, err)
+		}
+		res[strings.ToLower(id)] = ext.meta()
+	}
+	return res, nil
+}
+
+// searchExtensions runs a free-text registry search, most installed first
+func (i *Installer) searchExtensions(registry, query string, limit int) ([]extensionMeta, error) {
+	switch registry {
+	case registryMarketplace:
+		exts, err := i.galleryQuery([]galleryCriterion{{galleryFilterSearchText, query}}, limit, gallerySortInstallCount,
+			galleryIncludeVersions|galleryIncludeStatistics|galleryIncludeLatestVersionOnly)
+		if err != nil {
+			return nil, err
+		}
+		res := make([]extensionMeta, 0, len(exts))
+		for _, e := range exts {
+			res = append(res, e.meta())
+		}
+		return res, nil
+	case registryOpenVSX:
+		q := url.Values{"query": {query}, "size": {fmt.Sprint(limit)}, "sortBy": {"downloadCount"}, "sortOrder": {"desc"}}
+		req, err := http.NewRequest(http.MethodGet, openVSXURL+"/api/-/search?"+q.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		var res struct {
+			Extensions []openVSXExtension `json:"extensions"`
+		}
+		if err := i.doJSON(req, &res); err != nil {
+			return nil, fmt.Errorf("open vsx search: %w", err)
+		}
+		out := make([]extensionMeta, 0, len(res.Extensions))
+		for _, e := range res.Extensions {
+			out = append(out, e.meta())
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("unknown registry %q", registry)
+	}
+}
+
+// downloadSize asks the server for the size of url without downloading it.
+// Returns -1 when the server does not tell.
+func (i *Installer) downloadSize(url string) (int64, error) {
+	req, err := http.NewRequest(http.MethodHead, url, nil)
+	if err != nil {
+		return -1, err
+	}
+	resp, err := i.doHTTP(registryClient, req)
+	if err != nil {
+		return -1, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return -1, fmt.Errorf("HTTP %s", resp.Status)
+	}
+	return resp.ContentLength, nil
+}
+
+var errRegistryNotFound = errors.New("not found in registry")
+
+// doJSON performs req and decodes a JSON response into v
+func (i *Installer) doJSON(req *http.Request, v interface{}) error {
+	resp, err := i.doHTTP(registryClient, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return errRegistryNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("HTTP %s: %s", resp.Status, strings.TrimSpace(string(snippet)))
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,127 @@
+// matrix.go
+//
+// Editor matrix: one payload provisions several VS Code-family editors in
+// one run. --editor takes a comma-separated list (code,cursor,windsurf) or
+// "all" — every editor whose CLI is found on this machine — and the apply
+// flow runs once per editor, one after another, each with its own user
+// dir, extensions folder, CLI, backup, checkpoint and state record. The
+// exit code is the first failure; a --report file is written per editor
+// (report.cursor.json next to report.json).
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pterm/pterm"
+)
+
+const editorAll = "all"
+
+// editorMatrix resolves an --editor value naming several editors; it
+// returns nil for a single editor (or none), which the plain flow handles
+func editorMatrix(spec string) ([]string, error) {
+	if spec == editorAll {
+		names := installedEditors()
+		if len(names) == 0 {
+			return nil, errors.New("--editor all: no VS Code-family editor found")
+		}
+		return names, nil
+	}
+	if !strings.Contains(spec, ",") {
+		return nil, nil
+	}
+	var names []string
+	for _, n := range strings.Split(spec, ",") {
+		n = strings.TrimSpace(n)
+		if n == "" || containsString(names, n) {
+			continue
+		}
+		if _, ok := editorVariants[n]; !ok {
+			return nil, fmt.Errorf("unknown --editor %q (want %s)", n, editorNames())
+		}
+		names = append(names, n)
+	}
+	return names, nil
+}
+
+// installedEditors lists the editors whose CLI is found, by name
+func installedEditors() []string {
+	var names []string
+	for n, ed := range editorVariants {
+		if ed.findCLI() != "" {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkMatrixOptions rejects switches that make no sense once per editor
+func checkMatrixOptions(opts Options) error {
+	switch {
+	case opts.Watch:
+		return errors.New("several editors cannot be combined with --watch")
+	case opts.Ansible:
+		return errors.New("several editors cannot be combined with --ansible")
+	case opts.InstallEditor != "":
+		return errors.New("several editors cannot be combined with --install-editor")
+	case opts.Sandbox || opts.SandboxDir != "":
+		return errors.New("several editors cannot be combined with --sandbox")
+	case opts.UserDataDir != "":
+		return errors.New("several editors cannot be combined with --user-data-dir")
+	case opts.AllUsers || opts.Remote != "" || opts.Scan != "" || opts.WorkspaceSettings != "" || opts.Theia != "":
+		return errors.New("several editors cannot be combined with --all-users, --remote, --scan, --workspace-settings or --theia")
+	case len(selectedBackends(opts)) > 0:
+		return errors.New("several editors cannot be combined with --notepadpp, --lapce, --pulsar, --geany or --kakoune")
+	}
+	return nil
+}
+
+// matrixReportPath is the --report file of one editor of the matrix
+func matrixReportPath(p, editor string) string {
+	ext := filepath.Ext(p)
+	return strings.TrimSuffix(p, ext) + "." + editor + ext
+}
+
+// applyMatrix runs the apply flow for every editor in names
+func applyMatrix(opts Options, names []string, err error) int {
+	if err == nil {
+		err = checkMatrixOptions(opts)
+	}
+	if err != nil {
+		if opts.Silent || opts.Ansible {
+			fmt.Fprintln(os.Stderr, "ERROR: cannot initialize installer:", err)
+		} else {
+			pterm.Error.Println("Cannot initialize installer:", err)
+		}
+		return exitFailure
+	}
+	if !opts.Silent {
+		pterm.DefaultBigText.WithLetters(pterm.NewLettersFromString("HYPR • VS CODE")).Render()
+		fmt.Println()
+	}
+	rc := exitOK
+	// "a" / "s" answers carry over to the editors that follow
+	answers := make(map[string]bool)
+	for k, name := range names {
+		o := opts
+		o.Editor, o.NoHeader = name, true
+		o.Answers, o.Remaining = answers, len(names)-k-1
+		if o.Report != "" {
+			o.Report = matrixReportPath(o.Report, name)
+		}
+		if !opts.Silent {
+			pterm.DefaultSection.Printf("%s (%d/%d)\n", editorVariants[name].Title, k+1, len(names))
+		}
+		if code := apply(o); rc == exitOK {
+			rc = code
+		}
+	}
+	return rc
+}
@@ -0,0 +1,208 @@
+// merge.go
+//
+// Three-way merge of payload files (--merge). The payload applied last time
+// is kept per target under <state dir>/applied/, so a new apply can merge
+// line by line with base = last payload, ours = the user's current file and
+// theirs = the new payload: the user's edits survive and payload changes
+// still arrive. Where both sides changed the same lines the user is asked
+// which version to keep; with --yes (or no terminal) the payload wins and
+// the conflict is logged. Without a recorded base the file is overwritten
+// as before.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pterm/pterm"
+)
+
+const appliedDirName = "applied"
+
+// mergeConflict is a region both sides changed differently
+type mergeConflict struct {
+	File   string
+	Base   []string
+	Ours   []string
+	Theirs []string
+}
+
+// conflictResolver picks the lines to use for a conflict; nil takes theirs
+type conflictResolver func(c mergeConflict) []string
+
+// matchIndex maps every line of a to its matching line of b (-1 = changed)
+func matchIndex(a, b []string) []int {
+	m := make([]int, len(a))
+	for k := range m {
+		m[k] = -1
+	}
+	x, y := 0, 0
+	for _, op := range diffLines(a, b) {
+		switch op.kind {
+		case ' ':
+			m[x] = y
+			x++
+			y++
+		case '-':
+			x++
+		case '+':
+			y++
+		}
+	}
+	return m
+}
+
+// merge3 merges ours and theirs against base. Regions between lines left
+// untouched by both sides are taken from whichever side changed them;
+// when both did, differently, resolve decides. Returns the merged lines and
+// the number of conflicts.
+func merge3(file string, base, ours, theirs []string, resolve conflictResolver) ([]string, int) {
+	mo, mt := matchIndex(base, ours), matchIndex(base, theirs)
+	var res []string
+	conflicts := 0
+	pb, po, pt := -1, -1, -1 // previous sync point in base, ours, theirs
+	for k := 0; k <= len(base); k++ {
+		var o, t int
+		if k == len(base) {
+			o, t = len(ours), len(theirs)
+		} else {
+			if mo[k] < 0 || mt[k] < 0 {
+				continue
+			}
+			o, t = mo[k], mt[k]
+		}
+		b, oc, tc := base[pb+1:k], ours[po+1:o], theirs[pt+1:t]
+		switch {
+		case equalLines(oc, b):
+			res = append(res, tc...)
+		case equalLines(tc, b), equalLines(oc, tc):
+			res = append(res, oc...)
+		default:
+			conflicts++
+			c := mergeConflict{File: file, Base: b, Ours: oc, Theirs: tc}
+			if resolve == nil {
+				res = append(res, tc...)
+			} else {
+				res = append(res, resolve(c)...)
+			}
+		}
+		if k < len(base) {
+			res = append(res, base[k])
+		}
+		pb, po, pt = k, o, t
+	}
+	return res, conflicts
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k := range a {
+		if a[k] != b[k] {
+			return false
+		}
+	}
+	return true
+}
+
+// appliedPath is where the payload last applied to this target is kept
+func (i *Installer) appliedPath(name string) string {
+	sum := sha256.Sum256([]byte(i.vscodeUser))
+	return filepath.Join(stateDir(i.homeDir), appliedDirName, hex.EncodeToString(sum[:])[:12], name)
+}
+
+// rememberApplied stores payload as the merge base for the next run, with
+// its secrets back as placeholders
+func (i *Installer) rememberApplied(name string, payload []byte) {
+	if i.dryRun {
+		return
+	}
+	payload = i.unresolveSecrets(payload)
+	p := i.appliedPath(name)
+	prev, err := snapshot(p)
+	if err := writeBytes(p, payload); err != nil {
+		i.warnf("cannot record applied %s for future merges: %v", name, err)
+		return
+	}
+	if err == nil {
+		i.appliedPrev = append(i.appliedPrev, prev)
+	}
+	i.journalWrite(prev, payload)
+}
+
+// desiredContent is what apply would write for a payload file: the payload
+// itself or, with --merge, the three-way merge with the live file. With
+// interactive set, conflicts are asked about; otherwise the payload wins.
+// keybindings.json in append mode is merged by keybindings.go instead.
+func (i *Installer) desiredContent(name string, payload []byte, interactive bool) []byte {
+	if name == keybindingsFile && i.bindingsMode == keybindingsAppend {
+		return i.appendKeybindings(payload, interactive)
+	}
+	if !i.merge {
+		return payload
+	}
+	cur, err := os.ReadFile(filepath.Join(i.vscodeUser, name))
+	if err != nil {
+		return payload
+	}
+	base, err := os.ReadFile(i.appliedPath(name))
+	base = i.fillSecrets(base)
+	if err != nil {
+		if interactive {
+			i.warnf("%s: no previously applied payload recorded — overwriting instead of merging", name)
+		}
+		return payload
+	}
+	var resolve conflictResolver
+	if interactive {
+		resolve = i.resolveConflict
+	}
+	merged, conflicts := merge3(name, splitLines(string(base)), splitLines(string(cur)), splitLines(string(payload)), resolve)
+	if interactive {
+		i.logf("%s: three-way merge with your edits (%d conflicts)", name, conflicts)
+	}
+	out := strings.Join(merged, "\n")
+	if len(merged) > 0 && strings.HasSuffix(string(payload), "\n") {
+		out += "\n"
+	}
+	return []byte(out)
+}
+
+// resolveConflict asks which side of a conflict to keep; the payload wins
+// in non-interactive runs
+func (i *Installer) resolveConflict(c mergeConflict) []string {
+	if i.assumeYes {
+		i.warnf("%s: conflicting edit, payload version used:\n%s", c.File, conflictText(c))
+		return c.Theirs
+	}
+	pterm.DefaultSection.Printf("Conflict in %s\n", c.File)
+	fmt.Println(conflictText(c))
+	keep, err := askYesNoDefaultYes(i.input(), "Оставить вашу версию (n — взять из payload)?", false)
+	if err != nil || !keep {
+		i.logToFile("merge: %s conflict resolved with the payload version", c.File)
+		return c.Theirs
+	}
+	i.logToFile("merge: %s conflict resolved with the user's version", c.File)
+	return c.Ours
+}
+
+// conflictText renders a conflict git-style for display
+func conflictText(c mergeConflict) string {
+	var sb strings.Builder
+	sb.WriteString("<<<<<<< yours\n")
+	for _, l := range c.Ours {
+		sb.WriteString(l + "\n")
+	}
+	sb.WriteString("=======\n")
+	for _, l := range c.Theirs {
+		sb.WriteString(l + "\n")
+	}
+	sb.WriteString(">>>>>>> payload")
+	return sb.String()
+}
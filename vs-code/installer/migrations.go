@@ -0,0 +1,239 @@
+// migrations.go
+//
+// Settings migrations: ordered rule files migrations/*.json of the payload
+// (001-theme.json, 002-python.json, ...), applied to the user's existing
+// settings.json before the payload is merged or written, so the payload can
+// evolve its keys across releases without breaking older installs:
+//
+//   [
+//     {"op": "rename", "from": "myorg.oldKey", "to": "myorg.newKey"},
+//     {"op": "move", "from": "go.formatTool", "to": "[go].editor.defaultFormatter"},
+//     {"op": "transform", "key": "workbench.editor.showTabs", "map": {"true": "multiple", "false": "none"}}
+//   ]
+//
+//   rename     a top-level key, in place (its comments stay)
+//   move       a value to another key; either side may be "[<lang>].key"
+//   transform  replace a value found in map (keys are the old values as JSON)
+//
+// Files run in lexical order, rules in file order. A rule does nothing when
+// its source is absent and never overwrites a destination the user already
+// set, so rules must be written to be idempotent: they are checked on every
+// run. The applied copy of the last payload (merge.go) is migrated too, so
+// --merge sees migrated keys as unchanged.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const migrationsDir = "migrations"
+
+// migrationRule is one entry of a migrations/*.json file
+type migrationRule struct {
+	Op   string                     `json:"op"`
+	From string                     `json:"from,omitempty"`
+	To   string                     `json:"to,omitempty"`
+	Key  string                     `json:"key,omitempty"`
+	Map  map[string]json.RawMessage `json:"map,omitempty"`
+}
+
+// migration is a parsed rule with its origin, for messages
+type migration struct {
+	migrationRule
+	File string
+}
+
+func (m migration) String() string {
+	switch m.Op {
+	case "transform":
+		return fmt.Sprintf("%s: transform %s", m.File, m.Key)
+	default:
+		return fmt.Sprintf("%s: %s %s -> %s", m.File, m.Op, m.From, m.To)
+	}
+}
+
+// parseMigrations decodes the migration files in lexical order
+func parseMigrations(files map[string][]byte) ([]migration, error) {
+	var res []migration
+	for _, name := range sortedKeys(files) {
+		var rules []migrationRule
+		if err := json.Unmarshal(stripJSONC(files[name]), &rules); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", name, err)
+		}
+		for n, r := range rules {
+			var ok bool
+			switch r.Op {
+			case "rename":
+				_, _, fromScoped := languageScopedKey(r.From)
+				_, _, toScoped := languageScopedKey(r.To)
+				ok = r.From != "" && r.To != "" && !fromScoped && !toScoped
+			case "move":
+				ok = r.From != "" && r.To != ""
+			case "transform":
+				ok = r.Key != "" && len(r.Map) > 0
+			}
+			if !ok {
+				return nil, fmt.Errorf("%s: rule %d: bad %q rule", name, n+1, r.Op)
+			}
+			m := migration{migrationRule: r, File: filepath.Base(name)}
+			// map keys are compared as compact JSON
+			if r.Map != nil {
+				m.Map = make(map[string]json.RawMessage, len(r.Map))
+				for k, v := range r.Map {
+					m.Map[compactJSON([]byte(k))] = v
+				}
+			}
+			res = append(res, m)
+		}
+	}
+	return res, nil
+}
+
+// compactJSON returns JSON(C) compacted, or trimmed as is when invalid
+func compactJSON(b []byte) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, stripJSONC(b)); err != nil {
+		return strings.TrimSpace(string(b))
+	}
+	return buf.String()
+}
+
+// loadMigrations reads the migration rules from the payload source
+func (i *Installer) loadMigrations() error {
+	files, err := i.payloadDirFiles()
+	if err != nil {
+		return err
+	}
+	list, err := parseMigrations(filesIn(files, migrationsDir))
+	if err != nil {
+		return err
+	}
+	i.migrations = list
+	return nil
+}
+
+// migrate applies the rules to settings data and returns the new data with
+// the rules that changed something
+func migrate(data []byte, rules []migration) ([]byte, []migration, error) {
+	var applied []migration
+	for _, r := range rules {
+		out, err := r.apply(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", r, err)
+		}
+		if !bytes.Equal(out, data) {
+			applied = append(applied, r)
+			data = out
+		}
+	}
+	return data, applied, nil
+}
+
+// apply runs one rule on settings data
+func (r migration) apply(data []byte) ([]byte, error) {
+	switch r.Op {
+	case "rename":
+		return renameSettingsKey(data, r.From, r.To)
+	case "move":
+		v, ok, err := getSettingsKey(data, r.From)
+		if err != nil || !ok {
+			return data, err
+		}
+		if data, err = deleteSettingsKey(data, r.From); err != nil {
+			return nil, err
+		}
+		if _, set, err := getSettingsKey(data, r.To); err != nil || set {
+			return data, err
+		}
+		return setSettingsKey(data, r.To, v)
+	default: // transform
+		v, ok, err := getSettingsKey(data, r.Key)
+		if err != nil || !ok {
+			return data, err
+		}
+		repl, found := r.Map[compactJSON(v)]
+		if !found {
+			return data, nil
+		}
+		return setSettingsKey(data, r.Key, repl)
+	}
+}
+
+// renameSettingsKey renames a top-level key in place; when to is already
+// set the user's value wins and from is dropped
+func renameSettingsKey(data []byte, from, to string) ([]byte, error) {
+	members, _, _, err := jsoncMembers(data)
+	if err != nil {
+		return nil, err
+	}
+	var src *jsoncMember
+	for k, m := range members {
+		switch m.Key {
+		case to:
+			out, _, err := jsoncDelete(data, from)
+			return out, err
+		case from:
+			src = &members[k]
+		}
+	}
+	if src == nil {
+		return data, nil
+	}
+	end, err := jsoncSkipString(data, src.Start)
+	if err != nil {
+		return nil, err
+	}
+	name, _ := json.Marshal(to)
+	out := append(append(append([]byte{}, data[:src.Start]...), name...), data[end:]...)
+	return out, nil
+}
+
+// applyMigrations migrates the user's settings.json (and the applied copy
+// of the last payload) before anything is merged or written
+func (i *Installer) applyMigrations() error {
+	if len(i.migrations) == 0 {
+		return nil
+	}
+	dst := filepath.Join(i.vscodeUser, settingsFile)
+	data, err := os.ReadFile(dst)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	out, applied, err := migrate(data, i.migrations)
+	if err != nil {
+		return fmt.Errorf("cannot migrate %s: %w", dst, err)
+	}
+	if len(applied) == 0 {
+		i.logToFile("no settings migrations to apply")
+		return nil
+	}
+	if i.dryRun {
+		for _, m := range applied {
+			i.logf("DRY-RUN: would migrate %s", m)
+		}
+		return nil
+	}
+	if err := i.safeWrite(dst, i.formatSettings(out)); err != nil {
+		return fmt.Errorf("cannot write %s: %w", dst, err)
+	}
+	for _, m := range applied {
+		i.logf("Migrated %s", m)
+	}
+	if base, err := os.ReadFile(i.appliedPath(settingsFile)); err == nil {
+		if out, _, err := migrate(base, i.migrations); err == nil {
+			if err := writeBytes(i.appliedPath(settingsFile), out); err != nil {
+				i.warnf("cannot migrate the applied copy of %s: %v", settingsFile, err)
+			}
+		}
+	}
+	return nil
+}
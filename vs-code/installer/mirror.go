@@ -0,0 +1,166 @@
+// mirror.go
+//
+// Marketplace mirror support (--marketplace-url or manifest marketplaceUrl).
+// The URL is a gallery-compatible service endpoint, e.g.
+//   https://marketplace.corp.example/_apis/public/gallery
+//   https://openvsx.corp.example/vscode/gallery
+// All metadata queries go there, and extensions are downloaded from it as
+// .vsix (through the download cache, see cache.go) and installed from disk,
+// so the editor's own gallery setting does not matter. Packages are asked
+// for this machine's platform and cached per mirror host. For VSCodium the
+// user-level product.json is pointed at the mirror as well, so in-editor
+// installs and updates use it too.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"runtime"
+	"strings"
+)
+
+const defaultGalleryServiceURL = "https://marketplace.visualstudio.com/_apis/public/gallery"
+
+// galleryServiceURL is the gallery endpoint used for all queries
+var galleryServiceURL = defaultGalleryServiceURL
+
+// useMirror points gallery queries at url
+func (i *Installer) useMirror(url string) {
+	i.mirrorURL = strings.TrimRight(url, "/")
+	galleryServiceURL = i.mirrorURL
+	i.logf("Using marketplace mirror: %s", i.mirrorURL)
+}
+
+// vsixURL is the gallery asset endpoint for one extension version
+func vsixURL(service, id, version string) string {
+	pub, name, _ := strings.Cut(id, ".")
+	return fmt.Sprintf("%s/publishers/%s/vsextensions/%s/%s/vspackage", service, pub, name, version)
+}
+
+// mirrorHost names the mirror in cache keys
+func mirrorHost(mirror string) string {
+	if u, err := url.Parse(mirror); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return "mirror"
+}
+
+// hostTarget is this machine's VS Code target platform, e.g. linux-x64
+func hostTarget() string {
+	goos := map[string]string{"windows": "win32"}[runtime.GOOS]
+	if goos == "" {
+		goos = runtime.GOOS
+	}
+	arch := map[string]string{"amd64": "x64", "arm": "armhf"}[runtime.GOARCH]
+	if arch == "" {
+		arch = runtime.GOARCH
+	}
+	return goos + "-" + arch
+}
+
+// downloadFromMirror fetches the .vsix for spec into the run's download dir
+func (i *Installer) downloadFromMirror(spec extensionSpec) (vsixPackage, error) {
+	version := spec.Version
+	url := ""
+	if version == "" {
+		meta, err := i.queryMarketplace([]string{spec.ID})
+		if err != nil {
+			return vsixPackage{}, err
+		}
+		m, ok := meta[strings.ToLower(spec.ID)]
+		if !ok {
+			return vsixPackage{}, fmt.Errorf("%s: %w", spec.ID, errRegistryNotFound)
+		}
+		version, url = m.Version, m.DownloadURL
+	}
+	target := hostTarget()
+	if url == "" {
+		url = vsixURL(i.mirrorURL, spec.ID, version) + "?targetPlatform=" + target
+	}
+
+	key := cacheKey(mirrorHost(i.mirrorURL), spec.ID, version, target)
+	dst, hit, err := i.cache.fetch(key, url)
+	if err != nil {
+		return vsixPackage{}, fmt.Errorf("download %s: %w", spec.ID, err)
+	}
+	if _, err := readVSIXManifest(dst); err != nil {
+		i.cache.forget(key)
+		return vsixPackage{}, fmt.Errorf("%s: downloaded file is not a .vsix: %w", spec.ID, err)
+	}
+	if hit {
+		i.logf("Using cached %s %s", spec.ID, version)
+	} else {
+		i.logf("Downloaded %s %s from mirror", spec.ID, version)
+	}
+	return vsixPackage{Path: dst, ID: spec.ID, Version: version}, nil
+}
+
+// prefetchMirror downloads the packages of specs from the mirror in
+// parallel, so the installs that follow find them on disk; failures are
+// left to installSource, which tries once more and falls back
+func (i *Installer) prefetchMirror(specs []extensionSpec) {
+	if i.mirrorURL == "" || i.dryRun {
+		return
+	}
+	var todo []extensionSpec
+	for _, s := range specs {
+		if _, ok := i.vsix[strings.ToLower(s.ID)]; !ok {
+			todo = append(todo, s)
+		}
+	}
+	pkgs := make([]vsixPackage, len(todo))
+	errs := make([]error, len(todo))
+	parallel(len(todo), downloadWorkers, func(idx int) {
+		pkgs[idx], errs[idx] = i.downloadFromMirror(todo[idx])
+	})
+	if i.vsix == nil {
+		i.vsix = make(map[string]vsixPackage)
+	}
+	for idx, s := range todo {
+		if errs[idx] == nil {
+			i.vsix[strings.ToLower(s.ID)] = pkgs[idx]
+		}
+	}
+}
+
+// configureCodiumGallery points VSCodium's user product.json at the mirror.
+// Other keys of an existing product.json are preserved; editors that read
+// no user product.json (editorVariant.Product) are left alone.
+func (i *Installer) configureCodiumGallery() error {
+	path := i.editor.userProduct(i.vscodeUser)
+	if i.mirrorURL == "" || path == "" {
+		return nil
+	}
+	product := map[string]interface{}{}
+	if b, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(b, &product); err != nil {
+			return fmt.Errorf("cannot parse %s: %w", path, err)
+		}
+	}
+	gallery, _ := product["extensionsGallery"].(map[string]interface{})
+	if gallery == nil {
+		gallery = map[string]interface{}{}
+	}
+	gallery["serviceUrl"] = i.mirrorURL
+	product["extensionsGallery"] = gallery
+	out, err := json.MarshalIndent(product, "", "  ")
+	if err != nil {
+		return err
+	}
+	if sameContent(path, append(out, '\n')) {
+		i.logToFile("VSCodium gallery already points at the mirror")
+		return nil
+	}
+	if i.dryRun {
+		i.logf("DRY-RUN: would set extensionsGallery.serviceUrl=%s in %s", i.mirrorURL, path)
+		return nil
+	}
+	if err := i.safeWrite(path, append(out, '\n')); err != nil {
+		return err
+	}
+	i.logf("VSCodium gallery set to mirror in %s", path)
+	return nil
+}
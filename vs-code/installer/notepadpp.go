@@ -0,0 +1,215 @@
+// notepadpp.go
+//
+// Notepad++ on Windows (--notepadpp), for sites that standardize a
+// lightweight editor next to VS Code. The payload's notepadpp/ folder holds
+//
+//   config.xml      the main settings, written to the config folder
+//   themes/*.xml    style themes, written to <config folder>\themes
+//   plugins.json    plugins to install, in Plugin Admin's list format
+//                   (nppPluginList's pl.x64.json): an object whose
+//                   "npp-plugins" array has folder-name, display-name,
+//                   version, id (sha256 of the zip, required) and
+//                   repository (its https URL)
+//
+// The config folder is %APPDATA%\Notepad++, or the install folder when it
+// holds doLocalConf.xml (portable installs). Plugins are downloaded, checked
+// against their sha256 and unpacked to <install folder>\plugins\<folder-name>;
+// one that is already there is kept unless --force. The install folder is
+// under Program Files, so plugins need an elevated run. Notepad++ saves
+// config.xml when it exits, so a running instance would undo the change; it
+// is reported. The VS Code apply does not run.
+
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	notepadppDir        = "notepadpp"
+	notepadppConfig     = "config.xml"
+	notepadppThemes     = "themes"
+	notepadppPlugins    = "plugins.json"
+	notepadppLocalConf  = "doLocalConf.xml"
+	notepadppExe        = "notepad++.exe"
+	notepadppCmdTimeout = 30 * time.Second
+)
+
+// nppPlugin is one entry of a Plugin Admin plugin list
+type nppPlugin struct {
+	Folder     string `json:"folder-name"`
+	Name       string `json:"display-name"`
+	Version    string `json:"version"`
+	ID         string `json:"id"` // sha256 of the zip
+	Repository string `json:"repository"`
+}
+
+// nppPluginList is the Plugin Admin plugin list format
+type nppPluginList struct {
+	Plugins []nppPlugin `json:"npp-plugins"`
+}
+
+// notepadppInstallDir returns the Notepad++ install folder, "" when not installed
+func notepadppInstallDir() string {
+	for _, env := range []string{"ProgramFiles", "ProgramFiles(x86)", "ProgramW6432"} {
+		root := os.Getenv(env)
+		if root == "" {
+			continue
+		}
+		dir := filepath.Join(root, "Notepad++")
+		if exists(filepath.Join(dir, notepadppExe)) {
+			return dir
+		}
+	}
+	return ""
+}
+
+// notepadppConfigDir is where Notepad++ reads config.xml and themes from
+func notepadppConfigDir(install string) string {
+	if install != "" && exists(filepath.Join(install, notepadppLocalConf)) {
+		return install
+	}
+	return filepath.Join(os.Getenv("APPDATA"), "Notepad++")
+}
+
+// notepadppRunning reports whether Notepad++ is running
+func notepadppRunning() bool {
+	out, err := runCommandWithTimeout(notepadppCmdTimeout, "tasklist", "/FI", "IMAGENAME eq "+notepadppExe, "/NH")
+	return err == nil && strings.Contains(strings.ToLower(out), notepadppExe)
+}
+
+// applyNotepadPP deploys the payload's notepadpp/ folder
+func (i *Installer) applyNotepadPP() error {
+	if runtime.GOOS != "windows" {
+		return errors.New("--notepadpp is only supported on Windows")
+	}
+	files, err := i.backendFiles(notepadppDir)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("the payload has no %s/ folder", notepadppDir)
+	}
+	install := notepadppInstallDir()
+	if install == "" {
+		i.warnf("Notepad++ is not installed — only its config is written")
+	}
+	conf := notepadppConfigDir(install)
+	i.logf("Notepad++ config folder: %s", conf)
+	if notepadppRunning() {
+		i.warnf("Notepad++ is running — close it first, it rewrites %s when it exits", notepadppConfig)
+	}
+
+	var errs []error
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var dst string
+		switch {
+		case name == notepadppConfig:
+			dst = filepath.Join(conf, notepadppConfig)
+		case path.Dir(name) == notepadppThemes && strings.EqualFold(path.Ext(name), ".xml"):
+			dst = filepath.Join(conf, notepadppThemes, path.Base(name))
+		case name == notepadppPlugins:
+			continue
+		default:
+			i.warnf("%s/%s is not a Notepad++ payload file — skipped", notepadppDir, name)
+			continue
+		}
+		if err := i.deployFile("notepad++:"+name, dst, files[name]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if b, ok := files[notepadppPlugins]; ok {
+		var list nppPluginList
+		if err := json.Unmarshal(b, &list); err != nil {
+			errs = append(errs, fmt.Errorf("%s/%s: %w", notepadppDir, notepadppPlugins, err))
+		} else if install == "" {
+			i.warnf("%d Notepad++ plugin(s) skipped: Notepad++ is not installed", len(list.Plugins))
+		} else {
+			for _, p := range list.Plugins {
+				if err := i.installNppPlugin(install, p); err != nil {
+					errs = append(errs, fmt.Errorf("plugin %s: %w", p.Folder, err))
+				}
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// installNppPlugin downloads, verifies and unpacks one plugin
+func (i *Installer) installNppPlugin(install string, p nppPlugin) error {
+	switch {
+	case p.Folder == "" || strings.ContainsAny(p.Folder, `/\`) || !filepath.IsLocal(p.Folder):
+		return fmt.Errorf("invalid folder-name %q", p.Folder)
+	case len(p.ID) != 64:
+		return errors.New("id (the sha256 of the zip) is required")
+	case !strings.HasPrefix(strings.ToLower(p.Repository), "https://"):
+		return fmt.Errorf("repository must be an https URL, not %q", p.Repository)
+	}
+	item := "notepad++ plugin:" + p.Folder
+	dir := filepath.Join(install, "plugins", p.Folder)
+	if exists(filepath.Join(dir, p.Folder+".dll")) && !i.force {
+		i.report.Skipped = append(i.report.Skipped, item)
+		return nil
+	}
+	if i.dryRun {
+		i.logf("DRY-RUN: would install Notepad++ plugin %s %s into %s", p.Folder, p.Version, dir)
+		i.report.Installed = append(i.report.Installed, item)
+		return nil
+	}
+	tmp, err := os.CreateTemp("", "npp-plugin-*.zip")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	if err := i.resumeDownload(p.Repository, tmp.Name()); err != nil {
+		return fmt.Errorf("download failed: %w", err)
+	}
+	if !strings.EqualFold(fileHash(tmp.Name()), p.ID) {
+		return errors.New("checksum mismatch (the zip does not match its id)")
+	}
+	if err := extractNppPlugin(tmp.Name(), dir); err != nil {
+		return err
+	}
+	i.report.Installed = append(i.report.Installed, item)
+	i.logf("Notepad++ plugin %s %s installed", p.Folder, p.Version)
+	return nil
+}
+
+// extractNppPlugin unpacks a plugin zip into dir
+func extractNppPlugin(file, dir string) error {
+	zr, err := zip.OpenReader(file)
+	if err != nil {
+		return fmt.Errorf("not a plugin zip: %w", err)
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rel, ok := localZipPath(f.Name)
+		if !ok {
+			return fmt.Errorf("zip entry %q escapes the plugin folder", f.Name)
+		}
+		if err := extractZipEntry(f, filepath.Join(dir, rel)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
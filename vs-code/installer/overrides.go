@@ -0,0 +1,230 @@
+// overrides.go
+//
+// Per-machine setting overrides from the command line, merged on top of the
+// payload's settings.json before anything is planned or written:
+//
+//   --set editor.fontSize=14                   true/false/null and numbers as such, anything else a string
+//   --set-json 'workbench.colorTheme="Nord"'   the value is JSON (objects and arrays too)
+//
+//   --set '[go].editor.tabSize=4'              a key inside the "[go]" language block
+//
+// Both flags are repeatable and applied in command-line order, so a later
+// one wins. The payload keeps its comments and layout; an overridden key
+// keeps its place, a new key is appended.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// settingArg is one --set / --set-json argument as given
+type settingArg struct {
+	Arg  string
+	JSON bool
+}
+
+// settingArgs collects --set and --set-json into one list, keeping their
+// command-line order
+type settingArgs struct {
+	list *[]settingArg
+	json bool
+}
+
+func (a settingArgs) String() string {
+	if a.list == nil {
+		return ""
+	}
+	var res []string
+	for _, s := range *a.list {
+		if s.JSON == a.json {
+			res = append(res, s.Arg)
+		}
+	}
+	return strings.Join(res, ", ")
+}
+
+func (a settingArgs) Set(s string) error {
+	*a.list = append(*a.list, settingArg{Arg: s, JSON: a.json})
+	return nil
+}
+
+// settingOverride is one --set / --set-json
+type settingOverride struct {
+	Key   string
+	Value []byte // encoded JSON
+}
+
+// parseSettingOverride splits "key=value"; raw values are JSON (--set-json)
+func parseSettingOverride(arg string, raw bool) (settingOverride, error) {
+	key, val, ok := strings.Cut(arg, "=")
+	key = strings.TrimSpace(key)
+	if !ok || key == "" {
+		return settingOverride{}, fmt.Errorf("%q: want key=value", arg)
+	}
+	if raw {
+		v := bytes.TrimSpace(stripJSONC([]byte(val)))
+		if !json.Valid(v) {
+			return settingOverride{}, fmt.Errorf("%q: value is not valid JSON", arg)
+		}
+		var buf bytes.Buffer
+		json.Compact(&buf, v)
+		return settingOverride{Key: key, Value: buf.Bytes()}, nil
+	}
+	switch val {
+	case "true", "false", "null":
+		return settingOverride{Key: key, Value: []byte(val)}, nil
+	}
+	if _, err := strconv.ParseFloat(val, 64); err == nil && json.Valid([]byte(val)) {
+		return settingOverride{Key: key, Value: []byte(val)}, nil
+	}
+	b, _ := json.Marshal(val)
+	return settingOverride{Key: key, Value: b}, nil
+}
+
+// parseSettingOverrides turns the --set / --set-json arguments into overrides
+func parseSettingOverrides(args []settingArg) ([]settingOverride, error) {
+	var res []settingOverride
+	for _, a := range args {
+		o, err := parseSettingOverride(a.Arg, a.JSON)
+		if err != nil {
+			if a.JSON {
+				return nil, fmt.Errorf("--set-json %w", err)
+			}
+			return nil, fmt.Errorf("--set %w", err)
+		}
+		res = append(res, o)
+	}
+	return res, nil
+}
+
+// applySettingOverrides merges the overrides into the settings payload
+func (i *Installer) applySettingOverrides() error {
+	if len(i.overrides) == 0 {
+		return nil
+	}
+	data := i.settingsData
+	for _, o := range i.overrides {
+		out, err := setSettingsKey(data, o.Key, o.Value)
+		if err != nil {
+			return fmt.Errorf("cannot apply --set %s: %s: %w", o.Key, settingsFile, err)
+		}
+		data = out
+		i.logToFile("Override: %s = %s", o.Key, o.Value)
+	}
+	i.settingsData = data
+	i.logf("Applied %d setting overrides from the command line", len(i.overrides))
+	return nil
+}
+
+// languageScopedKey splits "[go].editor.tabSize" into "[go]" and
+// "editor.tabSize"
+func languageScopedKey(key string) (block, sub string, ok bool) {
+	if !strings.HasPrefix(key, "[") {
+		return "", "", false
+	}
+	block, sub, ok = strings.Cut(key, "].")
+	if !ok || sub == "" || len(block) < 2 {
+		return "", "", false
+	}
+	return block + "]", sub, true
+}
+
+// setSettingsKey sets a top-level key, or a key inside a language block,
+// to the encoded JSON value
+func setSettingsKey(data []byte, key string, value []byte) ([]byte, error) {
+	block, sub, ok := languageScopedKey(key)
+	if !ok {
+		return jsoncSet(data, key, value)
+	}
+	members, _, _, err := jsoncMembers(data)
+	if len(bytes.TrimSpace(data)) > 0 && err != nil {
+		return nil, err
+	}
+	obj := map[string]interface{}{}
+	for _, m := range members {
+		if m.Key != block {
+			continue
+		}
+		v, err := parseJSONC(data[m.ValueStart:m.End])
+		cur, isObj := v.(map[string]interface{})
+		if err != nil || !isObj {
+			return nil, fmt.Errorf("%s is not an object", block)
+		}
+		obj = cur
+	}
+	var v interface{}
+	if err := json.Unmarshal(value, &v); err != nil {
+		return nil, err
+	}
+	obj[sub] = v
+	return jsoncSet(data, block, encodeJSONValue(obj, "  "))
+}
+
+// getSettingsKey returns the raw value of a top-level key, or of a key inside
+// a language block
+func getSettingsKey(data []byte, key string) ([]byte, bool, error) {
+	if len(bytes.TrimSpace(stripJSONC(data))) == 0 {
+		return nil, false, nil
+	}
+	block, sub, scoped := languageScopedKey(key)
+	if !scoped {
+		block = key
+	}
+	members, _, _, err := jsoncMembers(data)
+	if err != nil {
+		return nil, false, err
+	}
+	var raw []byte
+	for _, m := range members {
+		if m.Key == block {
+			raw = data[m.ValueStart:m.End]
+		}
+	}
+	if raw == nil || !scoped {
+		return raw, raw != nil, nil
+	}
+	v, err := parseJSONC(raw)
+	obj, isObj := v.(map[string]interface{})
+	if err != nil || !isObj {
+		return nil, false, fmt.Errorf("%s is not an object", block)
+	}
+	val, ok := obj[sub]
+	if !ok {
+		return nil, false, nil
+	}
+	b, err := json.Marshal(val)
+	return b, true, err
+}
+
+// deleteSettingsKey deletes a top-level key, or a key inside a language
+// block (the block goes when it ends up empty)
+func deleteSettingsKey(data []byte, key string) ([]byte, error) {
+	block, sub, scoped := languageScopedKey(key)
+	if !scoped {
+		out, _, err := jsoncDelete(data, key)
+		return out, err
+	}
+	raw, ok, err := getSettingsKey(data, block)
+	if err != nil || !ok {
+		return data, err
+	}
+	v, err := parseJSONC(raw)
+	obj, isObj := v.(map[string]interface{})
+	if err != nil || !isObj {
+		return nil, fmt.Errorf("%s is not an object", block)
+	}
+	if _, ok := obj[sub]; !ok {
+		return data, nil
+	}
+	delete(obj, sub)
+	if len(obj) == 0 {
+		out, _, err := jsoncDelete(data, block)
+		return out, err
+	}
+	return jsoncSet(data, block, encodeJSONValue(obj, "  "))
+}
@@ -0,0 +1,234 @@
+// pack.go
+//
+// `pack` subcommand: builds a self-contained installer from a payload folder
+// without a Go toolchain. The payload files, the payload folders and the
+// backend folders (editorbackend.go) are zipped and appended to a copy of
+// this executable (or --base, e.g. a binary for another OS), followed by a
+// trailer:
+//
+//   <executable> <zip> <zip length, 8 bytes LE> "HYPRPAK1"
+//
+// On start-up loadAppendedPayload finds the trailer and the appended files
+// replace the whole embedded payload, like a preset: a payload file the pack
+// does not carry is not part of the run, even if the base binary embeds one.
+// Packing a packed binary replaces its payload. Note: on macOS the result has to be re-signed.
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+var packMagic = []byte("HYPRPAK1")
+
+const packTrailerLen = 16 // zip length + magic
+
+// packTargets maps the payload files a pack may carry to the
+// embedded variable they replace
+func packTargets() map[string]*[]byte {
+	return map[string]*[]byte{
+		settingsFile:    &embeddedSettings,
+		keybindingsFile: &embeddedKeybindings,
+		extensionsFile:  &embeddedExtensions,
+		blocklistFile:   &embeddedBlocklist,
+		manifestFile:    &embeddedManifest,
+		removeListFile:  &embeddedRemoveList,
+		keymapsFile:     &embeddedKeymaps,
+		policyFile:      &embeddedPolicy,
+	}
+}
+
+func runPack(args []string) error {
+	flags, _ := newCommandFlags("pack")
+	data := flags.String("data", "", "Payload folder (settings.json, keybindings.json, extensions.txt, blocked.txt, manifest.json)")
+	out := flags.String("out", "", "Output installer path")
+	base := flags.String("base", "", "Installer binary to pack into (default: this executable)")
+	flags.Parse(args)
+	if *data == "" || *out == "" {
+		return errors.New("usage: pack --data <dir> --out <file> [--base <installer>]")
+	}
+
+	if *base == "" {
+		exe, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("cannot determine exe path: %w", err)
+		}
+		*base = exe
+	}
+	bin, err := os.ReadFile(*base)
+	if err != nil {
+		return err
+	}
+	packed, names, err := packInto(bin, *data)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(*out, packed, 0o755); err != nil {
+		return err
+	}
+	fmt.Printf("Packed %d files (%v) into %s (%s)\n", len(names), names, *out, humanBytes(int64(len(packed))))
+	return nil
+}
+
+// packInto appends the payload files of dir to the installer binary bin
+// (replacing a payload appended earlier)
+func packInto(bin []byte, dir string) ([]byte, []string, error) {
+	bin = bin[:packedBinaryLen(bin)]
+	payload, names, err := zipPayload(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(names) == 0 {
+		return nil, nil, fmt.Errorf("no payload files in %s", dir)
+	}
+	var buf bytes.Buffer
+	buf.Grow(len(bin) + len(payload) + packTrailerLen)
+	buf.Write(bin)
+	buf.Write(payload)
+	binary.Write(&buf, binary.LittleEndian, uint64(len(payload)))
+	buf.Write(packMagic)
+	return buf.Bytes(), names, nil
+}
+
+// zipPayload zips the known payload files found in dir, its payload folders
+// and its backend folders
+func zipPayload(dir string) ([]byte, []string, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	var names []string
+	for _, name := range packFileNames() {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		w, err := zw.Create(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, err := w.Write(b); err != nil {
+			return nil, nil, err
+		}
+		names = append(names, name)
+	}
+	dirFiles, err := readPayloadDirs(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	backendFiles, err := readBackendDirs(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	for name, b := range backendFiles {
+		dirFiles[name] = b
+	}
+	for _, name := range sortedKeys(dirFiles) {
+		w, err := zw.Create(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, err := w.Write(dirFiles[name]); err != nil {
+			return nil, nil, err
+		}
+		names = append(names, name)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, nil, err
+	}
+	return buf.Bytes(), names, nil
+}
+
+// packedBinaryLen returns the length of bin without an appended payload
+func packedBinaryLen(bin []byte) int {
+	n := len(bin)
+	if n < packTrailerLen || !bytes.Equal(bin[n-len(packMagic):], packMagic) {
+		return n
+	}
+	size := binary.LittleEndian.Uint64(bin[n-packTrailerLen : n-len(packMagic)])
+	if size > uint64(n-packTrailerLen) {
+		return n
+	}
+	return n - packTrailerLen - int(size)
+}
+
+// packFileNames lists the payload file names in a stable order
+func packFileNames() []string {
+	var names []string
+	for name := range packTargets() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// appendedPayload is set when the payload was appended by pack
+var appendedPayload bool
+
+// loadAppendedPayload replaces the embedded payload with files appended by
+// `pack`, if this executable carries any. Only the top-level files are read
+// now; the folders are read from the zip when first needed, so the
+// executable stays open for the rest of the process.
+func loadAppendedPayload() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(exe)
+	if err != nil {
+		return err
+	}
+	keep := false
+	defer func() {
+		if !keep {
+			f.Close()
+		}
+	}()
+	st, err := f.Stat()
+	if err != nil || st.Size() < packTrailerLen {
+		return err
+	}
+	trailer := make([]byte, packTrailerLen)
+	if _, err := f.ReadAt(trailer, st.Size()-packTrailerLen); err != nil {
+		return err
+	}
+	if !bytes.Equal(trailer[8:], packMagic) {
+		return nil
+	}
+	size := int64(binary.LittleEndian.Uint64(trailer[:8]))
+	if size <= 0 || size > st.Size()-packTrailerLen {
+		return errors.New("corrupt appended payload")
+	}
+	zr, err := zip.NewReader(io.NewSectionReader(f, st.Size()-packTrailerLen-size, size), size)
+	if err != nil {
+		return fmt.Errorf("corrupt appended payload: %w", err)
+	}
+	targets := packTargets()
+	var top []*zip.File
+	for _, zf := range zr.File {
+		if _, ok := targets[zf.Name]; ok {
+			top = append(top, zf)
+		}
+	}
+	files, err := readZipFiles(top)
+	if err != nil {
+		return err
+	}
+	// the pack is the whole payload: targets it does not carry are cleared
+	for name, dst := range targets {
+		*dst = files[name]
+	}
+	embeddedDirFS, embeddedDirRoot, embeddedDirFiles = zr, ".", nil
+	appendedPayload, keep = true, true
+	return nil
+}
@@ -0,0 +1,185 @@
+// payloadcheck.go
+//
+// Startup validation of the payload (embedded or --src). Before anything is
+// applied every payload file and every file of the payload folders must be
+// UTF-8 without a byte order mark, smaller than maxPayloadFileSize and pass
+// validatePayloadFile: JSON files parse, payload files have the shape
+// their consumer expects, list files hold valid entries. Otherwise the run
+// refuses to apply and exits with exitPayload, naming the file, line and
+// column of every problem — an invalid settings.json written verbatim
+// breaks VS Code. `self-test` runs the same checks on the embedded payload
+// and the presets.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxPayloadFileSize is far above any real config file; larger files are
+// a packing mistake (a binary or a log file in the payload folder)
+const maxPayloadFileSize = 1 << 20
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// validatePayload checks the payload files of this run; the error lists
+// every invalid file
+func (i *Installer) validatePayload() error {
+	files := make(map[string][]byte)
+	for name, data := range packTargets() {
+		if !i.useEmbedded {
+			p := filepath.Join(i.baseDir, name)
+			if !exists(p) {
+				continue
+			}
+			b, err := os.ReadFile(p)
+			if err != nil {
+				return fmt.Errorf("cannot read %s: %w", p, err)
+			}
+			files[name] = b
+			continue
+		}
+		files[name] = *data
+	}
+	dirFiles, err := i.payloadDirFiles()
+	if err != nil {
+		return err
+	}
+	for name, data := range dirFiles {
+		files[name] = data
+	}
+	var bad []string
+	for _, name := range sortedKeys(files) {
+		if err := validatePayloadFile(name, files[name]); err != nil {
+			bad = append(bad, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+	if len(bad) > 0 {
+		return fmt.Errorf("invalid payload:\n  %s", strings.Join(bad, "\n  "))
+	}
+	return nil
+}
+
+// checkPayloadEncoding rejects files that are too large, start with a byte
+// order mark or are not UTF-8
+func checkPayloadEncoding(data []byte) error {
+	if len(data) > maxPayloadFileSize {
+		return fmt.Errorf("%s is larger than %s", humanBytes(int64(len(data))), humanBytes(maxPayloadFileSize))
+	}
+	if bytes.HasPrefix(data, utf8BOM) {
+		return errors.New("line 1, column 1: starts with a UTF-8 byte order mark — save the file without BOM")
+	}
+	if !utf8.Valid(data) {
+		off := 0
+		for off < len(data) {
+			r, size := utf8.DecodeRune(data[off:])
+			if r == utf8.RuneError && size <= 1 {
+				break
+			}
+			off += size
+		}
+		return fmt.Errorf("%s: invalid UTF-8 (byte 0x%02X)", positionAt(data, off), data[off])
+	}
+	return nil
+}
+
+// validatePayloadFile checks that a payload file parses and has the shape
+// its consumer expects
+func validatePayloadFile(name string, data []byte) error {
+	if err := checkPayloadEncoding(data); err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(stripJSONC(data))) == 0 && strings.HasSuffix(name, ".json") {
+		return nil
+	}
+	switch name {
+	case settingsFile:
+		v, err := parseJSONC(data)
+		if err != nil {
+			return err
+		}
+		if _, ok := v.(map[string]interface{}); !ok {
+			return errors.New("not a JSON object")
+		}
+	case keybindingsFile:
+		if _, err := parseJSONC(data); err != nil {
+			return err
+		}
+		_, list, err := parseKeybindings(data)
+		if err != nil {
+			return err
+		}
+		for n, b := range list {
+			// a "-command" entry without a key removes the command's every default
+			if b.cmd == "" || (b.key == "" && !strings.HasPrefix(b.cmd, "-")) {
+				return fmt.Errorf("%s: entry %d: \"key\" and \"command\" are required", positionAt(data, b.end-len(b.raw)), n+1)
+			}
+		}
+	case extensionsFile:
+		return checkLines(data, func(l string) error {
+			_, err := parseExtensionSpec(l)
+			return err
+		})
+	case blocklistFile:
+		return checkLines(data, func(l string) error {
+			if _, err := path.Match(l, ""); err != nil {
+				return fmt.Errorf("bad pattern %q", l)
+			}
+			return nil
+		})
+	case manifestFile:
+		var m Manifest
+		return decodeJSONC(data, &m)
+	case keymapsFile:
+		var catalog map[string]keymapPreset
+		if err := decodeJSONC(data, &catalog); err != nil {
+			return err
+		}
+		for _, name := range keymapNames(catalog) {
+			if _, err := parseExtensionList(catalog[name].Extensions); err != nil {
+				return fmt.Errorf("keymap %s: %w", name, err)
+			}
+		}
+	case removeListFile:
+		_, err := parseRemoveList(data)
+		return err
+	case policyFile:
+		_, err := parsePolicy(data)
+		return err
+	default:
+		if strings.HasSuffix(name, ".json") {
+			_, err := parseJSONC(data)
+			return err
+		}
+	}
+	return nil
+}
+
+// checkLines runs check on every entry of a line list file (blank lines and
+// # comments are skipped) and reports the first failing line
+func checkLines(data []byte, check func(string) error) error {
+	for n, l := range strings.Split(string(data), "\n") {
+		l = strings.TrimSpace(l)
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		if err := check(l); err != nil {
+			return fmt.Errorf("line %d: %w", n+1, err)
+		}
+	}
+	return nil
+}
+
+// decodeJSONC decodes JSONC into v the way the payload's consumers read
+// it: unknown keys ($schema, keys of newer releases) are ignored
+func decodeJSONC(data []byte, v interface{}) error {
+	return jsonErrorAt(data, json.Unmarshal(stripJSONC(data), v))
+}
@@ -0,0 +1,149 @@
+// payloadversion.go
+//
+// Payload versions. manifest.json may carry a "version" (e.g. "12"); without
+// one the payload is identified by its content hash. Every apply run records
+// the version together with a fingerprint of the payload (settings keys with
+// a hash of their values, the extension list), so a later run can say
+//
+//   payload v12 already applied on 2024-05-01, nothing to do
+//
+// and stop early (unless --force), or list what changed since the payload
+// that was applied last.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// payloadVersion is the manifest version, "" when the payload has none
+func (i *Installer) payloadVersion() string {
+	return i.manifest.Version
+}
+
+// payloadLabel names a payload for messages: "v12" or its short hash
+func payloadLabel(version, hash string) string {
+	if version != "" {
+		return "v" + version
+	}
+	return shortHash(hash)
+}
+
+// payloadKeys maps every top-level settings key of the payload to a short
+// hash of its value
+func (i *Installer) payloadKeys() map[string]string {
+	res := make(map[string]string)
+	// resolved secrets are hashed as their placeholders, never as values
+	v, err := parseJSONC(i.unresolveSecrets(i.settingsData))
+	obj, ok := v.(map[string]interface{})
+	if err != nil || !ok {
+		return res
+	}
+	for k, val := range obj {
+		b, _ := json.Marshal(val)
+		sum := sha256.Sum256(b)
+		res[k] = hex.EncodeToString(sum[:8])
+	}
+	return res
+}
+
+// payloadExtensions is the extension list as recorded in the state file
+func (i *Installer) payloadExtensions() []string {
+	var res []string
+	for _, s := range i.extList {
+		res = append(res, s.String())
+	}
+	return res
+}
+
+// payloadChanges lists the settings keys and extensions that differ between
+// the payload applied in rec and the current one, as "+ x" / "- x" / "~ x"
+func (i *Installer) payloadChanges(rec RunRecord) []string {
+	var res []string
+	cur := i.payloadKeys()
+	for _, k := range sortedStringKeys(cur) {
+		old, ok := rec.PayloadKeys[k]
+		switch {
+		case !ok:
+			res = append(res, "+ "+k)
+		case old != cur[k]:
+			res = append(res, "~ "+k)
+		}
+	}
+	for _, k := range sortedStringKeys(rec.PayloadKeys) {
+		if _, ok := cur[k]; !ok {
+			res = append(res, "- "+k)
+		}
+	}
+
+	exts := i.payloadExtensions()
+	var added, removed []string
+	for _, e := range exts {
+		if !containsString(rec.PayloadExtensions, e) {
+			added = append(added, e)
+		}
+	}
+	for _, e := range rec.PayloadExtensions {
+		if !containsString(exts, e) {
+			removed = append(removed, e)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	for _, e := range added {
+		res = append(res, "+ extension "+e)
+	}
+	for _, e := range removed {
+		res = append(res, "- extension "+e)
+	}
+	return res
+}
+
+// reportPayloadState logs whether this payload is already applied according
+// to the state file and, if it changed since, what changed. It returns true
+// when there is nothing to do.
+func (i *Installer) reportPayloadState() bool {
+	ok, why := i.upToDateFromState()
+	label := payloadLabel(i.payloadVersion(), i.payloadHash())
+	if ok {
+		st, _ := i.loadState()
+		rec, _ := st.lastRun(i.vscodeUser)
+		i.logf("Payload %s already applied on %s, nothing to do", label, rec.Time.Local().Format(time.DateOnly))
+		return true
+	}
+	i.logToFile("State: %s", why)
+
+	st, err := i.loadState()
+	if err != nil {
+		return false
+	}
+	rec, found := st.lastRun(i.vscodeUser)
+	if !found || rec.PayloadHash == i.payloadHash() || rec.PayloadKeys == nil {
+		return false
+	}
+	changes := i.payloadChanges(rec)
+	if len(changes) == 0 {
+		return false
+	}
+	if prev := payloadLabel(rec.PayloadVersion, rec.PayloadHash); prev != label {
+		label = prev + " → " + label
+	}
+	i.logf("Payload %s changed since the last apply (%s):", label, rec.Time.Local().Format(time.DateOnly))
+	for _, c := range changes {
+		i.logf("  %s", c)
+	}
+	return false
+}
+
+func sortedStringKeys(m map[string]string) []string {
+	res := make([]string, 0, len(m))
+	for k := range m {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
@@ -0,0 +1,156 @@
+// plan.go
+//
+// `plan` subcommand: what `apply --yes` would change, Terraform style.
+// Every file write (with its diff) and every extension install, reinstall
+// or removal is listed with +/~/- markers, followed by the totals. Nothing
+// is written and nothing is asked, so the output can be pasted into a PR or
+// ticket for review before the real run.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pterm/pterm"
+)
+
+// plan actions
+const (
+	planAdd    = "+"
+	planChange = "~"
+	planRemove = "-"
+)
+
+// planItem is one change the apply run would make
+type planItem struct {
+	Action string // planAdd, planChange or planRemove
+	What   string // "file" or "extension"
+	Name   string
+	Detail string
+	Diff   string // unified diff for files
+}
+
+func runPlan(args []string) error {
+	fs, opts := newCommandFlags("plan")
+	noDiff := fs.Bool("no-diff", false, "List changed files without their diffs")
+	fs.Parse(args)
+
+	inst, err := openInstaller(opts)
+	if err != nil {
+		return err
+	}
+	defer inst.Close()
+
+	items, err := inst.plan()
+	if err != nil {
+		return err
+	}
+	printPlan(items, !*noDiff)
+	return nil
+}
+
+// plan computes the changes of a non-interactive apply
+func (i *Installer) plan() ([]planItem, error) {
+	var items []planItem
+	for _, f := range []struct {
+		name string
+		data []byte
+	}{{settingsFile, i.settingsData}, {keybindingsFile, i.keybindData}} {
+		if len(f.data) == 0 {
+			continue
+		}
+		dst := filepath.Join(i.vscodeUser, f.name)
+		want := i.desiredContent(f.name, f.data, false)
+		if f.name == settingsFile {
+			want = i.enforcedSettings(want)
+		}
+		cur, err := os.ReadFile(dst)
+		switch {
+		case os.IsNotExist(err):
+			items = append(items, planItem{Action: planAdd, What: "file", Name: f.name, Detail: "create " + dst})
+		case err != nil:
+			return nil, fmt.Errorf("cannot read %s: %w", dst, err)
+		case !sameContent(dst, want):
+			d := i.redactSecrets(unifiedDiff("current/"+f.name, "payload/"+f.name, string(cur), string(want)))
+			items = append(items, planItem{Action: planChange, What: "file", Name: f.name, Detail: "update " + dst + " " + diffStat(d), Diff: d})
+		}
+	}
+
+	if err := i.ensureCodeCLI(); err != nil {
+		return nil, fmt.Errorf("code CLI not found: %w", err)
+	}
+	installed, err := i.installedExtensions()
+	if err != nil {
+		return nil, fmt.Errorf("cannot list installed extensions: %w", err)
+	}
+	for _, spec := range i.extList {
+		have := installedVersion(installed, spec.ID)
+		switch {
+		case have == "":
+			items = append(items, planItem{Action: planAdd, What: "extension", Name: spec.String(), Detail: "install"})
+		case spec.Version != "" && have != spec.Version:
+			items = append(items, planItem{Action: planChange, What: "extension", Name: spec.ID, Detail: have + " -> " + spec.Version + " (pinned)"})
+		}
+	}
+	for _, e := range installed {
+		if i.isBlocked(e.ID) {
+			items = append(items, planItem{Action: planRemove, What: "extension", Name: e.ID, Detail: "uninstall (blocked)"})
+		}
+	}
+	return items, nil
+}
+
+// diffStat summarizes a unified diff as "(+N -M lines)"
+func diffStat(d string) string {
+	add, del := 0, 0
+	for _, l := range strings.Split(d, "\n") {
+		switch {
+		case strings.HasPrefix(l, "+++"), strings.HasPrefix(l, "---"):
+		case strings.HasPrefix(l, "+"):
+			add++
+		case strings.HasPrefix(l, "-"):
+			del++
+		}
+	}
+	return fmt.Sprintf("(+%d -%d lines)", add, del)
+}
+
+// simulateWrite is the dry-run of writing data to dst: shows the diff
+// against the current file and records the write in the report
+func (i *Installer) simulateWrite(name, dst string, data []byte) {
+	cur, err := os.ReadFile(dst)
+	if err != nil && !os.IsNotExist(err) {
+		i.warnf("cannot read %s: %v", dst, err)
+	}
+	d := i.redactSecrets(unifiedDiff("current/"+name, "new/"+name, string(cur), string(data)))
+	i.logf("DRY-RUN: would write %s (%d bytes) %s", dst, len(data), diffStat(d))
+	printDiff(d)
+	i.report.Written = append(i.report.Written, name)
+}
+
+func printPlan(items []planItem, withDiff bool) {
+	if len(items) == 0 {
+		pterm.Success.Println("No changes. The config matches the payload.")
+		return
+	}
+	counts := map[string]int{}
+	for _, it := range items {
+		counts[it.Action]++
+		line := fmt.Sprintf("  %s %s %s: %s", it.Action, it.What, it.Name, it.Detail)
+		switch it.Action {
+		case planAdd:
+			pterm.FgGreen.Println(line)
+		case planRemove:
+			pterm.FgRed.Println(line)
+		default:
+			pterm.FgYellow.Println(line)
+		}
+		if withDiff && it.Diff != "" {
+			printDiff(it.Diff)
+		}
+	}
+	fmt.Printf("\nPlan: %d to add, %d to change, %d to remove.\n", counts[planAdd], counts[planChange], counts[planRemove])
+}
@@ -0,0 +1,108 @@
+// policy.go
+//
+// Locked settings (policy.json in the payload). The file maps settings
+// keys to mandated values, typically an organisation's security baseline
+// ("telemetry.telemetryLevel": "off"). Its keys join the mandatory
+// settings (see silent.go): they are enforced in settings.json on every
+// apply, --allow-keys and protected keys do not cover them, and
+// --mandatory-settings still wins per key.
+//
+// Unlike the rest of the payload a locked key is not the user's to
+// change: `verify` and --watch restore every locked key found changed and
+// report it as tampering (a warning and a POLICY line in the log; verify
+// lists it under policyViolations and exits non-zero).
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const policyFile = "policy.json"
+
+// parsePolicy decodes policy.json; an empty or comment-only file is no policy
+func parsePolicy(data []byte) (map[string]interface{}, error) {
+	if len(strings.TrimSpace(string(stripJSONC(data)))) == 0 {
+		return nil, nil
+	}
+	v, err := parseJSONC(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", policyFile, err)
+	}
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s must be a JSON object of settings", policyFile)
+	}
+	return obj, nil
+}
+
+// loadPolicy reads the locked settings from the payload source
+func (i *Installer) loadPolicy() (map[string]interface{}, error) {
+	data := embeddedPolicy
+	if !i.useEmbedded {
+		p := filepath.Join(i.baseDir, policyFile)
+		if !exists(p) {
+			return nil, nil
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read %s: %w", p, err)
+		}
+		data = b
+	}
+	return parsePolicy(data)
+}
+
+// policyViolations lists the locked keys whose live value differs from
+// the mandated one; other mandatory keys are not policy
+func (i *Installer) policyViolations() ([]keyDrift, error) {
+	if len(i.policyKeys) == 0 {
+		return nil, nil
+	}
+	dst := filepath.Join(i.vscodeUser, settingsFile)
+	data, err := os.ReadFile(dst)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	cur := map[string]interface{}{}
+	if len(strings.TrimSpace(string(stripJSONC(data)))) > 0 {
+		v, err := parseJSONC(data)
+		obj, ok := v.(map[string]interface{})
+		if err != nil || !ok {
+			return nil, fmt.Errorf("cannot parse %s to check the policy", dst)
+		}
+		cur = obj
+	}
+	var res []keyDrift
+	for k := range i.policyKeys {
+		want := i.mandatory[k]
+		if have, ok := cur[k]; !ok || !sameJSON(have, want) {
+			res = append(res, keyDrift{Key: k, Want: want, Have: have, Wanted: true, Present: ok})
+		}
+	}
+	sort.Slice(res, func(a, b int) bool { return res[a].Key < res[b].Key })
+	return res, nil
+}
+
+// enforcePolicy restores tampered locked keys and reports them; where says
+// who noticed (verify, watch)
+func (i *Installer) enforcePolicy(where string) ([]keyDrift, error) {
+	bad, err := i.policyViolations()
+	if err != nil || len(bad) == 0 {
+		return bad, err
+	}
+	for _, k := range bad {
+		have := "absent"
+		if k.Present {
+			have = fmt.Sprintf("%v", i.redactValue(k.Have))
+		}
+		want := i.redactValue(k.Want)
+		i.warnf("Policy: %s was changed (%s, mandated %v) — restoring", k.Key, have, want)
+		i.logToFile("POLICY %s: tampering with %s (have %s, want %v)", where, k.Key, have, want)
+	}
+	return bad, i.applyMandatorySettings()
+}
@@ -0,0 +1,113 @@
+// presets.go
+//
+// Named payload presets. Besides the default payload in data/ every
+// subfolder of data/ holding payload files (data/minimal/, data/work/, ...)
+// is embedded as a preset and can be chosen with --payload <name> or, in an
+// interactive apply, from a short menu. A preset replaces the whole default
+// payload: files it doesn't carry are simply not part of the run.
+
+package main
+
+import (
+	"bufio"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pterm/pterm"
+)
+
+//go:embed data
+var embeddedData embed.FS
+
+const presetsRoot = "data"
+
+// embeddedPresets lists the embedded preset names in sorted order; the
+// default payload's own folders (workspace/, settings.d/, templates/ ...)
+// are not presets even when they hold a settings.json
+func embeddedPresets() []string {
+	entries, err := fs.ReadDir(embeddedData, presetsRoot)
+	if err != nil {
+		return nil
+	}
+	var res []string
+	for _, e := range entries {
+		if !e.IsDir() || containsString(payloadDirs, e.Name()) || e.Name() == templatesDir {
+			continue
+		}
+		for name := range packTargets() {
+			if _, err := fs.Stat(embeddedData, path.Join(presetsRoot, e.Name(), name)); err == nil {
+				res = append(res, e.Name())
+				break
+			}
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// usePreset makes the named preset the embedded payload
+func (i *Installer) usePreset(name string) error {
+	if i.srcOverride != "" {
+		return fmt.Errorf("--payload %s cannot be combined with --src", name)
+	}
+	if !containsString(embeddedPresets(), name) {
+		return fmt.Errorf("unknown payload preset %q (available: %s)", name, orDash(strings.Join(embeddedPresets(), ", ")))
+	}
+	files := presetFiles(name)
+	for file, dst := range packTargets() {
+		*dst = files[file]
+	}
+	embeddedDirFS, embeddedDirRoot, embeddedDirFiles = embeddedData, path.Join(presetsRoot, name), nil
+	i.useEmbedded = true
+	i.preset = name
+	i.logToFile("Using embedded payload preset %q", name)
+	return nil
+}
+
+// presetFiles returns the payload files of an embedded preset
+func presetFiles(name string) map[string][]byte {
+	res := make(map[string][]byte)
+	for file := range packTargets() {
+		if b, err := embeddedData.ReadFile(path.Join(presetsRoot, name, file)); err == nil {
+			res[file] = b
+		}
+	}
+	return res
+}
+
+// choosePreset asks which embedded preset to apply when the binary carries
+// any and none was given on the command line
+func (i *Installer) choosePreset(reader *bufio.Reader) error {
+	presets := embeddedPresets()
+	if i.preset != "" || i.srcOverride != "" || i.assumeYes || len(presets) == 0 {
+		return nil
+	}
+	fmt.Println("Встроенные наборы настроек:")
+	fmt.Println("    0) default")
+	for idx, p := range presets {
+		fmt.Printf("  %3d) %s\n", idx+1, p)
+	}
+	for {
+		fmt.Print("Выберите набор (номер или имя) [0]: ")
+		txt, err := reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		txt = strings.TrimSpace(txt)
+		if txt == "" || txt == "0" || txt == "default" {
+			return nil
+		}
+		if n, err := strconv.Atoi(txt); err == nil && n >= 1 && n <= len(presets) {
+			txt = presets[n-1]
+		}
+		if containsString(presets, txt) {
+			return i.usePreset(txt)
+		}
+		pterm.Warning.Printf("Нет такого набора: %s\n", txt)
+	}
+}
@@ -0,0 +1,164 @@
+// profilekeys.go
+//
+// Keybinding variants for VS Code profiles. The payload's keybindings.json
+// is applied to the default profile; a profile named in the manifest's
+// "profileKeybindings" gets its own variant of it, written to the profile's
+// folder (profiles/<location>/keybindings.json):
+//
+//   "profileKeybindings": {
+//     "Writing": {
+//       "exclude": ["editor.action.goTo*", "workbench.action.gotoSymbol", "f12"],
+//       "add": [{"key": "ctrl+alt+w", "command": "workbench.action.toggleZenMode"}]
+//     }
+//   }
+//
+// exclude drops the payload's bindings by command or key (globs allowed),
+// add appends bindings of the profile's own. Profiles are looked up by name
+// in globalStorage/storage.json; one that shares the default profile's
+// keybindings ("use default" in the profile editor) cannot have a variant
+// and is only warned about. Profiles the manifest does not name are left as
+// they are. With --keybindings-mode append the variant is merged with the
+// profile's own bindings as keybindings.go does for the default profile,
+// each profile with its own merge base.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// ProfileKeybindings is the keybinding variant of one profile
+type ProfileKeybindings struct {
+	Exclude []string          `json:"exclude,omitempty"`
+	Add     []json.RawMessage `json:"add,omitempty"`
+}
+
+// vscodeProfile is one entry of the profile registry in storage.json
+type vscodeProfile struct {
+	Name            string          `json:"name"`
+	Location        string          `json:"location"`
+	UseDefaultFlags map[string]bool `json:"useDefaultFlags,omitempty"`
+}
+
+// readProfiles lists the profiles registered in storage.json
+func (i *Installer) readProfiles() ([]vscodeProfile, error) {
+	b, err := os.ReadFile(filepath.Join(i.vscodeUser, filepath.FromSlash(profileStorageFile)))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var storage struct {
+		Profiles []vscodeProfile `json:"userDataProfiles"`
+	}
+	if err := json.Unmarshal(b, &storage); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", profileStorageFile, err)
+	}
+	return storage.Profiles, nil
+}
+
+// keybindingVariant derives a profile's keybindings.json from the payload's
+func keybindingVariant(data []byte, v ProfileKeybindings) ([]byte, error) {
+	header, list, err := parseKeybindings(data)
+	if err != nil {
+		return nil, err
+	}
+	var kept []keybinding
+	for _, b := range list {
+		if !matchesBinding(b, v.Exclude) {
+			kept = append(kept, b)
+		}
+	}
+	out := formatKeybindings(header, kept)
+	if len(v.Add) > 0 {
+		return appendJSONCArray(out, v.Add)
+	}
+	return out, nil
+}
+
+// applyProfileKeybindings writes the manifest's keybinding variants into
+// their profiles
+func (i *Installer) applyProfileKeybindings() error {
+	variants := i.manifest.ProfileKeybindings
+	if len(variants) == 0 || len(i.keybindData) == 0 {
+		return nil
+	}
+	profiles, err := i.readProfiles()
+	if err != nil {
+		return err
+	}
+	byName := make(map[string]vscodeProfile, len(profiles))
+	for _, p := range profiles {
+		byName[p.Name] = p
+	}
+	names := make([]string, 0, len(variants))
+	for name := range variants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p, ok := byName[name]
+		switch {
+		case !ok:
+			i.logToFile("profile %s not found, keybinding variant skipped", name)
+			continue
+		case p.UseDefaultFlags["keybindings"]:
+			i.warnf("profile %s uses the default profile's keybindings — its variant cannot be applied", name)
+			continue
+		case p.Location == "" || filepath.Base(p.Location) != p.Location:
+			i.warnf("profile %s: unexpected location %q, skipped", name, p.Location)
+			continue
+		}
+		data, err := keybindingVariant(i.keybindData, variants[name])
+		if err != nil {
+			return fmt.Errorf("profile %s: %w", name, err)
+		}
+		dst := filepath.Join(i.vscodeUser, "profiles", p.Location, keybindingsFile)
+		applied := filepath.Join("profiles", p.Location, keybindingsFile)
+		variant := data
+		if i.bindingsMode == keybindingsAppend {
+			data = i.appendProfileKeybindings(name, dst, applied, variant)
+		}
+		if sameContent(dst, data) {
+			i.logf("profile %s: %s already up to date", name, keybindingsFile)
+			i.rememberApplied(applied, variant)
+			continue
+		}
+		if i.dryRun {
+			i.logf("DRY-RUN: would write %s for profile %s", dst, name)
+			continue
+		}
+		if err := i.safeWrite(dst, data); err != nil {
+			return fmt.Errorf("profile %s: cannot write %s: %w", name, dst, err)
+		}
+		i.rememberApplied(applied, variant)
+		i.logf("Applied %s variant -> profile %s (%s)", keybindingsFile, name, dst)
+	}
+	return nil
+}
+
+// appendProfileKeybindings merges a profile's variant with the bindings
+// already in the profile (append mode); applied names its merge base
+func (i *Installer) appendProfileKeybindings(name, dst, applied string, variant []byte) []byte {
+	live, err := os.ReadFile(dst)
+	if err != nil {
+		return variant
+	}
+	base, err := os.ReadFile(i.appliedPath(applied))
+	if err != nil {
+		base = nil
+	}
+	resolve, _ := i.keyConflictResolver(false)
+	out, kept, err := mergeKeybindings(base, live, variant, resolve)
+	if err != nil {
+		i.warnf("profile %s: cannot append to %s (%v) — overwriting instead", name, keybindingsFile, err)
+		return variant
+	}
+	i.logToFile("profile %s: variant bindings added, %d of the profile's bindings kept", name, kept)
+	return out
+}
@@ -0,0 +1,181 @@
+// pulsar.go
+//
+// Pulsar, and Atom where it is still around (--pulsar). The payload's
+// pulsar/ folder holds
+//
+//   config.cson, keymap.cson, snippets.cson, styles.less, init.js,
+//   init.coffee     written to the editor's home folder
+//   packages.txt    community packages, one per line as name or
+//                   name@version (# starts a comment), the format of
+//                   `ppm install --packages-file`
+//
+// The home folder is $ATOM_HOME when set, else ~/.pulsar — or ~/.atom when
+// only Atom's apm is found. Packages missing from `ppm list --installed`
+// (or installed at another version than pinned) are installed with one
+// `ppm install` call; packages installed by hand are left alone.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	pulsarDir            = "pulsar"
+	pulsarPackages       = "packages.txt"
+	pulsarListTimeout    = 2 * time.Minute
+	pulsarInstallTimeout = 15 * time.Minute
+)
+
+// pulsarHomeFiles are the payload files written to the editor's home folder
+var pulsarHomeFiles = []string{"config.cson", "keymap.cson", "snippets.cson", "styles.less", "init.js", "init.coffee"}
+
+// pulsarTarget returns the editor's home folder and its package manager
+// (ppm, or apm for Atom); the manager is "" when none is found
+func pulsarTarget(home string) (string, string) {
+	ppm, _ := exec.LookPath("ppm")
+	apm, _ := exec.LookPath("apm")
+	dir, cli := filepath.Join(home, ".pulsar"), ppm
+	if ppm == "" && (apm != "" || exists(filepath.Join(home, ".atom"))) && !exists(dir) {
+		dir, cli = filepath.Join(home, ".atom"), apm
+	}
+	if env := os.Getenv("ATOM_HOME"); env != "" {
+		dir = env
+	}
+	return dir, cli
+}
+
+// parsePulsarPackages reads a packages.txt; a name starting with - would
+// reach ppm as an option and is refused
+func parsePulsarPackages(data []byte) ([]extensionSpec, error) {
+	var res []extensionSpec
+	for n, line := range strings.Split(string(data), "\n") {
+		if k := strings.Index(line, "#"); k >= 0 {
+			line = line[:k]
+		}
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		name, version, _ := strings.Cut(line, "@")
+		if name == "" || strings.HasPrefix(name, "-") || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("%s/%s: line %d: invalid package name %q", pulsarDir, pulsarPackages, n+1, name)
+		}
+		res = append(res, extensionSpec{ID: name, Version: version})
+	}
+	return res, nil
+}
+
+// pulsarInstalled lists the installed community packages by name
+func pulsarInstalled(cli string) (map[string]string, error) {
+	out, err := runCommandWithTimeout(pulsarListTimeout, cli, "list", "--installed", "--bare")
+	if err != nil {
+		return nil, fmt.Errorf("%s list failed: %v: %s", filepath.Base(cli), err, strings.TrimSpace(out))
+	}
+	res := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		if name, version, ok := strings.Cut(strings.TrimSpace(line), "@"); ok && name != "" {
+			res[name] = version
+		}
+	}
+	return res, nil
+}
+
+// applyPulsar deploys the payload's pulsar/ folder
+func (i *Installer) applyPulsar() error {
+	files, err := i.backendFiles(pulsarDir)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("the payload has no %s/ folder", pulsarDir)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	dir, cli := pulsarTarget(home)
+	i.logf("Pulsar home folder: %s", dir)
+
+	var errs []error
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		switch {
+		case name == pulsarPackages:
+			continue
+		case !containsString(pulsarHomeFiles, name):
+			i.warnf("%s/%s is not a Pulsar payload file — skipped", pulsarDir, name)
+			continue
+		}
+		if err := i.deployFile("pulsar:"+name, filepath.Join(dir, name), files[name]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if b, ok := files[pulsarPackages]; ok {
+		if want, err := parsePulsarPackages(b); err != nil {
+			errs = append(errs, err)
+		} else if err := i.installPulsarPackages(cli, want); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// installPulsarPackages installs the packages of want that are missing
+func (i *Installer) installPulsarPackages(cli string, want []extensionSpec) error {
+	if len(want) == 0 {
+		return nil
+	}
+	if cli == "" {
+		if i.dryRun {
+			i.warnf("ppm not found — the %d package(s) could not be checked", len(want))
+			return nil
+		}
+		return fmt.Errorf("ppm (or apm) not found — %d package(s) not installed", len(want))
+	}
+	installed, err := pulsarInstalled(cli)
+	if err != nil {
+		return err
+	}
+	var missing []string
+	for _, p := range want {
+		v, ok := installed[p.ID]
+		if ok && (p.Version == "" || v == p.Version) {
+			i.report.Skipped = append(i.report.Skipped, "pulsar:"+p.ID)
+			continue
+		}
+		missing = append(missing, p.String())
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	if i.dryRun {
+		i.logf("DRY-RUN: would run %s install %s", filepath.Base(cli), strings.Join(missing, " "))
+		for _, m := range missing {
+			i.report.Installed = append(i.report.Installed, "pulsar:"+m)
+		}
+		return nil
+	}
+	i.logf("Installing %d Pulsar package(s): %s", len(missing), strings.Join(missing, ", "))
+	out, err := runCommandWithTimeout(pulsarInstallTimeout, cli, append([]string{"install"}, missing...)...)
+	if err != nil {
+		for _, m := range missing {
+			i.report.Failed = append(i.report.Failed, "pulsar:"+m)
+		}
+		return fmt.Errorf("%s install failed: %v: %s", filepath.Base(cli), err, strings.TrimSpace(out))
+	}
+	for _, m := range missing {
+		i.report.Installed = append(i.report.Installed, "pulsar:"+m)
+	}
+	return nil
+}
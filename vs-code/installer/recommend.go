@@ -0,0 +1,155 @@
+// recommend.go
+//
+// `recommend [<dir>...]` advertises the payload's extension set in team
+// projects: the extension ids are merged into the "recommendations" of each
+// project's .vscode/extensions.json, so VS Code offers them to anyone who
+// opens the folder. Without arguments the projects come from the manifest:
+//
+//   "projects": ["~/work/backend", "~/work/frontend/*"]
+//
+// (~ is the home directory, globs pick several folders). Recommendations
+// already listed stay in their order, the payload's missing ones are added
+// after them; ids in the file's "unwantedRecommendations" and blocked ones
+// (blocked.txt) are not added. The rest of the file (comments, other keys)
+// is kept.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pterm/pterm"
+)
+
+const projectExtensionsFile = ".vscode/extensions.json"
+
+func runRecommend(args []string) error {
+	fs, opts := newCommandFlags("recommend")
+	dirs := parseInterspersed(fs, args)
+
+	inst, err := openInstaller(opts)
+	if err != nil {
+		return err
+	}
+	defer inst.Close()
+	if len(dirs) == 0 {
+		if dirs, err = inst.projectDirs(); err != nil {
+			return err
+		}
+	}
+	if len(dirs) == 0 {
+		return fmt.Errorf("no projects given and none in the manifest's \"projects\"")
+	}
+	failed := 0
+	for _, dir := range dirs {
+		if err := inst.recommendExtensions(dir); err != nil {
+			inst.errorf("%s: %v", dir, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d projects failed", failed, len(dirs))
+	}
+	return nil
+}
+
+// projectDirs expands the manifest's project list
+func (i *Installer) projectDirs() ([]string, error) {
+	var res []string
+	for _, p := range i.manifest.Projects {
+		p = i.expandHome(p)
+		matches, err := filepath.Glob(p)
+		if err != nil {
+			return nil, fmt.Errorf("bad project pattern %q: %w", p, err)
+		}
+		if len(matches) == 0 {
+			i.warnf("project %s not found", p)
+		}
+		for _, m := range matches {
+			if st, err := os.Stat(m); err == nil && st.IsDir() {
+				res = append(res, m)
+			}
+		}
+	}
+	return res, nil
+}
+
+// mergeRecommendations adds ids to .vscode/extensions.json data and returns
+// the new data with the ids added
+func mergeRecommendations(data []byte, ids []string, skip func(string) bool) ([]byte, []string, error) {
+	var have, unwanted []string
+	if len(strings.TrimSpace(string(stripJSONC(data)))) > 0 {
+		v, err := parseJSONC(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, nil, fmt.Errorf("not a JSON object")
+		}
+		have = stringList(obj["recommendations"])
+		unwanted = stringList(obj["unwantedRecommendations"])
+	}
+	list := append([]string{}, have...)
+	var added []string
+	for _, id := range ids {
+		if installedContains(list, id) || installedContains(unwanted, id) || skip(id) {
+			continue
+		}
+		list = append(list, id)
+		added = append(added, id)
+	}
+	if len(added) == 0 {
+		return data, nil, nil
+	}
+	out, err := jsoncSet(data, "recommendations", encodeJSONValue(list, "  "))
+	return out, added, err
+}
+
+// stringList returns the strings of a decoded JSON array
+func stringList(v interface{}) []string {
+	var res []string
+	arr, _ := v.([]interface{})
+	for _, e := range arr {
+		if s, ok := e.(string); ok {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+// recommendExtensions merges the payload's extensions into one project
+func (i *Installer) recommendExtensions(dir string) error {
+	if st, err := os.Stat(dir); err != nil || !st.IsDir() {
+		return fmt.Errorf("not a directory")
+	}
+	ids := make([]string, 0, len(i.extList))
+	for _, e := range i.extList {
+		ids = append(ids, e.ID)
+	}
+	dst := filepath.Join(dir, filepath.FromSlash(projectExtensionsFile))
+	data, err := os.ReadFile(dst)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	out, added, err := mergeRecommendations(data, ids, i.isBlocked)
+	if err != nil {
+		return fmt.Errorf("%s: %w", dst, err)
+	}
+	if len(added) == 0 {
+		pterm.Success.Printf("%s: recommendations up to date\n", dst)
+		return nil
+	}
+	if i.dryRun {
+		i.logf("DRY-RUN: would add %d recommendations to %s: %s", len(added), dst, strings.Join(added, ", "))
+		return nil
+	}
+	if err := writeBytes(dst, out); err != nil {
+		return fmt.Errorf("cannot write %s: %w", dst, err)
+	}
+	i.logf("%s: %d recommendations added (%s)", dst, len(added), strings.Join(added, ", "))
+	return nil
+}
@@ -0,0 +1,215 @@
+// remote.go
+//
+// Remote-SSH hosts (--remote user@host[,user@host2]). VS Code Server keeps
+// its own config and extensions under ~/.vscode-server on the remote box,
+// so a local apply does not reach it. For every host the prepared payload
+// is copied over ssh:
+//
+//   - settings.json becomes the server's Machine settings
+//     (~/.vscode-server/data/Machine/settings.json), the previous file is
+//     kept as settings.json.backup_<ts> unless --no-backup
+//   - the extension list is installed with the server's own CLI
+//     (code-server --install-extension), skipping what is already there
+//
+// keybindings.json is not copied: keybindings always come from the client.
+// ssh runs in batch mode, so hosts must accept key authentication; a host
+// that fails is reported and the next one is tried. The server is only
+// present after the host was opened once from VS Code.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	remoteServerDir      = ".vscode-server"
+	remoteMachineSetting = remoteServerDir + "/data/Machine/" + settingsFile
+	sshTimeout           = 60 * time.Second
+	remoteInstallTimeout = 15 * time.Minute
+)
+
+// remoteServerCLI locates the newest VS Code Server CLI on the host
+// (legacy bin/<commit> layout and the newer cli/servers/ one)
+const remoteServerCLI = `srv=$(ls -t ~/` + remoteServerDir + `/bin/*/bin/code-server ~/` + remoteServerDir + `/cli/servers/*/server/bin/code-server 2>/dev/null | head -n 1)
+[ -n "$srv" ] || { echo "VS Code Server not found in ~/` + remoteServerDir + ` (connect once with Remote-SSH first)" >&2; exit 3; }
+`
+
+// parseRemoteHosts splits the --remote list
+func parseRemoteHosts(s string) []string {
+	var res []string
+	for _, h := range strings.Split(s, ",") {
+		if h = strings.TrimSpace(h); h != "" && !containsString(res, h) {
+			res = append(res, h)
+		}
+	}
+	return res
+}
+
+// checkSSHHost rejects host names ssh would take for options or that
+// cannot be a destination
+func checkSSHHost(host string) error {
+	switch {
+	case host == "":
+		return errors.New("empty host")
+	case strings.HasPrefix(host, "-"):
+		return fmt.Errorf("invalid host %q: starts with -", host)
+	case strings.IndexFunc(host, func(r rune) bool { return r <= ' ' || r == 0x7f }) >= 0:
+		return fmt.Errorf("invalid host %q: contains spaces or control characters", host)
+	}
+	return nil
+}
+
+// shellQuote quotes s for a POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// sshRun runs script with sh on host, feeding it stdin, and returns its
+// stdout; stderr (ssh's or the script's) becomes the error message
+func sshRun(timeout time.Duration, host, script string, stdin []byte) (string, error) {
+	if err := checkSSHHost(host); err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "ssh", "-o", "BatchMode=yes", "-o", "ConnectTimeout=10", "--", host, "sh -c "+shellQuote(script))
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return stdout.String(), errors.New(msg)
+		}
+		return stdout.String(), err
+	}
+	return stdout.String(), nil
+}
+
+// applyRemote provisions every host of the --remote list
+func (i *Installer) applyRemote(list string) error {
+	hosts := parseRemoteHosts(list)
+	if len(hosts) == 0 {
+		return errors.New("--remote: no hosts given")
+	}
+	for _, host := range hosts {
+		if err := checkSSHHost(host); err != nil {
+			return fmt.Errorf("--remote: %w", err)
+		}
+	}
+	if _, err := exec.LookPath("ssh"); err != nil {
+		return errors.New("ssh not found in PATH")
+	}
+	failed := 0
+	for _, host := range hosts {
+		i.logf("Remote %s: provisioning VS Code Server", host)
+		if err := i.applyRemoteSettings(host); err != nil {
+			i.errorf("Remote %s: settings not applied: %v", host, err)
+			i.fail(exitConfig)
+			failed++
+			continue
+		}
+		if err := i.installRemoteExtensions(host); err != nil {
+			i.errorf("Remote %s: %v", host, err)
+			i.fail(exitExtensions)
+			failed++
+		}
+	}
+	i.printSummary()
+	if failed > 0 {
+		return fmt.Errorf("%d of %d hosts failed", failed, len(hosts))
+	}
+	return nil
+}
+
+// applyRemoteSettings writes the payload's settings.json as the host's
+// Machine settings unless they already match
+func (i *Installer) applyRemoteSettings(host string) error {
+	if len(i.settingsData) == 0 {
+		i.warnf("%s payload is empty — skipped", settingsFile)
+		return nil
+	}
+	item := host + ":" + settingsFile
+	cur, err := sshRun(sshTimeout, host, `cat ~/`+remoteMachineSetting+` 2>/dev/null || true`, nil)
+	if err != nil {
+		return err
+	}
+	if cur == string(i.settingsData) {
+		i.logf("Remote %s: %s already up to date", host, settingsFile)
+		i.report.UpToDate = append(i.report.UpToDate, item)
+		return nil
+	}
+	if i.dryRun {
+		i.logf("DRY-RUN: would write %s:~/%s (%d bytes)", host, remoteMachineSetting, len(i.settingsData))
+		return nil
+	}
+	dst := "~/" + remoteMachineSetting
+	script := `mkdir -p "$(dirname ` + dst + `)"` + "\n"
+	if !i.skipBackup {
+		ts := time.Now().Format("2006-01-02_15-04-05")
+		script += `[ -f ` + dst + ` ] && cp ` + dst + ` ` + dst + `.` + backupPrefix + ts + "\n"
+	}
+	script += `cat > ` + dst + ".tmp && mv " + dst + ".tmp " + dst + "\n"
+	if _, err := sshRun(sshTimeout, host, script, i.settingsData); err != nil {
+		return err
+	}
+	i.report.Written = append(i.report.Written, item)
+	i.logf("Applied %s -> %s:~/%s", settingsFile, host, remoteMachineSetting)
+	return nil
+}
+
+// installRemoteExtensions installs the missing extensions with the
+// server's CLI in one call
+func (i *Installer) installRemoteExtensions(host string) error {
+	if len(i.extList) == 0 {
+		return nil
+	}
+	out, err := sshRun(sshTimeout, host, remoteServerCLI+`"$srv" --list-extensions --show-versions`, nil)
+	if err != nil {
+		return err
+	}
+	var installed []installedExtension
+	for _, l := range strings.Split(out, "\n") {
+		if t := strings.TrimSpace(l); t != "" {
+			id, ver, _ := strings.Cut(t, "@")
+			installed = append(installed, installedExtension{ID: id, Version: ver})
+		}
+	}
+	var args []string
+	var pending []extensionSpec
+	for _, ext := range i.extList {
+		if have := installedVersion(installed, ext.ID); have != "" && (ext.Version == "" || have == ext.Version) {
+			i.report.Skipped = append(i.report.Skipped, host+":"+ext.ID)
+			continue
+		}
+		pending = append(pending, ext)
+		args = append(args, "--install-extension", shellQuote(ext.String()))
+	}
+	if len(pending) == 0 {
+		i.logf("Remote %s: all %d extensions already installed", host, len(i.extList))
+		return nil
+	}
+	if i.dryRun {
+		i.logf("DRY-RUN: would install on %s: %d extensions", host, len(pending))
+		return nil
+	}
+	i.logf("Remote %s: installing %d extensions", host, len(pending))
+	out, err = sshRun(remoteInstallTimeout, host, remoteServerCLI+`"$srv" `+strings.Join(args, " ")+` --force`, nil)
+	i.logToFile("Remote %s install output:\n%s", host, out)
+	if err != nil {
+		for _, ext := range pending {
+			i.report.Failed = append(i.report.Failed, host+":"+ext.ID)
+		}
+		return fmt.Errorf("extension install failed: %w", err)
+	}
+	for _, ext := range pending {
+		i.report.Installed = append(i.report.Installed, host+":"+ext.ID)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+// removals.go
+//
+// Key deletion directives (settings.remove.json, embedded or from --src): a
+// JSON array of settings keys or glob patterns ("python.jediEnabled",
+// "someOldExtension.*"). Matching keys are deleted from the user's
+// settings.json on every apply and watch reconcile, so obsolete or harmful
+// settings are cleaned up even with --merge, which otherwise keeps the
+// user's own keys. Keys the payload (or --set, or the mandatory settings)
+// sets and protected keys (localconfig.go) are never removed; the rest of
+// the file is left as it is.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const removeListFile = "settings.remove.json"
+
+// parseRemoveList decodes settings.remove.json
+func parseRemoveList(data []byte) ([]string, error) {
+	if len(strings.TrimSpace(string(stripJSONC(data)))) == 0 {
+		return nil, nil
+	}
+	v, err := parseJSONC(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", removeListFile, err)
+	}
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s must be a JSON array of keys", removeListFile)
+	}
+	var res []string
+	for _, e := range list {
+		s, ok := e.(string)
+		if !ok || strings.TrimSpace(s) == "" {
+			return nil, fmt.Errorf("%s: %v is not a key", removeListFile, e)
+		}
+		if _, err := path.Match(s, ""); err != nil {
+			return nil, fmt.Errorf("%s: bad pattern %q", removeListFile, s)
+		}
+		res = append(res, strings.TrimSpace(s))
+	}
+	return res, nil
+}
+
+// loadRemoveList reads the deletion directives from the payload source
+func (i *Installer) loadRemoveList() error {
+	data := embeddedRemoveList
+	if !i.useEmbedded {
+		p := filepath.Join(i.baseDir, removeListFile)
+		if !exists(p) {
+			return nil
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return fmt.Errorf("cannot read %s: %w", p, err)
+		}
+		data = b
+	}
+	list, err := parseRemoveList(data)
+	if err != nil {
+		return err
+	}
+	i.removeKeys = list
+	return nil
+}
+
+// isRemovedKey reports whether key is to be deleted from the user's settings
+func (i *Installer) isRemovedKey(key string) bool {
+	if i.isMandatoryKey(key) || i.isProtectedKey(key) {
+		return false
+	}
+	if _, ok := i.payloadKeys()[key]; ok {
+		return false
+	}
+	for _, p := range i.removeKeys {
+		if ok, _ := path.Match(p, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// applyRemovedSettings deletes the keys matched by settings.remove.json
+// from the user's settings.json
+func (i *Installer) applyRemovedSettings() error {
+	if len(i.removeKeys) == 0 {
+		return nil
+	}
+	dst := filepath.Join(i.vscodeUser, settingsFile)
+	data, err := os.ReadFile(dst)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	members, _, _, err := jsoncMembers(data)
+	if err != nil {
+		return fmt.Errorf("cannot parse %s to remove settings: %w", dst, err)
+	}
+	var keys []string
+	for _, m := range members {
+		if i.isRemovedKey(m.Key) && !containsString(keys, m.Key) {
+			keys = append(keys, m.Key)
+		}
+	}
+	if len(keys) == 0 {
+		i.logToFile("no settings to remove")
+		return nil
+	}
+	sort.Strings(keys)
+	if i.dryRun {
+		i.logf("DRY-RUN: would remove settings: %s", strings.Join(keys, ", "))
+		if !containsString(i.report.Written, settingsFile) {
+			i.report.Written = append(i.report.Written, settingsFile)
+		}
+		return nil
+	}
+	for _, k := range keys {
+		if data, _, err = jsoncDelete(data, k); err != nil {
+			return fmt.Errorf("cannot remove %s from %s: %w", k, dst, err)
+		}
+	}
+	if err := i.safeWrite(dst, i.formatSettings(data)); err != nil {
+		return fmt.Errorf("cannot write %s: %w", dst, err)
+	}
+	if !containsString(i.report.Written, settingsFile) {
+		i.report.Written = append(i.report.Written, settingsFile)
+	}
+	i.logf("Removed settings: %s", strings.Join(keys, ", "))
+	return nil
+}
@@ -0,0 +1,177 @@
+// report.go
+//
+// Run report: what happened to every extension and payload file during this run. Steps record
+// into Installer.report as they go; the summary table is printed at the end, and
+// --report <file> saves it as JSON (used by `fleet apply` to collect the hosts' results).
+// A --dry-run records what it would do and flags the document "simulated".
+// --report-url POSTs the same document to a webhook, with a bearer token from
+// --report-token-file or $HYPREDITORS_REPORT_TOKEN when one is set.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/user"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/pterm/pterm"
+)
+
+// reportTokenEnv holds the --report-url bearer token when no file is given
+const reportTokenEnv = "HYPREDITORS_REPORT_TOKEN"
+
+// runReport collects per-extension outcomes of a run
+type runReport struct {
+	Installed   []string `json:"installed,omitempty"`   // installed or updated
+	Skipped     []string `json:"skipped,omitempty"`     // already present
+	Failed      []string `json:"failed,omitempty"`      // gave up after retries
+	Blocked     []string `json:"blocked,omitempty"`     // listed but refused by the blocklist
+	Uninstalled []string `json:"uninstalled,omitempty"` // blocked extensions removed from the editor
+	Written     []string `json:"written,omitempty"`     // payload files written
+	UpToDate    []string `json:"upToDate,omitempty"`    // payload files already identical, not rewritten
+}
+
+// reportFile is the --report document: the run report plus where and how
+// the run ended
+type reportFile struct {
+	Host     string    `json:"host"`
+	User     string    `json:"user"`
+	Target   string    `json:"target"` // the editor's user dir
+	Payload  string    `json:"payload,omitempty"`
+	OS       string    `json:"os"`
+	Finished time.Time `json:"finished"`
+	ExitCode int       `json:"exitCode"`
+	// Simulated marks a --dry-run: the results are what the run would do
+	Simulated bool `json:"simulated,omitempty"`
+	runReport
+}
+
+func (r *runReport) empty() bool {
+	return len(r.Installed)+len(r.Skipped)+len(r.Failed)+len(r.Blocked)+len(r.Uninstalled)+len(r.Written)+len(r.UpToDate) == 0
+}
+
+// upToDate reports whether the run found nothing to change
+func (r *runReport) upToDate() bool {
+	return len(r.Installed)+len(r.Failed)+len(r.Uninstalled)+len(r.Written) == 0
+}
+
+// printSummary renders the report as a table and logs it
+func (i *Installer) printSummary() {
+	r := &i.report
+	if r.empty() {
+		return
+	}
+	rows := [][]string{{"Result", "Count", "Items"}}
+	for _, g := range []struct {
+		name string
+		ids  []string
+	}{
+		{"installed", r.Installed},
+		{"already installed", r.Skipped},
+		{"failed", r.Failed},
+		{"blocked", r.Blocked},
+		{"uninstalled (blocked)", r.Uninstalled},
+		{"files written", r.Written},
+		{"files up to date", r.UpToDate},
+	} {
+		if len(g.ids) == 0 {
+			continue
+		}
+		rows = append(rows, []string{g.name, pterm.Sprint(len(g.ids)), truncate(strings.Join(g.ids, ", "), 80)})
+		i.logToFile("summary: %s (%d): %s", g.name, len(g.ids), strings.Join(g.ids, ", "))
+	}
+	if i.dryRun {
+		pterm.DefaultSection.Println("Summary (simulated — nothing was changed)")
+	} else {
+		pterm.DefaultSection.Println("Summary")
+	}
+	pterm.DefaultTable.WithHasHeader().WithData(rows).Render()
+	if r.upToDate() {
+		i.logf("Already up to date — nothing changed.")
+	}
+}
+
+// writeReport saves the report with the run's exit code as JSON to path
+func (i *Installer) writeReport(path string) {
+	if path == "" {
+		return
+	}
+	b, err := json.MarshalIndent(i.reportDoc(), "", "  ")
+	if err == nil {
+		err = writeBytes(path, append(b, '\n'))
+	}
+	if err != nil {
+		i.errorf("cannot write report %s: %v", path, err)
+	}
+}
+
+// reportDoc builds the --report / --report-url document of this run
+func (i *Installer) reportDoc() reportFile {
+	host, _ := os.Hostname()
+	name := os.Getenv("USER")
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	return reportFile{Host: host, User: name, Target: i.vscodeUser, Payload: i.manifest.Version,
+		OS: runtime.GOOS + "/" + runtime.GOARCH, Finished: time.Now().UTC(), ExitCode: i.failureStatus(), Simulated: i.dryRun, runReport: i.report}
+}
+
+// postReport sends the run report to the --report-url webhook. A failed
+// delivery is a warning: the run itself is not affected.
+func (i *Installer) postReport(url, tokenFile string) {
+	if url == "" {
+		return
+	}
+	token, err := reportToken(tokenFile)
+	if err == nil {
+		err = i.postJSON(url, token, i.reportDoc())
+	}
+	if err != nil {
+		i.warnf("cannot send report to %s: %v", url, err)
+		return
+	}
+	i.logToFile("Report sent to %s", url)
+}
+
+// reportToken reads the webhook bearer token: the file, else the environment
+func reportToken(file string) (string, error) {
+	if file == "" {
+		return os.Getenv(reportTokenEnv), nil
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("cannot read report token file: %w", err)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// postJSON POSTs v as JSON to url, with a bearer token when token is set
+func (i *Installer) postJSON(url, token string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := i.doHTTP(registryClient, req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("HTTP %s", resp.Status)
+	}
+	return nil
+}
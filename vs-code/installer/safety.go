@@ -0,0 +1,87 @@
+// safety.go
+//
+// Safety copies, independent of the user-facing backup (and of --no-backup).
+// Right before a payload file is overwritten its current content is kept in
+// memory; if the write fails half-way the original is put back, so a full
+// disk or a permission error never leaves a truncated settings.json behind.
+// The copies live for the whole run, one per path (the first, pre-run state).
+
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// safetyCopy is the pre-run content of one overwritten file
+type safetyCopy struct {
+	Path    string
+	Data    []byte
+	Mode    fs.FileMode
+	Existed bool // false: the file was created by this run
+}
+
+// restore puts the original content back (or removes a file the run created)
+func (c safetyCopy) restore() error {
+	if !c.Existed {
+		if err := os.Remove(c.Path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	if err := writeBytes(c.Path, c.Data); err != nil {
+		return err
+	}
+	return os.Chmod(c.Path, c.Mode)
+}
+
+// snapshot reads the current content of path
+func snapshot(path string) (safetyCopy, error) {
+	c := safetyCopy{Path: path}
+	st, err := os.Stat(path)
+	switch {
+	case err == nil:
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return c, fmt.Errorf("cannot read %s before overwriting it: %w", path, err)
+		}
+		c.Data, c.Mode, c.Existed = b, st.Mode().Perm(), true
+	case !os.IsNotExist(err):
+		return c, fmt.Errorf("cannot stat %s before overwriting it: %w", path, err)
+	}
+	return c, nil
+}
+
+// safeWrite writes data to dst; on failure the content dst had right before
+// the write is restored. With --link a linked dst is not written (link.go).
+func (i *Installer) safeWrite(dst string, data []byte) error {
+	if i.link && i.linkedToSource(dst) {
+		return fmt.Errorf("%s is linked to %s (--link): not editing the source", dst, i.baseDir)
+	}
+	c, err := snapshot(dst)
+	if err != nil {
+		return err
+	}
+	i.rememberSafetyCopy(c)
+	if err := writeBytes(dst, data); err != nil {
+		if rerr := c.restore(); rerr != nil {
+			i.errorf("Restoring %s after failed write also failed: %v", dst, rerr)
+			return fmt.Errorf("%w (original NOT restored: %v)", err, rerr)
+		}
+		i.warnf("Write to %s failed — original content restored", dst)
+		return err
+	}
+	i.journalWrite(c, data)
+	return nil
+}
+
+// rememberSafetyCopy keeps the first (pre-run) copy of each path
+func (i *Installer) rememberSafetyCopy(c safetyCopy) {
+	for _, prev := range i.safety {
+		if prev.Path == c.Path {
+			return
+		}
+	}
+	i.safety = append(i.safety, c)
+}
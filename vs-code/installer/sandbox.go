@@ -0,0 +1,95 @@
+// sandbox.go
+//
+// Sandbox runs (--sandbox, or --sandbox-dir <dir> to pick and reuse the
+// folder) for validating payload changes end-to-end in CI. The process gets
+// a throwaway home: HOME / USERPROFILE and the XDG and AppData variables
+// point into <sandbox>/home, so the VS Code user dir, state, cache and log
+// of the run all live there. The editor CLI is called with --user-data-dir
+// and --extensions-dir inside the sandbox, so extensions are really
+// installed, just not into a real profile. The folder is kept for
+// inspection (`verify --sandbox-dir <dir>` checks the result).
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// editor folders of a sandbox run, "" otherwise
+var sandboxUserData, sandboxExtensions string
+
+// codeArgs returns args for an editor CLI call; in a sandbox run the CLI is
+// pointed at the sandbox folders, with --user-data-dir at that folder
+func (i *Installer) codeArgs(args ...string) []string {
+	switch {
+	case sandboxExtensions != "":
+		return append([]string{"--user-data-dir", sandboxUserData, "--extensions-dir", sandboxExtensions}, args...)
+	case i.userDataDir != "":
+		return append([]string{"--user-data-dir", i.userDataDir}, args...)
+	}
+	return args
+}
+
+// enterSandbox creates the sandbox tree of editor ed in dir (a new temp
+// folder when empty) and moves the process's home into it
+func enterSandbox(dir string, ed editorVariant) (string, error) {
+	if dir == "" {
+		d, err := os.MkdirTemp("", "hypreditors-sandbox-")
+		if err != nil {
+			return "", err
+		}
+		dir = d
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	home := filepath.Join(dir, "home")
+	env := map[string]string{
+		"HOME":            home,
+		"USERPROFILE":     home,
+		"XDG_CONFIG_HOME": filepath.Join(home, ".config"),
+		"XDG_STATE_HOME":  filepath.Join(home, ".local", "state"),
+		"XDG_CACHE_HOME":  filepath.Join(home, ".cache"),
+		"APPDATA":         filepath.Join(home, "AppData", "Roaming"),
+		"LOCALAPPDATA":    filepath.Join(home, "AppData", "Local"),
+	}
+	for k, v := range env {
+		if err := os.MkdirAll(v, 0o755); err != nil {
+			return "", err
+		}
+		if err := os.Setenv(k, v); err != nil {
+			return "", err
+		}
+	}
+	userData := filepath.Dir(ed.userDir(home))
+	extDir := ed.extensionsDir(home)
+	for _, d := range []string{userData, extDir} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			return "", err
+		}
+	}
+	sandboxUserData, sandboxExtensions = userData, extDir
+	return dir, nil
+}
+
+// checkSandboxOptions rejects switches that reach beyond the sandbox
+func checkSandboxOptions(opts Options) error {
+	switch {
+	case opts.InstallEditor != "":
+		return errors.New("--sandbox cannot be combined with --install-editor")
+	case opts.UserDataDir != "":
+		return errors.New("--sandbox cannot be combined with --user-data-dir")
+	case opts.AllUsers:
+		return errors.New("--sandbox cannot be combined with --all-users")
+	case opts.Remote != "":
+		return errors.New("--sandbox cannot be combined with --remote")
+	case opts.Scan != "" || opts.WorkspaceSettings != "" || opts.Theia != "":
+		return errors.New("--sandbox cannot be combined with --scan / --workspace-settings / --theia")
+	case opts.NotepadPP:
+		return errors.New("--sandbox cannot be combined with --notepadpp")
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+// scaffold.go
+//
+// `new <template> <dir>` starts a project with its editor config: the
+// embedded template data/templates/<template>/ (settings.json, tasks.json,
+// launch.json, extensions.json) is copied into <dir>/.vscode/, creating the
+// directory if needed. Files the project has already are kept (--force
+// overwrites them), except extensions.json, whose recommendations are
+// merged in. Templates are plain folders, so a new language is one more
+// folder under data/templates/ at build time.
+
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pterm/pterm"
+)
+
+const templatesDir = "templates"
+
+// projectTemplates lists the embedded project templates in sorted order
+func projectTemplates() []string {
+	entries, err := fs.ReadDir(embeddedData, path.Join(presetsRoot, templatesDir))
+	if err != nil {
+		return nil
+	}
+	var res []string
+	for _, e := range entries {
+		if e.IsDir() {
+			res = append(res, e.Name())
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+func runNew(args []string) error {
+	fs, opts := newCommandFlags("new")
+	pos := parseInterspersed(fs, args)
+	if len(pos) != 2 {
+		return fmt.Errorf("usage: new <template> <dir> (templates: %s)", orDash(strings.Join(projectTemplates(), ", ")))
+	}
+	name, dir := pos[0], pos[1]
+	if !containsString(projectTemplates(), name) {
+		return fmt.Errorf("unknown template %q (available: %s)", name, orDash(strings.Join(projectTemplates(), ", ")))
+	}
+
+	inst, err := NewInstaller(*opts)
+	if err != nil {
+		return fmt.Errorf("cannot initialize installer: %w", err)
+	}
+	defer inst.Close()
+	return inst.scaffoldProject(name, dir)
+}
+
+// scaffoldProject copies one template into dir/.vscode
+func (i *Installer) scaffoldProject(name, dir string) error {
+	root := path.Join(presetsRoot, templatesDir, name)
+	entries, err := fs.ReadDir(embeddedData, root)
+	if err != nil {
+		return err
+	}
+	dst := filepath.Join(dir, ".vscode")
+	written, kept := 0, 0
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		data, err := embeddedData.ReadFile(path.Join(root, e.Name()))
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, e.Name())
+		if exists(target) && !i.force {
+			if e.Name() != filepath.Base(projectExtensionsFile) {
+				i.logToFile("%s exists, kept", target)
+				kept++
+				continue
+			}
+			if data, err = mergeTemplateRecommendations(target, data, i.isBlocked); err != nil {
+				return fmt.Errorf("%s: %w", target, err)
+			}
+			if data == nil {
+				kept++
+				continue
+			}
+		}
+		if i.dryRun {
+			i.logf("DRY-RUN: would write %s", target)
+			continue
+		}
+		if err := writeBytes(target, data); err != nil {
+			return fmt.Errorf("cannot write %s: %w", target, err)
+		}
+		written++
+	}
+	if i.dryRun {
+		return nil
+	}
+	if kept > 0 {
+		pterm.Info.Printf("%d existing files kept (--force overwrites them)\n", kept)
+	}
+	i.logf("Project %s (%s template): %d files written to %s", dir, name, written, dst)
+	return nil
+}
+
+// mergeTemplateRecommendations adds a template's recommendations to the
+// project's existing extensions.json; nil means nothing to add
+func mergeTemplateRecommendations(target string, tmpl []byte, skip func(string) bool) ([]byte, error) {
+	v, err := parseJSONC(tmpl)
+	if err != nil {
+		return nil, err
+	}
+	obj, _ := v.(map[string]interface{})
+	cur, err := os.ReadFile(target)
+	if err != nil {
+		return nil, err
+	}
+	out, added, err := mergeRecommendations(cur, stringList(obj["recommendations"]), skip)
+	if err != nil || len(added) == 0 {
+		return nil, err
+	}
+	return out, nil
+}
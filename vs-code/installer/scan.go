@@ -0,0 +1,228 @@
+// scan.go
+//
+// Workspace config for many checkouts (--scan <dir>). The payload's
+// workspace/ folder holds the project-level files (settings.json,
+// extensions.json, tasks.json, launch.json, ...); --scan finds the git
+// repositories below <dir> and brings each repository's .vscode/ in line:
+//
+//   - settings.json: the payload's keys are set, the project's other keys
+//     and comments are kept
+//   - extensions.json: the payload's recommendations are merged in (see
+//     recommend.go)
+//   - any other file is only added when the project has none yet
+//
+// The repositories and their pending changes are listed first; each one
+// is confirmed separately (all with --yes), --dry-run stops after the list.
+// The user-level apply does not run in this mode.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pterm/pterm"
+)
+
+const workspacePayloadDir = "workspace"
+
+// scanSkipDirs are never searched for repositories
+var scanSkipDirs = []string{"node_modules", "vendor", "__pycache__"}
+
+// projectChange is one pending file update of a scanned repository
+type projectChange struct {
+	Path    string
+	Summary string
+	Data    []byte
+}
+
+// findRepositories lists the git repositories below root; repositories
+// are not searched for nested ones
+func findRepositories(root string) ([]string, error) {
+	var res []string
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == root {
+				return err
+			}
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if p != root && (strings.HasPrefix(d.Name(), ".") || containsString(scanSkipDirs, d.Name())) {
+			return filepath.SkipDir
+		}
+		// .git is a folder, or a file in worktrees and submodules
+		if exists(filepath.Join(p, ".git")) {
+			res = append(res, p)
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	sort.Strings(res)
+	return res, err
+}
+
+// workspacePayload returns the payload's workspace/ files by file name
+func (i *Installer) workspacePayload() (map[string][]byte, error) {
+	files, err := i.payloadDirFiles()
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string][]byte)
+	for name, b := range filesIn(files, workspacePayloadDir) {
+		res[path.Base(name)] = b
+	}
+	return res, nil
+}
+
+// mergeWorkspaceSettings sets the payload's top-level keys in a project's
+// settings.json and returns the result with the keys that changed
+func mergeWorkspaceSettings(cur, payload []byte) ([]byte, []string, error) {
+	members, _, _, err := jsoncMembers(payload)
+	if err != nil {
+		return nil, nil, fmt.Errorf("payload: %w", err)
+	}
+	out := cur
+	var changed []string
+	for _, m := range members {
+		value := payload[m.ValueStart:m.End]
+		old, ok, err := getSettingsKey(out, m.Key)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok && compactJSON(old) == compactJSON(value) {
+			continue
+		}
+		v, err := parseJSONC(value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("payload: %s: %w", m.Key, err)
+		}
+		if out, err = jsoncSet(out, m.Key, encodeJSONValue(v, "  ")); err != nil {
+			return nil, nil, err
+		}
+		changed = append(changed, m.Key)
+	}
+	return out, changed, nil
+}
+
+// projectChanges computes the pending updates of one repository
+func (i *Installer) projectChanges(repo string, payload map[string][]byte) ([]projectChange, error) {
+	names := make([]string, 0, len(payload))
+	for name := range payload {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var res []projectChange
+	for _, name := range names {
+		dst := filepath.Join(repo, ".vscode", name)
+		cur, err := os.ReadFile(dst)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err != nil {
+			res = append(res, projectChange{Path: dst, Summary: "new file", Data: payload[name]})
+			continue
+		}
+		switch name {
+		case settingsFile:
+			out, keys, err := mergeWorkspaceSettings(cur, payload[name])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", dst, err)
+			}
+			if len(keys) > 0 {
+				res = append(res, projectChange{Path: dst, Summary: "set " + strings.Join(keys, ", "), Data: out})
+			}
+		case filepath.Base(projectExtensionsFile):
+			v, err := parseJSONC(payload[name])
+			if err != nil {
+				return nil, fmt.Errorf("payload %s: %w", name, err)
+			}
+			obj, _ := v.(map[string]interface{})
+			out, added, err := mergeRecommendations(cur, stringList(obj["recommendations"]), i.isBlocked)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", dst, err)
+			}
+			if len(added) > 0 {
+				res = append(res, projectChange{Path: dst, Summary: "recommend " + strings.Join(added, ", "), Data: out})
+			}
+		}
+	}
+	return res, nil
+}
+
+// scanProjects applies the workspace payload to the repositories below root
+func (i *Installer) scanProjects(root string, reader *bufio.Reader) error {
+	payload, err := i.workspacePayload()
+	if err != nil {
+		return err
+	}
+	if len(payload) == 0 {
+		return fmt.Errorf("the payload has no %s/ folder", workspacePayloadDir)
+	}
+	root = i.expandHome(root)
+	repos, err := findRepositories(root)
+	if err != nil {
+		return fmt.Errorf("cannot scan %s: %w", root, err)
+	}
+	i.logf("Found %d git repositories in %s", len(repos), root)
+
+	pending := make(map[string][]projectChange)
+	var todo []string
+	for _, repo := range repos {
+		changes, err := i.projectChanges(repo, payload)
+		if err != nil {
+			i.warnf("%s skipped: %v", repo, err)
+			continue
+		}
+		if len(changes) == 0 {
+			fmt.Printf("  = %s (up to date)\n", repo)
+			continue
+		}
+		fmt.Printf("  * %s\n", repo)
+		for _, c := range changes {
+			rel, _ := filepath.Rel(repo, c.Path)
+			fmt.Printf("      %s: %s\n", filepath.ToSlash(rel), c.Summary)
+		}
+		pending[repo] = changes
+		todo = append(todo, repo)
+	}
+	if len(todo) == 0 {
+		pterm.Success.Println("All repositories are up to date.")
+		return nil
+	}
+	if i.dryRun {
+		i.logf("DRY-RUN: would update %d of %d repositories", len(todo), len(repos))
+		return nil
+	}
+
+	updated := 0
+	for n, repo := range todo {
+		if !i.assumeYes {
+			ok, err := i.askForAll("scan.update", fmt.Sprintf("Обновить .vscode в %s?", repo), true, len(todo)-n-1)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				i.logToFile("%s skipped by the user", repo)
+				continue
+			}
+		}
+		for _, c := range pending[repo] {
+			if err := writeBytes(c.Path, c.Data); err != nil {
+				return fmt.Errorf("cannot write %s: %w", c.Path, err)
+			}
+			i.logToFile("%s: %s", c.Path, c.Summary)
+		}
+		updated++
+	}
+	i.logf("Workspace config updated in %d of %d repositories", updated, len(todo))
+	return nil
+}
@@ -0,0 +1,143 @@
+// search.go
+//
+// `search <query>` subcommand: free-text search in the Marketplace / Open VSX,
+// printing extension IDs with install counts and descriptions. With --add-to
+// the chosen results are appended to an extensions.txt, so lists can be
+// curated without a browser.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pterm/pterm"
+)
+
+const searchDescWidth = 70 // description column width in the results table
+
+func runSearch(args []string) error {
+	fs, opts := newCommandFlags("search")
+	registry := fs.String("registry", registryAuto, "Search in: auto, marketplace or openvsx")
+	limit := fs.Int("limit", 20, "Maximum number of results")
+	addTo := fs.String("add-to", "", "Append selected results to this extensions.txt")
+	fs.Parse(args)
+	query := strings.Join(fs.Args(), " ")
+	if query == "" {
+		return fmt.Errorf("usage: search [flags] <query>")
+	}
+
+	inst, err := openInstaller(opts)
+	if err != nil {
+		return err
+	}
+	defer inst.Close()
+
+	reg := inst.resolveRegistry(*registry)
+	results, err := inst.searchExtensions(reg, query, *limit)
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		pterm.Warning.Printf("Nothing found in %s for %q\n", reg, query)
+		return nil
+	}
+
+	rows := [][]string{{"#", "Extension", "Version", "Installs", "Description"}}
+	specs := make([]extensionSpec, 0, len(results))
+	for idx, r := range results {
+		rows = append(rows, []string{strconv.Itoa(idx + 1), r.ID, r.Version, humanCount(r.Installs), truncate(r.Description, searchDescWidth)})
+		specs = append(specs, extensionSpec{ID: r.ID})
+	}
+	pterm.DefaultTable.WithHasHeader().WithData(rows).Render()
+
+	if *addTo == "" {
+		return nil
+	}
+	selected := specs
+	if !inst.assumeYes {
+		fmt.Printf("Добавить в %s (all/none/числа): ", *addTo)
+		selected, err = readSelection(bufio.NewReader(os.Stdin), specs)
+		if err != nil {
+			return err
+		}
+	}
+	return inst.appendToExtensionList(*addTo, selected)
+}
+
+// appendToExtensionList appends specs missing from the list file at path
+func (i *Installer) appendToExtensionList(path string, specs []extensionSpec) error {
+	var existing []extensionSpec
+	if exists(path) {
+		lines, err := readLinesFromFile(path)
+		if err != nil {
+			return fmt.Errorf("cannot read %s: %w", path, err)
+		}
+		// invalid lines are the user's business here, we only need the ids
+		existing, _ = parseExtensionList(lines)
+	}
+	var add []string
+	for _, s := range specs {
+		if _, dup := findSpec(existing, s.ID); dup {
+			i.logf("%s already listed in %s", s.ID, path)
+			continue
+		}
+		existing = append(existing, s)
+		add = append(add, s.String())
+	}
+	if len(add) == 0 {
+		return nil
+	}
+	if i.dryRun {
+		i.logf("DRY-RUN: would append to %s: %s", path, strings.Join(add, ", "))
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := ensureTrailingNewline(path, f); err != nil {
+		return err
+	}
+	for _, l := range add {
+		if _, err := fmt.Fprintln(f, l); err != nil {
+			return err
+		}
+	}
+	i.logf("Appended %d extensions to %s", len(add), path)
+	return nil
+}
+
+// ensureTrailingNewline writes "\n" to f when the file at path does not end with one
+func ensureTrailingNewline(path string, f *os.File) error {
+	b, err := os.ReadFile(path)
+	if err != nil || len(b) == 0 || b[len(b)-1] == '\n' {
+		return err
+	}
+	_, err = f.WriteString("\n")
+	return err
+}
+
+// humanCount formats 1234567 as 1.2M
+func humanCount(n int64) string {
+	switch {
+	case n >= 1_000_000:
+		return fmt.Sprintf("%.1fM", float64(n)/1_000_000)
+	case n >= 1_000:
+		return fmt.Sprintf("%.1fK", float64(n)/1_000)
+	default:
+		return strconv.FormatInt(n, 10)
+	}
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
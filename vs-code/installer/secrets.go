@@ -0,0 +1,175 @@
+// secrets.go
+//
+// Secret placeholders in settings.json, so tokens (SonarLint connections,
+// proxy credentials) never live in the payload in plaintext:
+//
+//   "http.proxy": "http://me:{{ secret \"PROXY_PASSWORD\" }}@proxy:3128"
+//
+// {{ secret "NAME" }} is resolved at apply time from the environment
+// variable NAME or, failing that, the OS keyring: secret-tool (libsecret)
+// attribute service=hypreditors name=NAME on Linux, the generic password
+// with service hypreditors and account NAME on macOS. Windows reads the
+// environment only. An unresolvable secret fails the run and settings.json
+// is not written.
+//
+// pack and bundle ship the payload with its placeholders; only the
+// settings.json written on the target machine holds the values. Plan
+// diffs, verify reports and logs show resolved secrets as ********; the
+// merge base under the state dir, the --git history and the payload key
+// hashes of the state file keep the placeholders instead.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+const (
+	secretService = "hypreditors"
+	secretMask    = "********"
+)
+
+// secretPattern matches {{ secret "NAME" }}, quotes JSON-escaped or not
+var secretPattern = regexp.MustCompile(`\{\{\s*secret\s+\\?["']([A-Za-z_][A-Za-z0-9_.-]*)\\?["']\s*\}\}`)
+
+// lookupSecret returns the value of a secret from the environment or the
+// OS keyring
+func lookupSecret(name string) (string, bool) {
+	if v, ok := os.LookupEnv(name); ok {
+		return v, true
+	}
+	var out string
+	var err error
+	switch runtime.GOOS {
+	case "linux":
+		out, err = runCommandWithTimeout(factTimeout, "secret-tool", "lookup", "service", secretService, "name", name)
+	case "darwin":
+		out, err = runCommandWithTimeout(factTimeout, "security", "find-generic-password", "-s", secretService, "-a", name, "-w")
+	default:
+		return "", false
+	}
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimRight(out, "\r\n"), true
+}
+
+// resolveSecrets replaces the secret placeholders of the settings payload
+// with their values
+func (i *Installer) resolveSecrets() error {
+	names := secretPattern.FindAllSubmatch(i.settingsData, -1)
+	if len(names) == 0 {
+		return nil
+	}
+	values := make(map[string]string)
+	var missing []string
+	for _, m := range names {
+		name := string(m[1])
+		if _, seen := values[name]; seen || containsString(missing, name) {
+			continue
+		}
+		v, ok := lookupSecret(name)
+		if !ok {
+			missing = append(missing, name)
+			continue
+		}
+		values[name] = v
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		// never write the placeholders: settings.json is skipped this run
+		i.settingsData = nil
+		return fmt.Errorf("%s: secrets not set in the environment or keyring: %s", settingsFile, strings.Join(missing, ", "))
+	}
+
+	i.settingsData = secretPattern.ReplaceAllFunc(i.settingsData, func(m []byte) []byte {
+		// placeholders sit inside JSON strings: the value is escaped, unquoted
+		b, _ := json.Marshal(values[string(secretPattern.FindSubmatch(m)[1])])
+		return b[1 : len(b)-1]
+	})
+	i.secretNames = make(map[string]string)
+	for name, v := range values {
+		if v != "" {
+			b, _ := json.Marshal(v)
+			i.secrets = append(i.secrets, string(b[1:len(b)-1]))
+			i.secretNames[string(b[1:len(b)-1])] = name
+		}
+		i.logToFile("secret %s resolved", name)
+	}
+	// longest first, so a secret containing another one is masked whole
+	sort.Slice(i.secrets, func(a, b int) bool { return len(i.secrets[a]) > len(i.secrets[b]) })
+	i.logf("Resolved %d secrets in %s", len(values), settingsFile)
+	return nil
+}
+
+// redactSecrets masks the resolved secret values in s
+func (i *Installer) redactSecrets(s string) string {
+	for _, v := range i.secrets {
+		s = strings.ReplaceAll(s, v, secretMask)
+	}
+	return s
+}
+
+// holdsSecret reports whether s contains a resolved secret value
+func (i *Installer) holdsSecret(s []byte) bool {
+	for _, v := range i.secrets {
+		if bytes.Contains(s, []byte(v)) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactValue masks the resolved secret values in a decoded JSON value
+func (i *Installer) redactValue(v interface{}) interface{} {
+	if len(i.secrets) == 0 || v == nil {
+		return v
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	masked := i.redactSecrets(string(b))
+	if masked == string(b) {
+		return v
+	}
+	var res interface{}
+	if json.Unmarshal([]byte(masked), &res) != nil {
+		return secretMask
+	}
+	return res
+}
+
+// unresolveSecrets puts the placeholders back in place of the resolved
+// values, for copies of settings.json kept outside the user dir
+func (i *Installer) unresolveSecrets(data []byte) []byte {
+	for _, v := range i.secrets {
+		data = bytes.ReplaceAll(data, []byte(v), []byte("{{ secret '"+i.secretNames[v]+"' }}"))
+	}
+	return data
+}
+
+// fillSecrets resolves the placeholders left by unresolveSecrets with the
+// values of this run; unknown ones stay as they are
+func (i *Installer) fillSecrets(data []byte) []byte {
+	if len(i.secrets) == 0 {
+		return data
+	}
+	values := make(map[string]string, len(i.secretNames))
+	for v, name := range i.secretNames {
+		values[name] = v
+	}
+	return secretPattern.ReplaceAllFunc(data, func(m []byte) []byte {
+		if v, ok := values[string(secretPattern.FindSubmatch(m)[1])]; ok {
+			return []byte(v)
+		}
+		return m
+	})
+}
@@ -0,0 +1,104 @@
+package main
+
+import "testing"
+
+// TestCheckSSHHost feeds host names that ssh would take for options
+func TestCheckSSHHost(t *testing.T) {
+	for _, c := range []struct {
+		host string
+		ok   bool
+	}{
+		{"host", true},
+		{"user@host.example", true},
+		{"user@10.0.0.1", true},
+		{"", false},
+		{"-oProxyCommand=touch /tmp/x", false},
+		{"-x", false},
+		{"--foo", false},
+		{"host -oProxyCommand=x", false},
+		{"host\tx", false},
+		{"host\nx", false},
+		{"host\x7f", false},
+	} {
+		if err := checkSSHHost(c.host); (err == nil) != c.ok {
+			t.Errorf("checkSSHHost(%q) = %v, want ok %v", c.host, err, c.ok)
+		}
+	}
+}
+
+// TestLocalZipPath feeds zip entry names that would leave the extraction folder
+func TestLocalZipPath(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		ok   bool
+	}{
+		{"settings.json", true},
+		{"settings.d/10-extra.json", true},
+		{`settings.d\10-extra.json`, true},
+		{"./settings.json", true},
+		{"", false},
+		{"..", false},
+		{"../x", false},
+		{`..\x`, false},
+		{`settings.d/..\..\..\x.json`, false},
+		{"settings.d/../../x", false},
+		{"/etc/passwd", false},
+		{`\x`, false},
+		{"C:x", false},
+		{`C:\x`, false},
+		{"C:/x", false},
+	} {
+		if _, ok := localZipPath(c.name); ok != c.ok {
+			t.Errorf("localZipPath(%q) ok = %v, want %v", c.name, ok, c.ok)
+		}
+	}
+}
+
+// TestParsePulsarPackages feeds package names ppm would take for options
+func TestParsePulsarPackages(t *testing.T) {
+	for _, c := range []struct {
+		data string
+		ok   bool
+	}{
+		{"minimap\nlinter@3.4.0 # pinned\n\n# comment\n", true},
+		{"-x", false},
+		{"--foo", false},
+		{"--foo@1.0.0", false},
+		{"minimap\n  -g  ", false},
+		{"@1.0.0", false},
+		{"mini map", false},
+	} {
+		if _, err := parsePulsarPackages([]byte(c.data)); (err == nil) != c.ok {
+			t.Errorf("parsePulsarPackages(%q) = %v, want ok %v", c.data, err, c.ok)
+		}
+	}
+	specs, _ := parsePulsarPackages([]byte("linter@3.4.0"))
+	if len(specs) != 1 || specs[0].ID != "linter" || specs[0].Version != "3.4.0" {
+		t.Errorf("parsePulsarPackages(linter@3.4.0) = %+v", specs)
+	}
+}
+
+// TestPlugKakRef feeds refs git fetch would take for options or ranges
+func TestPlugKakRef(t *testing.T) {
+	for _, c := range []struct {
+		ref string
+		ok  bool
+	}{
+		{"v2023.08.19", true},
+		{"0f5b3ea4c1b2", true},
+		{"refs/tags/v1.0", true},
+		{"", false},
+		{"-x", false},
+		{"--foo", false},
+		{"--upload-pack=touch /tmp/x", false},
+		{"v1..v2", false},
+		{"../x", false},
+		{"v1 v2", false},
+		{"v1\n--upload-pack=x", false},
+		{"/abs", false},
+	} {
+		if got := validPlugKakRef(c.ref); got != c.ok {
+			t.Errorf("validPlugKakRef(%q) = %v, want %v", c.ref, got, c.ok)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+// selftest.go
+//
+// `self-test`: a quick health gate after building a custom payload. It
+// validates the embedded payload and every embedded preset (each file
+// parses and has the expected shape: manifest and keymaps decode into
+// their types as the apply reads them, extension IDs and versions match
+// the Marketplace syntax, blocklist and removal patterns compile, the
+// settings.d/ and languages/ fragments merge), runs the merge engines
+// (three-way merge, fragments, JSONC edits, layers, YAML, keybinding
+// chords) against the golden fixtures of testdata/selftest.json and
+// checks that the platform paths resolve. A missing editor CLI is reported
+// but is not a failure. Exits non-zero when any check fails.
+
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pterm/pterm"
+)
+
+// selfCheck is the result of one self-test
+type selfCheck struct {
+	Group string
+	Name  string
+	Err   error
+	Note  string // set for checks that were skipped, not failed
+}
+
+func runSelfTest(args []string) error {
+	fs, _ := newCommandFlags("self-test")
+	fs.Parse(args)
+
+	var checks []selfCheck
+	embedded := make(map[string][]byte)
+	for name, data := range packTargets() {
+		embedded[name] = *data
+	}
+	checks = append(checks, payloadChecks("payload", embedded, embeddedPayloadDirFiles())...)
+	for _, name := range embeddedPresets() {
+		checks = append(checks, payloadChecks("preset "+name, presetFiles(name), nil)...)
+	}
+	checks = append(checks, mergeChecks()...)
+	checks = append(checks, pathChecks()...)
+
+	rows := [][]string{{"Group", "Check", "Result"}}
+	failed := 0
+	for _, c := range checks {
+		res := pterm.Green("ok")
+		switch {
+		case c.Err != nil:
+			res = pterm.Red("FAIL: " + c.Err.Error())
+			failed++
+		case c.Note != "":
+			res = pterm.Yellow("skipped: " + c.Note)
+		}
+		rows = append(rows, []string{c.Group, c.Name, res})
+	}
+	pterm.DefaultTable.WithHasHeader().WithData(rows).Render()
+	if failed > 0 {
+		return fmt.Errorf("%d of %d self-tests failed", failed, len(checks))
+	}
+	pterm.Success.Printf("All %d self-tests passed.\n", len(checks))
+	return nil
+}
+
+// payloadChecks validates the payload files (name -> content) and the
+// payload folder files of one payload
+func payloadChecks(group string, files, dirFiles map[string][]byte) []selfCheck {
+	var res []selfCheck
+	for _, name := range sortedKeys(files) {
+		if len(files[name]) == 0 {
+			continue
+		}
+		res = append(res, selfCheck{Group: group, Name: name, Err: validatePayloadFile(name, files[name])})
+	}
+	if len(dirFiles) > 0 {
+		_, err := mergeFragments(files[settingsFile], dirFiles)
+		res = append(res, selfCheck{Group: group, Name: fmt.Sprintf("%d settings fragments", len(dirFiles)), Err: err})
+	}
+	return res
+}
+
+// selfTestFixtures are the merge engine golden fixtures, one list of cases
+// per engine; `go test` runs them too
+//
+//go:embed testdata/selftest.json
+var selfTestFixtures []byte
+
+// mergeFixtures is the layout of testdata/selftest.json
+type mergeFixtures struct {
+	Merge3 []struct {
+		Name, Base, Ours, Theirs, Want string
+		Conflicts                      int
+	}
+	Fragments []struct {
+		Name, Base, Keep string
+		Files            map[string]string
+		Want             json.RawMessage
+	}
+	JSONC []struct {
+		Name, Data, Keep string
+		Set              map[string]json.RawMessage
+		Delete           []string
+		Want             json.RawMessage
+	}
+	Layers []struct {
+		Name              string
+		Base, Layer, Want json.RawMessage
+	}
+	YAML []struct {
+		Name, Input string
+		Want        json.RawMessage
+	}
+	Chords []struct {
+		Name, Input, Want string
+	}
+}
+
+// mergeChecks runs the merge engines against the golden fixtures
+func mergeChecks() []selfCheck {
+	var fx mergeFixtures
+	if err := json.Unmarshal(selfTestFixtures, &fx); err != nil {
+		return []selfCheck{{Group: "merge engine", Name: "fixtures", Err: err}}
+	}
+	var res []selfCheck
+	fixture := func(name string, fn func() error) {
+		res = append(res, selfCheck{Group: "merge engine", Name: name, Err: fn()})
+	}
+	lines := func(s string) []string { return strings.Split(s, "\n") }
+	sameValue := func(got []byte, want json.RawMessage) error {
+		g, err := parseJSONC(got)
+		if err != nil {
+			return fmt.Errorf("result does not parse: %w", err)
+		}
+		w, _ := parseJSONC(want)
+		if !reflect.DeepEqual(g, w) {
+			return fmt.Errorf("got %s, want %s", strings.Join(strings.Fields(string(got)), " "), want)
+		}
+		return nil
+	}
+	for _, c := range fx.Merge3 {
+		fixture(c.Name, func() error {
+			got, n := merge3("f", lines(c.Base), lines(c.Ours), lines(c.Theirs), nil)
+			if strings.Join(got, "\n") != c.Want || n != c.Conflicts {
+				return fmt.Errorf("got %q (%d conflicts), want %q (%d)", strings.Join(got, "\n"), n, c.Want, c.Conflicts)
+			}
+			return nil
+		})
+	}
+	for _, c := range fx.Fragments {
+		fixture(c.Name, func() error {
+			frags := make(map[string][]byte, len(c.Files))
+			for name, data := range c.Files {
+				frags[name] = []byte(data)
+			}
+			got, err := mergeFragments([]byte(c.Base), frags)
+			if err != nil {
+				return err
+			}
+			if !bytes.Contains(got, []byte(c.Keep)) {
+				return errors.New("comment lost")
+			}
+			return sameValue(got, c.Want)
+		})
+	}
+	for _, c := range fx.JSONC {
+		fixture(c.Name, func() error {
+			data := []byte(c.Data)
+			var err error
+			keys := make([]string, 0, len(c.Set))
+			for k := range c.Set {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				if data, err = jsoncSet(data, k, c.Set[k]); err != nil {
+					return err
+				}
+			}
+			for _, k := range c.Delete {
+				if data, _, err = jsoncDelete(data, k); err != nil {
+					return err
+				}
+			}
+			if !bytes.Contains(data, []byte(c.Keep)) {
+				return errors.New("comment lost")
+			}
+			return sameValue(data, c.Want)
+		})
+	}
+	for _, c := range fx.Layers {
+		fixture(c.Name, func() error {
+			var base, layer interface{}
+			if err := json.Unmarshal(c.Base, &base); err != nil {
+				return err
+			}
+			if err := json.Unmarshal(c.Layer, &layer); err != nil {
+				return err
+			}
+			b, _ := json.Marshal(mergeLayerValue(base, layer))
+			return sameValue(b, c.Want)
+		})
+	}
+	for _, c := range fx.YAML {
+		fixture(c.Name, func() error {
+			v, err := parseYAML([]byte(c.Input))
+			if err != nil {
+				return err
+			}
+			b, _ := json.Marshal(v)
+			return sameValue(b, c.Want)
+		})
+	}
+	for _, c := range fx.Chords {
+		fixture(c.Name, func() error {
+			if got := canonicalChord(c.Input); got != c.Want {
+				return fmt.Errorf("got %q, want %q", got, c.Want)
+			}
+			return nil
+		})
+	}
+	return res
+}
+
+// pathChecks checks that the platform paths resolve
+func pathChecks() []selfCheck {
+	group := "paths"
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return []selfCheck{{Group: group, Name: "home dir", Err: err}}
+	}
+	abs := func(name, p string) selfCheck {
+		c := selfCheck{Group: group, Name: name + " (" + p + ")"}
+		if p == "" || !filepath.IsAbs(p) {
+			c.Err = fmt.Errorf("%q is not an absolute path", p)
+		}
+		return c
+	}
+	res := []selfCheck{
+		abs("home dir", home),
+		abs("VS Code user dir", userVSCodeDir(home)),
+		abs("state dir", stateDir(home)),
+		abs("cache dir", cacheDir(home)),
+		abs("machine log", machineLogPath()),
+	}
+	cli, err := findCodeCLI()
+	if err != nil {
+		return append(res, selfCheck{Group: group, Name: "editor CLI", Note: err.Error()})
+	}
+	return append(res, abs("editor CLI", cli), abs("extensions dir", extensionsDir(home, cli)))
+}
@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+// TestMergeFixtures runs the self-test golden fixtures (testdata/selftest.json)
+func TestMergeFixtures(t *testing.T) {
+	checks := mergeChecks()
+	if len(checks) == 0 {
+		t.Fatal("no fixtures")
+	}
+	for _, c := range checks {
+		t.Run(c.Name, func(t *testing.T) {
+			if c.Err != nil {
+				t.Error(c.Err)
+			}
+		})
+	}
+}
+
+// TestEmbeddedPayload validates the embedded payload and presets like self-test
+func TestEmbeddedPayload(t *testing.T) {
+	embedded := make(map[string][]byte)
+	for name, data := range packTargets() {
+		embedded[name] = *data
+	}
+	checks := payloadChecks("payload", embedded, embeddedPayloadDirFiles())
+	for _, name := range embeddedPresets() {
+		checks = append(checks, payloadChecks("preset "+name, presetFiles(name), nil)...)
+	}
+	for _, c := range checks {
+		if c.Err != nil {
+			t.Errorf("%s: %s: %v", c.Group, c.Name, c.Err)
+		}
+	}
+}
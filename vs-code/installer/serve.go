@@ -0,0 +1,291 @@
+// serve.go
+//
+// `serve-mirror` subcommand: serves a folder of .vsix packages (--dir,
+// default --vsix-dir) over HTTP as a minimal gallery, so machines on the LAN
+// install without internet:
+//
+//   vscode-installer serve-mirror --dir ./vsix --addr :8080
+//   vscode-installer --marketplace-url http://teacher-pc:8080 --yes
+//
+// Only the part of the gallery API the installer (and VSCodium pointed at
+// the mirror) uses is implemented: POST /extensionquery by name or search
+// text, GET/HEAD .../vspackage and the asset URLs for the package and its
+// manifest. The folder is rescanned on every query, so packages dropped in
+// while the server runs are picked up. Every version present is served.
+
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pterm/pterm"
+)
+
+const (
+	assetVSIXPackage  = "Microsoft.VisualStudio.Services.VSIXPackage"
+	assetCodeManifest = "Microsoft.VisualStudio.Code.Manifest"
+)
+
+func runServeMirror(args []string) error {
+	fs, opts := newCommandFlags("serve-mirror")
+	dir := fs.String("dir", "", "Folder with *.vsix packages to serve (default: --vsix-dir)")
+	addr := fs.String("addr", ":8080", "Listen address")
+	fs.Parse(args)
+	if *dir == "" {
+		*dir = opts.VSIXDir
+	}
+	if *dir == "" {
+		return errors.New("usage: serve-mirror --dir <folder with .vsix> [--addr :8080]")
+	}
+	abs, err := filepath.Abs(*dir)
+	if err != nil {
+		return err
+	}
+
+	inst, err := NewInstaller(*opts)
+	if err != nil {
+		return fmt.Errorf("cannot initialize installer: %w", err)
+	}
+	defer inst.Close()
+
+	m := &vsixMirror{dir: abs, inst: inst}
+	pkgs := m.scan()
+	inst.logf("Serving %d extensions from %s on %s", len(pkgs), abs, *addr)
+	pterm.Info.Printf("Clients: --marketplace-url http://<this-host>%s\n", *addr)
+	srv := &http.Server{Addr: *addr, Handler: m, ReadHeaderTimeout: 10 * time.Second}
+	return srv.ListenAndServe()
+}
+
+// vsixMirror is the HTTP handler of serve-mirror
+type vsixMirror struct {
+	dir  string
+	inst *Installer
+}
+
+// scan returns all packages by lower-cased id, newest version first
+func (m *vsixMirror) scan() map[string][]vsixPackage {
+	paths, _ := filepath.Glob(filepath.Join(m.dir, "*.vsix"))
+	res := make(map[string][]vsixPackage)
+	for _, p := range paths {
+		pkg, err := readVSIXManifest(p)
+		if err != nil {
+			m.inst.logToFile("serve-mirror: skipping %s: %v", filepath.Base(p), err)
+			continue
+		}
+		key := strings.ToLower(pkg.ID)
+		res[key] = append(res[key], pkg)
+	}
+	for _, v := range res {
+		sort.Slice(v, func(a, b int) bool { return compareVersions(v[a].Version, v[b].Version) > 0 })
+	}
+	return res
+}
+
+// find returns the package of id at version ("latest" or "" = newest)
+func (m *vsixMirror) find(id, version string) (vsixPackage, bool) {
+	for _, p := range m.scan()[strings.ToLower(id)] {
+		if version == "" || version == "latest" || p.Version == version {
+			return p, true
+		}
+	}
+	return vsixPackage{}, false
+}
+
+func (m *vsixMirror) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.inst.logToFile("serve-mirror: %s %s %s", r.RemoteAddr, r.Method, r.URL.Path)
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/extensionquery"):
+		m.serveQuery(w, r)
+	// /publishers/<pub>/vsextensions/<name>/<version>/vspackage
+	case len(parts) >= 6 && parts[len(parts)-6] == "publishers" && parts[len(parts)-4] == "vsextensions" && parts[len(parts)-1] == "vspackage":
+		n := len(parts)
+		m.serveAsset(w, r, parts[n-5]+"."+parts[n-3], parts[n-2], assetVSIXPackage)
+	// /assets/<id>/<version>/<asset type>
+	case len(parts) >= 4 && parts[len(parts)-4] == "assets":
+		n := len(parts)
+		m.serveAsset(w, r, parts[n-3], parts[n-2], parts[n-1])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (m *vsixMirror) serveAsset(w http.ResponseWriter, r *http.Request, id, version, asset string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	pkg, ok := m.find(id, version)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	switch asset {
+	case assetVSIXPackage:
+		f, err := os.Open(pkg.Path)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer f.Close()
+		st, err := f.Stat()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/vsix")
+		http.ServeContent(w, r, filepath.Base(pkg.Path), st.ModTime(), f)
+		if r.Method == http.MethodGet {
+			m.inst.logf("serve-mirror: %s %s -> %s", pkg.ID, pkg.Version, r.RemoteAddr)
+		}
+	case assetCodeManifest:
+		data, err := readZipMember(pkg.Path, vsixManifestPath)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// galleryRequest is the part of an extensionquery body the mirror reads
+type galleryRequest struct {
+	Filters []struct {
+		Criteria   []galleryCriterion `json:"criteria"`
+		PageNumber int                `json:"pageNumber"`
+		PageSize   int                `json:"pageSize"`
+	} `json:"filters"`
+	Flags int `json:"flags"`
+}
+
+func (m *vsixMirror) serveQuery(w http.ResponseWriter, r *http.Request) {
+	var req galleryRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+		http.Error(w, "bad query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	base := "http://" + r.Host + strings.TrimSuffix(r.URL.Path, "/extensionquery")
+	all := m.scan()
+
+	var results []interface{}
+	for _, f := range req.Filters {
+		var names []string
+		var search string
+		for _, c := range f.Criteria {
+			switch c.FilterType {
+			case galleryFilterExtensionName:
+				names = append(names, strings.ToLower(c.Value))
+			case galleryFilterSearchText:
+				search = strings.ToLower(c.Value)
+			}
+		}
+		var keys []string
+		for k, v := range all {
+			switch {
+			case len(names) > 0:
+				if containsString(names, k) {
+					keys = append(keys, k)
+				}
+			case search != "":
+				if strings.Contains(k, search) || strings.Contains(strings.ToLower(v[0].DisplayName), search) {
+					keys = append(keys, k)
+				}
+			default:
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		total := len(keys)
+		if f.PageSize > 0 {
+			start := (max(f.PageNumber, 1) - 1) * f.PageSize
+			keys = keys[min(start, len(keys)):min(start+f.PageSize, len(keys))]
+		}
+		exts := make([]interface{}, 0, len(keys))
+		for _, k := range keys {
+			exts = append(exts, galleryEntry(base, all[k], req.Flags&galleryIncludeLatestVersionOnly != 0))
+		}
+		results = append(results, map[string]interface{}{
+			"extensions": exts,
+			"resultMetadata": []interface{}{map[string]interface{}{
+				"metadataType":  "ResultCount",
+				"metadataItems": []interface{}{map[string]interface{}{"name": "TotalCount", "count": total}},
+			}},
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"results": results})
+}
+
+// galleryEntry renders the versions of one extension as a gallery result
+func galleryEntry(base string, versions []vsixPackage, latestOnly bool) map[string]interface{} {
+	if latestOnly {
+		versions = versions[:1]
+	}
+	latest := versions[0]
+	pub, name, _ := strings.Cut(latest.ID, ".")
+	var vs []interface{}
+	for _, p := range versions {
+		assetURI := fmt.Sprintf("%s/assets/%s/%s", base, p.ID, p.Version)
+		modified := time.Time{}
+		if st, err := os.Stat(p.Path); err == nil {
+			modified = st.ModTime().UTC()
+		}
+		vs = append(vs, map[string]interface{}{
+			"version":          p.Version,
+			"lastUpdated":      modified,
+			"assetUri":         assetURI,
+			"fallbackAssetUri": assetURI,
+			"files": []interface{}{
+				map[string]interface{}{"assetType": assetVSIXPackage, "source": vsixURL(base, p.ID, p.Version)},
+				map[string]interface{}{"assetType": assetCodeManifest, "source": assetURI + "/" + assetCodeManifest},
+			},
+		})
+	}
+	displayName := latest.DisplayName
+	if displayName == "" {
+		displayName = name
+	}
+	return map[string]interface{}{
+		"extensionId":      latest.ID,
+		"extensionName":    name,
+		"displayName":      displayName,
+		"shortDescription": latest.Description,
+		"publisher":        map[string]interface{}{"publisherId": pub, "publisherName": pub, "displayName": pub},
+		"versions":         vs,
+		"statistics":       []interface{}{map[string]interface{}{"statisticName": "install", "value": 0}},
+	}
+}
+
+// readZipMember returns one file of a zip archive
+func readZipMember(path, name string) ([]byte, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		if f.Name != name {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return io.ReadAll(rc)
+	}
+	return nil, fmt.Errorf("no %s in %s", name, filepath.Base(path))
+}
@@ -0,0 +1,320 @@
+// service.go
+//
+// `install-service` subcommand: schedules a periodic non-interactive apply
+// (`<installer> apply --yes --quiet`) so managed machines stay converged
+// without manual runs. The scheduler is native to the platform:
+//
+//   Linux    systemd user unit + timer in ~/.config/systemd/user
+//   macOS    launchd agent in ~/Library/LaunchAgents
+//   Windows  Scheduled Task \HyprEditors\Apply
+//
+// --uninstall removes it again; --dry-run prints what would be written.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	serviceName       = "hypreditors-apply"
+	launchdLabel      = "org.hyprarch.hypreditors.apply"
+	scheduledTaskName = `\HyprEditors\Apply`
+	serviceCmdTimeout = 30 * time.Second
+)
+
+func runInstallService(args []string) error {
+	fs, opts := newCommandFlags("install-service")
+	interval := fs.Duration("interval", time.Hour, "How often the apply runs")
+	uninstall := fs.Bool("uninstall", false, "Remove the scheduled apply instead of installing it")
+	fs.Parse(args)
+	if *interval < time.Minute {
+		return errors.New("--interval must be at least 1m")
+	}
+
+	inst, err := NewInstaller(*opts)
+	if err != nil {
+		return fmt.Errorf("cannot initialize installer: %w", err)
+	}
+	defer inst.Close()
+
+	if *uninstall {
+		return inst.uninstallService()
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("cannot determine exe path: %w", err)
+	}
+	cmd := append([]string{exe, "apply", "--yes", "--quiet"}, payloadArgs(opts)...)
+	return inst.installService(cmd, *interval)
+}
+
+// serviceArgs is the command line of an unattended child run (agent, fleet)
+func serviceArgs(opts *Options) []string {
+	return append([]string{"apply", "--silent"}, payloadArgs(opts)...)
+}
+
+// payloadArgs are the payload-related switches of opts, passed on to the
+// runs a command starts
+func payloadArgs(opts *Options) []string {
+	var args []string
+	if opts.SrcOverride != "" {
+		if abs, err := filepath.Abs(opts.SrcOverride); err == nil {
+			args = append(args, "--src", abs)
+		}
+	}
+	if opts.Payload != "" {
+		args = append(args, "--payload", opts.Payload)
+	}
+	if opts.Editor != "" {
+		args = append(args, "--editor", opts.Editor)
+	}
+	if opts.UserDataDir != "" {
+		if abs, err := filepath.Abs(opts.UserDataDir); err == nil {
+			args = append(args, "--user-data-dir", abs)
+		}
+	}
+	if opts.VSIXDir != "" {
+		if abs, err := filepath.Abs(opts.VSIXDir); err == nil {
+			args = append(args, "--vsix-dir", abs)
+		}
+	}
+	if opts.Marketplace != "" {
+		args = append(args, "--marketplace-url", opts.Marketplace)
+	}
+	if opts.CACert != "" {
+		if abs, err := filepath.Abs(opts.CACert); err == nil {
+			args = append(args, "--ca-cert", abs)
+		}
+	}
+	if opts.ReportURL != "" {
+		args = append(args, "--report-url", opts.ReportURL)
+	}
+	if opts.ReportTokenFile != "" {
+		if abs, err := filepath.Abs(opts.ReportTokenFile); err == nil {
+			args = append(args, "--report-token-file", abs)
+		}
+	}
+	if opts.BackupDir != "" {
+		if abs, err := filepath.Abs(opts.BackupDir); err == nil {
+			args = append(args, "--backup-dir", abs)
+		}
+	}
+	if opts.SkipBackup {
+		args = append(args, "--no-backup")
+	}
+	if opts.MandatorySettings != "" {
+		if abs, err := filepath.Abs(opts.MandatorySettings); err == nil {
+			args = append(args, "--mandatory-settings", abs)
+		}
+	}
+	if opts.Layers != "" {
+		if paths, err := parseLayerPaths(opts.Layers); err == nil {
+			args = append(args, "--layers", strings.Join(paths, ","))
+		}
+	}
+	if opts.Keymap != "" {
+		args = append(args, "--keymap", opts.Keymap)
+	}
+	if opts.KeybindingsMode != "" {
+		args = append(args, "--keybindings-mode", opts.KeybindingsMode)
+	}
+	for _, s := range opts.Overrides {
+		if s.JSON {
+			args = append(args, "--set-json", s.Arg)
+		} else {
+			args = append(args, "--set", s.Arg)
+		}
+	}
+	return args
+}
+
+func (i *Installer) installService(cmd []string, interval time.Duration) error {
+	switch runtime.GOOS {
+	case "linux":
+		dir := filepath.Join(i.homeDir, ".config", "systemd", "user")
+		if err := i.writeServiceFile(filepath.Join(dir, serviceName+".service"), systemdService(cmd)); err != nil {
+			return err
+		}
+		if err := i.writeServiceFile(filepath.Join(dir, serviceName+".timer"), systemdTimer(interval)); err != nil {
+			return err
+		}
+		return i.runServiceCmds(
+			[]string{"systemctl", "--user", "daemon-reload"},
+			[]string{"systemctl", "--user", "enable", "--now", serviceName + ".timer"},
+		)
+	case "darwin":
+		p := filepath.Join(i.homeDir, "Library", "LaunchAgents", launchdLabel+".plist")
+		if err := i.writeServiceFile(p, launchdPlist(cmd, interval, i.homeDir)); err != nil {
+			return err
+		}
+		// reload so a changed interval takes effect; unload fails harmlessly on first install
+		i.runServiceCmds([]string{"launchctl", "unload", p})
+		return i.runServiceCmds([]string{"launchctl", "load", "-w", p})
+	case "windows":
+		sched, err := schtasksSchedule(interval)
+		if err != nil {
+			return err
+		}
+		return i.runServiceCmds(append([]string{"schtasks", "/Create", "/F", "/TN", scheduledTaskName, "/TR", windowsCommandLine(cmd)}, sched...))
+	default:
+		return fmt.Errorf("install-service is not supported on %s", runtime.GOOS)
+	}
+}
+
+func (i *Installer) uninstallService() error {
+	switch runtime.GOOS {
+	case "linux":
+		dir := filepath.Join(i.homeDir, ".config", "systemd", "user")
+		i.runServiceCmds([]string{"systemctl", "--user", "disable", "--now", serviceName + ".timer"})
+		for _, f := range []string{serviceName + ".timer", serviceName + ".service"} {
+			if err := i.removeServiceFile(filepath.Join(dir, f)); err != nil {
+				return err
+			}
+		}
+		return i.runServiceCmds([]string{"systemctl", "--user", "daemon-reload"})
+	case "darwin":
+		p := filepath.Join(i.homeDir, "Library", "LaunchAgents", launchdLabel+".plist")
+		i.runServiceCmds([]string{"launchctl", "unload", "-w", p})
+		return i.removeServiceFile(p)
+	case "windows":
+		return i.runServiceCmds([]string{"schtasks", "/Delete", "/F", "/TN", scheduledTaskName})
+	default:
+		return fmt.Errorf("install-service is not supported on %s", runtime.GOOS)
+	}
+}
+
+func (i *Installer) writeServiceFile(path, content string) error {
+	if i.dryRun {
+		i.logf("DRY-RUN: would write %s:\n%s", path, content)
+		return nil
+	}
+	if err := writeBytes(path, []byte(content)); err != nil {
+		return fmt.Errorf("cannot write %s: %w", path, err)
+	}
+	i.logf("Wrote %s", path)
+	return nil
+}
+
+func (i *Installer) removeServiceFile(path string) error {
+	if i.dryRun {
+		i.logf("DRY-RUN: would remove %s", path)
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	i.logf("Removed %s", path)
+	return nil
+}
+
+// runServiceCmds runs scheduler commands in order, stopping at the first failure
+func (i *Installer) runServiceCmds(cmds ...[]string) error {
+	for _, c := range cmds {
+		if i.dryRun {
+			i.logf("DRY-RUN: would run: %s", strings.Join(c, " "))
+			continue
+		}
+		out, err := runCommandWithTimeout(serviceCmdTimeout, c[0], c[1:]...)
+		if err != nil {
+			return fmt.Errorf("%s failed: %v: %s", strings.Join(c, " "), err, strings.TrimSpace(out))
+		}
+		i.logf("Ran: %s", strings.Join(c, " "))
+	}
+	return nil
+}
+
+func systemdService(cmd []string) string {
+	quoted := make([]string, len(cmd))
+	for k, a := range cmd {
+		quoted[k] = strconv.Quote(a)
+	}
+	return fmt.Sprintf(`[Unit]
+Description=HyprEditors: reconcile editor config with the payload
+
+[Service]
+Type=oneshot
+ExecStart=%s
+`, strings.Join(quoted, " "))
+}
+
+func systemdTimer(interval time.Duration) string {
+	return fmt.Sprintf(`[Unit]
+Description=Periodic HyprEditors apply
+
+[Timer]
+OnBootSec=5min
+OnUnitActiveSec=%ds
+Persistent=true
+
+[Install]
+WantedBy=timers.target
+`, int(interval.Seconds()))
+}
+
+func launchdPlist(cmd []string, interval time.Duration, home string) string {
+	var args strings.Builder
+	for _, a := range cmd {
+		fmt.Fprintf(&args, "\t\t<string>%s</string>\n", xmlEscape(a))
+	}
+	logPath := xmlEscape(filepath.Join(home, "Library", "Logs", serviceName+".log"))
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>%s</string>
+	<key>ProgramArguments</key>
+	<array>
+%s	</array>
+	<key>StartInterval</key>
+	<integer>%d</integer>
+	<key>RunAtLoad</key>
+	<true/>
+	<key>ProcessType</key>
+	<string>Background</string>
+	<key>StandardOutPath</key>
+	<string>%s</string>
+	<key>StandardErrorPath</key>
+	<string>%s</string>
+</dict>
+</plist>
+`, launchdLabel, args.String(), int(interval.Seconds()), logPath, logPath)
+}
+
+func xmlEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;").Replace(s)
+}
+
+// windowsCommandLine joins cmd for schtasks /TR, quoting arguments with spaces
+func windowsCommandLine(cmd []string) string {
+	parts := make([]string, len(cmd))
+	for k, a := range cmd {
+		if strings.ContainsAny(a, " \t") {
+			a = `"` + a + `"`
+		}
+		parts[k] = a
+	}
+	return strings.Join(parts, " ")
+}
+
+// schtasksSchedule maps interval to schtasks /SC flags: whole minutes below
+// a day (MINUTE allows up to 1439) or whole days; anything else would be
+// rounded by the scheduler, so it is refused
+func schtasksSchedule(interval time.Duration) ([]string, error) {
+	const day = 24 * time.Hour
+	switch {
+	case interval < day && interval%time.Minute == 0:
+		return []string{"/SC", "MINUTE", "/MO", strconv.Itoa(int(interval / time.Minute))}, nil
+	case interval >= day && interval%day == 0:
+		return []string{"/SC", "DAILY", "/MO", strconv.Itoa(int(interval / day))}, nil
+	}
+	return nil, fmt.Errorf("--interval %s cannot be scheduled on Windows: use whole minutes below 24h or whole days", interval)
+}
@@ -0,0 +1,67 @@
+// session.go
+//
+// Answers remembered for the rest of a run. When one run walks several
+// targets (repositories with --scan, the editors of an --editor matrix),
+// the same question comes up once per target. askForAll offers
+// two more answers besides y/n:
+//
+//   a   yes, and yes for all remaining targets
+//   s   no, and skip all remaining targets
+//
+// Such an answer is kept under the question's key for the whole process
+// and later questions with that key are answered from it (logged, not
+// shown). Plain y/n answers are not remembered.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// askForAll asks question for one of several targets; remaining is the
+// number of targets after this one (0 makes it a plain yes/no question)
+func (i *Installer) askForAll(key, question string, defaultYes bool, remaining int) (bool, error) {
+	if ans, ok := i.answers[key]; ok {
+		i.logToFile("%s — answered for all targets: %v", question, ans)
+		return ans, nil
+	}
+	if remaining <= 0 {
+		return askYesNoDefaultYes(i.input(), question, defaultYes)
+	}
+	hint := "Y/n/a/s"
+	if !defaultYes {
+		hint = "y/N/a/s"
+	}
+	for {
+		fmt.Printf("%s [%s] (a — да для всех оставшихся %d, s — пропустить все): ", question, hint, remaining)
+		text, err := i.input().ReadString('\n')
+		if err != nil {
+			return false, err
+		}
+		switch strings.ToLower(strings.TrimSpace(text)) {
+		case "":
+			return defaultYes, nil
+		case "y", "yes", "д", "да":
+			return true, nil
+		case "n", "no", "н", "нет":
+			return false, nil
+		case "a", "all":
+			i.rememberAnswer(key, true)
+			return true, nil
+		case "s", "skip":
+			i.rememberAnswer(key, false)
+			return false, nil
+		}
+		fmt.Println("Введите y, n, a или s.")
+	}
+}
+
+// rememberAnswer keeps ans for every later question with key
+func (i *Installer) rememberAnswer(key string, ans bool) {
+	if i.answers == nil {
+		i.answers = make(map[string]bool)
+	}
+	i.answers[key] = ans
+	i.logToFile("answer %v remembered for all remaining targets (%s)", ans, key)
+}
@@ -0,0 +1,265 @@
+// silent.go
+//
+// Silent mode (--silent) for MDM / endpoint management deployments: no TTY
+// is needed, nothing is ever asked (implies --yes, the backup passphrase must
+// come from --backup-key-file or the environment, sudo runs with -n), only
+// errors are printed (to stderr) and the process ends with one of the exit
+// codes below. The log goes to a machine-scoped location when writable:
+//
+//   Linux    /var/log/hypreditors/install.log
+//   macOS    /Library/Logs/HyprEditors/install.log
+//   Windows  %ProgramData%\HyprEditors\Logs\install.log
+//
+// Mandatory settings (manifest "mandatorySettings" or --mandatory-settings
+// <file>) are enforced in settings.json on every run, silent or not, even if
+// applying settings.json itself was declined; --allow-keys does not cover
+// them.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// exit codes of a silent run; the first failure of a run decides
+const (
+	exitOK         = 0
+	exitFailure    = 1 // cannot initialize (bad flags, home dir, log file)
+	exitUsage      = 2 // command-line parse error (flag package)
+	exitPayload    = 3 // payload invalid or could not be loaded
+	exitConfig     = 4 // settings/keybindings/mandatory settings not written
+	exitNoEditor   = 5 // editor CLI missing, extensions not processed
+	exitExtensions = 6 // some extensions failed to install or uninstall
+
+	exitNonCompliant = 7 // verify --enforce-exit found violations
+)
+
+// machineLogPath is the machine-scoped log file of silent runs
+func machineLogPath() string {
+	switch runtime.GOOS {
+	case "windows":
+		if pd := os.Getenv("ProgramData"); pd != "" {
+			return filepath.Join(pd, "HyprEditors", "Logs", "install.log")
+		}
+		return ""
+	case "darwin":
+		return "/Library/Logs/HyprEditors/install.log"
+	default:
+		return "/var/log/hypreditors/install.log"
+	}
+}
+
+// openLog opens the run log: the machine-scoped one in silent mode when
+// possible (not in a sandbox), ~/vscode-custom-install.log otherwise
+func (i *Installer) openLog() error {
+	if i.silent && i.sandbox == "" {
+		if p := machineLogPath(); p != "" && os.MkdirAll(filepath.Dir(p), 0o755) == nil {
+			if f, err := os.OpenFile(p, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644); err == nil {
+				i.logPath, i.logger = p, f
+				return nil
+			}
+		}
+	}
+	i.logPath = filepath.Join(i.homeDir, logFileName)
+	logFile, err := os.OpenFile(i.logPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("cannot open log file %s: %w", i.logPath, err)
+	}
+	i.logger = logFile
+	return nil
+}
+
+// fail records the exit code of the first failure
+func (i *Installer) fail(code int) {
+	if i.exitStatus == exitOK {
+		i.exitStatus = code
+	}
+}
+
+// exitCode is the process exit status of the apply run; only silent runs
+// report failures through it
+func (i *Installer) exitCode() int {
+	if !i.silent && !i.quiet {
+		return exitOK
+	}
+	return i.failureStatus()
+}
+
+// failureStatus is the exit code the run would have in silent mode
+func (i *Installer) failureStatus() int {
+	if i.exitStatus == exitOK && len(i.report.Failed) > 0 {
+		return exitExtensions
+	}
+	return i.exitStatus
+}
+
+// loadMandatorySettings merges the manifest's mandatory settings, the
+// payload's policy.json and the --mandatory-settings file (later wins per key)
+func (i *Installer) loadMandatorySettings(file string) error {
+	m := make(map[string]interface{})
+	for k, v := range i.manifest.MandatorySettings {
+		m[k] = v
+	}
+	policy, err := i.loadPolicy()
+	if err != nil {
+		return err
+	}
+	i.policyKeys = make(map[string]bool, len(policy))
+	for k, v := range policy {
+		m[k] = v
+		i.policyKeys[k] = true
+	}
+	if file != "" {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("cannot read %s: %w", file, err)
+		}
+		v, err := parseJSONC(b)
+		obj, ok := v.(map[string]interface{})
+		if err != nil || !ok {
+			return fmt.Errorf("%s: mandatory settings must be a JSON object", file)
+		}
+		for k, v := range obj {
+			m[k] = v
+		}
+	}
+	i.mandatory = m
+	return nil
+}
+
+// isMandatoryKey reports whether key is enforced by the mandatory settings
+func (i *Installer) isMandatoryKey(key string) bool {
+	_, ok := i.mandatory[key]
+	return ok
+}
+
+// applyMandatorySettings sets every mandatory key in settings.json to its
+// value, editing the keys in place so the rest of the file is kept
+func (i *Installer) applyMandatorySettings() error {
+	if len(i.mandatory) == 0 {
+		return nil
+	}
+	dst := filepath.Join(i.vscodeUser, settingsFile)
+	data, err := os.ReadFile(dst)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	cur := map[string]interface{}{}
+	if len(strings.TrimSpace(string(data))) > 0 {
+		v, err := parseJSONC(data)
+		obj, ok := v.(map[string]interface{})
+		if err != nil || !ok {
+			return fmt.Errorf("cannot parse %s to enforce mandatory settings", dst)
+		}
+		cur = obj
+	}
+
+	var changed []string
+	for k, want := range i.mandatory {
+		if have, ok := cur[k]; !ok || !sameJSON(have, want) {
+			changed = append(changed, k)
+		}
+	}
+	if len(changed) == 0 {
+		i.logToFile("mandatory settings already in place")
+		return nil
+	}
+	sort.Strings(changed)
+	if i.dryRun {
+		i.logf("DRY-RUN: would enforce mandatory settings: %s", strings.Join(changed, ", "))
+		if !containsString(i.report.Written, settingsFile) {
+			i.report.Written = append(i.report.Written, settingsFile)
+		}
+		return nil
+	}
+	for _, k := range changed {
+		v, err := json.Marshal(i.mandatory[k])
+		if err != nil {
+			return err
+		}
+		if data, err = jsoncSet(data, k, v); err != nil {
+			return fmt.Errorf("cannot set %s in %s: %w", k, dst, err)
+		}
+	}
+	if err := i.safeWrite(dst, i.formatSettings(data)); err != nil {
+		return fmt.Errorf("cannot write %s: %w", dst, err)
+	}
+	if !containsString(i.report.Written, settingsFile) {
+		i.report.Written = append(i.report.Written, settingsFile)
+	}
+	i.logf("Mandatory settings enforced: %s", strings.Join(changed, ", "))
+	return nil
+}
+
+// expectedSettings is the settings.json verify, plan, status and watch
+// compare with
+func (i *Installer) expectedSettings() []byte {
+	return i.enforcedSettings(i.settingsData)
+}
+
+// enforcedSettings is settings data as an apply leaves it: removed keys
+// deleted, then mandatory keys set. Data that does not parse is returned as is
+func (i *Installer) enforcedSettings(data []byte) []byte {
+	if len(i.removeKeys) == 0 && len(i.mandatory) == 0 {
+		return data
+	}
+	members, _, _, err := jsoncMembers(data)
+	if err != nil {
+		return data
+	}
+	out, edited := data, false
+	for _, m := range members {
+		if !i.isRemovedKey(m.Key) {
+			continue
+		}
+		if out, _, err = jsoncDelete(out, m.Key); err != nil {
+			return data
+		}
+		edited = true
+	}
+	cur := map[string]interface{}{}
+	if len(strings.TrimSpace(string(out))) > 0 {
+		v, err := parseJSONC(out)
+		obj, ok := v.(map[string]interface{})
+		if err != nil || !ok {
+			return data
+		}
+		cur = obj
+	}
+	keys := make([]string, 0, len(i.mandatory))
+	for k := range i.mandatory {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if have, ok := cur[k]; ok && sameJSON(have, i.mandatory[k]) {
+			continue
+		}
+		v, err := json.Marshal(i.mandatory[k])
+		if err != nil {
+			return data
+		}
+		if out, err = jsoncSet(out, k, v); err != nil {
+			return data
+		}
+		edited = true
+	}
+	if !edited {
+		return data
+	}
+	return i.formatSettings(out)
+}
+
+// sameJSON compares decoded JSON values by their encoding, so float64 and
+// json.Number forms of a number are equal
+func sameJSON(a, b interface{}) bool {
+	x, err1 := json.Marshal(a)
+	y, err2 := json.Marshal(b)
+	return err1 == nil && err2 == nil && string(x) == string(y)
+}
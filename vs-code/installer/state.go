@@ -0,0 +1,245 @@
+// state.go
+//
+// Persistent installer state in $XDG_STATE_HOME/hypreditors/state.json
+// (~/.local/state/hypreditors on Linux, ~/Library/Application Support/hypreditors
+// on macOS, %LOCALAPPDATA%\hypreditors on Windows). Unlike the log it is
+// machine-readable and meant to be read back by later runs.
+//
+// Every apply run is recorded with the payload hash, the target user dir,
+// hashes of the files it left behind and the installed extensions, so "is
+// this machine up to date?" is answered from the state file alone, without
+// listing extensions or diffing files.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	stateDirName  = "hypreditors"
+	stateFileName = "state.json"
+	maxRunHistory = 50 // runs kept in state.json
+)
+
+// State is the decoded state.json
+type State struct {
+	// BackupLocations are directories outside the user dir that hold backups (--backup-dir)
+	BackupLocations []string `json:"backupLocations,omitempty"`
+	// Runs are the recorded apply runs, oldest first
+	Runs []RunRecord `json:"runs,omitempty"`
+	// Checkpoints hold the completed steps of the unfinished run of each
+	// target (VS Code user dir), see checkpoint.go
+	Checkpoints map[string]*Checkpoint `json:"checkpoints,omitempty"`
+}
+
+// RunRecord describes one apply run
+type RunRecord struct {
+	Time              time.Time         `json:"time"`
+	Target            string            `json:"target"`           // VS Code user dir
+	Editor            string            `json:"editor,omitempty"` // code CLI used
+	PayloadHash       string            `json:"payloadHash"`
+	PayloadVersion    string            `json:"payloadVersion,omitempty"`    // manifest "version"
+	PayloadKeys       map[string]string `json:"payloadKeys,omitempty"`       // payload settings key -> value hash
+	PayloadExtensions []string          `json:"payloadExtensions,omitempty"` // payload extension list
+	Files             map[string]string `json:"files,omitempty"`             // payload file -> sha256 after the run
+	Extensions        []string          `json:"extensions,omitempty"`        // id@version installed after the run
+}
+
+// stateDir returns the per-user state directory
+func stateDir(home string) string {
+	switch runtime.GOOS {
+	case "windows":
+		if d := os.Getenv("LOCALAPPDATA"); d != "" {
+			return filepath.Join(d, stateDirName)
+		}
+		return filepath.Join(home, "AppData", "Local", stateDirName)
+	case "darwin":
+		return filepath.Join(home, "Library", "Application Support", stateDirName)
+	default:
+		if d := os.Getenv("XDG_STATE_HOME"); d != "" {
+			return filepath.Join(d, stateDirName)
+		}
+		return filepath.Join(home, ".local", "state", stateDirName)
+	}
+}
+
+func (i *Installer) statePath() string {
+	return filepath.Join(stateDir(i.homeDir), stateFileName)
+}
+
+// loadState reads state.json; a missing file yields an empty state
+func (i *Installer) loadState() (State, error) {
+	var st State
+	b, err := os.ReadFile(i.statePath())
+	if os.IsNotExist(err) {
+		return st, nil
+	}
+	if err != nil {
+		return st, err
+	}
+	if err := json.Unmarshal(b, &st); err != nil {
+		return st, fmt.Errorf("corrupt %s: %w", i.statePath(), err)
+	}
+	return st, nil
+}
+
+// saveState writes state.json atomically (temp file + rename)
+func (i *Installer) saveState(st State) error {
+	if i.dryRun {
+		return nil
+	}
+	p := i.statePath()
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, append(b, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+// updateState loads the state, applies fn and saves it back
+func (i *Installer) updateState(fn func(*State)) error {
+	st, err := i.loadState()
+	if err != nil {
+		return err
+	}
+	fn(&st)
+	return i.saveState(st)
+}
+
+// payloadHash identifies the payload contents (files, extension list, blocklist)
+func (i *Installer) payloadHash() string {
+	h := sha256.New()
+	for _, part := range [][]byte{i.settingsData, i.keybindData} {
+		fmt.Fprintf(h, "%d:", len(part))
+		h.Write(part)
+	}
+	for _, s := range i.extList {
+		fmt.Fprintf(h, "ext:%s\n", s)
+	}
+	for _, b := range i.blocklist {
+		fmt.Fprintf(h, "block:%s\n", b)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// fileHash returns the sha256 of a file, "" when it cannot be read
+func fileHash(path string) string {
+	// streamed: the file may be a large .vsix
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// payloadTargets maps each non-empty payload file to its live path
+func (i *Installer) payloadTargets() map[string]string {
+	res := make(map[string]string)
+	if len(i.settingsData) > 0 {
+		res[settingsFile] = filepath.Join(i.vscodeUser, settingsFile)
+	}
+	if len(i.keybindData) > 0 {
+		res[keybindingsFile] = filepath.Join(i.vscodeUser, keybindingsFile)
+	}
+	return res
+}
+
+// recordRun appends this run to the state file
+func (i *Installer) recordRun() error {
+	rec := RunRecord{
+		Time:              time.Now(),
+		Target:            i.vscodeUser,
+		Editor:            i.codeCLIPath,
+		PayloadHash:       i.payloadHash(),
+		PayloadVersion:    i.payloadVersion(),
+		PayloadKeys:       i.payloadKeys(),
+		PayloadExtensions: i.payloadExtensions(),
+		Files:             make(map[string]string),
+	}
+	for name, p := range i.payloadTargets() {
+		rec.Files[name] = fileHash(p)
+	}
+	if i.codeCLIPath != "" {
+		if installed, err := i.installedExtensions(); err == nil {
+			for _, e := range installed {
+				rec.Extensions = append(rec.Extensions, e.ID+"@"+e.Version)
+			}
+		}
+	}
+	return i.updateState(func(st *State) {
+		st.Runs = append(st.Runs, rec)
+		if len(st.Runs) > maxRunHistory {
+			st.Runs = st.Runs[len(st.Runs)-maxRunHistory:]
+		}
+	})
+}
+
+// lastRun returns the newest recorded run for target
+func (st State) lastRun(target string) (RunRecord, bool) {
+	for k := len(st.Runs) - 1; k >= 0; k-- {
+		if st.Runs[k].Target == target {
+			return st.Runs[k], true
+		}
+	}
+	return RunRecord{}, false
+}
+
+// upToDateFromState tells from the state file alone whether this payload was
+// applied to the target and its files are unchanged since; why explains a "no"
+func (i *Installer) upToDateFromState() (ok bool, why string) {
+	st, err := i.loadState()
+	if err != nil {
+		return false, err.Error()
+	}
+	rec, found := st.lastRun(i.vscodeUser)
+	switch {
+	case !found:
+		return false, "never applied to " + i.vscodeUser
+	case rec.PayloadHash != i.payloadHash():
+		return false, "payload changed since the last apply (" + rec.Time.Format(time.RFC3339) + ")"
+	}
+	for name, p := range i.payloadTargets() {
+		if fileHash(p) != rec.Files[name] {
+			return false, name + " changed since the last apply (" + rec.Time.Format(time.RFC3339) + ")"
+		}
+	}
+	for _, spec := range i.extList {
+		if !appliedExtension(rec.Extensions, spec) {
+			return false, spec.ID + " was not installed by the last apply (" + rec.Time.Format(time.RFC3339) + ")"
+		}
+	}
+	return true, "applied " + rec.Time.Format(time.RFC3339)
+}
+
+// appliedExtension reports whether spec is among the recorded id@version list
+func appliedExtension(recorded []string, spec extensionSpec) bool {
+	for _, e := range recorded {
+		id, ver, _ := strings.Cut(e, "@")
+		if strings.EqualFold(id, spec.ID) && (spec.Version == "" || ver == spec.Version) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+// status.go
+//
+// `status` subcommand: a quick health check per target editor recorded in
+// the state file — last apply time, which payload was applied, how many of
+// the listed extensions are present and whether settings/keybindings still
+// match the payload. Built on the run records (state.go) and verifyFile.
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pterm/pterm"
+)
+
+func runStatus(args []string) error {
+	fs, opts := newCommandFlags("status")
+	fs.Parse(args)
+
+	inst, err := openInstaller(opts)
+	if err != nil {
+		return err
+	}
+	defer inst.Close()
+
+	st, err := inst.loadState()
+	if err != nil {
+		return err
+	}
+	targets := []string{inst.vscodeUser}
+	for _, r := range st.Runs {
+		if r.Target != inst.vscodeUser && !containsString(targets, r.Target) {
+			targets = append(targets, r.Target)
+		}
+	}
+
+	current := inst.payloadHash()
+	rows := [][]string{{"Target", "Editor", "Last apply", "Payload", "Extensions", settingsFile, keybindingsFile}}
+	for _, t := range targets {
+		rec, found := st.lastRun(t)
+		if !found {
+			rows = append(rows, []string{t, "-", "never", "-", inst.extensionStatus(t, rec), inst.fileStatus(t, settingsFile, inst.expectedSettings()), inst.fileStatus(t, keybindingsFile, inst.keybindData)})
+			continue
+		}
+		payload := payloadLabel(rec.PayloadVersion, rec.PayloadHash)
+		if rec.PayloadHash == current {
+			payload += " (current)"
+		} else {
+			payload += " (outdated)"
+		}
+		editor := "-"
+		if rec.Editor != "" {
+			editor = filepath.Base(rec.Editor)
+		}
+		rows = append(rows, []string{
+			t, editor, rec.Time.Local().Format(time.DateTime), payload,
+			inst.extensionStatus(t, rec),
+			inst.fileStatus(t, settingsFile, inst.expectedSettings()),
+			inst.fileStatus(t, keybindingsFile, inst.keybindData),
+		})
+	}
+	pterm.DefaultTable.WithHasHeader().WithData(rows).Render()
+	return nil
+}
+
+// fileStatus says whether a payload file still matches under target
+func (i *Installer) fileStatus(target, name string, want []byte) string {
+	if len(want) == 0 {
+		return "-"
+	}
+	switch verifyFile(name, filepath.Join(target, name), want).Status {
+	case driftOK:
+		return "match"
+	case driftMissing:
+		return "missing"
+	default:
+		return "drifted"
+	}
+}
+
+// extensionStatus counts listed extensions present under target: live via the
+// editor CLI of the current target, from the recorded run otherwise
+func (i *Installer) extensionStatus(target string, rec RunRecord) string {
+	if len(i.extList) == 0 {
+		return "-"
+	}
+	var have []installedExtension
+	if target == i.vscodeUser && i.ensureCodeCLI() == nil {
+		installed, err := i.installedExtensions()
+		if err != nil {
+			return "unknown"
+		}
+		have = installed
+	} else {
+		for _, e := range rec.Extensions {
+			id, ver, _ := strings.Cut(e, "@")
+			have = append(have, installedExtension{ID: id, Version: ver})
+		}
+	}
+	present := 0
+	for _, spec := range i.extList {
+		ver := installedVersion(have, spec.ID)
+		if ver != "" && (spec.Version == "" || ver == spec.Version) {
+			present++
+		}
+	}
+	return fmt.Sprintf("%d present, %d missing", present, len(i.extList)-present)
+}
+
+func shortHash(h string) string {
+	if len(h) > 12 {
+		return h[:12]
+	}
+	return h
+}
+
+func containsString(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+// strict.go
+//
+// Strict mode (--strict) for automated pipelines: the first error of an
+// apply run — a failed backup, a file that cannot be written, the first
+// extension that fails to install, anything else logged as an error — ends
+// the run right after the step it happened in. The config files written so
+// far are put back from their safety copies (safety.go) and their recorded
+// merge bases (merge.go) with them, so the target is left as it was before
+// the run, and the process exits non-zero even in interactive mode: with
+// the exit* code of the failure, exitFailure when the error set none.
+// Extensions installed before the failure stay, unless the run is a
+// --transaction with --rollback-extensions (journal.go).
+
+package main
+
+// strictAbort reports whether a strict run has to stop here; it rolls the
+// written files back and returns the exit code of the run
+func (i *Installer) strictAbort() (int, bool) {
+	if !i.strict || (i.errorCount.Load() == 0 && i.failureStatus() == exitOK) {
+		return exitOK, false
+	}
+	if i.failureStatus() == exitOK {
+		i.fail(exitFailure)
+	}
+	i.errorf("--strict: stopping at the first error")
+	if i.txn != nil {
+		i.rollbackTransaction()
+	} else {
+		i.rollbackFiles()
+	}
+	return i.failureStatus(), true
+}
+
+// rollbackFiles restores every file written during this run from its
+// safety copy, the latest first
+func (i *Installer) rollbackFiles() {
+	for k := len(i.safety) - 1; k >= 0; k-- {
+		c := i.safety[k]
+		if err := c.restore(); err != nil {
+			i.errorf("Rollback of %s failed: %v", c.Path, err)
+			continue
+		}
+		i.logf("Rolled back %s", c.Path)
+	}
+	// the next merge starts from the base the files went back to
+	for k := len(i.appliedPrev) - 1; k >= 0; k-- {
+		if err := i.appliedPrev[k].restore(); err != nil {
+			i.warnf("cannot restore the merge base %s: %v", i.appliedPrev[k].Path, err)
+		}
+	}
+	// nothing of this run stays written
+	i.safety, i.report.Written, i.appliedPrev = nil, nil, nil
+	i.clearCheckpoint()
+}
@@ -0,0 +1,287 @@
+// theia.go
+//
+// Theia-based workspaces (--theia <dir>): Gitpod and vendor IDEs built on
+// Eclipse Theia read the workspace settings from <dir>/.theia/settings.json
+// and install the extensions listed under vscode.extensions of
+// <dir>/.gitpod.yml when the workspace starts. Both are written from the
+// same payload as the local editor, so a cloud workspace matches it:
+//
+//   .theia/settings.json   the payload's settings.json, merged like
+//                          --workspace-settings (payload keys set, the
+//                          project's other keys and comments kept; user-scope
+//                          keys and keys holding a {{ secret }} reported and
+//                          left out)
+//   .gitpod.yml            vscode.extensions gets every payload extension
+//                          (id or id@version when pinned); entries already
+//                          listed stay in place, a pin is updated, the rest
+//                          of the file is not touched
+//
+// The user-level apply does not run.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	theiaDir       = ".theia"
+	gitpodFileName = ".gitpod.yml"
+)
+
+// applyTheia writes the payload into the Theia/Gitpod workspace dir
+func (i *Installer) applyTheia(dir string) error {
+	dir = i.expandHome(dir)
+	if st, err := os.Stat(dir); err != nil || !st.IsDir() {
+		return fmt.Errorf("%s is not a folder", dir)
+	}
+	var errs []error
+	if len(i.settingsData) > 0 {
+		if err := i.applyTheiaSettings(dir); err != nil {
+			errs = append(errs, err)
+		}
+	} else {
+		i.warnf("%s payload is empty — %s/%s not written", settingsFile, theiaDir, settingsFile)
+	}
+	if len(i.extList) > 0 {
+		if err := i.applyGitpodExtensions(dir); err != nil {
+			errs = append(errs, err)
+		}
+	} else {
+		i.warnf("No extensions in the payload — %s not changed", gitpodFileName)
+	}
+	return errors.Join(errs...)
+}
+
+// applyTheiaSettings merges the payload settings into .theia/settings.json
+func (i *Installer) applyTheiaSettings(dir string) error {
+	payload := i.settingsData
+	members, _, _, err := jsoncMembers(payload)
+	if err != nil {
+		return fmt.Errorf("%s: %w", settingsFile, err)
+	}
+	var dropped, secret []string
+	for _, m := range members {
+		switch {
+		case isUserScopeKey(m.Key):
+			dropped = append(dropped, m.Key)
+		case i.holdsSecret(payload[m.ValueStart:m.End]):
+			secret = append(secret, m.Key)
+		}
+	}
+	for _, k := range append(dropped, secret...) {
+		if payload, _, err = jsoncDelete(payload, k); err != nil {
+			return err
+		}
+	}
+	if len(dropped) > 0 {
+		i.warnf("%s: user-scope settings ignored in a workspace: %s", settingsFile, strings.Join(dropped, ", "))
+	}
+	if len(secret) > 0 {
+		i.warnf("%s: settings holding secrets are not written into the project: %s", settingsFile, strings.Join(secret, ", "))
+	}
+	dst := filepath.Join(dir, theiaDir, settingsFile)
+	cur, err := os.ReadFile(dst)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	out, summary := payload, "new file"
+	if err == nil {
+		var keys []string
+		if out, keys, err = mergeWorkspaceSettings(cur, payload); err != nil {
+			return fmt.Errorf("%s: %w", dst, err)
+		}
+		if len(keys) == 0 {
+			i.logf("%s already up to date", dst)
+			i.report.UpToDate = append(i.report.UpToDate, dst)
+			return nil
+		}
+		summary = "set " + strings.Join(keys, ", ")
+	}
+	return i.writeTheiaFile(dst, out, summary)
+}
+
+// applyGitpodExtensions puts the payload extensions into .gitpod.yml
+func (i *Installer) applyGitpodExtensions(dir string) error {
+	dst := filepath.Join(dir, gitpodFileName)
+	cur, err := os.ReadFile(dst)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	want := make([]string, 0, len(i.extList))
+	for _, ext := range i.extList {
+		want = append(want, ext.String())
+	}
+	out, changed, err := setGitpodExtensions(string(cur), want)
+	if err != nil {
+		return fmt.Errorf("%s: %w", dst, err)
+	}
+	if len(changed) == 0 {
+		i.logf("%s already up to date", dst)
+		i.report.UpToDate = append(i.report.UpToDate, dst)
+		return nil
+	}
+	return i.writeTheiaFile(dst, []byte(out), "vscode.extensions: "+strings.Join(changed, ", "))
+}
+
+func (i *Installer) writeTheiaFile(dst string, data []byte, summary string) error {
+	if i.dryRun {
+		i.logf("DRY-RUN: would write %s (%s)", dst, summary)
+		i.report.Written = append(i.report.Written, dst)
+		return nil
+	}
+	if err := i.safeWrite(dst, data); err != nil {
+		return fmt.Errorf("cannot write %s: %w", dst, err)
+	}
+	i.report.Written = append(i.report.Written, dst)
+	i.logf("Theia workspace %s: %s", dst, summary)
+	return nil
+}
+
+// gitpodEntryID is the extension id of a vscode.extensions entry
+// ("id", "id@version", quoted, with a trailing comment)
+func gitpodEntryID(entry string) string {
+	id, _, _ := strings.Cut(gitpodEntryValue(entry), "@")
+	return strings.ToLower(id)
+}
+
+func gitpodEntryValue(entry string) string {
+	if k := strings.Index(entry, " #"); k >= 0 {
+		entry = entry[:k]
+	}
+	return strings.Trim(strings.TrimSpace(entry), `"'`)
+}
+
+// setGitpodExtensions returns src with want merged into vscode.extensions
+// and the entries it added or re-pinned
+func setGitpodExtensions(src string, want []string) (string, []string, error) {
+	lines := strings.Split(strings.TrimRight(src, "\n"), "\n")
+	if src == "" {
+		lines = nil
+	}
+	indentOf := func(l string) int { return len(l) - len(strings.TrimLeft(l, " ")) }
+	blank := func(l string) bool {
+		t := strings.TrimSpace(l)
+		return t == "" || strings.HasPrefix(t, "#")
+	}
+
+	// the top-level vscode: block
+	vs := -1
+	for k, l := range lines {
+		if indentOf(l) == 0 && strings.TrimSpace(strings.SplitN(l, "#", 2)[0]) == "vscode:" {
+			vs = k
+			break
+		}
+		if indentOf(l) == 0 && strings.HasPrefix(l, "vscode:") {
+			return "", nil, errors.New("vscode: is not a mapping")
+		}
+	}
+	if vs < 0 {
+		if len(lines) > 0 && lines[len(lines)-1] != "" {
+			lines = append(lines, "")
+		}
+		lines = append(lines, "vscode:", "  extensions:")
+		for _, w := range want {
+			lines = append(lines, "    - "+w)
+		}
+		return strings.Join(lines, "\n") + "\n", want, nil
+	}
+	end := len(lines)
+	for k := vs + 1; k < len(lines); k++ {
+		if !blank(lines[k]) && indentOf(lines[k]) == 0 {
+			end = k
+			break
+		}
+	}
+
+	// its extensions: key and the items below it
+	ex, exIndent := -1, 2
+	for k := vs + 1; k < end; k++ {
+		t := strings.TrimSpace(lines[k])
+		if strings.HasPrefix(t, "extensions:") {
+			ex, exIndent = k, indentOf(lines[k])
+			break
+		}
+	}
+	var items []string // current entries, as written
+	last := end
+	if ex >= 0 {
+		rest := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(lines[ex]), "extensions:"))
+		if k := strings.Index(rest, " #"); k >= 0 {
+			rest = strings.TrimSpace(rest[:k])
+		}
+		switch {
+		case strings.HasPrefix(rest, "[") && strings.HasSuffix(rest, "]"):
+			// flow sequence: rewritten as a block below
+			for _, e := range strings.Split(strings.Trim(rest, "[]"), ",") {
+				if e = strings.TrimSpace(e); e != "" {
+					items = append(items, e)
+				}
+			}
+			last = ex + 1
+		case rest != "":
+			return "", nil, fmt.Errorf("vscode.extensions is not a list")
+		default:
+			last = ex + 1
+			for k := ex + 1; k < end; k++ {
+				t := strings.TrimSpace(lines[k])
+				if blank(lines[k]) {
+					continue
+				}
+				if (!strings.HasPrefix(t, "- ") && t != "-") || indentOf(lines[k]) < exIndent {
+					break
+				}
+				items = append(items, strings.TrimSpace(strings.TrimPrefix(t, "-")))
+				last = k + 1
+			}
+		}
+	}
+
+	var changed []string
+	for _, w := range want {
+		id := gitpodEntryID(w)
+		found := false
+		for k, it := range items {
+			if gitpodEntryID(it) != id {
+				continue
+			}
+			found = true
+			if strings.Contains(w, "@") && !strings.EqualFold(gitpodEntryValue(it), w) {
+				items[k] = w
+				changed = append(changed, w)
+			}
+			break
+		}
+		if !found {
+			items = append(items, w)
+			changed = append(changed, w)
+		}
+	}
+	if len(changed) == 0 {
+		return src, nil, nil
+	}
+
+	block := make([]string, 0, len(items)+1)
+	pad := strings.Repeat(" ", exIndent+2)
+	for _, it := range items {
+		block = append(block, pad+"- "+it)
+	}
+	var out []string
+	if ex < 0 {
+		// vscode: without extensions: the list goes first in the block
+		out = append(out, lines[:vs+1]...)
+		out = append(out, strings.Repeat(" ", exIndent)+"extensions:")
+		out = append(out, block...)
+		out = append(out, lines[vs+1:]...)
+	} else {
+		out = append(out, lines[:ex]...)
+		out = append(out, strings.Repeat(" ", exIndent)+"extensions:")
+		out = append(out, block...)
+		out = append(out, lines[last:]...)
+	}
+	return strings.Join(out, "\n") + "\n", changed, nil
+}
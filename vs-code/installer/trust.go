@@ -0,0 +1,214 @@
+// trust.go
+//
+// Workspace trust, managed only when the manifest opts in:
+//
+//   "workspaceTrust": {
+//     "manage": true,
+//     "settings": {"startupPrompt": "never", "untrustedFiles": "open"},
+//     "trustedFolders": ["~/work/**", "~/src/team-*"]
+//   }
+//
+// settings are security.workspace.trust.* keys (the prefix may be left out)
+// added to the payload's settings.json. trustedFolders are pre-trusted:
+// VS Code keeps the list in its state database (globalStorage/state.vscdb,
+// SQLite), updated through the sqlite3 CLI. Trusting a folder trusts all
+// folders below it, so "dir/**" trusts dir itself; other patterns are
+// expanded to the existing folders they match. Folders the user trusted
+// already stay trusted. The editor rewrites its state when it exits, so it
+// should not be running during the apply.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	trustSettingsPrefix = "security.workspace.trust."
+	trustStateKey       = "content.trust.model.key"
+	stateDBFile         = "globalStorage/state.vscdb"
+	sqliteTimeout       = 10 * time.Second
+)
+
+// WorkspaceTrust is the manifest's "workspaceTrust" section
+type WorkspaceTrust struct {
+	Manage         bool                       `json:"manage"`
+	Settings       map[string]json.RawMessage `json:"settings,omitempty"`
+	TrustedFolders []string                   `json:"trustedFolders,omitempty"`
+}
+
+// trustURI is a folder URI as VS Code stores it
+type trustURI struct {
+	Mid       int    `json:"$mid"`
+	Scheme    string `json:"scheme"`
+	Authority string `json:"authority,omitempty"`
+	Path      string `json:"path"`
+	Query     string `json:"query,omitempty"`
+	Fragment  string `json:"fragment,omitempty"`
+	FsPath    string `json:"fsPath,omitempty"`
+	External  string `json:"external,omitempty"`
+}
+
+// trustEntry is one element of the stored "uriTrustInfo"
+type trustEntry struct {
+	URI     trustURI `json:"uri"`
+	Trusted bool     `json:"trusted"`
+}
+
+// applyTrustSettings adds the manifest's workspace trust settings to the
+// settings payload
+func (i *Installer) applyTrustSettings() error {
+	wt := i.manifest.WorkspaceTrust
+	if wt == nil || !wt.Manage || len(wt.Settings) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(wt.Settings))
+	for k := range wt.Settings {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	data := i.settingsData
+	for _, k := range keys {
+		full := k
+		if !strings.HasPrefix(full, trustSettingsPrefix) {
+			full = trustSettingsPrefix + k
+		}
+		var err error
+		if data, err = setSettingsKey(data, full, wt.Settings[k]); err != nil {
+			return fmt.Errorf("%s: workspaceTrust: %s: %w", manifestFile, k, err)
+		}
+	}
+	i.settingsData = data
+	i.logToFile("applied %d workspace trust settings", len(keys))
+	return nil
+}
+
+// trustedFolderPaths expands the manifest's trusted folder patterns
+func (i *Installer) trustedFolderPaths(patterns []string) []string {
+	var res []string
+	for _, p := range patterns {
+		p = i.expandHome(strings.TrimSuffix(p, "/**"))
+		matches, err := filepath.Glob(p)
+		if err != nil {
+			i.warnf("workspaceTrust: bad pattern %q: %v", p, err)
+			continue
+		}
+		if len(matches) == 0 && !strings.ContainsAny(p, "*?[") {
+			// a folder that does not exist yet can be trusted ahead of time
+			matches = []string{p}
+		}
+		for _, m := range matches {
+			if st, err := os.Stat(m); err == nil && !st.IsDir() {
+				continue
+			}
+			if abs, err := filepath.Abs(m); err == nil && !containsString(res, abs) {
+				res = append(res, abs)
+			}
+		}
+	}
+	return res
+}
+
+// folderTrustURI builds the stored URI of a local folder
+func folderTrustURI(dir string) trustURI {
+	p := filepath.ToSlash(dir)
+	if runtime.GOOS == "windows" {
+		// c:\work -> /c:/work, drive letter lower case as VS Code writes it
+		p = "/" + strings.ToLower(p[:1]) + p[1:]
+	}
+	u := url.URL{Scheme: "file", Path: p}
+	return trustURI{Mid: 1, Scheme: "file", Path: p, FsPath: dir, External: u.String()}
+}
+
+// sqlite runs one SQL statement on the state database
+func sqlite(db, sql string) (string, error) {
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		return "", errors.New("sqlite3 not found in PATH")
+	}
+	out, err := runCommandWithTimeout(sqliteTimeout, "sqlite3", db, sql)
+	if err != nil {
+		return "", fmt.Errorf("sqlite3: %v: %s", err, strings.TrimSpace(out))
+	}
+	return out, nil
+}
+
+// applyTrustedFolders pre-trusts the manifest's folders in VS Code's state
+func (i *Installer) applyTrustedFolders() error {
+	wt := i.manifest.WorkspaceTrust
+	if wt == nil || !wt.Manage || len(wt.TrustedFolders) == 0 {
+		return nil
+	}
+	folders := i.trustedFolderPaths(wt.TrustedFolders)
+	if len(folders) == 0 {
+		return nil
+	}
+	db := filepath.Join(i.vscodeUser, filepath.FromSlash(stateDBFile))
+	// other members of the stored state are written back as they were
+	model := make(map[string]json.RawMessage)
+	var entries []trustEntry
+	if exists(db) {
+		cur, err := sqlite(db, "SELECT value FROM ItemTable WHERE key = '"+trustStateKey+"';")
+		if err != nil {
+			return fmt.Errorf("cannot read trusted folders: %w", err)
+		}
+		if s := strings.TrimSpace(cur); s != "" {
+			if err := json.Unmarshal([]byte(s), &model); err != nil {
+				return fmt.Errorf("cannot read trusted folders: %w", err)
+			}
+			if raw, ok := model["uriTrustInfo"]; ok {
+				if err := json.Unmarshal(raw, &entries); err != nil {
+					return fmt.Errorf("cannot read trusted folders: %w", err)
+				}
+			}
+		}
+	}
+
+	var added []string
+	for _, dir := range folders {
+		uri := folderTrustURI(dir)
+		found := false
+		for n, t := range entries {
+			if t.URI.Scheme == uri.Scheme && t.URI.Authority == "" && strings.EqualFold(t.URI.Path, uri.Path) {
+				if !t.Trusted {
+					entries[n].Trusted = true
+					added = append(added, dir)
+				}
+				found = true
+			}
+		}
+		if !found {
+			entries = append(entries, trustEntry{URI: uri, Trusted: true})
+			added = append(added, dir)
+		}
+	}
+	if len(added) == 0 {
+		i.logToFile("trusted folders already up to date")
+		return nil
+	}
+	if i.dryRun {
+		i.logf("DRY-RUN: would trust %s", strings.Join(added, ", "))
+		return nil
+	}
+	model["uriTrustInfo"], _ = json.Marshal(entries)
+	value, _ := json.Marshal(model)
+	sql := "CREATE TABLE IF NOT EXISTS ItemTable (key TEXT UNIQUE ON CONFLICT REPLACE, value BLOB);" +
+		"INSERT OR REPLACE INTO ItemTable (key, value) VALUES ('" + trustStateKey + "', '" + strings.ReplaceAll(string(value), "'", "''") + "');"
+	if err := os.MkdirAll(filepath.Dir(db), 0o755); err != nil {
+		return err
+	}
+	if _, err := sqlite(db, sql); err != nil {
+		return fmt.Errorf("cannot write trusted folders: %w", err)
+	}
+	i.logf("Trusted folders: %s", strings.Join(added, ", "))
+	return nil
+}
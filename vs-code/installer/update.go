@@ -0,0 +1,179 @@
+// update.go
+//
+// `update` subcommand: compares installed extension versions with the latest
+// versions published in the registry, prints the outdated ones and, with
+// --apply, updates only those that are part of the curated extensions list.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pterm/pterm"
+)
+
+// outdatedExtension is an installed extension with a newer registry version
+type outdatedExtension struct {
+	ID        string
+	Installed string
+	Latest    string
+	Curated   bool
+	Pinned    bool // curated entry pinned to a version — never auto-updated
+}
+
+func runUpdate(args []string) error {
+	fs, opts := newCommandFlags("update")
+	apply := fs.Bool("apply", false, "Update outdated extensions that are in the curated list")
+	registry := fs.String("registry", registryAuto, "Metadata source: auto, marketplace or openvsx")
+	fs.Parse(args)
+
+	inst, err := openInstaller(opts)
+	if err != nil {
+		return err
+	}
+	defer inst.Close()
+
+	if err := inst.ensureCodeCLI(); err != nil {
+		return fmt.Errorf("code CLI not found: %w", err)
+	}
+	outdated, err := inst.findOutdated(inst.resolveRegistry(*registry))
+	if err != nil {
+		return err
+	}
+	if len(outdated) == 0 {
+		pterm.Success.Println("All installed extensions are up to date.")
+		return nil
+	}
+
+	rows := [][]string{{"Extension", "Installed", "Latest", "Curated"}}
+	var toUpdate []extensionSpec
+	for _, o := range outdated {
+		mark := ""
+		switch {
+		case o.Pinned:
+			mark = "pinned"
+		case o.Curated:
+			mark = "yes"
+			// the curated entry keeps its timeout and retries; only a
+			// pin is dropped to take the latest version
+			spec, _ := findSpec(inst.extList, o.ID)
+			spec.Version = ""
+			toUpdate = append(toUpdate, spec)
+		}
+		rows = append(rows, []string{o.ID, o.Installed, o.Latest, mark})
+	}
+	pterm.DefaultTable.WithHasHeader().WithData(rows).Render()
+	inst.logf("%d outdated extensions, %d of them in the curated list", len(outdated), len(toUpdate))
+
+	if !*apply {
+		return nil
+	}
+	if len(toUpdate) == 0 {
+		inst.logf("No curated extensions to update.")
+		return nil
+	}
+	if !inst.assumeYes {
+		ok, err := askYesNoDefaultYes(bufio.NewReader(os.Stdin), fmt.Sprintf("Обновить %d расширений из списка?", len(toUpdate)), true)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			inst.logf("User declined to update extensions")
+			return nil
+		}
+	}
+	err = inst.updateExtensions(toUpdate)
+	inst.printSummary()
+	return err
+}
+
+// findOutdated lists installed extensions whose registry version is newer
+func (i *Installer) findOutdated(registry string) ([]outdatedExtension, error) {
+	installed, err := i.installedExtensions()
+	if err != nil {
+		return nil, fmt.Errorf("cannot list installed extensions: %w", err)
+	}
+	ids := make([]string, 0, len(installed))
+	for _, e := range installed {
+		ids = append(ids, e.ID)
+	}
+	i.logf("Checking %d installed extensions against %s", len(ids), registry)
+	meta, err := i.fetchExtensionMeta(registry, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []outdatedExtension
+	for _, e := range installed {
+		m, ok := meta[strings.ToLower(e.ID)]
+		if !ok {
+			i.warnf("%s not found in %s — skipping", e.ID, registry)
+			continue
+		}
+		if compareVersions(m.Version, e.Version) > 0 {
+			spec, curated := findSpec(i.extList, e.ID)
+			res = append(res, outdatedExtension{
+				ID:        e.ID,
+				Installed: e.Version,
+				Latest:    m.Version,
+				Curated:   curated,
+				Pinned:    curated && spec.Version != "",
+			})
+		}
+	}
+	return res, nil
+}
+
+// updateExtensions reinstalls each extension with --force, which pulls the latest version
+func (i *Installer) updateExtensions(ids []extensionSpec) error {
+	total := len(ids)
+	pbar, _ := pterm.DefaultProgressbar.WithTotal(total).WithTitle("Updating extensions").Start()
+	failed := 0
+	for idx, ext := range ids {
+		pbar.UpdateTitle(fmt.Sprintf("[%d/%d] %s", idx+1, total, ext))
+		if err := i.installOne(ext); err != nil {
+			i.errorf("%v", err)
+			failed++
+		}
+		pbar.Increment()
+		i.throttle(minSleepMs, maxSleepMs)
+	}
+	pbar.Stop()
+	if failed > 0 {
+		return fmt.Errorf("%d of %d extensions failed to update", failed, total)
+	}
+	return nil
+}
+
+// compareVersions compares dotted numeric versions ("1.10.2" > "1.9.0").
+// A missing component counts as 0, a non-numeric suffix ("-pre") is ignored.
+func compareVersions(a, b string) int {
+	pa := strings.Split(a, ".")
+	pb := strings.Split(b, ".")
+	for k := 0; k < len(pa) || k < len(pb); k++ {
+		va, vb := versionPart(pa, k), versionPart(pb, k)
+		if va != vb {
+			if va > vb {
+				return 1
+			}
+			return -1
+		}
+	}
+	return 0
+}
+
+func versionPart(parts []string, k int) int {
+	if k >= len(parts) {
+		return 0
+	}
+	p := parts[k]
+	if cut := strings.IndexFunc(p, func(r rune) bool { return r < '0' || r > '9' }); cut >= 0 {
+		p = p[:cut]
+	}
+	v, _ := strconv.Atoi(p)
+	return v
+}
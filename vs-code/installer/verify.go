@@ -0,0 +1,372 @@
+// verify.go
+//
+// `verify` subcommand: drift detection. Compares the live settings.json,
+// keybindings.json and extension set with the payload and reports every
+// difference per file (changed settings keys) and per extension. Exits
+// non-zero when anything drifted, so it can gate CI jobs and compliance
+// checks. Nothing is written, except that changed locked settings
+// (policy.json) are restored and reported as policy violations. --output
+// json prints the report as one JSON document on stdout (and nothing else)
+// for pipelines and dashboards.
+//
+// --enforce-exit is the compliance scanner mode: nothing is written (locked
+// settings are reported, not restored), stdout is one JSON document listing
+// the violations (changed locked settings, blocked extensions present,
+// listed extensions missing or at the wrong pinned version) and the exit
+// code is exitNonCompliant when there is any. Other drift is not a violation.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pterm/pterm"
+)
+
+// drift statuses of a payload file
+const (
+	driftOK      = "ok"
+	driftMissing = "missing"
+	driftChanged = "changed"
+)
+
+// keyDrift is one settings key whose live value differs from the payload;
+// Want and Have may be JSON null, so presence is tracked separately
+type keyDrift struct {
+	Key     string      `json:"key"`
+	Want    interface{} `json:"expected"`
+	Have    interface{} `json:"actual"`
+	Wanted  bool        `json:"inPayload"` // the key is in the payload
+	Present bool        `json:"present"`   // the key is in the live file
+}
+
+// fileDrift is the verification result of one payload file
+type fileDrift struct {
+	Name   string     `json:"name"`
+	Path   string     `json:"path"`
+	Status string     `json:"status"`
+	Keys   []keyDrift `json:"changedKeys,omitempty"` // settings only, when both sides parse
+}
+
+// extDrift is a listed extension that is missing or at the wrong version
+type extDrift struct {
+	ID   string `json:"id"`
+	Want string `json:"expected,omitempty"` // pinned version, "" = any
+	Have string `json:"actual,omitempty"`   // installed version, "" = not installed
+}
+
+// violation is one compliance finding of verify --enforce-exit
+type violation struct {
+	Type     string      `json:"type"` // policy, blockedExtension, missingExtension
+	Key      string      `json:"key,omitempty"`
+	ID       string      `json:"id,omitempty"`
+	Expected interface{} `json:"expected,omitempty"`
+	Actual   interface{} `json:"actual,omitempty"`
+}
+
+// complianceReport is the output of verify --enforce-exit
+type complianceReport struct {
+	Compliant  bool        `json:"compliant"`
+	Violations []violation `json:"violations"`
+}
+
+// driftReport is the outcome of verify
+type driftReport struct {
+	Drift     bool        `json:"drift"`
+	Files     []fileDrift `json:"files"`
+	Missing   []extDrift  `json:"missingExtensions"` // listed but absent or at the wrong pinned version
+	Blocked   []string    `json:"blockedExtensions"` // installed although blocked
+	Extra     []string    `json:"extraExtensions"`   // installed but not listed
+	Policy    []keyDrift  `json:"policyViolations"`  // locked settings found changed (restored)
+	exactExts bool        // extras count as drift
+}
+
+// drifted reports whether anything differs from the payload
+func (r *driftReport) drifted() bool {
+	for _, f := range r.Files {
+		if f.Status != driftOK {
+			return true
+		}
+	}
+	return len(r.Missing) > 0 || len(r.Blocked) > 0 || len(r.Policy) > 0 || (r.exactExts && len(r.Extra) > 0)
+}
+
+// violations lists the compliance findings of the report
+func (r *driftReport) violations() []violation {
+	res := []violation{}
+	for _, k := range r.Policy {
+		res = append(res, violation{Type: "policy", Key: k.Key, Expected: k.Want, Actual: k.Have})
+	}
+	for _, id := range r.Blocked {
+		res = append(res, violation{Type: "blockedExtension", ID: id})
+	}
+	for _, m := range r.Missing {
+		v := violation{Type: "missingExtension", ID: m.ID}
+		if m.Want != "" {
+			v.Expected = m.Want
+		}
+		if m.Have != "" {
+			v.Actual = m.Have
+		}
+		res = append(res, v)
+	}
+	return res
+}
+
+func runVerify(args []string) (err error) {
+	fs, opts := newCommandFlags("verify")
+	exact := fs.Bool("exact", false, "Treat installed extensions missing from the list as drift")
+	output := fs.String("output", "text", "Report format: text or json")
+	enforceExit := fs.Bool("enforce-exit", false, "Compliance mode: change nothing, print the violations as JSON, exit "+strconv.Itoa(exitNonCompliant)+" when there are any")
+	fs.Parse(args)
+	if *output != "text" && *output != "json" {
+		return fmt.Errorf("unknown --output %q (want text or json)", *output)
+	}
+	if *output == "json" || *enforceExit {
+		// stdout carries the JSON document only; progress still goes to the log file
+		pterm.DisableOutput()
+		defer func() {
+			var exit exitCodeError
+			if err != nil && !errors.As(err, &exit) {
+				fmt.Fprintln(os.Stderr, "verify:", err)
+			}
+		}()
+	}
+
+	inst, err := openInstaller(opts)
+	if err != nil {
+		return err
+	}
+	defer inst.Close()
+
+	// locked settings are restored right away, the violation still counts;
+	// compliance scans only look
+	var policy []keyDrift
+	if *enforceExit {
+		policy, err = inst.policyViolations()
+	} else {
+		policy, err = inst.enforcePolicy("verify")
+	}
+	if err != nil {
+		return err
+	}
+	rep, err := inst.verify()
+	if err != nil {
+		return err
+	}
+	if policy != nil {
+		rep.Policy = policy
+	}
+	// reported values never carry resolved secrets, in text or JSON
+	for f := range rep.Files {
+		inst.redactDrift(rep.Files[f].Keys)
+	}
+	inst.redactDrift(rep.Policy)
+	rep.exactExts = *exact
+	rep.Drift = rep.drifted()
+	if *enforceExit {
+		doc := complianceReport{Violations: rep.violations()}
+		doc.Compliant = len(doc.Violations) == 0
+		b, err := json.MarshalIndent(doc, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+		for _, v := range doc.Violations {
+			inst.logToFile("COMPLIANCE %s %s%s", v.Type, v.Key, v.ID)
+		}
+		if !doc.Compliant {
+			return exitCodeError{exitNonCompliant}
+		}
+		return nil
+	}
+	if *output == "json" {
+		b, err := json.MarshalIndent(rep, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+	} else {
+		inst.printDrift(rep)
+	}
+	if rep.Drift {
+		return errors.New("drift detected")
+	}
+	return nil
+}
+
+// verify compares the live config with the payload
+func (i *Installer) verify() (*driftReport, error) {
+	// empty lists, not null, in the JSON report
+	rep := &driftReport{Files: []fileDrift{}, Missing: []extDrift{}, Blocked: []string{}, Extra: []string{}, Policy: []keyDrift{}}
+	if len(i.settingsData) > 0 {
+		rep.Files = append(rep.Files, verifyFile(settingsFile, filepath.Join(i.vscodeUser, settingsFile), i.expectedSettings()))
+	}
+	if len(i.keybindData) > 0 {
+		rep.Files = append(rep.Files, verifyFile(keybindingsFile, filepath.Join(i.vscodeUser, keybindingsFile), i.expectedKeybindings()))
+	}
+
+	if err := i.ensureCodeCLI(); err != nil {
+		return nil, fmt.Errorf("code CLI not found: %w", err)
+	}
+	installed, err := i.installedExtensions()
+	if err != nil {
+		return nil, fmt.Errorf("cannot list installed extensions: %w", err)
+	}
+	for _, spec := range i.extList {
+		have := installedVersion(installed, spec.ID)
+		if have == "" || (spec.Version != "" && have != spec.Version) {
+			rep.Missing = append(rep.Missing, extDrift{ID: spec.ID, Want: spec.Version, Have: have})
+		}
+	}
+	for _, e := range installed {
+		switch {
+		case i.isBlocked(e.ID):
+			rep.Blocked = append(rep.Blocked, e.ID)
+		default:
+			if _, listed := findSpec(i.extList, e.ID); !listed {
+				rep.Extra = append(rep.Extra, e.ID)
+			}
+		}
+	}
+	return rep, nil
+}
+
+// verifyFile compares one live file with its payload. JSONC content is
+// compared semantically, so formatting and comments do not count as drift.
+func verifyFile(name, path string, want []byte) fileDrift {
+	d := fileDrift{Name: name, Path: path, Status: driftOK}
+	have, err := os.ReadFile(path)
+	if err != nil {
+		d.Status = driftMissing
+		return d
+	}
+	wv, werr := parseJSONC(want)
+	hv, herr := parseJSONC(have)
+	if werr != nil || herr != nil {
+		if string(want) != string(have) {
+			d.Status = driftChanged
+		}
+		return d
+	}
+	if reflect.DeepEqual(wv, hv) {
+		return d
+	}
+	d.Status = driftChanged
+	wm, wok := wv.(map[string]interface{})
+	hm, hok := hv.(map[string]interface{})
+	if wok && hok {
+		d.Keys = diffKeys(wm, hm)
+	}
+	return d
+}
+
+// diffKeys lists top-level keys whose values differ, sorted by key
+func diffKeys(want, have map[string]interface{}) []keyDrift {
+	var res []keyDrift
+	for k, w := range want {
+		if h, ok := have[k]; !ok || !reflect.DeepEqual(w, h) {
+			res = append(res, keyDrift{Key: k, Want: w, Have: h, Wanted: true, Present: ok})
+		}
+	}
+	for k, h := range have {
+		if _, ok := want[k]; !ok {
+			res = append(res, keyDrift{Key: k, Have: h, Present: true})
+		}
+	}
+	sort.Slice(res, func(a, b int) bool { return res[a].Key < res[b].Key })
+	return res
+}
+
+// redactDrift masks the resolved secrets in the values of keys
+func (i *Installer) redactDrift(keys []keyDrift) {
+	for k := range keys {
+		keys[k].Want = i.redactValue(keys[k].Want)
+		keys[k].Have = i.redactValue(keys[k].Have)
+	}
+}
+
+// printDrift renders the report for humans
+func (i *Installer) printDrift(r *driftReport) {
+	pterm.DefaultSection.Println("Files")
+	rows := [][]string{{"File", "Status", "Details"}}
+	for _, f := range r.Files {
+		var details []string
+		for _, k := range f.Keys {
+			switch {
+			case !k.Wanted:
+				details = append(details, "+"+k.Key)
+			case !k.Present:
+				details = append(details, "-"+k.Key)
+			default:
+				details = append(details, "~"+k.Key)
+			}
+		}
+		rows = append(rows, []string{f.Name, f.Status, truncate(strings.Join(details, " "), 80)})
+		i.logToFile("verify: %s %s %s", f.Name, f.Status, strings.Join(details, " "))
+	}
+	pterm.DefaultTable.WithHasHeader().WithData(rows).Render()
+
+	if len(r.Policy) > 0 {
+		pterm.DefaultSection.Println("Policy violations (restored)")
+		rows = [][]string{{"Key", "Mandated", "Found"}}
+		for _, k := range r.Policy {
+			found := "absent"
+			if k.Present {
+				found = fmt.Sprint(k.Have)
+			}
+			rows = append(rows, []string{k.Key, fmt.Sprint(k.Want), found})
+		}
+		pterm.DefaultTable.WithHasHeader().WithData(rows).Render()
+	}
+
+	pterm.DefaultSection.Println("Extensions")
+	rows = [][]string{{"Extension", "Drift", "Expected", "Installed"}}
+	for _, m := range r.Missing {
+		kind := "missing"
+		if m.Have != "" {
+			kind = "wrong version"
+		}
+		rows = append(rows, []string{m.ID, kind, orDash(m.Want), orDash(m.Have)})
+		i.logToFile("verify: extension %s %s (want %s, have %s)", m.ID, kind, orDash(m.Want), orDash(m.Have))
+	}
+	for _, id := range r.Blocked {
+		rows = append(rows, []string{id, "blocked but installed", "-", "yes"})
+		i.logToFile("verify: extension %s blocked but installed", id)
+	}
+	if r.exactExts {
+		for _, id := range r.Extra {
+			rows = append(rows, []string{id, "not in list", "-", "yes"})
+			i.logToFile("verify: extension %s not in list", id)
+		}
+	}
+	if len(rows) > 1 {
+		pterm.DefaultTable.WithHasHeader().WithData(rows).Render()
+	} else {
+		pterm.Success.Println("All listed extensions are installed.")
+	}
+	if !r.exactExts && len(r.Extra) > 0 {
+		pterm.Info.Printf("%d installed extensions are not in the list (use --exact to treat them as drift)\n", len(r.Extra))
+	}
+
+	if r.drifted() {
+		pterm.Warning.Println("Drift detected.")
+	} else {
+		pterm.Success.Println("Config matches the payload.")
+	}
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
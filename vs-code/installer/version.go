@@ -0,0 +1,169 @@
+// version.go
+//
+// `version` subcommand: what exactly is running on this machine — binary
+// version, build date and commit, Go version, where the payload comes from
+// (embedded, packed, preset or --src) and sha256 sums of every embedded
+// payload file and preset. Release builds set the version and date with
+//
+//   go build -ldflags "-X main.version=1.4.0 -X main.buildDate=2024-05-01" .
+//
+// otherwise the VCS stamp Go embeds in the binary is used.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/pterm/pterm"
+)
+
+// set at build time via -ldflags "-X main.version=... -X main.buildDate=..."
+var (
+	version   = "dev"
+	buildDate = ""
+)
+
+// versionInfo is the report of `version --output json`
+type versionInfo struct {
+	Version        string            `json:"version"`
+	BuildDate      string            `json:"buildDate,omitempty"`
+	Commit         string            `json:"commit,omitempty"`
+	GoVersion      string            `json:"goVersion"`
+	Platform       string            `json:"platform"`
+	PayloadSource  string            `json:"payloadSource"`
+	PayloadVersion string            `json:"payloadVersion,omitempty"`
+	PayloadHash    string            `json:"payloadHash,omitempty"`
+	Embedded       map[string]string `json:"embedded,omitempty"` // payload file -> sha256
+	Presets        map[string]string `json:"presets,omitempty"`  // preset -> sha256 of its files
+}
+
+func runVersion(args []string) (err error) {
+	fs, opts := newCommandFlags("version")
+	output := fs.String("output", "text", "Report format: text or json")
+	fs.Parse(args)
+	if *output != "text" && *output != "json" {
+		return fmt.Errorf("unknown --output %q (want text or json)", *output)
+	}
+	if *output == "json" {
+		pterm.DisableOutput()
+		defer func() {
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "version:", err)
+			}
+		}()
+	}
+
+	// the embedded files are hashed before --payload swaps a preset in
+	info := buildVersionInfo()
+
+	inst, err := openInstaller(opts)
+	if err != nil {
+		return err
+	}
+	defer inst.Close()
+	info.PayloadSource = inst.payloadSource()
+	info.PayloadVersion = inst.payloadVersion()
+	info.PayloadHash = inst.payloadHash()
+
+	if *output == "json" {
+		b, err := json.MarshalIndent(info, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+		return nil
+	}
+	rows := [][]string{
+		{"Version", info.Version},
+		{"Build date", orDash(info.BuildDate)},
+		{"Commit", orDash(info.Commit)},
+		{"Go", info.GoVersion},
+		{"Platform", info.Platform},
+		{"Payload source", info.PayloadSource},
+		{"Payload", payloadLabel(info.PayloadVersion, info.PayloadHash)},
+	}
+	if info.PayloadVersion != "" {
+		rows[len(rows)-1][1] += " (" + shortHash(info.PayloadHash) + ")"
+	}
+	for _, name := range sortedStringKeys(info.Embedded) {
+		rows = append(rows, []string{"Embedded " + name, info.Embedded[name]})
+	}
+	for _, name := range sortedStringKeys(info.Presets) {
+		rows = append(rows, []string{"Preset " + name, info.Presets[name]})
+	}
+	pterm.DefaultTable.WithData(rows).Render()
+	return nil
+}
+
+// buildVersionInfo collects the binary's build and embedded payload details
+func buildVersionInfo() versionInfo {
+	info := versionInfo{
+		Version:   version,
+		BuildDate: buildDate,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+		Embedded:  make(map[string]string),
+		Presets:   make(map[string]string),
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		dirty := false
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				info.Commit = s.Value
+			case "vcs.time":
+				if info.BuildDate == "" {
+					info.BuildDate = s.Value
+				}
+			case "vcs.modified":
+				dirty = s.Value == "true"
+			}
+		}
+		if dirty && info.Commit != "" {
+			info.Commit += "-dirty"
+		}
+		if info.Version == "dev" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+			info.Version = bi.Main.Version
+		}
+	}
+	for name, data := range packTargets() {
+		if len(*data) > 0 {
+			sum := sha256.Sum256(*data)
+			info.Embedded[name] = hex.EncodeToString(sum[:])
+		}
+	}
+	for name, data := range embeddedPayloadDirFiles() {
+		sum := sha256.Sum256(data)
+		info.Embedded[name] = hex.EncodeToString(sum[:])
+	}
+	for _, p := range embeddedPresets() {
+		h := sha256.New()
+		files := presetFiles(p)
+		for _, name := range sortedKeys(files) {
+			fmt.Fprintf(h, "%s:%d:", name, len(files[name]))
+			h.Write(files[name])
+		}
+		info.Presets[p] = hex.EncodeToString(h.Sum(nil))
+	}
+	return info
+}
+
+// payloadSource says where the payload of this run comes from
+func (i *Installer) payloadSource() string {
+	switch {
+	case !i.useEmbedded:
+		return "external (--src " + i.baseDir + ")"
+	case i.preset != "":
+		return "embedded preset " + i.preset
+	case appendedPayload:
+		return "packed (appended to the binary)"
+	default:
+		return "embedded"
+	}
+}
@@ -0,0 +1,147 @@
+// vsix.go
+//
+// Local .vsix payloads (--vsix-dir). Every *.vsix in the directory joins the
+// install set; its identity (publisher.name@version) is read from the
+// extension/package.json inside the archive. When a list entry has a matching
+// local package it is installed from the file instead of the network.
+
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const vsixManifestPath = "extension/package.json"
+
+// vsixPackage is a local .vsix file and the extension it contains
+type vsixPackage struct {
+	Path        string
+	ID          string
+	Version     string
+	DisplayName string
+	Description string
+}
+
+// readVSIXManifest extracts publisher.name and version from a .vsix archive
+func readVSIXManifest(path string) (vsixPackage, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return vsixPackage{}, err
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		if f.Name != vsixManifestPath {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return vsixPackage{}, err
+		}
+		defer rc.Close()
+		var pkg struct {
+			Publisher   string `json:"publisher"`
+			Name        string `json:"name"`
+			Version     string `json:"version"`
+			DisplayName string `json:"displayName"`
+			Description string `json:"description"`
+		}
+		if err := json.NewDecoder(io.LimitReader(rc, 4<<20)).Decode(&pkg); err != nil {
+			return vsixPackage{}, fmt.Errorf("bad %s: %w", vsixManifestPath, err)
+		}
+		if pkg.Publisher == "" || pkg.Name == "" {
+			return vsixPackage{}, fmt.Errorf("%s lacks publisher/name", vsixManifestPath)
+		}
+		return vsixPackage{
+			Path: path, ID: pkg.Publisher + "." + pkg.Name, Version: pkg.Version,
+			DisplayName: pkg.DisplayName, Description: pkg.Description,
+		}, nil
+	}
+	return vsixPackage{}, fmt.Errorf("no %s in archive", vsixManifestPath)
+}
+
+// scanVSIXDir reads all *.vsix in dir; unreadable files are reported and skipped.
+// When several files carry the same extension, the highest version wins.
+func (i *Installer) scanVSIXDir(dir string) (map[string]vsixPackage, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.vsix"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	res := make(map[string]vsixPackage)
+	for _, p := range paths {
+		pkg, err := readVSIXManifest(p)
+		if err != nil {
+			i.warnf("skipping %s: %v", filepath.Base(p), err)
+			continue
+		}
+		key := strings.ToLower(pkg.ID)
+		if prev, ok := res[key]; ok && compareVersions(prev.Version, pkg.Version) >= 0 {
+			continue
+		}
+		res[key] = pkg
+	}
+	return res, nil
+}
+
+// loadVSIXDir scans --vsix-dir and merges the local packages into the install set
+func (i *Installer) loadVSIXDir() error {
+	if i.vsixDir == "" {
+		return nil
+	}
+	pkgs, err := i.scanVSIXDir(i.vsixDir)
+	if err != nil {
+		return fmt.Errorf("cannot scan %s: %w", i.vsixDir, err)
+	}
+	i.vsix = pkgs
+	i.logf("Found %d local .vsix packages in %s", len(pkgs), i.vsixDir)
+
+	// list entries pinned to another version must not be satisfied by the local file
+	for _, spec := range i.extList {
+		pkg, ok := pkgs[strings.ToLower(spec.ID)]
+		if ok && spec.Version != "" && spec.Version != pkg.Version {
+			i.warnf("%s is pinned to %s but %s has %s — installing from registry", spec.ID, spec.Version, filepath.Base(pkg.Path), pkg.Version)
+			delete(i.vsix, strings.ToLower(spec.ID))
+		}
+	}
+	// local packages missing from the list join the install set
+	keys := make([]string, 0, len(pkgs))
+	for k := range pkgs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if _, listed := findSpec(i.extList, pkgs[k].ID); !listed {
+			i.extList = append(i.extList, extensionSpec{ID: pkgs[k].ID})
+		}
+	}
+	return nil
+}
+
+// installSource returns what to pass to --install-extension for spec:
+// a local .vsix path when available (downloading it first when a mirror is
+// configured), otherwise the (pinned) extension id
+func (i *Installer) installSource(spec extensionSpec) string {
+	key := strings.ToLower(spec.ID)
+	if pkg, ok := i.vsix[key]; ok {
+		return pkg.Path
+	}
+	if i.mirrorURL != "" && !i.dryRun {
+		pkg, err := i.downloadFromMirror(spec)
+		if err != nil {
+			i.warnf("%v — falling back to the editor's gallery", err)
+			return spec.String()
+		}
+		if i.vsix == nil {
+			i.vsix = make(map[string]vsixPackage)
+		}
+		i.vsix[key] = pkg
+		return pkg.Path
+	}
+	return spec.String()
+}
@@ -0,0 +1,264 @@
+// watch.go
+//
+// Watch mode (--watch): after the apply run the installer keeps running and
+// reconciles drift back to the payload. Changes to the user dir arrive as
+// file-change notifications (fsnotify: inotify, FSEvents/kqueue,
+// ReadDirectoryChangesW); the folder is watched rather than the files, as
+// editors save by renaming a temp file over them. A change is acted on once
+// the files stayed quiet for watchDebounce, so an editor saving several
+// times in a row triggers one reconcile, and only when their stat differs
+// from what the installer itself wrote. Where notifications are not
+// available (watch limit reached, network drives) the folder is polled
+// instead. Extensions are checked on the slower --watch-interval.
+//
+// Settings keys matching --allow-keys patterns ("editor.fontSize",
+// "workbench.*") may be changed freely: drift limited to them is left alone,
+// and their live values survive a reconcile of the other keys.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	watchPollInterval = 2 * time.Second
+	watchDebounce     = 3 * time.Second
+)
+
+// fileStamp is what a change is compared with: the file as last written or seen
+type fileStamp struct {
+	mod  time.Time
+	size int64
+	ok   bool
+}
+
+func stampOf(p string) fileStamp {
+	st, err := os.Stat(p)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{mod: st.ModTime(), size: st.Size(), ok: true}
+}
+
+// isAllowedKey reports whether a settings key may drift (--allow-keys or
+// protected)
+func (i *Installer) isAllowedKey(key string) bool {
+	if i.isMandatoryKey(key) {
+		return false
+	}
+	if i.isProtectedKey(key) {
+		return true
+	}
+	for _, p := range i.allowKeys {
+		if ok, _ := path.Match(p, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// watch runs until interrupted, reconciling drift back to the payload
+func (i *Installer) watch() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	files := []string{filepath.Join(i.vscodeUser, settingsFile), filepath.Join(i.vscodeUser, keybindingsFile)}
+	stamps := make(map[string]fileStamp)
+	snap := func() {
+		for _, p := range files {
+			stamps[p] = stampOf(p)
+		}
+	}
+	changed := func() bool {
+		res := false
+		for _, p := range files {
+			if st := stampOf(p); st != stamps[p] {
+				stamps[p] = st
+				res = true
+			}
+		}
+		return res
+	}
+	snap()
+
+	// file-change notifications, or a poll ticker when they are unavailable
+	var events <-chan fsnotify.Event
+	var watchErrs <-chan error
+	var poll <-chan time.Time
+	if w, err := fsnotify.NewWatcher(); err != nil {
+		i.warnf("File-change notifications unavailable (%v) — polling every %s", err, watchPollInterval)
+	} else if err := w.Add(i.vscodeUser); err != nil {
+		w.Close()
+		i.warnf("Cannot watch %s (%v) — polling every %s", i.vscodeUser, err, watchPollInterval)
+	} else {
+		defer w.Close()
+		events, watchErrs = w.Events, w.Errors
+	}
+	if events == nil {
+		t := time.NewTicker(watchPollInterval)
+		defer t.Stop()
+		poll = t.C
+	}
+
+	i.logf("Watching %s (extensions every %s, Ctrl+C to stop)", i.vscodeUser, i.watchInterval)
+	full := time.NewTicker(i.watchInterval)
+	defer full.Stop()
+	debounce := time.NewTimer(watchDebounce)
+	debounce.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			i.logf("Watch stopped")
+			return
+		case <-full.C:
+			i.reconcileFiles()
+			i.reconcileExtensions()
+			snap()
+		case ev := <-events:
+			if containsString(files, filepath.Clean(ev.Name)) {
+				debounce.Reset(watchDebounce)
+			}
+		case err := <-watchErrs:
+			i.warnf("watch: %v", err)
+		case <-poll:
+			if changed() {
+				debounce.Reset(watchDebounce)
+			}
+		case <-debounce.C:
+			// our own writes are not a change
+			if changed() || poll != nil {
+				i.reconcileFiles()
+				snap()
+			}
+		}
+	}
+}
+
+// reconcileFiles rewrites drifted payload files
+func (i *Installer) reconcileFiles() {
+	if _, err := i.enforcePolicy("watch"); err != nil {
+		i.errorf("watch: %v", err)
+	}
+	if len(i.settingsData) > 0 {
+		dst := filepath.Join(i.vscodeUser, settingsFile)
+		want := i.expectedSettings()
+		if d := verifyFile(settingsFile, dst, want); d.Status != driftOK {
+			i.reconcileSettings(d, want)
+		}
+	}
+	if len(i.keybindData) > 0 {
+		dst := filepath.Join(i.vscodeUser, keybindingsFile)
+		want := i.expectedKeybindings()
+		if d := verifyFile(keybindingsFile, dst, want); d.Status != driftOK {
+			i.reconcileWrite(dst, want, "keybindings.json "+d.Status)
+		}
+	}
+	if err := i.applyRemovedSettings(); err != nil {
+		i.errorf("watch: %v", err)
+	}
+	if err := i.applyMandatorySettings(); err != nil {
+		i.errorf("watch: %v", err)
+	}
+}
+
+// reconcileSettings restores settings.json, keeping live values of allowed keys
+func (i *Installer) reconcileSettings(d fileDrift, want []byte) {
+	var allowed, enforced []keyDrift
+	for _, k := range d.Keys {
+		if i.isAllowedKey(k.Key) {
+			allowed = append(allowed, k)
+		} else {
+			enforced = append(enforced, k)
+		}
+	}
+	if d.Status == driftChanged && len(d.Keys) > 0 && len(enforced) == 0 {
+		i.logToFile("watch: settings.json drift limited to allowed keys, left alone")
+		return
+	}
+	names := make([]string, 0, len(enforced))
+	for _, k := range enforced {
+		names = append(names, k.Key)
+	}
+	reason := "settings.json " + d.Status
+	if len(names) > 0 {
+		reason += ": " + strings.Join(names, ", ")
+	}
+	if len(allowed) == 0 {
+		i.reconcileWrite(d.Path, want, reason)
+		return
+	}
+	// allowed keys keep their live values; the file is re-rendered from the
+	// parsed payload, which drops the payload's comments
+	v, err := parseJSONC(want)
+	m, ok := v.(map[string]interface{})
+	if err != nil || !ok {
+		i.reconcileWrite(d.Path, want, reason)
+		return
+	}
+	for _, k := range allowed {
+		if !k.Present {
+			delete(m, k.Key)
+		} else {
+			m[k.Key] = k.Have
+		}
+	}
+	out, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		i.errorf("watch: cannot render settings.json: %v", err)
+		return
+	}
+	i.reconcileWrite(d.Path, append(out, '\n'), reason)
+}
+
+func (i *Installer) reconcileWrite(dst string, data []byte, reason string) {
+	if i.dryRun {
+		i.logf("DRY-RUN: would restore %s (%s)", dst, reason)
+		return
+	}
+	if err := i.safeWrite(dst, data); err != nil {
+		i.errorf("watch: cannot restore %s: %v", dst, err)
+		return
+	}
+	i.logf("Drift reconciled (%s)", reason)
+}
+
+// reconcileExtensions installs missing listed extensions and removes blocked ones
+func (i *Installer) reconcileExtensions() {
+	if i.codeCLIPath == "" {
+		if err := i.ensureCodeCLI(); err != nil {
+			i.warnf("watch: %v — extensions not checked", err)
+			return
+		}
+	}
+	if _, err := i.installedExtensions(); err != nil {
+		i.warnf("watch: cannot list installed extensions: %v", err)
+		return
+	}
+	for _, spec := range i.extList {
+		if i.installed.satisfies(spec) {
+			continue
+		}
+		have, _ := i.installed.lookup(spec.ID)
+		i.logf("watch: %s drifted (installed %s) — reinstalling", spec, orDash(have.Version))
+		if err := i.installOne(spec); err != nil {
+			i.errorf("%v", err)
+		}
+	}
+	if len(i.blocklist) > 0 {
+		if err := i.enforceBlocklist(); err != nil {
+			i.errorf("watch: blocklist enforcement failed: %v", err)
+		}
+	}
+}
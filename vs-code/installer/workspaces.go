@@ -0,0 +1,174 @@
+// workspaces.go
+//
+// `workspace [<name>...]` stamps out multi-root .code-workspace files from
+// the manifest's "workspaces" section (all of them without names):
+//
+//   "workspaces": {
+//     "backend": {
+//       "file": "~/work/backend.code-workspace",
+//       "folders": [{"path": "~/work/api", "name": "API"}, {"path": "~/work/shared"}],
+//       "settings": {"files.exclude": {"**/vendor": true}},
+//       "recommendations": true
+//     }
+//   }
+//
+// recommendations is a list of extension ids or true for the payload's
+// extension list. Folders inside the workspace file's directory are written
+// relative to it, others absolute; ~ is the home directory. An existing
+// file keeps everything but "folders", "settings" and "extensions" (launch,
+// tasks, comments).
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pterm/pterm"
+)
+
+// WorkspaceFile is one entry of the manifest's "workspaces"
+type WorkspaceFile struct {
+	File            string                     `json:"file"`
+	Folders         []WorkspaceFolder          `json:"folders"`
+	Settings        map[string]json.RawMessage `json:"settings,omitempty"`
+	Recommendations json.RawMessage            `json:"recommendations,omitempty"`
+}
+
+// WorkspaceFolder is a folder of a multi-root workspace
+type WorkspaceFolder struct {
+	Path string `json:"path"`
+	Name string `json:"name,omitempty"`
+}
+
+func runWorkspace(args []string) error {
+	fs, opts := newCommandFlags("workspace")
+	names := parseInterspersed(fs, args)
+
+	inst, err := openInstaller(opts)
+	if err != nil {
+		return err
+	}
+	defer inst.Close()
+	all := inst.manifest.Workspaces
+	if len(all) == 0 {
+		return fmt.Errorf("the manifest has no \"workspaces\"")
+	}
+	if len(names) == 0 {
+		for name := range all {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	for _, name := range names {
+		ws, ok := all[name]
+		if !ok {
+			return fmt.Errorf("unknown workspace %q", name)
+		}
+		if err := inst.writeWorkspace(name, ws); err != nil {
+			return fmt.Errorf("workspace %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// expandHome resolves a leading ~ to the home directory
+func (i *Installer) expandHome(p string) string {
+	if p == "~" || strings.HasPrefix(p, "~/") {
+		return filepath.Join(i.homeDir, p[1:])
+	}
+	return filepath.FromSlash(p)
+}
+
+// workspaceRecommendations decodes "recommendations": true or a list of ids
+func (i *Installer) workspaceRecommendations(raw json.RawMessage) ([]string, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	var all bool
+	if json.Unmarshal(raw, &all) == nil {
+		if !all {
+			return nil, nil
+		}
+		var ids []string
+		for _, e := range i.extList {
+			ids = append(ids, e.ID)
+		}
+		return ids, nil
+	}
+	var ids []string
+	if err := json.Unmarshal(raw, &ids); err != nil {
+		return nil, fmt.Errorf("recommendations: want true or a list of extension ids")
+	}
+	return ids, nil
+}
+
+// writeWorkspace writes (or updates) one .code-workspace file
+func (i *Installer) writeWorkspace(name string, ws WorkspaceFile) error {
+	if ws.File == "" || len(ws.Folders) == 0 {
+		return fmt.Errorf("needs a \"file\" and at least one folder")
+	}
+	dst := i.expandHome(ws.File)
+	if !strings.HasSuffix(dst, ".code-workspace") {
+		dst += ".code-workspace"
+	}
+	base := filepath.Dir(dst)
+
+	folders := make([]WorkspaceFolder, 0, len(ws.Folders))
+	for _, f := range ws.Folders {
+		p, err := filepath.Abs(i.expandHome(f.Path))
+		if err != nil {
+			return err
+		}
+		if !exists(p) {
+			i.warnf("workspace %s: folder %s does not exist (yet)", name, p)
+		}
+		if rel, err := filepath.Rel(base, p); err == nil && !strings.HasPrefix(rel, "..") {
+			p = rel
+		}
+		folders = append(folders, WorkspaceFolder{Path: filepath.ToSlash(p), Name: f.Name})
+	}
+	recs, err := i.workspaceRecommendations(ws.Recommendations)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(dst)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	err = nil
+	out := data
+	set := func(key string, v interface{}) {
+		if err == nil {
+			out, err = jsoncSet(out, key, encodeJSONValue(v, "  "))
+		}
+	}
+	set("folders", folders)
+	if len(ws.Settings) > 0 {
+		set("settings", ws.Settings)
+	}
+	if len(recs) > 0 {
+		set("extensions", map[string][]string{"recommendations": recs})
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", dst, err)
+	}
+	if string(out) == string(data) {
+		pterm.Success.Printf("%s is up to date\n", dst)
+		return nil
+	}
+	if i.dryRun {
+		i.logf("DRY-RUN: would write %s", dst)
+		return nil
+	}
+	if err := writeBytes(dst, out); err != nil {
+		return fmt.Errorf("cannot write %s: %w", dst, err)
+	}
+	i.logf("Workspace %s: %s (%d folders)", name, dst, len(folders))
+	return nil
+}
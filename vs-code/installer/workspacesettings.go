@@ -0,0 +1,111 @@
+// workspacesettings.go
+//
+// Workspace settings for one project (--workspace-settings <dir>). The
+// payload keeps the two scopes apart: the top-level settings.json is the
+// user's, workspace/settings.json (shared with --scan, see scan.go) holds
+// what belongs to a project. This mode merges only the latter into
+// <dir>/.vscode/settings.json: the payload's keys are set, the project's
+// other keys and comments are kept. Keys VS Code ignores in workspace
+// settings (application and machine scope: telemetry, updates, proxy, ...)
+// are reported and left out. The user-level apply does not run.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// userScopeKeys are settings only honoured in user settings
+var userScopeKeys = []string{
+	"telemetry.*", "update.*", "extensions.autoUpdate", "extensions.autoCheckUpdates",
+	"http.proxy*", "security.workspace.trust.*", "settingsSync.*",
+	"window.titleBarStyle", "window.menuBarVisibility", "window.restoreWindows",
+	"workbench.enableExperiments", "remote.SSH.*",
+}
+
+// isUserScopeKey reports whether key cannot be set per workspace
+func isUserScopeKey(key string) bool {
+	for _, p := range userScopeKeys {
+		if ok, _ := path.Match(p, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// workspaceSettingsPayload returns the payload's workspace/settings.json
+// without the user-scope keys, which are returned separately
+func (i *Installer) workspaceSettingsPayload() ([]byte, []string, error) {
+	payload, err := i.workspacePayload()
+	if err != nil {
+		return nil, nil, err
+	}
+	data, ok := payload[settingsFile]
+	if !ok {
+		return nil, nil, fmt.Errorf("the payload has no %s/%s", workspacePayloadDir, settingsFile)
+	}
+	members, _, _, err := jsoncMembers(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s/%s: %w", workspacePayloadDir, settingsFile, err)
+	}
+	var dropped []string
+	for _, m := range members {
+		if isUserScopeKey(m.Key) {
+			dropped = append(dropped, m.Key)
+		}
+	}
+	for _, k := range dropped {
+		if data, _, err = jsoncDelete(data, k); err != nil {
+			return nil, nil, err
+		}
+	}
+	return data, dropped, nil
+}
+
+// applyWorkspaceSettings merges the workspace-scope payload into the
+// project's .vscode/settings.json
+func (i *Installer) applyWorkspaceSettings(dir string) error {
+	payload, dropped, err := i.workspaceSettingsPayload()
+	if err != nil {
+		return err
+	}
+	if len(dropped) > 0 {
+		i.warnf("%s/%s: user-scope settings ignored in a workspace: %s", workspacePayloadDir, settingsFile, strings.Join(dropped, ", "))
+	}
+	dir = i.expandHome(dir)
+	if st, err := os.Stat(dir); err != nil || !st.IsDir() {
+		return fmt.Errorf("%s is not a folder", dir)
+	}
+	dst := filepath.Join(dir, ".vscode", settingsFile)
+	cur, err := os.ReadFile(dst)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	out, summary := payload, "new file"
+	if err == nil {
+		var keys []string
+		if out, keys, err = mergeWorkspaceSettings(cur, payload); err != nil {
+			return fmt.Errorf("%s: %w", dst, err)
+		}
+		if len(keys) == 0 {
+			i.logf("%s already up to date", dst)
+			i.report.UpToDate = append(i.report.UpToDate, dst)
+			return nil
+		}
+		summary = "set " + strings.Join(keys, ", ")
+	}
+	if i.dryRun {
+		i.logf("DRY-RUN: would write %s (%s)", dst, summary)
+		return nil
+	}
+	if err := i.safeWrite(dst, out); err != nil {
+		return fmt.Errorf("cannot write %s: %w", dst, err)
+	}
+	i.report.Written = append(i.report.Written, dst)
+	i.logf("Workspace settings %s: %s", dst, summary)
+	return nil
+}
@@ -0,0 +1,255 @@
+// yaml.go
+//
+// A small YAML reader for the files people write by hand (layer manifests).
+// It covers the block style subset: nested mappings and sequences by
+// indentation, "- key: value" items, plain / single / double quoted
+// scalars, null/true/false/numbers, flow collections that are valid JSON
+// ([a, b] of plain scalars too), comments and a leading "---". Anchors,
+// tags, multi-document streams and block scalars (| >) are not supported
+// and reported as errors. Values decode like parseJSONC: maps, []interface{},
+// float64, bool, string, nil. A file that is JSON is parsed as JSONC.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+type yamlLine struct {
+	n      int // 1-based line number
+	indent int
+	text   string // without indentation and comment
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+// parseYAML decodes a YAML document of the supported subset
+func parseYAML(data []byte) (interface{}, error) {
+	if t := strings.TrimSpace(string(data)); strings.HasPrefix(t, "{") || strings.HasPrefix(t, "[") {
+		return parseJSONC(data)
+	}
+	var lines []yamlLine
+	for n, raw := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		if strings.Contains(raw, "\t") && strings.TrimLeft(raw, " \t") != strings.TrimLeft(raw, " ") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed for indentation", n+1)
+		}
+		text := strings.TrimRight(stripYAMLComment(raw), " \t")
+		body := strings.TrimLeft(text, " ")
+		if body == "" || (body == "---" && len(lines) == 0) {
+			continue
+		}
+		lines = append(lines, yamlLine{n: n + 1, indent: len(text) - len(body), text: body})
+	}
+	if len(lines) == 0 {
+		return nil, nil
+	}
+	p := &yamlParser{lines: lines}
+	v, err := p.block(lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(lines) {
+		return nil, fmt.Errorf("line %d: unexpected indentation", lines[p.pos].n)
+	}
+	return v, nil
+}
+
+// stripYAMLComment cuts a # comment that is not inside quotes
+func stripYAMLComment(s string) string {
+	var quote byte
+	for k := 0; k < len(s); k++ {
+		c := s[k]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (k == 0 || s[k-1] == ' ' || s[k-1] == '\t'):
+			return s[:k]
+		}
+	}
+	return s
+}
+
+func isYAMLItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// block parses the mapping or sequence starting at the current line
+func (p *yamlParser) block(indent int) (interface{}, error) {
+	if isYAMLItem(p.lines[p.pos].text) {
+		return p.sequence(indent)
+	}
+	return p.mapping(indent)
+}
+
+func (p *yamlParser) sequence(indent int) (interface{}, error) {
+	res := []interface{}{}
+	for p.pos < len(p.lines) && p.lines[p.pos].indent == indent && isYAMLItem(p.lines[p.pos].text) {
+		l := p.lines[p.pos]
+		item := strings.TrimLeft(strings.TrimPrefix(l.text, "-"), " ")
+		switch {
+		case item == "":
+			p.pos++
+			var v interface{}
+			if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+				var err error
+				if v, err = p.block(p.lines[p.pos].indent); err != nil {
+					return nil, err
+				}
+			}
+			res = append(res, v)
+		case isYAMLItem(item) || yamlHasKey(item):
+			// "- key: value" (or "- - x"): a nested block starting on this line
+			// at the column of item
+			col := indent + len(l.text) - len(item)
+			p.lines[p.pos] = yamlLine{n: l.n, indent: col, text: item}
+			v, err := p.block(col)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, v)
+		default:
+			p.pos++
+			v, err := yamlScalarValue(item, l.n)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, v)
+		}
+	}
+	return res, nil
+}
+
+func (p *yamlParser) mapping(indent int) (interface{}, error) {
+	res := map[string]interface{}{}
+	for p.pos < len(p.lines) && p.lines[p.pos].indent == indent {
+		l := p.lines[p.pos]
+		if isYAMLItem(l.text) {
+			return nil, fmt.Errorf("line %d: expected key: value, found a list item", l.n)
+		}
+		key, rest, ok := yamlKeyValue(l.text)
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key: value", l.n)
+		}
+		p.pos++
+		var v interface{}
+		var err error
+		switch {
+		case rest != "":
+			if v, err = yamlScalarValue(rest, l.n); err != nil {
+				return nil, err
+			}
+			if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+				return nil, fmt.Errorf("line %d: unexpected indentation", p.lines[p.pos].n)
+			}
+		case p.pos < len(p.lines) && p.lines[p.pos].indent > indent:
+			v, err = p.block(p.lines[p.pos].indent)
+		case p.pos < len(p.lines) && p.lines[p.pos].indent == indent && isYAMLItem(p.lines[p.pos].text):
+			// "key:" followed by a list at the same indentation
+			v, err = p.sequence(indent)
+		}
+		if err != nil {
+			return nil, err
+		}
+		res[key] = v
+	}
+	return res, nil
+}
+
+// yamlHasKey reports whether text starts a "key: value" pair
+func yamlHasKey(text string) bool {
+	_, _, ok := yamlKeyValue(text)
+	return ok
+}
+
+// yamlKeyValue splits "key: value" (key plain or quoted)
+func yamlKeyValue(text string) (key, rest string, ok bool) {
+	if text[0] == '"' || text[0] == '\'' {
+		end := strings.IndexByte(text[1:], text[0])
+		if end < 0 {
+			return "", "", false
+		}
+		after := text[end+2:]
+		if after != ":" && !strings.HasPrefix(after, ": ") {
+			return "", "", false
+		}
+		k, err := yamlScalarValue(text[:end+2], 0)
+		s, isStr := k.(string)
+		return s, strings.TrimSpace(strings.TrimPrefix(after, ":")), err == nil && isStr
+	}
+	if strings.HasPrefix(text, "[") || strings.HasPrefix(text, "{") {
+		// "[python]: ..." is a key, "[a, b]" a flow list
+		if !strings.Contains(text, "]:") && !strings.Contains(text, "}:") {
+			return "", "", false
+		}
+	}
+	if k, r, found := strings.Cut(text, ": "); found {
+		return strings.TrimSpace(k), strings.TrimSpace(r), true
+	}
+	if strings.HasSuffix(text, ":") {
+		return strings.TrimSpace(strings.TrimSuffix(text, ":")), "", true
+	}
+	return "", "", false
+}
+
+// yamlScalarValue decodes an inline value
+func yamlScalarValue(s string, line int) (interface{}, error) {
+	switch {
+	case strings.HasPrefix(s, `"`):
+		v, err := strconv.Unquote(s)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: bad double-quoted string %s", line, s)
+		}
+		return v, nil
+	case strings.HasPrefix(s, "'"):
+		if len(s) < 2 || !strings.HasSuffix(s, "'") {
+			return nil, fmt.Errorf("line %d: unterminated single-quoted string", line)
+		}
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	case strings.HasPrefix(s, "[") || strings.HasPrefix(s, "{"):
+		if v, err := parseJSONC([]byte(s)); err == nil {
+			return v, nil
+		}
+		if strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") {
+			res := []interface{}{}
+			for _, part := range strings.Split(s[1:len(s)-1], ",") {
+				if part = strings.TrimSpace(part); part == "" {
+					continue
+				}
+				v, err := yamlScalarValue(part, line)
+				if err != nil {
+					return nil, err
+				}
+				res = append(res, v)
+			}
+			return res, nil
+		}
+		return nil, fmt.Errorf("line %d: flow mappings must be valid JSON", line)
+	case s == "|" || s == ">" || strings.HasPrefix(s, "|") || strings.HasPrefix(s, ">"),
+		strings.HasPrefix(s, "&"), strings.HasPrefix(s, "*"), strings.HasPrefix(s, "!"):
+		return nil, fmt.Errorf("line %d: %q: block scalars, anchors and tags are not supported", line, s)
+	}
+	switch s {
+	case "null", "~", "Null", "NULL":
+		return nil, nil
+	case "true", "True", "TRUE":
+		return true, nil
+	case "false", "False", "FALSE":
+		return false, nil
+	}
+	// inf and nan stay strings: JSON has no such numbers
+	if f, err := strconv.ParseFloat(s, 64); err == nil && !strings.ContainsAny(s, "xXpP_") &&
+		!math.IsInf(f, 0) && !math.IsNaN(f) {
+		return f, nil
+	}
+	return s, nil
+}